@@ -0,0 +1,923 @@
+// Package automation ties the screen, the matcher, the mouse and the keyboard together into a session,
+// for the common flow of finding an element on screen by its template, clicking it and typing into it.
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Carmen-Shannon/automation/device/display"
+	"github.com/Carmen-Shannon/automation/device/keyboard"
+	"github.com/Carmen-Shannon/automation/device/mouse"
+	"github.com/Carmen-Shannon/automation/tools/matcher"
+)
+
+// ErrTemplateNotFound is the error reported by Find when the template is not on any of the watched displays.
+var ErrTemplateNotFound = errors.New("the template was not found on any watched display")
+
+// ErrVerificationFailed is the error reported by WaitAndClick when the verification template did not disappear or appear after the last click.
+var ErrVerificationFailed = errors.New("the click could not be verified")
+
+// ErrSessionClosed is the error reported by the searches of a session once it has been closed.
+var ErrSessionClosed = errors.New("the session is closed")
+
+const (
+	// defaultWaitInterval is the time between the attempts of WaitAndClick, see IntervalOpt
+	defaultWaitInterval = 250 * time.Millisecond
+	// defaultVerifyTimeout is how long WaitAndClick waits for the verification of a click, see VerifyTimeoutOpt
+	defaultVerifyTimeout = time.Second
+	// defaultWatchInterval is how often WatchRegion, WaitForPixel and WaitForPixelChange capture the screen when no interval is given
+	defaultWatchInterval = 100 * time.Millisecond
+)
+
+// templateExtensions are the extensions tried, in order, for a template name given without one.
+var templateExtensions = []string{".bmp", ".png", ".jpg", ".jpeg"}
+
+// Match is a template found on screen by Session.Find.
+type Match struct {
+	Template string          // the name of the template, as given to Find
+	Display  display.Display // the display the template was found on
+	Bounds   image.Rectangle // the matched rectangle, in virtual screen coordinates
+}
+
+// Center returns the center of the match, the point Session.Click clicks.
+//
+// Returns:
+//   - int32: The x-coordinate of the center, in virtual screen coordinates.
+//   - int32: The y-coordinate of the center, in virtual screen coordinates.
+func (m Match) Center() (int32, int32) {
+	return int32(m.Bounds.Min.X + m.Bounds.Dx()/2), int32(m.Bounds.Min.Y + m.Bounds.Dy()/2)
+}
+
+// Attempt is a single search made by WaitAndClick, for the template to click or the template verifying the click.
+type Attempt struct {
+	Template string        // the name of the template searched for
+	Started  time.Time     // when the attempt started
+	Duration time.Duration // how long the capture and search took
+	Found    bool          // whether the template was found
+	Err      error         // the error of the attempt, nil if the template was found
+
+	// NearMiss is the window that came closest to matching on a failed attempt, in virtual screen coordinates, see matcher.NoMatchError.
+	NearMiss image.Rectangle
+	// NearMissConfidence is the confidence of the near miss.
+	NearMissConfidence float64
+}
+
+// WaitError is the error reported by WaitAndClick, carrying the history of every search it made, such as the near miss of each attempt.
+type WaitError struct {
+	Template string    // the name of the template to click
+	Attempts []Attempt // every search made, in order, including those of the verification
+	Err      error     // why WaitAndClick gave up, such as the error of the last attempt, the context's error or ErrVerificationFailed
+}
+
+func (e *WaitError) Error() string {
+	return fmt.Sprintf("failed to click %q after %d attempts: %v", e.Template, len(e.Attempts), e.Err)
+}
+
+func (e *WaitError) Unwrap() error {
+	return e.Err
+}
+
+// RegionChange is a change of a region watched by Session.WatchRegion, reported once the region settled.
+// The frames are shared with the watcher and the other changes it reports, so they must not be modified.
+type RegionChange struct {
+	Before  display.BMP       // the region as it was before the change, when it last settled
+	After   display.BMP       // the region once it settled after the change
+	Changed []image.Rectangle // the regions that changed between the frames, relative to the top-left corner of the watched region, see display.BMP.Diff
+	Err     error             // the capture error that stopped the watcher, in which case it is the last value sent and the frames are empty
+}
+
+// PixelWaitError is the error reported by WaitForPixel and WaitForPixelChange when the context is done before the pixel reached or left its color.
+type PixelWaitError struct {
+	X, Y   int32      // the pixel, in virtual screen coordinates
+	Target color.RGBA // the color WaitForPixel waited for, or the initial color WaitForPixelChange waited for the pixel to leave
+	Change bool       // whether the wait was for the pixel to leave the target color rather than reach it
+	Last   color.RGBA // the last color observed
+	Err    error      // the context's error
+}
+
+func (e *PixelWaitError) Error() string {
+	verb := "reach"
+	if e.Change {
+		verb = "change from"
+	}
+	return fmt.Sprintf("the pixel at %d, %d did not %s %s, last observed %s: %v", e.X, e.Y, verb, hexColor(e.Target), hexColor(e.Last), e.Err)
+}
+
+func (e *PixelWaitError) Unwrap() error {
+	return e.Err
+}
+
+// PixelSource reads the color of a pixel of the screen, see PixelSourceOpt.
+//
+// Parameters:
+//   - ctx: The context of the wait reading the pixel.
+//   - x: The x-coordinate of the pixel, in virtual screen coordinates.
+//   - y: The y-coordinate of the pixel, in virtual screen coordinates.
+//
+// Returns:
+//   - color.RGBA: The color of the pixel, opaque.
+//   - error: An error if the pixel can not be read, the context's error if it ended the read.
+type PixelSource func(ctx context.Context, x, y int32) (color.RGBA, error)
+
+// Session owns a virtual screen, a mouse and a matcher, and translates between the coordinates of the captures and those of the screen,
+// so finding a template and clicking it takes two calls. A session is safe for concurrent use, its searches are serialized.
+type Session struct {
+	screen display.VirtualScreen
+	mouse  mouse.Mouse
+
+	displays    []display.Display
+	bounds      [4]int32
+	templateDir string
+
+	moveOptions  []mouse.MouseMoveOption
+	clickOptions []mouse.MouseClickOption
+	findOptions  []matcher.FindBuilderOption
+	pixelSource  PixelSource // reads the pixels of WaitForPixel and WaitForPixelChange, nil to capture them
+
+	ownsScreen bool // whether the session created the screen rather than being given it with ScreenOpt, see Close
+	ownsMouse  bool // whether the session created the mouse rather than being given it with MouseOpt, see Close
+
+	mu        sync.Mutex
+	matcher   matcher.Matcher // reused by every search, created on the first one
+	templates map[string]*display.BMP
+	closed    bool
+}
+
+// New creates a new session, detecting the displays and the position of the mouse cursor unless they are given as options.
+//
+// Parameters:
+//   - options: Optional parameters for the session, such as the displays to watch, the template library and the movement options.
+//
+// Returns:
+//   - *Session: The new session.
+//   - error: An error if the primary display or the mouse position can not be detected, or the template directory does not exist.
+func New(options ...Option) (*Session, error) {
+	opts := &sessionOption{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if opts.TemplateDir != "" {
+		info, err := os.Stat(opts.TemplateDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the template directory: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("the template directory %q is not a directory", opts.TemplateDir)
+		}
+	}
+
+	screen := opts.Screen
+	if screen == nil {
+		screen = display.NewVirtualScreen()
+	}
+	displays := opts.Displays
+	if len(displays) == 0 {
+		pd, err := screen.GetPrimaryDisplay()
+		if err != nil {
+			return nil, err
+		}
+		displays = []display.Display{pd}
+	}
+
+	m := opts.Mouse
+	if m == nil {
+		var err error
+		if m, err = mouse.NewMouse(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Session{
+		screen:       screen,
+		mouse:        m,
+		ownsScreen:   opts.Screen == nil,
+		ownsMouse:    opts.Mouse == nil,
+		displays:     slices.Clone(displays),
+		bounds:       opts.Bounds,
+		templateDir:  opts.TemplateDir,
+		moveOptions:  opts.MoveOptions,
+		clickOptions: opts.ClickOptions,
+		findOptions:  opts.FindOptions,
+		pixelSource:  opts.PixelSource,
+		templates:    make(map[string]*display.BMP),
+	}, nil
+}
+
+// Close stops the worker pool of the session's matcher, and closes the virtual screen and the mouse if the session created them and they hold resources,
+// that is if they implement io.Closer. A screen or mouse given with ScreenOpt or MouseOpt belongs to the caller and is left open.
+// Once the session is closed its searches fail with ErrSessionClosed. It is safe to call Close any number of times.
+//
+// Returns:
+//   - error: The errors of closing the screen and the mouse joined with errors.Join, nil if there were none.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	if s.matcher != nil {
+		s.matcher.Close()
+		s.matcher = nil
+	}
+	var errs []error
+	if c, ok := s.screen.(io.Closer); ok && s.ownsScreen {
+		errs = append(errs, c.Close())
+	}
+	if c, ok := s.mouse.(io.Closer); ok && s.ownsMouse {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Find captures the watched displays in order and searches each of them for a template of the library, until it is found.
+// Templates are loaded from the library on first use and cached by the session.
+//
+// Parameters:
+//   - templateName: The name of the template, a path relative to the template directory, optionally without its extension.
+//
+// Returns:
+//   - Match: The match, on the first watched display the template was found on.
+//   - error: An error wrapping ErrTemplateNotFound and the *matcher.NoMatchError with the closest near miss, in virtual screen coordinates,
+//     if the template is not on any watched display, an error if the template can not be loaded or a capture fails.
+func (s *Session) Find(templateName string) (Match, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	template, err := s.loadTemplate(templateName)
+	if err != nil {
+		return Match{}, err
+	}
+	return s.search(templateName, *template, s.findOptions)
+}
+
+// Click moves the mouse to the center of a match with the movement options of the session, then clicks it with its click options.
+//
+// Parameters:
+//   - m: The match to click, as returned by Find.
+//
+// Returns:
+//   - error: An error if the mouse can not be moved or the click fails.
+func (s *Session) Click(m Match) error {
+	return s.click(m, s.moveOptions, s.clickOptions)
+}
+
+// ClickTemplate finds a template on the watched displays the same way Find does, then clicks the center of the match the same way Click does.
+// This is the whole capture, match and click flow in one call, for templates that are not part of the template library.
+//
+// Parameters:
+//   - template: The template to search for.
+//   - options: Optional parameters for this call, such as search, movement and click options applied on top of those of the session.
+//
+// Returns:
+//   - error: An error wrapping ErrTemplateNotFound and the *matcher.NoMatchError with the closest near miss, in virtual screen coordinates,
+//     if the template is not on any watched display, an error if a capture fails or the mouse can not be moved or clicked.
+func (s *Session) ClickTemplate(template display.BMP, options ...ClickTemplateOption) error {
+	opts := &clickTemplateOption{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	s.mu.Lock()
+	m, err := s.search("", template, append(slices.Clip(s.findOptions), opts.FindOptions...))
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.click(m, append(slices.Clip(s.moveOptions), opts.MoveOptions...), append(slices.Clip(s.clickOptions), opts.ClickOptions...))
+}
+
+// WaitAndClick waits for a template of the library to appear and clicks it, for elements that appear asynchronously.
+// The watched displays are captured and searched again every interval until the template is found, the attempts run out or the context is done.
+// With VerifyGoneOpt or VerifyShownOpt the click is verified, and when the verification fails the template is found and clicked again, a bounded number of times.
+//
+// Parameters:
+//   - ctx: The context that bounds how long to wait.
+//   - templateName: The name of the template to click, resolved in the template library like the names given to Find.
+//   - options: Optional parameters for the wait, such as the interval, the attempt limits and the verification.
+//
+// Returns:
+//   - error: A *WaitError with the history of every attempt if the template was not clicked or the click could not be verified,
+//     wrapping the context's error, ErrVerificationFailed, or the error of the last attempt.
+func (s *Session) WaitAndClick(ctx context.Context, templateName string, options ...WaitOption) error {
+	opts := &waitOption{MaxReclicks: 1}
+	for _, opt := range options {
+		opt(opts)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultWaitInterval
+	}
+	if opts.VerifyTimeout <= 0 {
+		opts.VerifyTimeout = defaultVerifyTimeout
+	}
+
+	werr := &WaitError{Template: templateName}
+	for clicks := 0; ; clicks++ {
+		m, err := s.waitFor(ctx, templateName, opts, werr)
+		if err != nil {
+			werr.Err = err
+			return werr
+		}
+		if err := s.Click(m); err != nil {
+			werr.Err = err
+			return werr
+		}
+		if opts.VerifyTemplate == "" {
+			return nil
+		}
+
+		verified, err := s.verify(ctx, opts, werr)
+		if err != nil {
+			werr.Err = err
+			return werr
+		}
+		if verified {
+			return nil
+		}
+		if clicks >= opts.MaxReclicks {
+			state := "still shown"
+			if !opts.VerifyGone {
+				state = "not shown"
+			}
+			werr.Err = fmt.Errorf("%w: %q is %s after the last click", ErrVerificationFailed, opts.VerifyTemplate, state)
+			return werr
+		}
+	}
+}
+
+// waitFor searches for a template every interval until it is found, the attempts run out or the context is done.
+// Only a template that is not found is searched for again, a template that can not be loaded or a capture that fails ends the wait.
+//
+// Parameters:
+//   - ctx: The context that bounds how long to wait.
+//   - templateName: The name of the template.
+//   - opts: The options of the wait.
+//   - werr: Receives the history of the attempts.
+//
+// Returns:
+//   - Match: The match of the template.
+//   - error: The context's error wrapped with the error of the last attempt, or the error of the last attempt.
+func (s *Session) waitFor(ctx context.Context, templateName string, opts *waitOption, werr *WaitError) (Match, error) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			if lastErr == nil {
+				return Match{}, ctx.Err()
+			}
+			return Match{}, fmt.Errorf("%w, last attempt: %w", ctx.Err(), lastErr)
+		case <-timer.C:
+		}
+
+		m, err := s.attempt(ctx, templateName, opts, werr)
+		if err == nil {
+			return m, nil
+		}
+		if !errors.Is(err, ErrTemplateNotFound) || (opts.MaxAttempts > 0 && attempt >= opts.MaxAttempts) {
+			return Match{}, err
+		}
+		lastErr = err
+		timer.Reset(opts.Interval)
+	}
+}
+
+// verify waits for the verification template to disappear or appear, checking it every interval until the verification timeout passed.
+//
+// Parameters:
+//   - ctx: The context that bounds how long to wait.
+//   - opts: The options of the wait, with the verification template.
+//   - werr: Receives the history of the attempts.
+//
+// Returns:
+//   - bool: True if the template disappeared or appeared as expected, false if the verification timeout passed first.
+//   - error: The context's error, or an error if the template can not be loaded or a capture fails.
+func (s *Session) verify(ctx context.Context, opts *waitOption, werr *WaitError) (bool, error) {
+	deadline := time.Now().Add(opts.VerifyTimeout)
+	for {
+		// give the click a moment to take effect before the first check
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(min(opts.Interval, max(time.Until(deadline), 0))):
+		}
+
+		_, err := s.attempt(ctx, opts.VerifyTemplate, opts, werr)
+		if err != nil && !errors.Is(err, ErrTemplateNotFound) {
+			return false, err
+		}
+		if found := err == nil; found != opts.VerifyGone {
+			return true, nil
+		}
+		if !time.Now().Before(deadline) {
+			return false, nil
+		}
+	}
+}
+
+// attempt makes a single search for a template of the library and records it in the history of the wait.
+//
+// Parameters:
+//   - ctx: The context of the wait, the search timeout is shortened to its deadline.
+//   - templateName: The name of the template.
+//   - opts: The options of the wait, with the timeout of each attempt.
+//   - werr: Receives the attempt.
+//
+// Returns:
+//   - Match: The match of the template.
+//   - error: An error wrapping ErrTemplateNotFound if the template was not found, an error if it can not be loaded or a capture fails.
+func (s *Session) attempt(ctx context.Context, templateName string, opts *waitOption, werr *WaitError) (Match, error) {
+	findOptions := slices.Clip(s.findOptions)
+	if timeout := opts.AttemptTimeout; timeout > 0 {
+		if deadline, ok := ctx.Deadline(); ok {
+			// the matcher falls back to its default timeout for a zero timeout, so an expired deadline still searches briefly
+			timeout = max(min(timeout, time.Until(deadline)), time.Millisecond)
+		}
+		findOptions = append(findOptions, matcher.TimeoutOpt(timeout))
+	}
+
+	started := time.Now()
+	s.mu.Lock()
+	template, err := s.loadTemplate(templateName)
+	var m Match
+	if err == nil {
+		m, err = s.search(templateName, *template, findOptions)
+	}
+	s.mu.Unlock()
+
+	attempt := Attempt{Template: templateName, Started: started, Duration: time.Since(started), Found: err == nil, Err: err}
+	var noMatch *matcher.NoMatchError
+	if errors.As(err, &noMatch) {
+		attempt.NearMiss, attempt.NearMissConfidence = noMatch.NearMiss, noMatch.NearMissConfidence
+	}
+	werr.Attempts = append(werr.Attempts, attempt)
+	return m, err
+}
+
+// WatchRegion watches a region of the screen for changes, such as a status text or a progress bar, capturing it every interval.
+// Changes are debounced, the region must stay the same for an interval before its change is reported, so an animation or rapid flicker
+// produces a single change once it settles, and flicker that settles back into the previous frame produces none.
+// The watcher stops and closes the channel once the context is done, or after sending the error of a failed capture.
+//
+// Parameters:
+//   - ctx: The context that stops the watcher.
+//   - region: The region to watch, in virtual screen coordinates, it must be within a single display.
+//   - interval: The time between captures, which is also how long the region must stay the same to settle, zero or less for 100ms.
+//   - tolerance: The largest difference of a color channel that is not a change, see display.BMP.Diff.
+//
+// Returns:
+//   - <-chan RegionChange: The channel the changes are sent on, it is not buffered, so a slow receiver delays the next capture.
+//   - error: An error if the region is empty or not within a single display, or the first capture of it fails.
+func (s *Session) WatchRegion(ctx context.Context, region image.Rectangle, interval time.Duration, tolerance uint8) (<-chan RegionChange, error) {
+	if region.Empty() {
+		return nil, fmt.Errorf("the region %v to watch is empty", region)
+	}
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	capture, err := s.regionCapture(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	settled, err := capture(nil)
+	if err != nil {
+		return nil, err
+	}
+	changes := make(chan RegionChange)
+	go s.watchRegion(ctx, capture, settled, interval, tolerance, changes)
+	return changes, nil
+}
+
+// WaitForPixel waits for a pixel of the screen to reach a color, such as a status indicator turning green, capturing it every interval,
+// or reading it from the pixel source set with PixelSourceOpt.
+//
+// Parameters:
+//   - ctx: The context that bounds how long to wait.
+//   - x: The x-coordinate of the pixel, in virtual screen coordinates.
+//   - y: The y-coordinate of the pixel, in virtual screen coordinates.
+//   - r, g, b: The color to wait for.
+//   - tolerance: The largest difference of a color channel from the color that still counts as reaching it.
+//   - interval: The time between captures, zero or less for 100ms.
+//
+// Returns:
+//   - error: A *PixelWaitError with the last observed color wrapping the context's error if the pixel did not reach the color in time,
+//     an error if the pixel is not on any display or a capture or the pixel source fails.
+func (s *Session) WaitForPixel(ctx context.Context, x, y int32, r, g, b uint8, tolerance uint8, interval time.Duration) error {
+	target := color.RGBA{R: r, G: g, B: b, A: 255}
+	werr := &PixelWaitError{X: x, Y: y, Target: target}
+	return s.waitForPixel(ctx, x, y, interval, werr, func(c color.RGBA) bool {
+		return colorWithin(c, target, tolerance)
+	})
+}
+
+// WaitForPixelChange waits for a pixel of the screen to change from the color it has when the wait starts, such as a button greying out once it is clicked,
+// capturing it every interval, or reading it from the pixel source set with PixelSourceOpt.
+//
+// Parameters:
+//   - ctx: The context that bounds how long to wait.
+//   - x: The x-coordinate of the pixel, in virtual screen coordinates.
+//   - y: The y-coordinate of the pixel, in virtual screen coordinates.
+//   - tolerance: The largest difference of a color channel from the initial color that is not a change, which ignores noise such as dithering.
+//   - interval: The time between captures, zero or less for 100ms.
+//
+// Returns:
+//   - error: A *PixelWaitError with the initial and the last observed color wrapping the context's error if the pixel did not change in time,
+//     an error if the pixel is not on any display or a capture or the pixel source fails.
+func (s *Session) WaitForPixelChange(ctx context.Context, x, y int32, tolerance uint8, interval time.Duration) error {
+	werr := &PixelWaitError{X: x, Y: y, Change: true}
+	observed := false
+	return s.waitForPixel(ctx, x, y, interval, werr, func(c color.RGBA) bool {
+		// the first capture is the color the pixel has to change from
+		if !observed {
+			werr.Target, observed = c, true
+			return false
+		}
+		return !colorWithin(c, werr.Target, tolerance)
+	})
+}
+
+// waitForPixel reads a pixel every interval until its color satisfies a condition or the context is done.
+// The pixel is read from the pixel source of the session, or captured into the same buffer every interval without one.
+//
+// Parameters:
+//   - ctx: The context that bounds how long to wait.
+//   - x: The x-coordinate of the pixel, in virtual screen coordinates.
+//   - y: The y-coordinate of the pixel, in virtual screen coordinates.
+//   - interval: The time between reads, zero or less for the default.
+//   - werr: The error reported if the context is done first, which receives the last observed color.
+//   - done: Reports whether a color ends the wait, it is called with the color of every read starting with the first, which is taken immediately.
+//
+// Returns:
+//   - error: werr wrapping the context's error if the context is done first, an error if a read fails.
+func (s *Session) waitForPixel(ctx context.Context, x, y int32, interval time.Duration, werr *PixelWaitError, done func(color.RGBA) bool) error {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	read := func() (color.RGBA, error) {
+		return s.pixelSource(ctx, x, y)
+	}
+	if s.pixelSource == nil {
+		captureRegion, err := s.regionCapture(ctx, image.Rect(int(x), int(y), int(x)+1, int(y)+1))
+		if err != nil {
+			return err
+		}
+		var frame *display.BMP
+		read = func() (color.RGBA, error) {
+			// only the pixel of the previous frame is kept, so its buffer is reused
+			next, err := captureRegion(frame)
+			if err != nil {
+				return color.RGBA{}, err
+			}
+			frame = next
+			r, g, b, err := frame.Pixel(0, 0)
+			if err != nil {
+				return color.RGBA{}, fmt.Errorf("failed to read the pixel at %d, %d: %w", x, y, err)
+			}
+			return color.RGBA{R: r, G: g, B: b, A: 255}, nil
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c, err := read()
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+				// the context ended the read, which is the timeout of the wait rather than a failure of the read
+				werr.Err = ctxErr
+				return werr
+			}
+			return err
+		}
+		werr.Last = c
+		if done(c) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			werr.Err = ctx.Err()
+			return werr
+		case <-ticker.C:
+		}
+	}
+}
+
+// regionCapture prepares the capture of a region of the screen within a single display.
+//
+// Parameters:
+//   - ctx: The context that cancels the captures.
+//   - region: The region, in virtual screen coordinates.
+//
+// Returns:
+//   - func(reuse *display.BMP) (*display.BMP, error): Captures the region, into the pixel buffer of reuse where the platform supports it, see display.ReuseBufferOpt.
+//   - error: An error if the region is not within a single display.
+func (s *Session) regionCapture(ctx context.Context, region image.Rectangle) (func(reuse *display.BMP) (*display.BMP, error), error) {
+	var captureOptions []display.DisplayCaptureOption
+	for _, d := range s.screen.GetDisplays() {
+		x, y := d.ToLocal(int32(region.Min.X), int32(region.Min.Y))
+		local := image.Rect(int(x), int(y), int(x)+region.Dx(), int(y)+region.Dy())
+		if local.In(image.Rect(0, 0, d.Width, d.Height)) {
+			captureOptions = []display.DisplayCaptureOption{
+				display.DisplaysOpt([]display.Display{d}),
+				display.BoundsOpt([4]int32{int32(local.Min.X), int32(local.Max.X), int32(local.Min.Y), int32(local.Max.Y)}),
+			}
+			break
+		}
+	}
+	if captureOptions == nil {
+		if region.Dx() == 1 && region.Dy() == 1 {
+			return nil, fmt.Errorf("the pixel at %d, %d is not on any display", region.Min.X, region.Min.Y)
+		}
+		return nil, fmt.Errorf("the region %v is not within a single display", region)
+	}
+
+	return func(reuse *display.BMP) (*display.BMP, error) {
+		bitmaps, err := s.screen.CaptureBmpCtx(ctx, append(slices.Clip(captureOptions), display.ReuseBufferOpt(reuse))...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to capture the region %v: %w", region, err)
+		}
+		if len(bitmaps) != 1 {
+			return nil, fmt.Errorf("expected 1 capture of the region %v, got %d", region, len(bitmaps))
+		}
+		return &bitmaps[0], nil
+	}, nil
+}
+
+// watchRegion captures a watched region every interval and reports its changes once it settled, until the context is done or a capture fails.
+// Only the frame the region last settled in and the previous frame are kept. Each capture reuses the buffer of the frame before the previous one,
+// unless that frame is the settled one, which may have been sent as part of a change, so a watched region that does not change is captured
+// into the same two buffers over and over rather than into a new one every interval.
+//
+// Parameters:
+//   - ctx: The context that stops the watcher.
+//   - capture: Captures the region, into the pixel buffer of the given frame where the platform supports it.
+//   - settled: The first frame of the region.
+//   - interval: The time between captures.
+//   - tolerance: The largest difference of a color channel that is not a change.
+//   - changes: The channel the changes are sent on, closed once the watcher stops.
+func (s *Session) watchRegion(ctx context.Context, capture func(reuse *display.BMP) (*display.BMP, error), settled *display.BMP, interval time.Duration, tolerance uint8, changes chan<- RegionChange) {
+	defer close(changes)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	send := func(change RegionChange) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case changes <- change:
+			return true
+		}
+	}
+
+	last := settled
+	var spare *display.BMP // a frame the watcher no longer holds, whose buffer the next capture reuses
+	changing := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		frame, err := capture(spare)
+		if err == nil && (frame.Width != last.Width || frame.Height != last.Height) {
+			// the display was resized or rotated, the region is no longer the one being watched
+			err = fmt.Errorf("the watched region changed size from %dx%d to %dx%d", last.Width, last.Height, frame.Width, frame.Height)
+		}
+		var moved []image.Rectangle
+		if err == nil {
+			moved, err = last.Diff(frame, tolerance)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				send(RegionChange{Err: err})
+			}
+			return
+		}
+		// the settled frame is still held, and was possibly sent as the frame after a change, so only a frame that never settled is reused
+		spare = nil
+		if last != settled {
+			spare = last
+		}
+		last = frame
+
+		// keep waiting while the region is still changing, a change is reported once the region stayed the same for an interval
+		if len(moved) > 0 {
+			changing = true
+			continue
+		}
+		if !changing {
+			continue
+		}
+		changing = false
+
+		changed, err := settled.Diff(frame, tolerance)
+		if err != nil {
+			send(RegionChange{Err: err})
+			return
+		}
+		if len(changed) == 0 {
+			continue
+		}
+		if !send(RegionChange{Before: *settled, After: *frame, Changed: changed}) {
+			return
+		}
+		settled = frame
+	}
+}
+
+// Type types text into the focused window, see keyboard.Type.
+//
+// Parameters:
+//   - text: The text to type.
+//
+// Returns:
+//   - error: An error if the text could not be typed.
+func (s *Session) Type(text string) error {
+	return keyboard.Type(text)
+}
+
+// search captures the watched displays in order and searches each of them for a template, until it is found. The caller must hold the lock.
+//
+// Parameters:
+//   - templateName: The name of the template reported in the match and errors, empty if it is not part of the library.
+//   - template: The template to search for.
+//   - findOptions: The options of the search.
+//
+// Returns:
+//   - Match: The match, on the first watched display the template was found on.
+//   - error: An error wrapping ErrTemplateNotFound and the closest near miss if the template is not on any watched display, an error if a capture fails,
+//     or ErrSessionClosed if the session is closed.
+func (s *Session) search(templateName string, template display.BMP, findOptions []matcher.FindBuilderOption) (Match, error) {
+	if s.closed {
+		return Match{}, ErrSessionClosed
+	}
+	var searchErrs []error
+	var closest *matcher.NoMatchError
+	for _, d := range s.displays {
+		captureOptions := []display.DisplayCaptureOption{display.DisplaysOpt([]display.Display{d})}
+		if s.bounds != [4]int32{} {
+			captureOptions = append(captureOptions, display.BoundsOpt(s.bounds))
+		}
+		bitmaps, err := s.screen.CaptureBmp(captureOptions...)
+		if err != nil {
+			return Match{}, fmt.Errorf("failed to capture the display at %d, %d: %w", d.X, d.Y, err)
+		}
+		if len(bitmaps) != 1 {
+			return Match{}, fmt.Errorf("expected 1 capture of the display at %d, %d, got %d", d.X, d.Y, len(bitmaps))
+		}
+
+		if s.matcher == nil {
+			s.matcher = matcher.NewMatcher(bitmaps[0])
+		} else {
+			s.matcher.SetScan(bitmaps[0])
+		}
+		rect, err := s.matcher.FindTemplateRect(template, findOptions...)
+		if err == nil {
+			return Match{Template: templateName, Display: d, Bounds: s.toScreen(d, rect)}, nil
+		}
+
+		var noMatch *matcher.NoMatchError
+		if !errors.As(err, &noMatch) {
+			searchErrs = append(searchErrs, fmt.Errorf("display at %d, %d: %w", d.X, d.Y, err))
+			continue
+		}
+		if closest == nil || noMatch.NearMissConfidence > closest.NearMissConfidence || (closest.NearMiss.Empty() && !noMatch.NearMiss.Empty()) {
+			// the near miss is reported in screen coordinates, like a match
+			closest = &matcher.NoMatchError{Timeout: noMatch.Timeout, NearMissConfidence: noMatch.NearMissConfidence}
+			if !noMatch.NearMiss.Empty() {
+				closest.NearMiss = s.toScreen(d, noMatch.NearMiss)
+			}
+		}
+	}
+
+	if templateName == "" {
+		templateName = fmt.Sprintf("%dx%d template", template.Width, template.Height)
+	}
+	if closest != nil {
+		searchErrs = append([]error{closest}, searchErrs...)
+	}
+	return Match{}, fmt.Errorf("%w: %q: %w", ErrTemplateNotFound, templateName, errors.Join(searchErrs...))
+}
+
+// click moves the mouse to the center of a match, then clicks it.
+//
+// Parameters:
+//   - m: The match to click.
+//   - moveOptions: The options of the movement, the display is always set to the one the match is on.
+//   - clickOptions: The options of the click.
+//
+// Returns:
+//   - error: An error if the mouse can not be moved or the click fails.
+func (s *Session) click(m Match, moveOptions []mouse.MouseMoveOption, clickOptions []mouse.MouseClickOption) error {
+	name := m.Template
+	if name == "" {
+		name = "the match"
+	}
+	x, y := m.Display.ToLocal(m.Center())
+	if err := s.mouse.Move(x, y, append(slices.Clip(moveOptions), mouse.DisplayOpt(&m.Display))...); err != nil {
+		return fmt.Errorf("failed to move to %s: %w", name, err)
+	}
+	if err := s.mouse.Click(clickOptions...); err != nil {
+		return fmt.Errorf("failed to click %s: %w", name, err)
+	}
+	return nil
+}
+
+// toScreen translates a rectangle of the capture of a display to virtual screen coordinates,
+// accounting for the bounds of the capture within the display and the origin of the display.
+//
+// Parameters:
+//   - d: The display the capture was taken from.
+//   - rect: The rectangle, relative to the top-left corner of the capture.
+//
+// Returns:
+//   - image.Rectangle: The rectangle in virtual screen coordinates.
+func (s *Session) toScreen(d display.Display, rect image.Rectangle) image.Rectangle {
+	// an unbounded capture starts at the top-left corner of the display, a bounded one at its left and top bounds
+	x, y := d.ToGlobal(s.bounds[0], s.bounds[2])
+	return rect.Add(image.Pt(int(x), int(y)))
+}
+
+// loadTemplate returns a template of the library, loading it on first use. The caller must hold the lock.
+//
+// Parameters:
+//   - name: The name of the template, a path relative to the template directory, optionally without its extension.
+//
+// Returns:
+//   - *display.BMP: The template.
+//   - error: An error if no file holds the template, or it can not be decoded.
+func (s *Session) loadTemplate(name string) (*display.BMP, error) {
+	if template, ok := s.templates[name]; ok {
+		return template, nil
+	}
+
+	path := filepath.Join(s.templateDir, name)
+	candidates := []string{path}
+	if filepath.Ext(name) == "" {
+		candidates = candidates[:0]
+		for _, ext := range templateExtensions {
+			candidates = append(candidates, path+ext)
+		}
+	}
+
+	for _, candidate := range candidates {
+		data, err := os.ReadFile(candidate)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the template %q: %w", name, err)
+		}
+		template, err := display.LoadImage(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the template %q: %w", name, err)
+		}
+		s.templates[name] = template
+		return template, nil
+	}
+	return nil, fmt.Errorf("the template %q was not found in %q: %w", name, s.templateDir, os.ErrNotExist)
+}
+
+// colorWithin reports whether every color channel of two colors differs by at most a tolerance.
+//
+// Parameters:
+//   - a: The first color.
+//   - b: The second color.
+//   - tolerance: The largest difference of a color channel.
+//
+// Returns:
+//   - bool: True if the colors are within the tolerance of each other, false otherwise.
+func colorWithin(a, b color.RGBA, tolerance uint8) bool {
+	within := func(x, y uint8) bool {
+		return max(x, y)-min(x, y) <= tolerance
+	}
+	return within(a.R, b.R) && within(a.G, b.G) && within(a.B, b.B)
+}
+
+// hexColor formats the color channels of a color as a hex triplet, such as #00ff00.
+//
+// Parameters:
+//   - c: The color.
+//
+// Returns:
+//   - string: The hex triplet.
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
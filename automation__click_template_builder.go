@@ -0,0 +1,47 @@
+package automation
+
+import (
+	"slices"
+
+	"github.com/Carmen-Shannon/automation/device/mouse"
+	"github.com/Carmen-Shannon/automation/tools/matcher"
+)
+
+type clickTemplateOption struct {
+	FindOptions  []matcher.FindBuilderOption
+	MoveOptions  []mouse.MouseMoveOption
+	ClickOptions []mouse.MouseClickOption
+}
+
+// ClickTemplateOption is the builder option function for the ClickTemplate method of a Session.
+type ClickTemplateOption func(*clickTemplateOption)
+
+// TemplateFindOpt adds search options for a single ClickTemplate call, applied after the search options of the session so they take precedence.
+//
+// Parameters:
+//   - options: The search options, such as matcher.ConfidenceOpt.
+func TemplateFindOpt(options ...matcher.FindBuilderOption) ClickTemplateOption {
+	return func(opts *clickTemplateOption) {
+		opts.FindOptions = append(slices.Clip(opts.FindOptions), options...)
+	}
+}
+
+// TemplateMoveOpt adds movement options for a single ClickTemplate call, applied after the movement options of the session so they take precedence.
+//
+// Parameters:
+//   - options: The movement options, such as mouse.ProfileOpt.
+func TemplateMoveOpt(options ...mouse.MouseMoveOption) ClickTemplateOption {
+	return func(opts *clickTemplateOption) {
+		opts.MoveOptions = append(slices.Clip(opts.MoveOptions), options...)
+	}
+}
+
+// TemplateClickOpt adds click options for a single ClickTemplate call, applied after the click options of the session so they take precedence.
+//
+// Parameters:
+//   - options: The click options, such as mouse.RightClickOpt.
+func TemplateClickOpt(options ...mouse.MouseClickOption) ClickTemplateOption {
+	return func(opts *clickTemplateOption) {
+		opts.ClickOptions = append(slices.Clip(opts.ClickOptions), options...)
+	}
+}
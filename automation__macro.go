@@ -0,0 +1,435 @@
+package automation
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/Carmen-Shannon/automation/device/display"
+	"github.com/Carmen-Shannon/automation/device/keyboard"
+	"github.com/Carmen-Shannon/automation/device/keyboard/key_codes"
+	"github.com/Carmen-Shannon/automation/device/mouse"
+)
+
+const (
+	// recordPollInterval is how often Record polls the cursor, the mouse buttons, the wheel and the recorded keys
+	recordPollInterval = 10 * time.Millisecond
+	// defaultMoveInterval is the shortest time between two moves recorded by Record, see MoveIntervalOpt
+	defaultMoveInterval = 50 * time.Millisecond
+)
+
+// MacroEventKind is the kind of a recorded event.
+type MacroEventKind string
+
+const (
+	MoveEvent  MacroEventKind = "move"  // the cursor moved to X, Y
+	ClickEvent MacroEventKind = "click" // Button was pressed at X, Y and released after Duration
+	KeyEvent   MacroEventKind = "key"   // Keys were pressed in order and released after Duration
+	WheelEvent MacroEventKind = "wheel" // the wheel was rotated by Delta with the cursor at X, Y
+)
+
+// MacroEvent is a single input event of a Macro.
+type MacroEvent struct {
+	Kind     MacroEventKind      `json:"kind"`
+	Offset   time.Duration       `json:"offset"`             // when the event happened, since the start of the recording
+	X        int32               `json:"x,omitempty"`        // the x-coordinate of a move, click or wheel event, in virtual screen coordinates
+	Y        int32               `json:"y,omitempty"`        // the y-coordinate of a move, click or wheel event, in virtual screen coordinates
+	Button   int                 `json:"button,omitempty"`   // the button of a click, 1 for left, 2 for middle, 3 for right
+	Keys     []key_codes.KeyCode `json:"keys,omitempty"`     // the keys of a key event, any held modifiers first
+	Duration time.Duration       `json:"duration,omitempty"` // how long the button or keys were held
+	Delta    int32               `json:"delta,omitempty"`    // the rotation of a wheel event, in multiples of mouse.WheelDelta per notch, positive away from the user
+}
+
+// Macro is a recording of mouse and keyboard input made by Record, which a Session replays.
+// Key codes are those of the platform the macro was recorded on, so a macro with key events only replays on the same platform.
+type Macro struct {
+	Displays []display.Display `json:"displays"` // the display layout at the time of the recording, used to translate the coordinates on replay
+	Events   []MacroEvent      `json:"events"`   // the events, ordered by their offset
+}
+
+// Save writes the macro to a file as JSON.
+//
+// Parameters:
+//   - path: The path of the file, which is created or truncated.
+//
+// Returns:
+//   - error: An error if the file can not be written.
+func (m *Macro) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the macro: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to save the macro: %w", err)
+	}
+	return nil
+}
+
+// Load reads a macro written by Save into m, replacing its displays and events.
+//
+// Parameters:
+//   - path: The path of the file.
+//
+// Returns:
+//   - error: An error if the file can not be read or does not hold a macro.
+func (m *Macro) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to load the macro: %w", err)
+	}
+	var loaded Macro
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("failed to decode the macro %q: %w", path, err)
+	}
+	for i, event := range loaded.Events {
+		switch event.Kind {
+		case MoveEvent, ClickEvent, KeyEvent, WheelEvent:
+		default:
+			return fmt.Errorf("event %d of the macro %q has an unknown kind %q", i, path, event.Kind)
+		}
+	}
+	*m = loaded
+	return nil
+}
+
+// inputSource is where Record reads the state of the input devices from.
+type inputSource struct {
+	displays []display.Display
+	position func() (int32, int32, error)
+	button   func(button int) (bool, error)
+	key      func(code key_codes.KeyCode) (bool, error)
+	wheel    func() (int32, error) // returns the rotation of the wheel since the previous call, nil if the wheel is not recorded
+}
+
+// Record records the mouse and keyboard input of the user until the context is done, so a workflow demonstrated once by hand can be replayed with Session.Replay.
+// The cursor, the mouse buttons and the keys given with RecordKeysOpt are polled every 10ms. Moves of the cursor are downsampled, see MoveIntervalOpt,
+// a press and release of a mouse button is recorded as a click at the position it was pressed at, and a key pressed while other recorded keys are held
+// is recorded together with them, so a shortcut such as ctrl+s replays as one chord.
+// No key is recorded unless it is given with RecordKeysOpt, without it only the mouse is recorded.
+// The rotation of the mouse wheel between two polls is recorded as a single wheel event at the position of the cursor, on windows only,
+// since the wheel can not be watched on linux, see mouse.WatchWheel.
+// Movement while a button is held is replayed after the click, so drags are not reproduced, and presses still held when the recording ends are left out.
+//
+// Parameters:
+//   - ctx: The context that ends the recording.
+//   - options: Optional parameters for the recording, such as the keys to record.
+//
+// Returns:
+//   - *Macro: The recorded macro, with the display layout at the start of the recording.
+//   - error: An error if the cursor, a mouse button, the wheel or a key can not be polled.
+func Record(ctx context.Context, options ...RecordOption) (*Macro, error) {
+	opts := &recordOption{}
+	for _, opt := range options {
+		opt(opts)
+	}
+	m, err := mouse.NewMouse()
+	if err != nil {
+		return nil, err
+	}
+	wheel, err := watchWheel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return record(ctx, opts, inputSource{
+		displays: display.NewVirtualScreen().GetDisplays(),
+		position: mouse.CursorPosition,
+		button:   m.GetButtonState,
+		key:      keyboard.IsKeyPressed,
+		wheel:    wheel,
+	})
+}
+
+// watchWheel watches the mouse wheel until the context is done, adding up its rotations between two polls.
+//
+// Parameters:
+//   - ctx: The context that stops the watch.
+//
+// Returns:
+//   - func() (int32, error): Returns the rotation of the wheel since the previous call, nil if the wheel can not be watched on this platform.
+//   - error: An error if the wheel can be watched but the watch failed to start.
+func watchWheel(ctx context.Context) (func() (int32, error), error) {
+	deltas, err := mouse.WatchWheel(ctx)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch the mouse wheel: %w", err)
+	}
+	var rotated atomic.Int32
+	go func() {
+		for delta := range deltas {
+			rotated.Add(delta)
+		}
+	}()
+	return func() (int32, error) {
+		return rotated.Swap(0), nil
+	}, nil
+}
+
+// pendingPress is a mouse button or key that is held down while recording.
+type pendingPress struct {
+	event   MacroEvent
+	chorded bool // whether the key was recorded as part of a chord of a later key, so its own release is not recorded
+}
+
+// record polls the input devices until the context is done, see Record.
+//
+// Parameters:
+//   - ctx: The context that ends the recording.
+//   - opts: The options of the recording.
+//   - src: The input devices to poll.
+//
+// Returns:
+//   - *Macro: The recorded macro.
+//   - error: An error if an input device can not be polled.
+func record(ctx context.Context, opts *recordOption, src inputSource) (*Macro, error) {
+	moveInterval := opts.MoveInterval
+	if moveInterval <= 0 {
+		moveInterval = defaultMoveInterval
+	}
+	macro := &Macro{Displays: slices.Clone(src.displays)}
+	ticker := time.NewTicker(recordPollInterval)
+	defer ticker.Stop()
+
+	started := time.Now()
+	var lastX, lastY int32
+	lastMove := -moveInterval
+	moved := false
+	buttons := make(map[int]*pendingPress)
+	keys := make(map[key_codes.KeyCode]*pendingPress)
+	var held []key_codes.KeyCode // the recorded keys held down, in the order they were pressed
+	for {
+		offset := time.Since(started)
+		x, y, err := src.position()
+		if err != nil {
+			return nil, err
+		}
+		move := func() {
+			if moved && x == lastX && y == lastY {
+				return
+			}
+			macro.Events = append(macro.Events, MacroEvent{Kind: MoveEvent, Offset: offset, X: x, Y: y})
+			lastX, lastY, lastMove, moved = x, y, offset, true
+		}
+		if offset-lastMove >= moveInterval {
+			move()
+		}
+
+		for button := 1; button <= 3; button++ {
+			down, err := src.button(button)
+			if err != nil {
+				return nil, err
+			}
+			press, wasDown := buttons[button]
+			switch {
+			case down && !wasDown:
+				// the click is replayed where the cursor is, so it is moved there first
+				move()
+				buttons[button] = &pendingPress{event: MacroEvent{Kind: ClickEvent, Offset: offset, X: x, Y: y, Button: button}}
+			case !down && wasDown:
+				press.event.Duration = offset - press.event.Offset
+				macro.Events = append(macro.Events, press.event)
+				delete(buttons, button)
+			}
+		}
+
+		if src.wheel != nil {
+			delta, err := src.wheel()
+			if err != nil {
+				return nil, err
+			}
+			if delta != 0 {
+				// the wheel scrolls the window under the cursor, so the cursor is moved there first
+				move()
+				macro.Events = append(macro.Events, MacroEvent{Kind: WheelEvent, Offset: offset, X: x, Y: y, Delta: delta})
+			}
+		}
+
+		for _, code := range opts.Keys {
+			down, err := src.key(code)
+			if err != nil {
+				return nil, err
+			}
+			press, wasDown := keys[code]
+			switch {
+			case down && !wasDown:
+				for _, h := range held {
+					keys[h].chorded = true
+				}
+				held = append(held, code)
+				keys[code] = &pendingPress{event: MacroEvent{Kind: KeyEvent, Offset: offset, Keys: slices.Clone(held)}}
+			case !down && wasDown:
+				if !press.chorded {
+					press.event.Duration = offset - press.event.Offset
+					macro.Events = append(macro.Events, press.event)
+				}
+				held = slices.DeleteFunc(held, func(h key_codes.KeyCode) bool { return h == code })
+				delete(keys, code)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			// presses are recorded once released, so the events are ordered by when they started
+			slices.SortStableFunc(macro.Events, func(a, b MacroEvent) int {
+				return cmp.Compare(a.Offset, b.Offset)
+			})
+			return macro, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Replay replays a macro recorded by Record, with the movement, clicks and wheel rotations injected through the mouse of the session and the keys through the keyboard.
+// Every event is replayed at its offset divided by the speed, and the time buttons and keys are held is divided the same way.
+// When an event takes longer than the time until the next one, such as a long click, the following events are replayed as soon as possible.
+// The coordinates are translated from the display layout of the recording to the current one: a point is replayed on the display with the same bounds,
+// or else the primary display if it was recorded on the primary display, or else the display at the same position in the layout,
+// at the same position relative to the display, scaled to the size of the display.
+//
+// Parameters:
+//   - ctx: The context that stops the replay.
+//   - m: The macro to replay.
+//   - speed: The speed of the replay, 1 for the recorded speed, 2 for twice as fast.
+//
+// Returns:
+//   - error: An error if the speed is not positive, a point can not be translated to the current layout, an event can not be injected, or the context's error.
+func (s *Session) Replay(ctx context.Context, m *Macro, speed float64) error {
+	if speed <= 0 {
+		return fmt.Errorf("invalid replay speed: %v", speed)
+	}
+	scale := func(d time.Duration) time.Duration {
+		return time.Duration(float64(d) / speed)
+	}
+	current := s.screen.GetDisplays()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+	started := time.Now()
+	for i, event := range m.Events {
+		timer.Reset(max(time.Until(started.Add(scale(event.Offset))), 0))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		var err error
+		switch event.Kind {
+		case MoveEvent, ClickEvent, WheelEvent:
+			d, x, y, translateErr := translatePoint(m.Displays, current, event.X, event.Y)
+			if translateErr != nil {
+				return fmt.Errorf("failed to replay event %d: %w", i, translateErr)
+			}
+			err = s.mouse.Move(x, y, mouse.DisplayOpt(&d))
+			if err == nil && event.Kind == ClickEvent {
+				err = s.mouse.Click(buttonOpt(event.Button), mouse.DurationOpt(int(scale(event.Duration).Milliseconds())))
+			}
+			if err == nil && event.Kind == WheelEvent {
+				err = s.mouse.Scroll(event.Delta)
+			}
+		case KeyEvent:
+			err = keyboard.KeyPress(keyboard.KeyCodeOpt(event.Keys), keyboard.DurationOpt(int(scale(event.Duration).Milliseconds())))
+		default:
+			err = fmt.Errorf("unknown event kind %q", event.Kind)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to replay event %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// buttonOpt returns the click option of a mouse button.
+//
+// Parameters:
+//   - button: The button, 1 for left, 2 for middle, 3 for right.
+//
+// Returns:
+//   - mouse.MouseClickOption: The click option of the button, a left click for an unknown button.
+func buttonOpt(button int) mouse.MouseClickOption {
+	switch button {
+	case 2:
+		return mouse.MiddleClickOpt()
+	case 3:
+		return mouse.RightClickOpt()
+	default:
+		return mouse.LeftClickOpt()
+	}
+}
+
+// translatePoint translates a point recorded in one display layout to a display of the current layout and coordinates relative to it, see Replay.
+//
+// Parameters:
+//   - recorded: The display layout of the recording, none to use the point as is.
+//   - current: The current display layout.
+//   - x: The x-coordinate of the point, in the virtual screen coordinates of the recording.
+//   - y: The y-coordinate of the point, in the virtual screen coordinates of the recording.
+//
+// Returns:
+//   - display.Display: The current display to replay the point on.
+//   - int32: The x-coordinate of the point, relative to the display.
+//   - int32: The y-coordinate of the point, relative to the display.
+//   - error: An error if the point has no display to be replayed on.
+func translatePoint(recorded, current []display.Display, x, y int32) (display.Display, int32, int32, error) {
+	index := slices.IndexFunc(recorded, func(d display.Display) bool { return d.Contains(x, y) })
+	if index < 0 {
+		// without a recorded display, the point is only replayed where it is on the current layout
+		for _, d := range current {
+			if d.Contains(x, y) {
+				lx, ly := d.ToLocal(x, y)
+				return d, lx, ly, nil
+			}
+		}
+		return display.Display{}, 0, 0, fmt.Errorf("the point %d, %d is not on any display", x, y)
+	}
+
+	from := recorded[index]
+	to, ok := display.Display{}, false
+	for _, d := range current {
+		if d.X == from.X && d.Y == from.Y && d.Width == from.Width && d.Height == from.Height {
+			to, ok = d, true
+			break
+		}
+	}
+	if !ok && from.Primary {
+		to, ok = findPrimary(current)
+	}
+	if !ok && index < len(current) {
+		to, ok = current[index], true
+	}
+	if !ok {
+		return display.Display{}, 0, 0, errors.New("the display the point was recorded on has no counterpart in the current layout")
+	}
+
+	lx, ly := from.ToLocal(x, y)
+	if to.Width != from.Width || to.Height != from.Height {
+		lx = int32(int64(lx) * int64(to.Width) / int64(from.Width))
+		ly = int32(int64(ly) * int64(to.Height) / int64(from.Height))
+	}
+	return to, lx, ly, nil
+}
+
+// findPrimary finds the primary display of a layout.
+//
+// Parameters:
+//   - displays: The display layout.
+//
+// Returns:
+//   - display.Display: The primary display.
+//   - bool: True if the layout has a primary display, false otherwise.
+func findPrimary(displays []display.Display) (display.Display, bool) {
+	for _, d := range displays {
+		if d.Primary {
+			return d, true
+		}
+	}
+	return display.Display{}, false
+}
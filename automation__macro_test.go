@@ -0,0 +1,118 @@
+package automation
+
+import (
+	"context"
+	"image"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Carmen-Shannon/automation/device/keyboard/key_codes"
+)
+
+// inputStep is the state of the input devices at one poll of a scripted recording.
+type inputStep struct {
+	x, y  int32
+	left  bool  // whether the left button is held
+	wheel int32 // the rotation of the wheel since the previous poll
+}
+
+// scriptedInput is an input source that plays a script, one step per poll, and ends the recording once the script ran out.
+type scriptedInput struct {
+	mu     sync.Mutex
+	steps  []inputStep
+	poll   int
+	cancel context.CancelFunc
+}
+
+// step returns the step of the current poll, advancing to the next poll first when asked to, which the position does since it is polled first.
+func (s *scriptedInput) step(advance bool) inputStep {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if advance {
+		s.poll++
+		if s.poll >= len(s.steps) {
+			s.cancel()
+		}
+	}
+	return s.steps[min(s.poll, len(s.steps)-1)]
+}
+
+func (s *scriptedInput) source() inputSource {
+	s.poll = -1
+	return inputSource{
+		displays: twoDisplays,
+		position: func() (int32, int32, error) {
+			step := s.step(true)
+			return step.x, step.y, nil
+		},
+		button: func(button int) (bool, error) {
+			return button == 1 && s.step(false).left, nil
+		},
+		key: func(key_codes.KeyCode) (bool, error) {
+			return false, nil
+		},
+		wheel: func() (int32, error) {
+			return s.step(false).wheel, nil
+		},
+	}
+}
+
+func TestRecordAndReplayMouse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	input := &scriptedInput{cancel: cancel, steps: []inputStep{
+		{x: 10, y: 10},
+		{x: 50, y: 40, wheel: 120},
+		{x: 50, y: 40, left: true},
+		{x: 50, y: 40},
+		{x: 400, y: 100, wheel: -240},
+		{x: 400, y: 100},
+	}}
+
+	recorded, err := record(ctx, &recordOption{MoveInterval: time.Nanosecond}, input.source())
+	if err != nil {
+		t.Fatalf("record() error = %v", err)
+	}
+	var kinds []MacroEventKind
+	for _, e := range recorded.Events {
+		kinds = append(kinds, e.Kind)
+	}
+	if want := []MacroEventKind{MoveEvent, MoveEvent, WheelEvent, ClickEvent, MoveEvent, WheelEvent}; !slices.Equal(kinds, want) {
+		t.Fatalf("recorded events %v, want %v", kinds, want)
+	}
+	if wheel := recorded.Events[5]; wheel.X != 400 || wheel.Y != 100 || wheel.Delta != -240 {
+		t.Errorf("recorded wheel event %+v, want a rotation of -240 at 400, 100", wheel)
+	}
+
+	// the macro replays the same after a round trip through its file
+	path := filepath.Join(t.TempDir(), "macro.json")
+	if err := recorded.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	var m Macro
+	if err := m.Load(path); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	fm := &fakeMouse{}
+	s, err := New(ScreenOpt(&fakeScreen{displays: twoDisplays}), MouseOpt(fm), DisplaysOpt(twoDisplays))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer s.Close()
+	if err := s.Replay(context.Background(), &m, 1000); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+
+	// the moves are relative to the display of each point, 400, 100 is on the second display
+	wantMoves := []image.Point{{10, 10}, {50, 40}, {50, 40}, {50, 40}, {80, 100}, {80, 100}}
+	if !slices.Equal(fm.moves, wantMoves) {
+		t.Errorf("replayed moves %v, want %v", fm.moves, wantMoves)
+	}
+	if want := []int32{120, -240}; fm.clicks != 1 || !slices.Equal(fm.scrolls, want) {
+		t.Errorf("replayed %d clicks and scrolls %v, want 1 click and scrolls %v", fm.clicks, fm.scrolls, want)
+	}
+}
@@ -0,0 +1,125 @@
+package automation
+
+import (
+	"slices"
+
+	"github.com/Carmen-Shannon/automation/device/display"
+	"github.com/Carmen-Shannon/automation/device/mouse"
+	"github.com/Carmen-Shannon/automation/tools/matcher"
+)
+
+type sessionOption struct {
+	Displays    []display.Display // the displays searched by Find, in order, none for the primary display
+	Bounds      [4]int32          // left, right, top, bottom bounds of the capture on each display, relative to the display, zero for the whole display
+	TemplateDir string            // the directory template names are resolved in, empty for paths relative to the working directory
+
+	MoveOptions  []mouse.MouseMoveOption
+	ClickOptions []mouse.MouseClickOption
+	FindOptions  []matcher.FindBuilderOption
+
+	Screen      display.VirtualScreen // the virtual screen to capture from, nil for a new one
+	Mouse       mouse.Mouse           // the mouse to click with, nil for a new one
+	PixelSource PixelSource           // reads the pixels WaitForPixel and WaitForPixelChange wait on, nil to capture them from the screen
+}
+
+// Option is the builder option function for the New function of the automation package.
+type Option func(*sessionOption)
+
+// DisplaysOpt sets the displays the session watches, which are searched in the order given by Find.
+// If this option is not provided, only the primary display is watched.
+//
+// Parameters:
+//   - displays: The displays to watch.
+func DisplaysOpt(displays []display.Display) Option {
+	return func(opts *sessionOption) {
+		opts.Displays = displays
+	}
+}
+
+// BoundsOpt limits the capture of every watched display to a region of it, such as the area of an application,
+// which makes searches faster. Matches are still reported in virtual screen coordinates.
+//
+// Parameters:
+//   - bounds: The left, right, top and bottom bounds of the region, relative to the top-left corner of each display.
+func BoundsOpt(bounds [4]int32) Option {
+	return func(opts *sessionOption) {
+		opts.Bounds = bounds
+	}
+}
+
+// TemplateDirOpt sets the directory of the template library, which the template names given to Find are resolved in.
+// A name without an extension is looked up as a .bmp, .png, .jpg or .jpeg file, in that order.
+//
+// Parameters:
+//   - dir: The path of the directory holding the templates.
+func TemplateDirOpt(dir string) Option {
+	return func(opts *sessionOption) {
+		opts.TemplateDir = dir
+	}
+}
+
+// MoveOpt sets the movement options used by every Click of the session to move to the match, such as mouse.ProfileOpt for humanized movement.
+// It can be passed multiple times, the options are applied in the order given.
+//
+// Parameters:
+//   - options: The movement options, the display is always set to the one the match is on.
+func MoveOpt(options ...mouse.MouseMoveOption) Option {
+	return func(opts *sessionOption) {
+		opts.MoveOptions = append(slices.Clip(opts.MoveOptions), options...)
+	}
+}
+
+// ClickOpt sets the click options used by every Click of the session, such as mouse.DurationOpt for a humanized press.
+// It can be passed multiple times, the options are applied in the order given.
+//
+// Parameters:
+//   - options: The click options.
+func ClickOpt(options ...mouse.MouseClickOption) Option {
+	return func(opts *sessionOption) {
+		opts.ClickOptions = append(slices.Clip(opts.ClickOptions), options...)
+	}
+}
+
+// FindOpt sets the search options used by every Find of the session, such as matcher.ConfidenceOpt or matcher.TimeoutOpt.
+// It can be passed multiple times, the options are applied in the order given.
+//
+// Parameters:
+//   - options: The search options, CenterResultOpt has no effect since a match always reports its whole rectangle.
+func FindOpt(options ...matcher.FindBuilderOption) Option {
+	return func(opts *sessionOption) {
+		opts.FindOptions = append(slices.Clip(opts.FindOptions), options...)
+	}
+}
+
+// ScreenOpt makes the session capture from an existing virtual screen instead of creating its own,
+// such as one shared with other code or one standing in for the real screen.
+//
+// Parameters:
+//   - vs: The virtual screen to capture from.
+func ScreenOpt(vs display.VirtualScreen) Option {
+	return func(opts *sessionOption) {
+		opts.Screen = vs
+	}
+}
+
+// MouseOpt makes the session click with an existing mouse instead of creating its own,
+// so its cached position is shared with other code, or with one standing in for the real mouse.
+//
+// Parameters:
+//   - m: The mouse to click with.
+func MouseOpt(m mouse.Mouse) Option {
+	return func(opts *sessionOption) {
+		opts.Mouse = m
+	}
+}
+
+// PixelSourceOpt makes WaitForPixel and WaitForPixelChange read the pixel they wait on from a pixel source instead of capturing it,
+// such as a platform primitive reading a single pixel, which is far cheaper than a capture of the region around it, or one standing in for the real screen.
+//
+// Parameters:
+//   - source: Reads the color of a pixel, nil to capture the pixel from the screen.
+func PixelSourceOpt(source PixelSource) Option {
+	return func(opts *sessionOption) {
+		opts.PixelSource = source
+	}
+}
@@ -0,0 +1,39 @@
+package automation
+
+import (
+	"slices"
+	"time"
+
+	"github.com/Carmen-Shannon/automation/device/keyboard/key_codes"
+)
+
+type recordOption struct {
+	Keys         []key_codes.KeyCode // the keys whose presses are recorded, none to record only the mouse
+	MoveInterval time.Duration       // the shortest time between two recorded moves, zero for the default
+}
+
+// RecordOption is the builder option function for the Record function of the automation package.
+type RecordOption func(*recordOption)
+
+// RecordKeysOpt records the presses of the given keys, such as the letters and modifiers a workflow types.
+// The state of every key is polled, so only the listed keys are recorded, and without this option no key is recorded at all.
+// It can be passed multiple times, the keys are combined.
+//
+// Parameters:
+//   - codes: The key codes of the keys to record.
+func RecordKeysOpt(codes ...key_codes.KeyCode) RecordOption {
+	return func(opts *recordOption) {
+		opts.Keys = append(slices.Clip(opts.Keys), codes...)
+	}
+}
+
+// MoveIntervalOpt sets the shortest time between two moves of the cursor Record keeps, which downsamples the path of the cursor.
+// The position of the cursor is always recorded right before a click, so the click lands where it was recorded. The default is 50ms.
+//
+// Parameters:
+//   - interval: The shortest time between two recorded moves, values of zero or less keep the default.
+func MoveIntervalOpt(interval time.Duration) RecordOption {
+	return func(opts *recordOption) {
+		opts.MoveInterval = interval
+	}
+}
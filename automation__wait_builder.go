@@ -0,0 +1,94 @@
+package automation
+
+import "time"
+
+type waitOption struct {
+	Interval       time.Duration // how long to wait between attempts
+	MaxAttempts    int           // how many attempts are made before giving up, zero for no limit
+	AttemptTimeout time.Duration // the search timeout of each attempt, zero for the search timeout of the session
+
+	VerifyTemplate string        // the template checked after the click, empty for no verification
+	VerifyGone     bool          // whether the verification template must disappear after the click rather than appear
+	VerifyTimeout  time.Duration // how long the verification waits for the template to disappear or appear
+	MaxReclicks    int           // how many times the template is clicked again when the verification fails
+}
+
+// WaitOption is the builder option function for the WaitAndClick method of a Session.
+type WaitOption func(*waitOption)
+
+// IntervalOpt sets how long WaitAndClick waits between attempts to find the template, and between the checks of the verification.
+// The default is 250ms.
+//
+// Parameters:
+//   - interval: The time between attempts, values of zero or less keep the default.
+func IntervalOpt(interval time.Duration) WaitOption {
+	return func(opts *waitOption) {
+		opts.Interval = interval
+	}
+}
+
+// MaxAttemptsOpt limits how many times WaitAndClick searches for the template before giving up, regardless of its context.
+// By default the search is retried until the context is done.
+//
+// Parameters:
+//   - attempts: The maximum number of attempts, zero or less for no limit.
+func MaxAttemptsOpt(attempts int) WaitOption {
+	return func(opts *waitOption) {
+		opts.MaxAttempts = max(attempts, 0)
+	}
+}
+
+// AttemptTimeoutOpt sets the search timeout of each attempt of WaitAndClick, overriding the timeout of the session's search options.
+// The timeout is shortened to the deadline of the context when that comes first.
+//
+// Parameters:
+//   - timeout: The search timeout of each attempt.
+func AttemptTimeoutOpt(timeout time.Duration) WaitOption {
+	return func(opts *waitOption) {
+		opts.AttemptTimeout = timeout
+	}
+}
+
+// VerifyGoneOpt verifies a click of WaitAndClick by waiting for a template to disappear, such as a dialog that closes once its Save button is clicked.
+// If the template is still on screen once the verification timeout passed, the button is found and clicked again, up to the limit of MaxReclicksOpt.
+//
+// Parameters:
+//   - templateName: The name of the template that must disappear, resolved in the template library like the names given to Find.
+func VerifyGoneOpt(templateName string) WaitOption {
+	return func(opts *waitOption) {
+		opts.VerifyTemplate = templateName
+		opts.VerifyGone = true
+	}
+}
+
+// VerifyShownOpt verifies a click of WaitAndClick by waiting for a template to appear, such as the page a link leads to.
+// If the template is not on screen once the verification timeout passed, the button is found and clicked again, up to the limit of MaxReclicksOpt.
+//
+// Parameters:
+//   - templateName: The name of the template that must appear, resolved in the template library like the names given to Find.
+func VerifyShownOpt(templateName string) WaitOption {
+	return func(opts *waitOption) {
+		opts.VerifyTemplate = templateName
+		opts.VerifyGone = false
+	}
+}
+
+// VerifyTimeoutOpt sets how long the verification of a click waits for its template to disappear or appear, the default is 1s.
+//
+// Parameters:
+//   - timeout: How long the verification waits, values of zero or less keep the default.
+func VerifyTimeoutOpt(timeout time.Duration) WaitOption {
+	return func(opts *waitOption) {
+		opts.VerifyTimeout = timeout
+	}
+}
+
+// MaxReclicksOpt sets how many times WaitAndClick clicks the template again when the verification of a click fails, the default is 1.
+//
+// Parameters:
+//   - reclicks: The maximum number of additional clicks, zero to give up after the first failed verification.
+func MaxReclicksOpt(reclicks int) WaitOption {
+	return func(opts *waitOption) {
+		opts.MaxReclicks = max(reclicks, 0)
+	}
+}
@@ -0,0 +1,637 @@
+package automation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Carmen-Shannon/automation/device/display"
+	"github.com/Carmen-Shannon/automation/device/mouse"
+	"github.com/Carmen-Shannon/automation/tools/matcher"
+)
+
+// fakeScreen stands in for the real screen. Every capture returns the next frame of frames, repeating the last one once they run out,
+// since the capture options can not be inspected from outside the display package. Its other methods are not implemented.
+type fakeScreen struct {
+	display.VirtualScreen
+
+	displays []display.Display
+
+	mu       sync.Mutex
+	frames   []display.BMP
+	captures int
+	closed   bool
+}
+
+func (f *fakeScreen) GetDisplays() []display.Display {
+	return f.displays
+}
+
+func (f *fakeScreen) GetPrimaryDisplay() (display.Display, error) {
+	for _, d := range f.displays {
+		if d.Primary {
+			return d, nil
+		}
+	}
+	return display.Display{}, errors.New("no primary display")
+}
+
+func (f *fakeScreen) CaptureBmp(options ...display.DisplayCaptureOption) ([]display.BMP, error) {
+	return f.CaptureBmpCtx(context.Background(), options...)
+}
+
+func (f *fakeScreen) CaptureBmpCtx(ctx context.Context, _ ...display.DisplayCaptureOption) ([]display.BMP, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	frame := f.frames[min(f.captures, len(f.frames)-1)]
+	f.captures++
+	return []display.BMP{frame}, nil
+}
+
+func (f *fakeScreen) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+// fakeMouse stands in for the real mouse, recording its moves, clicks and scrolls. Its other methods are not implemented.
+type fakeMouse struct {
+	mouse.Mouse
+
+	mu      sync.Mutex
+	moves   []image.Point
+	clicks  int
+	scrolls []int32
+	closed  bool
+}
+
+func (f *fakeMouse) Move(x, y int32, _ ...mouse.MouseMoveOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.moves = append(f.moves, image.Pt(int(x), int(y)))
+	return nil
+}
+
+func (f *fakeMouse) Click(_ ...mouse.MouseClickOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.clicks++
+	return nil
+}
+
+func (f *fakeMouse) Scroll(delta int32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scrolls = append(f.scrolls, delta)
+	return nil
+}
+
+func (f *fakeMouse) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+// noiseBMP creates a BMP filled with pseudo-random noise, so a template cut out of it matches nowhere else.
+func noiseBMP(t *testing.T, width, height int, seed uint32) *display.BMP {
+	t.Helper()
+	bmp := display.NewBMP(width, height, 0, 0, 0)
+	for y := range height {
+		for x := range width {
+			seed = seed*1664525 + 1013904223
+			if err := bmp.SetPixel(x, y, uint8(seed>>24), uint8(seed>>16), uint8(seed>>8)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return bmp
+}
+
+// twoDisplays is a primary display with a second display to the right of it.
+var twoDisplays = []display.Display{
+	{X: 0, Y: 0, Width: 320, Height: 240, Primary: true},
+	{X: 320, Y: 0, Width: 320, Height: 240},
+}
+
+// newFakeSession creates a session watching both displays of twoDisplays, with the button template of the library on the second one at 100, 60.
+func newFakeSession(t *testing.T) (*Session, *fakeScreen, *fakeMouse) {
+	t.Helper()
+	button := noiseBMP(t, 24, 24, 7)
+	second := noiseBMP(t, 320, 240, 2)
+	if err := second.Paste(button, 100, 60); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "button.bmp"), button.ToBinary(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	screen := &fakeScreen{displays: twoDisplays, frames: []display.BMP{*noiseBMP(t, 320, 240, 1), *second}}
+	m := &fakeMouse{}
+	s, err := New(
+		ScreenOpt(screen),
+		MouseOpt(m),
+		DisplaysOpt(twoDisplays),
+		TemplateDirOpt(dir),
+		FindOpt(matcher.ConfidenceOpt(0.95)),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, screen, m
+}
+
+func TestFindAndClick(t *testing.T) {
+	s, screen, m := newFakeSession(t)
+
+	match, err := s.Find("button")
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if want := image.Rect(420, 60, 444, 84); match.Bounds != want || match.Display != twoDisplays[1] {
+		t.Fatalf("Find() = %v on %+v, want %v on the second display", match.Bounds, match.Display, want)
+	}
+	if screen.captures != 2 {
+		t.Errorf("%d captures were taken, want one of each display", screen.captures)
+	}
+
+	if err := s.Click(match); err != nil {
+		t.Fatalf("Click() error = %v", err)
+	}
+	// the mouse moves in coordinates relative to the display of the match
+	if want := []image.Point{image.Pt(112, 72)}; len(m.moves) != 1 || m.moves[0] != want[0] || m.clicks != 1 {
+		t.Errorf("the mouse moved to %v and clicked %d times, want a move to %v and 1 click", m.moves, m.clicks, want)
+	}
+}
+
+func TestFindWithinBounds(t *testing.T) {
+	// the capture of the second display is bounded to 40..280 by 30..200, so the button at 100, 60 on it is at 60, 30 in the capture
+	button := noiseBMP(t, 24, 24, 7)
+	bounded := noiseBMP(t, 240, 170, 2)
+	if err := bounded.Paste(button, 60, 30); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "button.bmp"), button.ToBinary(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	screen := &fakeScreen{displays: twoDisplays, frames: []display.BMP{*bounded}}
+	m := &fakeMouse{}
+	s, err := New(
+		ScreenOpt(screen),
+		MouseOpt(m),
+		DisplaysOpt(twoDisplays[1:]),
+		BoundsOpt([4]int32{40, 280, 30, 200}),
+		TemplateDirOpt(dir),
+		FindOpt(matcher.ConfidenceOpt(0.95)),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer s.Close()
+
+	match, err := s.Find("button")
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if want := image.Rect(420, 60, 444, 84); match.Bounds != want || match.Display != twoDisplays[1] {
+		t.Fatalf("Find() = %v on %+v, want %v on the second display", match.Bounds, match.Display, want)
+	}
+	if err := s.Click(match); err != nil {
+		t.Fatalf("Click() error = %v", err)
+	}
+	if want := image.Pt(112, 72); len(m.moves) != 1 || m.moves[0] != want {
+		t.Errorf("the mouse moved to %v, want a single move to %v on the second display", m.moves, want)
+	}
+}
+
+func TestFindNotFound(t *testing.T) {
+	s, _, _ := newFakeSession(t)
+	missing := noiseBMP(t, 24, 24, 99)
+
+	err := s.ClickTemplate(*missing)
+	var noMatch *matcher.NoMatchError
+	if !errors.Is(err, ErrTemplateNotFound) || !errors.As(err, &noMatch) {
+		t.Fatalf("ClickTemplate() error = %v, want ErrTemplateNotFound with the near miss", err)
+	}
+}
+
+func TestCloseLeavesGivenDevicesOpen(t *testing.T) {
+	s, screen, m := newFakeSession(t)
+	if _, err := s.Find("button"); err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("second Close() error = %v", err)
+	}
+	if screen.closed || m.closed {
+		t.Errorf("Close closed the screen (%v) or the mouse (%v) given with ScreenOpt and MouseOpt", screen.closed, m.closed)
+	}
+	if s.matcher != nil {
+		t.Error("Close did not release the matcher")
+	}
+	if _, err := s.Find("button"); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("Find() after Close error = %v, want %v", err, ErrSessionClosed)
+	}
+}
+
+func TestCloseClosesOwnedDevices(t *testing.T) {
+	s, screen, m := newFakeSession(t)
+	// stand in for a session that created its own screen and mouse
+	s.ownsScreen, s.ownsMouse = true, true
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if !screen.closed || !m.closed {
+		t.Errorf("Close left the screen (closed %v) or the mouse (closed %v) the session created open", screen.closed, m.closed)
+	}
+}
+
+// paintedBMP creates a gray BMP with the given rectangles painted white.
+func paintedBMP(t *testing.T, width, height int, rects ...image.Rectangle) display.BMP {
+	t.Helper()
+	bmp := display.NewBMP(width, height, 128, 128, 128)
+	for _, r := range rects {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if err := bmp.SetPixel(x, y, 255, 255, 255); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	return *bmp
+}
+
+func TestWatchRegionDebounce(t *testing.T) {
+	const w, h = 40, 30
+	settled := paintedBMP(t, w, h)
+	noise := paintedBMP(t, w, h)
+	if err := noise.SetPixel(3, 3, 130, 128, 126); err != nil {
+		t.Fatal(err)
+	}
+	flicker := paintedBMP(t, w, h, image.Rect(0, 0, 8, 8))
+	animating := paintedBMP(t, w, h, image.Rect(10, 8, 13, 10))
+	done := paintedBMP(t, w, h, image.Rect(10, 8, 15, 12))
+
+	screen := &fakeScreen{displays: twoDisplays, frames: []display.BMP{
+		settled,
+		noise, // within the tolerance, not a change
+		// flicker that settles back into the settled frame, which is never reported
+		flicker,
+		settled,
+		settled,
+		// an animation, reported once when it settles, the last frame repeats once the frames run out
+		animating,
+		done,
+		done,
+	}}
+	s, err := New(ScreenOpt(screen), MouseOpt(&fakeMouse{}), DisplaysOpt(twoDisplays))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := s.WatchRegion(ctx, image.Rect(100, 50, 100+w, 50+h), time.Millisecond, 5)
+	if err != nil {
+		t.Fatalf("WatchRegion() error = %v", err)
+	}
+
+	select {
+	case change := <-changes:
+		if change.Err != nil {
+			t.Fatalf("WatchRegion sent error %v", change.Err)
+		}
+		if want := []image.Rectangle{image.Rect(10, 8, 15, 12)}; !slices.Equal(change.Changed, want) {
+			t.Errorf("Changed = %v, want %v", change.Changed, want)
+		}
+		if !bytes.Equal(change.Before.Data, settled.Data) || !bytes.Equal(change.After.Data, done.Data) {
+			t.Error("the change is not reported between the settled frame and the frame the animation settled in")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no change was reported once the region settled")
+	}
+
+	// the region stays the same from now on, the watcher must report nothing more until it is stopped
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	for change := range changes {
+		t.Errorf("WatchRegion reported another change %v, err %v", change.Changed, change.Err)
+	}
+}
+
+func TestWatchRegionSizeChange(t *testing.T) {
+	screen := &fakeScreen{displays: twoDisplays, frames: []display.BMP{paintedBMP(t, 40, 30), paintedBMP(t, 30, 40)}}
+	s, err := New(ScreenOpt(screen), MouseOpt(&fakeMouse{}), DisplaysOpt(twoDisplays))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer s.Close()
+
+	changes, err := s.WatchRegion(context.Background(), image.Rect(0, 0, 40, 30), time.Millisecond, 0)
+	if err != nil {
+		t.Fatalf("WatchRegion() error = %v", err)
+	}
+	change, ok := <-changes
+	if !ok || change.Err == nil {
+		t.Fatalf("WatchRegion sent %+v, want the error of the resized region", change)
+	}
+	if _, ok := <-changes; ok {
+		t.Error("the channel was not closed after the error")
+	}
+}
+
+func TestWatchRegionReusesFramesItNoLongerHolds(t *testing.T) {
+	const w, h = 20, 10
+	frames := []display.BMP{
+		paintedBMP(t, w, h),
+		paintedBMP(t, w, h, image.Rect(0, 0, 4, 4)),
+		paintedBMP(t, w, h, image.Rect(0, 0, 4, 4)),
+	}
+
+	var mu sync.Mutex
+	var captures int
+	var reused []*byte
+	capture := func(reuse *display.BMP) (*display.BMP, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		src := frames[min(captures, len(frames)-1)]
+		captures++
+		data := make([]byte, len(src.Data))
+		if reuse != nil {
+			reused = append(reused, &reuse.Data[0])
+			data = reuse.Data[:len(src.Data)]
+		}
+		copy(data, src.Data)
+		frame := src
+		frame.Data = data
+		return &frame, nil
+	}
+
+	s := &Session{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first, _ := capture(nil)
+	changes := make(chan RegionChange)
+	go s.watchRegion(ctx, capture, first, time.Millisecond, 0, changes)
+
+	var change RegionChange
+	select {
+	case change = <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("no change was reported")
+	}
+	before, after := slices.Clone(change.Before.Data), slices.Clone(change.After.Data)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	for range changes {
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reused) < captures/2 {
+		t.Errorf("%d of %d captures reused a frame, want the watcher to keep capturing into the frames it no longer holds", len(reused), captures)
+	}
+	for _, p := range reused {
+		if p == &change.Before.Data[0] || p == &change.After.Data[0] {
+			t.Fatal("the watcher reused the buffer of a frame it sent")
+		}
+	}
+	if !bytes.Equal(before, change.Before.Data) || !bytes.Equal(after, change.After.Data) {
+		t.Error("the frames of a sent change were modified")
+	}
+}
+
+// fakePixels is a pixel source returning the next color of colors on every read, repeating the last one once they run out.
+type fakePixels struct {
+	mu     sync.Mutex
+	colors []color.RGBA
+	reads  []image.Point
+}
+
+func (f *fakePixels) read(ctx context.Context, x, y int32) (color.RGBA, error) {
+	if err := ctx.Err(); err != nil {
+		return color.RGBA{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.colors[min(len(f.reads), len(f.colors)-1)]
+	f.reads = append(f.reads, image.Pt(int(x), int(y)))
+	return c, nil
+}
+
+// newPixelSession creates a session reading its pixels from a fake pixel source, its fake screen has no frames and must not be captured.
+func newPixelSession(t *testing.T, colors ...color.RGBA) (*Session, *fakePixels) {
+	t.Helper()
+	pixels := &fakePixels{colors: colors}
+	s, err := New(ScreenOpt(&fakeScreen{displays: twoDisplays}), MouseOpt(&fakeMouse{}), DisplaysOpt(twoDisplays), PixelSourceOpt(pixels.read))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, pixels
+}
+
+var (
+	red   = color.RGBA{R: 255, A: 255}
+	green = color.RGBA{G: 255, A: 255}
+	gray  = color.RGBA{R: 128, G: 128, B: 128, A: 255}
+)
+
+func TestWaitForPixel(t *testing.T) {
+	s, pixels := newPixelSession(t, red, color.RGBA{G: 240, B: 5, A: 255}, color.RGBA{G: 250, B: 3, A: 255}, red)
+
+	if err := s.WaitForPixel(context.Background(), 400, 20, 0, 255, 0, 10, time.Millisecond); err != nil {
+		t.Fatalf("WaitForPixel() error = %v", err)
+	}
+	if len(pixels.reads) != 3 || pixels.reads[0] != image.Pt(400, 20) {
+		t.Errorf("the pixels read were %v, want 400, 20 read until it was within the tolerance on the third read", pixels.reads)
+	}
+}
+
+func TestWaitForPixelTimeout(t *testing.T) {
+	s, _ := newPixelSession(t, red, gray)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := s.WaitForPixel(ctx, 10, 10, 0, 255, 0, 0, time.Millisecond)
+	var werr *PixelWaitError
+	if !errors.As(err, &werr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForPixel() error = %v, want a *PixelWaitError wrapping %v", err, context.DeadlineExceeded)
+	}
+	if werr.Target != green || werr.Last != gray || werr.Change {
+		t.Errorf("PixelWaitError = %+v, want the target green and the last observed color gray", werr)
+	}
+}
+
+func TestWaitForPixelChange(t *testing.T) {
+	s, pixels := newPixelSession(t, gray, color.RGBA{R: 130, G: 126, B: 128, A: 255}, red)
+
+	if err := s.WaitForPixelChange(context.Background(), 10, 10, 5, time.Millisecond); err != nil {
+		t.Fatalf("WaitForPixelChange() error = %v", err)
+	}
+	if len(pixels.reads) != 3 {
+		t.Errorf("the pixel was read %d times, want a change within the tolerance ignored", len(pixels.reads))
+	}
+}
+
+func TestWaitForPixelChangeTimeout(t *testing.T) {
+	s, _ := newPixelSession(t, gray, color.RGBA{R: 131, G: 128, B: 128, A: 255})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := s.WaitForPixelChange(ctx, 10, 10, 5, time.Millisecond)
+	var werr *PixelWaitError
+	if !errors.As(err, &werr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForPixelChange() error = %v, want a *PixelWaitError wrapping %v", err, context.DeadlineExceeded)
+	}
+	if want := (color.RGBA{R: 131, G: 128, B: 128, A: 255}); werr.Target != gray || werr.Last != want || !werr.Change {
+		t.Errorf("PixelWaitError = %+v, want the initial color gray and the last observed color %v", werr, want)
+	}
+}
+
+func TestWaitForPixelCapturesWithoutPixelSource(t *testing.T) {
+	screen := &fakeScreen{displays: twoDisplays, frames: []display.BMP{*display.NewBMP(1, 1, 255, 0, 0), *display.NewBMP(1, 1, 0, 255, 0)}}
+	s, err := New(ScreenOpt(screen), MouseOpt(&fakeMouse{}), DisplaysOpt(twoDisplays))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer s.Close()
+
+	if err := s.WaitForPixel(context.Background(), 330, 10, 0, 255, 0, 0, time.Millisecond); err != nil {
+		t.Fatalf("WaitForPixel() error = %v", err)
+	}
+	if screen.captures != 2 {
+		t.Errorf("%d captures were taken, want 2", screen.captures)
+	}
+	if err := s.WaitForPixel(context.Background(), 700, 10, 0, 255, 0, 0, time.Millisecond); err == nil {
+		t.Error("WaitForPixel() of a pixel on no display succeeded")
+	}
+}
+
+// newButtonSession creates a session watching the primary display of twoDisplays, whose captures show the button template of the library at 100, 60
+// in the frames for which shown is true, and noise without it otherwise.
+func newButtonSession(t *testing.T, shown ...bool) (*Session, *fakeScreen, *fakeMouse) {
+	t.Helper()
+	button := noiseBMP(t, 24, 24, 7)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "button.bmp"), button.ToBinary(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var frames []display.BMP
+	for _, show := range shown {
+		frame := noiseBMP(t, 320, 240, 1)
+		if show {
+			if err := frame.Paste(button, 100, 60); err != nil {
+				t.Fatal(err)
+			}
+		}
+		frames = append(frames, *frame)
+	}
+	screen := &fakeScreen{displays: twoDisplays, frames: frames}
+	m := &fakeMouse{}
+	s, err := New(
+		ScreenOpt(screen),
+		MouseOpt(m),
+		DisplaysOpt(twoDisplays[:1]),
+		TemplateDirOpt(dir),
+		FindOpt(matcher.ConfidenceOpt(0.95)),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, screen, m
+}
+
+// foundPattern returns whether each attempt of a wait found its template.
+func foundPattern(attempts []Attempt) []bool {
+	found := make([]bool, len(attempts))
+	for i, a := range attempts {
+		found[i] = a.Found
+	}
+	return found
+}
+
+func TestWaitAndClickAppearsOnThirdAttempt(t *testing.T) {
+	s, screen, m := newButtonSession(t, false, false, true)
+
+	if err := s.WaitAndClick(context.Background(), "button", IntervalOpt(time.Millisecond)); err != nil {
+		t.Fatalf("WaitAndClick() error = %v", err)
+	}
+	if screen.captures != 3 || m.clicks != 1 {
+		t.Errorf("WaitAndClick took %d captures and clicked %d times, want 3 captures and 1 click", screen.captures, m.clicks)
+	}
+	if want := image.Pt(112, 72); len(m.moves) != 1 || m.moves[0] != want {
+		t.Errorf("the mouse moved to %v, want a single move to %v", m.moves, want)
+	}
+}
+
+func TestWaitAndClickRunsOutOfAttempts(t *testing.T) {
+	s, _, m := newButtonSession(t, false, false, true)
+
+	err := s.WaitAndClick(context.Background(), "button", IntervalOpt(time.Millisecond), MaxAttemptsOpt(2))
+	var werr *WaitError
+	if !errors.As(err, &werr) || !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("WaitAndClick() error = %v, want a *WaitError wrapping ErrTemplateNotFound", err)
+	}
+	if got, want := foundPattern(werr.Attempts), []bool{false, false}; !slices.Equal(got, want) {
+		t.Errorf("WaitError.Attempts found = %v, want %v", got, want)
+	}
+	if m.clicks != 0 {
+		t.Errorf("the mouse clicked %d times, want none", m.clicks)
+	}
+}
+
+func TestWaitAndClickReclicksOnFailedVerification(t *testing.T) {
+	// the first click leaves the button shown, the second one makes it disappear
+	s, screen, m := newButtonSession(t, true, true, true, false)
+
+	err := s.WaitAndClick(context.Background(), "button", IntervalOpt(time.Millisecond), VerifyGoneOpt("button"), VerifyTimeoutOpt(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("WaitAndClick() error = %v", err)
+	}
+	if screen.captures != 4 || m.clicks != 2 {
+		t.Errorf("WaitAndClick took %d captures and clicked %d times, want 4 captures and 2 clicks", screen.captures, m.clicks)
+	}
+}
+
+func TestWaitAndClickVerificationHistory(t *testing.T) {
+	// the button appears on the third attempt and never disappears, so both verifications fail
+	s, _, m := newButtonSession(t, false, false, true)
+
+	err := s.WaitAndClick(context.Background(), "button", IntervalOpt(time.Millisecond), VerifyGoneOpt("button"), VerifyTimeoutOpt(time.Nanosecond))
+	var werr *WaitError
+	if !errors.As(err, &werr) || !errors.Is(err, ErrVerificationFailed) {
+		t.Fatalf("WaitAndClick() error = %v, want a *WaitError wrapping ErrVerificationFailed", err)
+	}
+	// three attempts to find the button, the failed verification, the search before the re-click and the second failed verification
+	if got, want := foundPattern(werr.Attempts), []bool{false, false, true, true, true, true}; !slices.Equal(got, want) {
+		t.Errorf("WaitError.Attempts found = %v, want %v", got, want)
+	}
+	if m.clicks != 2 {
+		t.Errorf("the mouse clicked %d times, want 2", m.clicks)
+	}
+}
@@ -0,0 +1,120 @@
+package clipboard
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	// openAttempts is how many times opening the clipboard is attempted, another application may briefly hold it open
+	openAttempts = 10
+	// openRetryDelay is how long to wait between attempts to open the clipboard
+	openRetryDelay = 20 * time.Millisecond
+)
+
+// ReadText reads the text on the clipboard.
+//
+// Returns:
+//   - string: The text on the clipboard, empty if the clipboard holds no text.
+//   - error: An error if the clipboard could not be read.
+func ReadText() (string, error) {
+	return doReadText()
+}
+
+// WriteText replaces the contents of the clipboard with text.
+//
+// Parameters:
+//   - text: The text to write.
+//
+// Returns:
+//   - error: An error if the clipboard could not be written.
+func WriteText(text string) error {
+	return doWriteText(text)
+}
+
+// Clear removes the contents of the clipboard.
+//
+// Returns:
+//   - error: An error if the clipboard could not be cleared.
+func Clear() error {
+	return doClear()
+}
+
+// retry calls fn until it succeeds or it has been called the given number of times, sleeping between the calls.
+//
+// Parameters:
+//   - attempts: The maximum number of calls, at least one call is always made.
+//   - delay: How long to sleep between the calls.
+//   - fn: The function to call.
+//
+// Returns:
+//   - error: nil if a call succeeded, otherwise an error wrapping the error of the last call.
+func retry(attempts int, delay time.Duration, fn func() error) error {
+	attempts = max(attempts, 1)
+	var err error
+	for i := range attempts {
+		if i > 0 {
+			time.Sleep(delay)
+		}
+		if err = fn(); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("failed after %d attempts: %w", attempts, err)
+}
+
+// withOpened opens a resource shared with other applications, retrying while another application holds it, calls fn, then closes the resource.
+// The resource is only closed if it was opened, and fn is not called if it could not be opened.
+//
+// Parameters:
+//   - open: Opens the resource, such as the clipboard.
+//   - close: Closes the resource.
+//   - fn: The function to call while the resource is open.
+//
+// Returns:
+//   - error: An error if the resource could not be opened, otherwise the error returned by fn.
+func withOpened(open func() error, close func(), fn func() error) error {
+	if err := retry(openAttempts, openRetryDelay, open); err != nil {
+		return err
+	}
+	defer close()
+	return fn()
+}
+
+// encodeUTF16 encodes text as NUL terminated UTF-16, the layout of CF_UNICODETEXT.
+// Text is cut at its first NUL, which would otherwise end the clipboard text early.
+//
+// Parameters:
+//   - text: The text to encode.
+//
+// Returns:
+//   - []uint16: The encoded text, including the NUL terminator.
+func encodeUTF16(text string) []uint16 {
+	encoded := utf16.Encode([]rune(text))
+	for i, unit := range encoded {
+		if unit == 0 {
+			encoded = encoded[:i]
+			break
+		}
+	}
+	return append(encoded, 0)
+}
+
+// decodeUTF16 decodes UTF-16 text up to its first NUL, or all of it if it is not NUL terminated.
+// Unpaired surrogates are decoded as the Unicode replacement character.
+//
+// Parameters:
+//   - text: The text to decode.
+//
+// Returns:
+//   - string: The decoded text.
+func decodeUTF16(text []uint16) string {
+	for i, unit := range text {
+		if unit == 0 {
+			text = text[:i]
+			break
+		}
+	}
+	return string(utf16.Decode(text))
+}
@@ -0,0 +1,24 @@
+//go:build linux
+// +build linux
+
+package clipboard
+
+import (
+	linux "github.com/Carmen-Shannon/automation/tools/_linux"
+)
+
+func doReadText() (string, error) {
+	text, err := linux.ExecuteClipboardRead()
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+func doWriteText(text string) error {
+	return linux.ExecuteClipboardWrite([]byte(text))
+}
+
+func doClear() error {
+	return linux.ExecuteClipboardClear()
+}
@@ -0,0 +1,165 @@
+package clipboard
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestEncodeUTF16(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []uint16
+	}{
+		{name: "empty", text: "", want: []uint16{0}},
+		{name: "ascii", text: "hi", want: []uint16{'h', 'i', 0}},
+		{name: "accents", text: "café", want: []uint16{'c', 'a', 'f', 0xe9, 0}},
+		{name: "surrogate pair", text: "a😀", want: []uint16{'a', 0xd83d, 0xde00, 0}},
+		{name: "cut at NUL", text: "ab\x00cd", want: []uint16{'a', 'b', 0}},
+		{name: "newlines", text: "a\r\nb", want: []uint16{'a', '\r', '\n', 'b', 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encodeUTF16(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("encodeUTF16(%q) = %#x, want %#x", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeUTF16(t *testing.T) {
+	tests := []struct {
+		name string
+		data []uint16
+		want string
+	}{
+		{name: "empty", data: nil, want: ""},
+		{name: "terminator only", data: []uint16{0}, want: ""},
+		{name: "terminated", data: []uint16{'h', 'i', 0}, want: "hi"},
+		{name: "unterminated", data: []uint16{'h', 'i'}, want: "hi"},
+		{name: "garbage after the terminator", data: []uint16{'h', 'i', 0, 'x', 'y'}, want: "hi"},
+		{name: "surrogate pair", data: []uint16{0xd83d, 0xde00, 0}, want: "😀"},
+		{name: "unpaired surrogate", data: []uint16{'a', 0xd83d, 'b', 0}, want: "a�b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeUTF16(tt.data); got != tt.want {
+				t.Errorf("decodeUTF16(%#x) = %q, want %q", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUTF16RoundTrip(t *testing.T) {
+	for _, text := range []string{"", "plain", "ünïcödé", "日本語", "emoji 😀🎉", "tab\tand\nnewline"} {
+		encoded := encodeUTF16(text)
+		if encoded[len(encoded)-1] != 0 || len(encoded) != len(utf16.Encode([]rune(text)))+1 {
+			t.Errorf("encodeUTF16(%q) = %#x, want the UTF-16 text with a single NUL terminator", text, encoded)
+		}
+		if got := decodeUTF16(encoded); got != text {
+			t.Errorf("decodeUTF16(encodeUTF16(%q)) = %q", text, got)
+		}
+	}
+}
+
+// fakeClipboard stands in for the clipboard calls of the OS, it fails to open until it has been asked the given number of times.
+type fakeClipboard struct {
+	busyFor int // how many calls to open fail, as if another application held the clipboard
+	opens   int
+	closes  int
+}
+
+var errBusy = errors.New("the clipboard is held by another application")
+
+func (f *fakeClipboard) open() error {
+	f.opens++
+	if f.opens <= f.busyFor {
+		return errBusy
+	}
+	return nil
+}
+
+func (f *fakeClipboard) close() {
+	f.closes++
+}
+
+func TestWithOpenedRetriesWhileBusy(t *testing.T) {
+	f := &fakeClipboard{busyFor: 2}
+	calls := 0
+	err := withOpened(f.open, f.close, func() error {
+		calls++
+		if f.closes != 0 {
+			t.Error("the clipboard was closed before fn was called")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("withOpened() error = %v", err)
+	}
+	if f.opens != 3 || calls != 1 || f.closes != 1 {
+		t.Errorf("opened %d times, called fn %d times and closed %d times, want 3, 1 and 1", f.opens, calls, f.closes)
+	}
+}
+
+func TestWithOpenedGivesUp(t *testing.T) {
+	f := &fakeClipboard{busyFor: openAttempts}
+	called := false
+	err := withOpened(f.open, f.close, func() error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, errBusy) {
+		t.Fatalf("withOpened() error = %v, want %v", err, errBusy)
+	}
+	if f.opens != openAttempts || called || f.closes != 0 {
+		t.Errorf("opened %d times, called fn %v and closed %d times, want %d attempts without calling fn or closing", f.opens, called, f.closes, openAttempts)
+	}
+}
+
+func TestWithOpenedClosesWhenFnFails(t *testing.T) {
+	f := &fakeClipboard{}
+	errFn := errors.New("fn failed")
+	if err := withOpened(f.open, f.close, func() error { return errFn }); !errors.Is(err, errFn) {
+		t.Fatalf("withOpened() error = %v, want %v", err, errFn)
+	}
+	if f.opens != 1 || f.closes != 1 {
+		t.Errorf("opened %d times and closed %d times, want 1 and 1", f.opens, f.closes)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	errFail := errors.New("failed")
+	tests := []struct {
+		name      string
+		attempts  int
+		failures  int
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "first call succeeds", attempts: 3, failures: 0, wantCalls: 1},
+		{name: "last call succeeds", attempts: 3, failures: 2, wantCalls: 3},
+		{name: "every call fails", attempts: 3, failures: 5, wantCalls: 3, wantErr: true},
+		{name: "no attempts still calls once", attempts: 0, failures: 0, wantCalls: 1},
+		{name: "no attempts fails after one call", attempts: 0, failures: 1, wantCalls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := retry(tt.attempts, 0, func() error {
+				calls++
+				if calls <= tt.failures {
+					return errFail
+				}
+				return nil
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("retry() called fn %d times, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr != errors.Is(err, errFail) {
+				t.Errorf("retry() error = %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+//go:build windows
+// +build windows
+
+package clipboard
+
+import (
+	"runtime"
+
+	windows "github.com/Carmen-Shannon/automation/tools/_windows"
+)
+
+// withClipboard opens the clipboard, retrying while another application holds it open, calls fn, then closes the clipboard.
+// The clipboard is opened for the calling thread, so the goroutine is locked to its OS thread until the clipboard is closed.
+//
+// Parameters:
+//   - fn: The function to call while the clipboard is open.
+//
+// Returns:
+//   - error: An error if the clipboard could not be opened, otherwise the error returned by fn.
+func withClipboard(fn func() error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	return withOpened(windows.OpenClipboard, windows.CloseClipboard, fn)
+}
+
+func doReadText() (string, error) {
+	var text string
+	err := withClipboard(func() error {
+		data, err := windows.GetClipboardUnicodeText()
+		if err != nil {
+			return err
+		}
+		text = decodeUTF16(data)
+		return nil
+	})
+	return text, err
+}
+
+func doWriteText(text string) error {
+	return withClipboard(func() error {
+		// emptying the clipboard makes this process its owner, which is required to set its data
+		if err := windows.EmptyClipboard(); err != nil {
+			return err
+		}
+		return windows.SetClipboardUnicodeText(encodeUTF16(text))
+	})
+}
+
+func doClear() error {
+	return withClipboard(windows.EmptyClipboard)
+}
@@ -0,0 +1,91 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// inputBlocker keeps the input of the user blocked while any caller holds a block.
+// Blocks are counted, so the input is blocked by the first holder and only unblocked once the last holder releases theirs.
+type inputBlocker struct {
+	mu      sync.Mutex
+	acquire func() (func() error, error) // blocks the input, returning the function unblocking it
+
+	holders int          // the number of blocks that were not released yet
+	unblock func() error // unblocks the input, nil while the input is not blocked
+}
+
+// blocker is the input blocker shared by every caller of BlockInput.
+var blocker = &inputBlocker{acquire: doBlockInput}
+
+// BlockInput blocks the keyboard and mouse input of the user, so bumping the mouse can not interfere with a critical sequence such as a drag.
+// The input stays blocked until the returned release function is called or the context is done, whichever comes first.
+// Blocks may be nested, the input is unblocked once every block was released. It is safe to call the release function any number of times.
+//
+// On windows it uses the BlockInput API, which requires the process to run elevated or with UIAccess. The user can always unblock the input
+// with Ctrl+Alt+Del, and the system unblocks it if the process exits without releasing the block.
+// On linux it grabs the pointer and the keyboard on the root window through the shared X connection, and the X server releases the grab if the process exits.
+// Note that the grab also captures the clicks and key presses sent by this package, only pointer movement still reaches other applications.
+//
+// Parameters:
+//   - ctx: The context the block is tied to, the block is released once it is done.
+//
+// Returns:
+//   - func(): The function releasing the block.
+//   - error: An error if the context is already done or the input could not be blocked, such as without the required privileges.
+func BlockInput(ctx context.Context) (func(), error) {
+	return blocker.block(ctx)
+}
+
+// block takes a block on the input, blocking it if it is not blocked yet, and releases it once the context is done.
+//
+// Parameters:
+//   - ctx: The context the block is tied to.
+//
+// Returns:
+//   - func(): The function releasing the block, safe to call any number of times.
+//   - error: An error if the context is already done or the input could not be blocked.
+func (b *inputBlocker) block(ctx context.Context) (func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	if b.holders == 0 {
+		unblock, err := b.acquire()
+		if err != nil {
+			b.mu.Unlock()
+			return nil, fmt.Errorf("failed to block input: %w", err)
+		}
+		b.unblock = unblock
+	}
+	b.holders++
+	b.mu.Unlock()
+
+	var once sync.Once
+	release := func() {
+		once.Do(b.release)
+	}
+	// the context may already be done here, in which case the block is released right away on another goroutine
+	stop := context.AfterFunc(ctx, release)
+	return func() {
+		stop()
+		release()
+	}, nil
+}
+
+// release gives up a block, unblocking the input once no block is held anymore.
+func (b *inputBlocker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.holders == 0 {
+		return
+	}
+	b.holders--
+	if b.holders == 0 && b.unblock != nil {
+		// there is no caller to report a failure to, the input is unblocked by the system at the latest when the process exits
+		_ = b.unblock()
+		b.unblock = nil
+	}
+}
@@ -0,0 +1,23 @@
+//go:build linux
+// +build linux
+
+package device
+
+import (
+	linux "github.com/Carmen-Shannon/automation/tools/_linux"
+)
+
+// doBlockInput blocks the input by grabbing the pointer and the keyboard through the shared X connection.
+//
+// Returns:
+//   - func() error: The function releasing the grab.
+//   - error: An error if the session is a Wayland session or the input could not be grabbed.
+func doBlockInput() (func() error, error) {
+	if err := linux.CheckX11Session("block input"); err != nil {
+		return nil, err
+	}
+	if err := linux.GrabInput(); err != nil {
+		return nil, err
+	}
+	return linux.UngrabInput, nil
+}
@@ -0,0 +1,231 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeInput counts how often the input was blocked and unblocked.
+type fakeInput struct {
+	mu               sync.Mutex
+	blocks, unblocks int
+	failBlock        error
+	failUnblock      error
+}
+
+func (f *fakeInput) acquire() (func() error, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failBlock != nil {
+		return nil, f.failBlock
+	}
+	f.blocks++
+	return func() error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.unblocks++
+		return f.failUnblock
+	}, nil
+}
+
+func (f *fakeInput) counts() (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.blocks, f.unblocks
+}
+
+// wantCounts checks how often the input was blocked and unblocked, waiting a moment for releases made by a context on another goroutine.
+func (f *fakeInput) wantCounts(t *testing.T, blocks, unblocks int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		gotBlocks, gotUnblocks := f.counts()
+		if gotBlocks == blocks && gotUnblocks == unblocks {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("input blocked %d times and unblocked %d times, want %d and %d", gotBlocks, gotUnblocks, blocks, unblocks)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// wantHolders checks the number of blocks held, waiting a moment for releases made by a context on another goroutine.
+func wantHolders(t *testing.T, b *inputBlocker, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		b.mu.Lock()
+		holders := b.holders
+		b.mu.Unlock()
+		if holders == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d blocks held, want %d", holders, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBlockNestsBlocks(t *testing.T) {
+	f := &fakeInput{}
+	b := &inputBlocker{acquire: f.acquire}
+
+	release1, err := b.block(context.Background())
+	if err != nil {
+		t.Fatalf("block() error = %v", err)
+	}
+	release2, err := b.block(context.Background())
+	if err != nil {
+		t.Fatalf("block() error = %v", err)
+	}
+	f.wantCounts(t, 1, 0)
+
+	release1()
+	f.wantCounts(t, 1, 0)
+	release2()
+	f.wantCounts(t, 1, 1)
+
+	// a new block after every block was released blocks the input again
+	release3, err := b.block(context.Background())
+	if err != nil {
+		t.Fatalf("block() error = %v", err)
+	}
+	f.wantCounts(t, 2, 1)
+	release3()
+	f.wantCounts(t, 2, 2)
+}
+
+func TestReleaseTwiceIsSafe(t *testing.T) {
+	f := &fakeInput{}
+	b := &inputBlocker{acquire: f.acquire}
+
+	release1, _ := b.block(context.Background())
+	release2, _ := b.block(context.Background())
+	release1()
+	release1()
+	// releasing the first block twice must not give up the second one
+	f.wantCounts(t, 1, 0)
+	release2()
+	release2()
+	f.wantCounts(t, 1, 1)
+	release1()
+	f.wantCounts(t, 1, 1)
+}
+
+func TestBlockReleasedWithContext(t *testing.T) {
+	f := &fakeInput{}
+	b := &inputBlocker{acquire: f.acquire}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	release, err := b.block(ctx)
+	if err != nil {
+		t.Fatalf("block() error = %v", err)
+	}
+	held, err := b.block(context.Background())
+	if err != nil {
+		t.Fatalf("block() error = %v", err)
+	}
+
+	cancel()
+	// the block of the context is released, the other one still holds the input
+	wantHolders(t, b, 1)
+	f.wantCounts(t, 1, 0)
+
+	// releasing a block its context already released is safe
+	release()
+	f.wantCounts(t, 1, 0)
+	held()
+	f.wantCounts(t, 1, 1)
+}
+
+func TestBlockWithDoneContext(t *testing.T) {
+	f := &fakeInput{}
+	b := &inputBlocker{acquire: f.acquire}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := b.block(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("block() error = %v, want %v", err, context.Canceled)
+	}
+	f.wantCounts(t, 0, 0)
+}
+
+func TestBlockFailure(t *testing.T) {
+	errDenied := errors.New("access denied")
+	f := &fakeInput{failBlock: errDenied}
+	b := &inputBlocker{acquire: f.acquire}
+
+	if _, err := b.block(context.Background()); !errors.Is(err, errDenied) {
+		t.Fatalf("block() error = %v, want %v", err, errDenied)
+	}
+	if b.holders != 0 {
+		t.Fatalf("%d blocks held after blocking failed, want 0", b.holders)
+	}
+
+	// a failed block is not remembered, the next block tries again
+	f.failBlock = nil
+	release, err := b.block(context.Background())
+	if err != nil {
+		t.Fatalf("block() error = %v", err)
+	}
+	release()
+	f.wantCounts(t, 1, 1)
+}
+
+func TestUnblockFailureIsForgotten(t *testing.T) {
+	f := &fakeInput{failUnblock: errors.New("not blocked by this thread")}
+	b := &inputBlocker{acquire: f.acquire}
+
+	release, _ := b.block(context.Background())
+	release()
+	f.wantCounts(t, 1, 1)
+
+	// the failed unblock is not retried, and a new block blocks the input again
+	release, _ = b.block(context.Background())
+	release()
+	f.wantCounts(t, 2, 2)
+}
+
+func TestBlockConcurrently(t *testing.T) {
+	f := &fakeInput{}
+	b := &inputBlocker{acquire: f.acquire}
+
+	var wg sync.WaitGroup
+	for i := range 64 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			release, err := b.block(ctx)
+			if err != nil {
+				t.Errorf("block() error = %v", err)
+				return
+			}
+			// release a third of the blocks through their context, a third directly and a third twice
+			switch i % 3 {
+			case 0:
+				cancel()
+			case 1:
+				release()
+			default:
+				release()
+				release()
+			}
+		}()
+	}
+	wg.Wait()
+
+	wantHolders(t, b, 0)
+	if b.unblock != nil {
+		t.Error("the input is still blocked after every block was released")
+	}
+	if blocks, unblocks := f.counts(); blocks != unblocks || blocks == 0 {
+		t.Errorf("input blocked %d times and unblocked %d times, want every block unblocked", blocks, unblocks)
+	}
+}
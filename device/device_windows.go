@@ -0,0 +1,41 @@
+//go:build windows
+// +build windows
+
+package device
+
+import (
+	"runtime"
+
+	windows "github.com/Carmen-Shannon/automation/tools/_windows"
+)
+
+// doBlockInput blocks the input with the BlockInput API on a dedicated thread.
+// Only the thread that blocked the input can unblock it, and the system unblocks it once that thread exits,
+// so the thread is locked to its goroutine and never unlocked, which makes it exit along with the goroutine.
+//
+// Returns:
+//   - func() error: The function unblocking the input.
+//   - error: An error if the input could not be blocked.
+func doBlockInput() (func() error, error) {
+	blocked := make(chan error, 1)
+	unblock := make(chan struct{})
+	unblocked := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := windows.BlockInput(true); err != nil {
+			blocked <- err
+			return
+		}
+		blocked <- nil
+		<-unblock
+		unblocked <- windows.BlockInput(false)
+	}()
+
+	if err := <-blocked; err != nil {
+		return nil, err
+	}
+	return func() error {
+		close(unblock)
+		return <-unblocked
+	}, nil
+}
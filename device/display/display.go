@@ -2,8 +2,19 @@ package display
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"image"
+	"math"
+	"slices"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/Carmen-Shannon/automation/device/window"
+	"github.com/Carmen-Shannon/automation/tools"
 )
 
 type Display struct {
@@ -15,6 +26,77 @@ type Display struct {
 	Primary     bool
 }
 
+// Contains reports whether a point of the virtual screen is on the display.
+//
+// Parameters:
+//   - x: The x-coordinate of the point, in virtual screen coordinates.
+//   - y: The y-coordinate of the point, in virtual screen coordinates.
+//
+// Returns:
+//   - bool: True if the point is within the bounds of the display, false otherwise.
+func (d Display) Contains(x, y int32) bool {
+	lx, ly := d.ToLocal(x, y)
+	return lx >= 0 && lx < int32(d.Width) && ly >= 0 && ly < int32(d.Height)
+}
+
+// ToLocal converts a point from virtual screen coordinates to coordinates relative to the top-left corner of the display.
+// The point does not have to be on the display, use Contains to check that.
+//
+// Parameters:
+//   - x: The x-coordinate of the point, in virtual screen coordinates.
+//   - y: The y-coordinate of the point, in virtual screen coordinates.
+//
+// Returns:
+//   - int32: The x-coordinate of the point, relative to the display.
+//   - int32: The y-coordinate of the point, relative to the display.
+func (d Display) ToLocal(x, y int32) (int32, int32) {
+	return x - d.X, y - d.Y
+}
+
+// ToGlobal converts a point from coordinates relative to the top-left corner of the display to virtual screen coordinates.
+//
+// Parameters:
+//   - x: The x-coordinate of the point, relative to the display.
+//   - y: The y-coordinate of the point, relative to the display.
+//
+// Returns:
+//   - int32: The x-coordinate of the point, in virtual screen coordinates.
+//   - int32: The y-coordinate of the point, in virtual screen coordinates.
+func (d Display) ToGlobal(x, y int32) (int32, int32) {
+	return x + d.X, y + d.Y
+}
+
+// DisplayCapture is a capture of a single display, tied to the display it was taken from.
+type DisplayCapture struct {
+	Display Display // the display the capture was taken from, its X and Y translate capture coordinates back to screen space
+	BMP     BMP
+}
+
+// CaptureTiming is how long the capture of a single display took, split into its stages.
+// On Windows Copy is the BitBlt of the screen into memory, and Read is the GetDIBits copying the pixels out of it.
+// On Linux Copy is the run of the external capture command, and Read is the parsing of its output.
+type CaptureTiming struct {
+	Display Display       // the display that was captured
+	Copy    time.Duration // copying the screen contents
+	Read    time.Duration // reading the copied pixels into the BMP
+	Total   time.Duration // the whole capture of the display, including the setup and post-processing around Copy and Read
+}
+
+// DisplayCaptureError is the error of a single display that failed to capture, reported by captures taken with PartialCaptureOpt.
+// The errors of every failed display are joined with errors.Join, so they can be listed through its Unwrap() []error method.
+type DisplayCaptureError struct {
+	Display Display // the display that failed to capture
+	Err     error
+}
+
+func (e *DisplayCaptureError) Error() string {
+	return fmt.Sprintf("failed to capture the display at %d, %d: %v", e.Display.X, e.Display.Y, e.Err)
+}
+
+func (e *DisplayCaptureError) Unwrap() error {
+	return e.Err
+}
+
 type BMP struct {
 	FileHeader bitmapHeader
 	InfoHeader bitmapInfoHeader
@@ -22,6 +104,17 @@ type BMP struct {
 	Data       []byte
 	Width      int
 	Height     int
+
+	// Grayscale reports that every pixel has equal color channels, such as a capture taken with GrayscaleOpt.
+	// It is not stored in the BMP file, so it is false for BMPs loaded from one.
+	Grayscale bool
+
+	// DirtyRects are the regions that changed since the previous capture of the same display, relative to the top-left corner of the BMP.
+	// They are only reported for captures taken with DesktopDuplicationOpt, it is empty if nothing changed, and nil if it is not known what changed.
+	DirtyRects []image.Rectangle
+
+	frameSource uint64 // identifies the desktop duplication the BMP was captured from, zero if it was not
+	frameSeq    uint64 // the number of the frame within its desktop duplication
 }
 
 // ToBinary serializes the BMP struct into a byte slice in BMP format.
@@ -67,6 +160,382 @@ func (b *BMP) ToBinary() []byte {
 	return buffer.Bytes()
 }
 
+// Equal reports whether two BMPs hold the same image, comparing their dimensions and the color of every pixel.
+// Differences that do not change the image are ignored, such as a zero BiSizeImage, the row order, the row padding,
+// the bit depth of pixels with the same colors, and the alpha bytes of 32-bit pixels, which makes it useful for asserting on round trips in tests.
+//
+// Parameters:
+//   - other: The BMP to compare with.
+//
+// Returns:
+//   - bool: True if both BMPs are nil, or both hold the same image, false otherwise or if the pixel data of either can not be read.
+func (b *BMP) Equal(other *BMP) bool {
+	if b == nil || other == nil {
+		return b == other
+	}
+	if b.Width != other.Width || b.Height != other.Height {
+		return false
+	}
+	pixels, err := b.bgrPixels()
+	if err != nil {
+		return false
+	}
+	otherPixels, err := other.bgrPixels()
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(pixels, otherPixels)
+}
+
+// Diff finds the regions that changed between the BMP and a later BMP of the same size and pixel format, such as two captures of the same region.
+// A pixel changed when any of its color channels differs by more than the tolerance, which ignores noise such as compression artifacts or dithering.
+// Touching changed pixels are grouped into one rectangle, so separate changes, such as a blinking cursor and a progress bar, are reported separately.
+//
+// Parameters:
+//   - other: The later BMP to compare with.
+//   - tolerance: The largest difference of a color channel that is not a change, zero for an exact comparison.
+//
+// Returns:
+//   - []image.Rectangle: The bounds of each group of changed pixels, relative to the top-left corner of the BMPs, empty if nothing changed.
+//   - error: An error if the sizes or pixel formats of the BMPs differ, or the pixel data of either can not be read.
+func (b *BMP) Diff(other *BMP, tolerance uint8) ([]image.Rectangle, error) {
+	if b.Width != other.Width || b.Height != other.Height {
+		return nil, fmt.Errorf("sizes differ: %dx%d and %dx%d", b.Width, b.Height, other.Width, other.Height)
+	}
+	return diffRects(b, other, tolerance)
+}
+
+// Paste copies the pixels of src into the BMP with the top-left corner of src placed at the given offset.
+// Both BMPs may be stored top-down or bottom-up, and row padding is handled for each of them, the offset is always relative to the top-left corner of the BMP.
+// This is useful for building synthetic scans, such as pasting a template into a blank image at a known location.
+//
+// Parameters:
+//   - src: The BMP to copy the pixels from, it must have the same pixel format as the BMP.
+//   - x: The x-coordinate in the BMP to place the left edge of src at.
+//   - y: The y-coordinate in the BMP to place the top edge of src at.
+//
+// Returns:
+//   - error: An error if the pixel formats differ or src does not fit within the BMP at the given offset.
+func (b *BMP) Paste(src *BMP, x, y int) error {
+	if src == nil {
+		return errors.New("source BMP is nil")
+	}
+	if x < 0 || y < 0 || x+src.Width > b.Width || y+src.Height > b.Height {
+		return fmt.Errorf("paste region %dx%d+%d+%d does not fit within the BMP of size %dx%d", src.Width, src.Height, x, y, b.Width, b.Height)
+	}
+
+	dstBytesPerPixel, dstRowSize, err := b.pixelLayout()
+	if err != nil {
+		return err
+	}
+	srcBytesPerPixel, srcRowSize, err := src.pixelLayout()
+	if err != nil {
+		return err
+	}
+	if dstBytesPerPixel != srcBytesPerPixel {
+		return fmt.Errorf("pixel formats differ: %d bytes per pixel in the BMP and %d in the source", dstBytesPerPixel, srcBytesPerPixel)
+	}
+
+	rowBytes := src.Width * srcBytesPerPixel
+	for row := range src.Height {
+		srcOffset := src.dataRow(row) * srcRowSize
+		dstOffset := b.dataRow(y+row)*dstRowSize + x*dstBytesPerPixel
+		copy(b.Data[dstOffset:dstOffset+rowBytes], src.Data[srcOffset:srcOffset+rowBytes])
+	}
+	return nil
+}
+
+// Rotate rotates the BMP clockwise by a multiple of 90 degrees into a new top-down BMP, the BMP itself is left unchanged.
+// Every pixel is moved as is, so the rotation is exact, and rotating by 90 or 270 degrees swaps the width and height.
+//
+// Parameters:
+//   - degrees: The clockwise rotation in degrees, a multiple of 90. Negative values rotate counter-clockwise.
+//
+// Returns:
+//   - *BMP: A pointer to the rotated BMP.
+//   - error: An error if the rotation is not a multiple of 90 degrees or the pixel data of the BMP can not be read.
+func (b *BMP) Rotate(degrees int) (*BMP, error) {
+	if degrees%90 != 0 {
+		return nil, fmt.Errorf("unsupported rotation of %d degrees, only multiples of 90 are supported", degrees)
+	}
+	quarterTurns := (degrees/90%4 + 4) % 4
+	bytesPerPixel, rowSize, err := b.pixelLayout()
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := b.Width, b.Height
+	if quarterTurns%2 == 1 {
+		width, height = height, width
+	}
+	dst := newBlankBMP(width, height, bytesPerPixel*8)
+	dst.Grayscale = b.Grayscale
+	dstRowSize := (width*bytesPerPixel + 3) & ^3
+	for row := range b.Height {
+		srcOffset := b.dataRow(row) * rowSize
+		for col := range b.Width {
+			var x, y int
+			switch quarterTurns {
+			case 0:
+				x, y = col, row
+			case 1:
+				x, y = b.Height-1-row, col
+			case 2:
+				x, y = b.Width-1-col, b.Height-1-row
+			case 3:
+				x, y = row, b.Width-1-col
+			}
+			src := srcOffset + col*bytesPerPixel
+			copy(dst.Data[y*dstRowSize+x*bytesPerPixel:], b.Data[src:src+bytesPerPixel])
+		}
+	}
+	return dst, nil
+}
+
+// GaussianBlur blurs the BMP into a new top-down BMP with the same pixel format, the BMP itself is left unchanged.
+// Blurring smooths out noise such as anti-aliasing, font hinting and subpixel rendering differences, which makes template matching more robust
+// when both the scan and the template are blurred the same way. Pixels past the edges repeat the edge pixels, and alpha bytes are copied as is.
+//
+// Parameters:
+//   - radius: The standard deviation of the Gaussian in pixels, the blur spans three times this value on every side. Zero or less copies the BMP unblurred.
+//
+// Returns:
+//   - *BMP: A pointer to the blurred BMP.
+//   - error: An error if the pixel data of the BMP can not be read.
+func (b *BMP) GaussianBlur(radius float64) (*BMP, error) {
+	bytesPerPixel, rowSize, err := b.pixelLayout()
+	if err != nil {
+		return nil, err
+	}
+	dst := newBlankBMP(b.Width, b.Height, bytesPerPixel*8)
+	dst.Grayscale = b.Grayscale
+	dstRowSize := (b.Width*bytesPerPixel + 3) & ^3
+	for row := range b.Height {
+		copy(dst.Data[row*dstRowSize:row*dstRowSize+b.Width*bytesPerPixel], b.Data[b.dataRow(row)*rowSize:])
+	}
+	if radius <= 0 {
+		return dst, nil
+	}
+
+	// the Gaussian is separable, so the pixels are blurred along the rows, then the result along the columns
+	kernel := gaussianKernel(radius)
+	blurred := make([]float64, b.Width*b.Height*3)
+	for row := range b.Height {
+		for col := range b.Width {
+			for ch := range 3 {
+				sum := 0.0
+				for k, weight := range kernel {
+					x := min(max(col+k-len(kernel)/2, 0), b.Width-1)
+					sum += weight * float64(dst.Data[row*dstRowSize+x*bytesPerPixel+ch])
+				}
+				blurred[(row*b.Width+col)*3+ch] = sum
+			}
+		}
+	}
+	for row := range b.Height {
+		for col := range b.Width {
+			for ch := range 3 {
+				sum := 0.0
+				for k, weight := range kernel {
+					y := min(max(row+k-len(kernel)/2, 0), b.Height-1)
+					sum += weight * blurred[(y*b.Width+col)*3+ch]
+				}
+				dst.Data[row*dstRowSize+col*bytesPerPixel+ch] = uint8(min(max(math.Round(sum), 0), 255))
+			}
+		}
+	}
+	return dst, nil
+}
+
+// SobelEdges computes the edge magnitude of the BMP with the Sobel operator into a new top-down BMP with the same pixel format, the BMP itself is left unchanged.
+// Every color channel of a pixel holds how sharply the luma changes around it, so the result only keeps the structure of the image, such as the outline and text of a button,
+// and the same control rendered in a light and a dark theme has similar edges. Pixels past the edges repeat the edge pixels, and alpha bytes are copied as is.
+//
+// Returns:
+//   - *BMP: A pointer to the edge BMP.
+//   - error: An error if the pixel data of the BMP can not be read.
+func (b *BMP) SobelEdges() (*BMP, error) {
+	bytesPerPixel, rowSize, err := b.pixelLayout()
+	if err != nil {
+		return nil, err
+	}
+	luma := make([]int, b.Width*b.Height)
+	for row := range b.Height {
+		rowStart := b.dataRow(row) * rowSize
+		for col := range b.Width {
+			// pixels are stored in BGR order
+			px := b.Data[rowStart+col*bytesPerPixel : rowStart+col*bytesPerPixel+3]
+			luma[row*b.Width+col] = (114*int(px[0]) + 587*int(px[1]) + 299*int(px[2]) + 500) / 1000
+		}
+	}
+
+	dst := newBlankBMP(b.Width, b.Height, bytesPerPixel*8)
+	dst.Grayscale = true
+	dstRowSize := (b.Width*bytesPerPixel + 3) & ^3
+	at := func(col, row int) int {
+		return luma[min(max(row, 0), b.Height-1)*b.Width+min(max(col, 0), b.Width-1)]
+	}
+	for row := range b.Height {
+		for col := range b.Width {
+			gx := at(col+1, row-1) + 2*at(col+1, row) + at(col+1, row+1) - at(col-1, row-1) - 2*at(col-1, row) - at(col-1, row+1)
+			gy := at(col-1, row+1) + 2*at(col, row+1) + at(col+1, row+1) - at(col-1, row-1) - 2*at(col, row-1) - at(col+1, row-1)
+			// the kernels weigh 4 pixels on each side, so dividing by 4 keeps a hard edge between black and white at full intensity
+			magnitude := uint8(min(math.Round(math.Hypot(float64(gx), float64(gy))/4), 255))
+			px := dst.Data[row*dstRowSize+col*bytesPerPixel:]
+			px[0], px[1], px[2] = magnitude, magnitude, magnitude
+			if bytesPerPixel == 4 {
+				px[3] = b.Data[b.dataRow(row)*rowSize+col*bytesPerPixel+3]
+			}
+		}
+	}
+	return dst, nil
+}
+
+// ConvertTo converts the BMP into a new top-down BMP with the given bit depth, the BMP itself is left unchanged.
+// This is useful for aligning a scan and a template to the same pixel format before matching, such as a 32-bit capture against a 24-bit template.
+// 32-bit output has every alpha byte set to 255, and 8-bit output stores palette indices into a fixed 256 color palette, trading color accuracy for a compact size.
+//
+// Parameters:
+//   - bitCount: The bit depth to convert to, one of 8, 24 or 32.
+//
+// Returns:
+//   - *BMP: A pointer to the converted BMP.
+//   - error: An error if the target bit depth is not supported or the pixel data of the BMP can not be read.
+func (b *BMP) ConvertTo(bitCount int) (*BMP, error) {
+	if bitCount != 8 && bitCount != 24 && bitCount != 32 {
+		return nil, fmt.Errorf("unsupported target bit count: %d, expected 8, 24 or 32", bitCount)
+	}
+	if b.Width <= 0 || b.Height <= 0 {
+		return nil, fmt.Errorf("invalid BMP dimensions: %dx%d", b.Width, b.Height)
+	}
+
+	pixels, err := b.bgrPixels()
+	if err != nil {
+		return nil, err
+	}
+
+	dst := newBlankBMP(b.Width, b.Height, bitCount)
+	if bitCount == 8 {
+		dst.ColorTable = buildPalette332()
+	} else {
+		dst.Grayscale = b.Grayscale
+	}
+	rowSize := len(dst.Data) / dst.Height
+	for row := range dst.Height {
+		rowStart := row * rowSize
+		for col := range dst.Width {
+			src := pixels[(row*dst.Width+col)*3:]
+			switch bitCount {
+			case 8:
+				dst.Data[rowStart+col] = paletteIndex332(src[2], src[1], src[0])
+			case 24:
+				copy(dst.Data[rowStart+col*3:], src[:3])
+			case 32:
+				copy(dst.Data[rowStart+col*4:], src[:3])
+				dst.Data[rowStart+col*4+3] = 255
+			}
+		}
+	}
+	return dst, nil
+}
+
+// Pixel returns the color of a single pixel, such as for checking the state of an indicator in a capture.
+//
+// Parameters:
+//   - x: The x-coordinate of the pixel, relative to the left edge of the BMP.
+//   - y: The y-coordinate of the pixel, relative to the top edge of the BMP.
+//
+// Returns:
+//   - uint8: The red channel of the pixel.
+//   - uint8: The green channel of the pixel.
+//   - uint8: The blue channel of the pixel.
+//   - error: An error if the coordinates are outside of the BMP or the pixel data of the BMP can not be read.
+func (b *BMP) Pixel(x, y int) (uint8, uint8, uint8, error) {
+	if x < 0 || y < 0 || x >= b.Width || y >= b.Height {
+		return 0, 0, 0, fmt.Errorf("pixel %d,%d is outside of the BMP of size %dx%d", x, y, b.Width, b.Height)
+	}
+	bytesPerPixel, rowSize, err := b.pixelLayout()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	offset := b.dataRow(y)*rowSize + x*bytesPerPixel
+	return b.Data[offset+2], b.Data[offset+1], b.Data[offset], nil
+}
+
+// SetPixel sets the color of a single pixel, such as for drawing markers onto a capture.
+// For 32-bit BMPs the alpha byte of the pixel is left unchanged.
+//
+// Parameters:
+//   - x: The x-coordinate of the pixel, relative to the left edge of the BMP.
+//   - y: The y-coordinate of the pixel, relative to the top edge of the BMP.
+//   - red, green, blue: The color to set the pixel to.
+//
+// Returns:
+//   - error: An error if the coordinates are outside of the BMP or the pixel data of the BMP can not be written.
+func (b *BMP) SetPixel(x, y int, red, green, blue uint8) error {
+	if x < 0 || y < 0 || x >= b.Width || y >= b.Height {
+		return fmt.Errorf("pixel %d,%d is outside of the BMP of size %dx%d", x, y, b.Width, b.Height)
+	}
+	bytesPerPixel, rowSize, err := b.pixelLayout()
+	if err != nil {
+		return err
+	}
+
+	offset := b.dataRow(y)*rowSize + x*bytesPerPixel
+	b.Data[offset] = blue
+	b.Data[offset+1] = green
+	b.Data[offset+2] = red
+	return nil
+}
+
+// Validate checks that the BMP is well-formed before it is used, such as an externally-sourced BMP about to be matched.
+// It verifies the headers, that the dimensions are positive and consistent with the info header, that the bit depth is supported,
+// and that the pixel data is exactly as large as the dimensions and bit depth require.
+// Pixel data of BMPs below 24-bit is accepted both as stored in the file and as decoded by LoadBmp into 3 bytes per pixel without row padding.
+//
+// Returns:
+//   - error: An error describing the first problem found, nil if the BMP is well-formed.
+func (b *BMP) Validate() error {
+	if b.FileHeader.Type != 0x4D42 { // 'BM'
+		return fmt.Errorf("invalid BMP file type: 0x%x", b.FileHeader.Type)
+	}
+	if b.InfoHeader.BiSize < bitmapInfoHeaderSize {
+		return fmt.Errorf("invalid BMP info header size: %d, expected at least %d", b.InfoHeader.BiSize, bitmapInfoHeaderSize)
+	}
+	if b.FileHeader.OffBits < 14+b.InfoHeader.BiSize {
+		return fmt.Errorf("invalid BMP pixel data offset: %d, the headers take %d bytes", b.FileHeader.OffBits, 14+b.InfoHeader.BiSize)
+	}
+	if b.InfoHeader.BiCompression != 0 {
+		return fmt.Errorf("unsupported BMP compression: %d", b.InfoHeader.BiCompression)
+	}
+
+	if b.Width <= 0 || b.Height <= 0 {
+		return fmt.Errorf("invalid BMP dimensions: %dx%d", b.Width, b.Height)
+	}
+	infoHeight := int(b.InfoHeader.BiHeight)
+	if infoHeight < 0 {
+		infoHeight = -infoHeight
+	}
+	if int(b.InfoHeader.BiWidth) != b.Width || infoHeight != b.Height {
+		return fmt.Errorf("BMP dimensions %dx%d do not match the info header dimensions %dx%d", b.Width, b.Height, b.InfoHeader.BiWidth, infoHeight)
+	}
+
+	bitCount := int(b.InfoHeader.BiBitCount)
+	if !slices.Contains(validBitCounts, bitCount) {
+		return fmt.Errorf("unsupported BMP bit count: %d", bitCount)
+	}
+
+	expected := calcBmpSize(b.Width, b.Height, tools.CalcBytesPerPixel(bitCount), bitCount)
+	if len(b.Data) == expected {
+		return nil
+	}
+	if bitCount < 24 && len(b.Data) == b.Width*b.Height*3 {
+		return nil
+	}
+	return fmt.Errorf("invalid BMP pixel data: expected %d bytes for a %dx%d %d-bit BMP, got %d", expected, b.Width, b.Height, bitCount, len(b.Data))
+}
+
 type bitmapInfoHeader struct {
 	BiSize          uint32
 	BiWidth         int32
@@ -81,10 +550,11 @@ type bitmapInfoHeader struct {
 	BiClrImportant  uint32
 }
 
-type bitmapInfo struct {
-	BmiHeader bitmapInfoHeader
-	BmiColors [1]uint32
-}
+// bitmapInfoHeaderSize is the size of the BITMAPINFOHEADER structure, the smallest info header supported.
+const bitmapInfoHeaderSize = uint32(unsafe.Sizeof(bitmapInfoHeader{}))
+
+// biBitfields is the BI_BITFIELDS compression mode, where uncompressed pixels are described by color masks instead of a fixed layout.
+const biBitfields = 3
 
 type bitmapHeader struct {
 	Type      uint16
@@ -100,6 +570,9 @@ type virtualScreen struct {
 	Top      int32
 	Bottom   int32
 	Displays []Display
+
+	mu        sync.Mutex
+	lastFrame *BMP // the frame captured by the previous call to CaptureChanges, nil before the first call
 }
 
 type VirtualScreen interface {
@@ -111,9 +584,80 @@ type VirtualScreen interface {
 	//
 	// Returns:
 	//   - [][]byte: A byte slice containing the bitmap data of the captured screen.
-	//   - error: An error if the capture fails.
+	//   - error: An error if the capture fails. With PartialCaptureOpt the displays that were captured are returned along with
+	//     a *DisplayCaptureError for each display that failed, joined with errors.Join.
 	CaptureBmp(options ...DisplayCaptureOption) ([]BMP, error)
 
+	// CaptureBmpCtx captures the screen like CaptureBmp, and stops early once the context is done.
+	// The context is checked between the captures of each display, and before the pixels of a display are copied,
+	// so aborting a multi-display capture happens between displays rather than after all of them.
+	// On Linux the capture command of the display in progress is killed as well.
+	//
+	// Parameters:
+	//   - ctx: The context that cancels the capture.
+	//   - options: Optional parameters for the display capture, the same as for CaptureBmp.
+	//
+	// Returns:
+	//   - []BMP: The captured bitmaps, one per display.
+	//   - error: The context's error if it is done before the capture finished, an error if the capture fails.
+	CaptureBmpCtx(ctx context.Context, options ...DisplayCaptureOption) ([]BMP, error)
+
+	// CaptureBmpTimed captures the screen like CaptureBmp, and reports how long the capture of each display took.
+	// This helps choose a realistic capture frequency, and tell which stage of the capture is slow in a given environment.
+	//
+	// Parameters:
+	//   - options: Optional parameters for the display capture, the same as for CaptureBmp.
+	//
+	// Returns:
+	//   - []BMP: The captured bitmaps, one per display.
+	//   - []CaptureTiming: The timing of each capture, in the same order as the bitmaps.
+	//   - error: An error if the capture fails.
+	CaptureBmpTimed(options ...DisplayCaptureOption) ([]BMP, []CaptureTiming, error)
+
+	// CaptureByDisplay captures the screen like CaptureBmp, and pairs each capture with the display it was taken from,
+	// so the caller does not have to rely on the captures being in the order of the displays.
+	//
+	// Parameters:
+	//   - options: Optional parameters for the display capture, such as the displays to capture, the same as for CaptureBmp.
+	//
+	// Returns:
+	//   - []DisplayCapture: The captures, one per captured display.
+	//   - error: An error if the capture fails. With PartialCaptureOpt the displays that were captured are returned along with the errors of those that failed.
+	CaptureByDisplay(options ...DisplayCaptureOption) ([]DisplayCapture, error)
+
+	// CaptureChanges captures the screen like CaptureBmp, and returns only the smallest rectangle that changed since the previous call to CaptureChanges.
+	// With DesktopDuplicationOpt the changed rectangle is taken from the dirty rects reported by the duplication instead of comparing the frames,
+	// as long as no other capture of the display was taken in between, so it may be larger than the pixels that actually changed.
+	// The previous frame is retained by the virtual screen, so monitoring a mostly static screen only hands the changed region to the matcher.
+	// The first call, and any call whose frame differs in size or pixel format from the previous one, reports the whole frame as changed.
+	// Only a single display can be captured at a time, and the capture must be 24-bit or 32-bit.
+	//
+	// Parameters:
+	//   - options: Optional parameters for the display capture, such as the display to capture, the same as for CaptureBmp.
+	//
+	// Returns:
+	//   - BMP: The changed region of the frame as a new top-down BMP, the zero value if nothing changed.
+	//   - image.Rectangle: The bounds of the changed region, relative to the top-left corner of the captured frame.
+	//   - bool: True if anything changed since the previous frame, false otherwise.
+	//   - error: An error if the capture fails, or it does not consist of a single 24-bit or 32-bit frame.
+	CaptureChanges(options ...DisplayCaptureOption) (BMP, image.Rectangle, bool, error)
+
+	// StreamCapture captures a display continuously and calls fn with every frame that differs from the previous one, until the context is done or fn returns an error.
+	// With DesktopDuplicationOpt on Windows, frames are delivered by the desktop duplication API only when the screen changes, without polling,
+	// and report the regions that changed in DirtyRects. Otherwise, or once duplication turns out to be unavailable, the display is captured every interval
+	// and frames equal to the previous one are skipped. The first frame is always delivered.
+	// Only a single display can be streamed at a time, the primary display if none is given.
+	//
+	// Parameters:
+	//   - ctx: The context that stops the stream.
+	//   - interval: How often the display is captured when change notifications are not available, non-positive values default to 100ms.
+	//   - fn: The function called with each changed frame, from the calling goroutine. Returning an error stops the stream.
+	//   - options: Optional parameters for the display capture, such as the display to stream, the same as for CaptureBmp.
+	//
+	// Returns:
+	//   - error: The context's error once it is done, the error returned by fn, or an error if a capture fails.
+	StreamCapture(ctx context.Context, interval time.Duration, fn func(frame BMP) error, options ...DisplayCaptureOption) error
+
 	// DetectDisplays detects all displays connected to the system and returns a slice of display structs.
 	// It also modifies the virtual screen Displays field to include the detected displays.
 	// If no displays are found, it returns an error.
@@ -123,6 +667,15 @@ type VirtualScreen interface {
 	//   - error: An error if the detection fails or no displays are found.
 	DetectDisplays() ([]Display, error)
 
+	// GetActiveDisplay retrieves the display the user is currently working on, the one containing the mouse cursor.
+	// This is more useful than GetPrimaryDisplay for interactive automations that should act on the monitor the user is looking at.
+	// If the cursor is not on any known display, such as when the displays changed since they were detected, the primary display is returned.
+	//
+	// Returns:
+	//   - Display: The display containing the mouse cursor.
+	//   - error: An error if the cursor position could not be retrieved, or no display is found.
+	GetActiveDisplay() (Display, error)
+
 	// GetPrimaryDisplay retrieves the primary display from the virtual screen.
 	// If no primary display is found, it returns an error.
 	//
@@ -159,6 +712,237 @@ type VirtualScreen interface {
 
 var _ VirtualScreen = (*virtualScreen)(nil) // compile-time check to ensure that virtualScreen implements VirtualScreen
 
+// CaptureWindowRegion captures the client area of a window through CaptureBmp, so every capture option applies,
+// except the displays and bounds, which are derived from the window.
+// A window spanning several displays is captured from each of them and stitched into one BMP,
+// parts of it that are not on any display, such as in a gap between displays of different sizes, are left black.
+//
+// Parameters:
+//   - vs: The virtual screen to capture from.
+//   - w: The window to capture.
+//   - options: Optional parameters for the capture, such as the bit count.
+//
+// Returns:
+//   - *BMP: The capture of the client area of the window.
+//   - error: An error if the window is minimized or entirely off screen, or the capture fails.
+func CaptureWindowRegion(vs VirtualScreen, w window.WindowInfo, options ...DisplayCaptureOption) (*BMP, error) {
+	state, err := window.State(w)
+	if err != nil {
+		return nil, err
+	}
+	if state == window.WindowMinimized {
+		return nil, errors.New("the window is minimized, restore it before capturing it")
+	}
+	bounds, err := window.ClientBounds(w)
+	if err != nil {
+		return nil, err
+	}
+
+	displays := vs.GetDisplays()
+	if len(displays) == 0 {
+		if displays, err = vs.DetectDisplays(); err != nil {
+			return nil, err
+		}
+	}
+	pieces := windowPieces(bounds, displays)
+	if len(pieces) == 0 {
+		return nil, fmt.Errorf("the window at %v is not on any display", bounds)
+	}
+
+	captures := make([]BMP, len(pieces))
+	for i, piece := range pieces {
+		pieceOptions := append(slices.Clip(options),
+			DisplaysOpt([]Display{piece.display}),
+			BoundsOpt(piece.localBounds()),
+		)
+		bitmaps, err := vs.CaptureBmp(pieceOptions...)
+		if err != nil {
+			return nil, err
+		}
+		if len(bitmaps) != 1 {
+			return nil, fmt.Errorf("expected 1 capture of the window on a display, got %d", len(bitmaps))
+		}
+		captures[i] = bitmaps[0]
+	}
+	if len(captures) == 1 && captures[0].Width == bounds.Dx() && captures[0].Height == bounds.Dy() {
+		return &captures[0], nil
+	}
+	return stitchPieces(bounds, pieces, captures)
+}
+
+func (vs *virtualScreen) CaptureBmp(options ...DisplayCaptureOption) ([]BMP, error) {
+	return vs.CaptureBmpCtx(context.Background(), options...)
+}
+
+func (vs *virtualScreen) CaptureBmpTimed(options ...DisplayCaptureOption) ([]BMP, []CaptureTiming, error) {
+	var timings []CaptureTiming
+	bitmaps, err := vs.CaptureBmpCtx(context.Background(), append(slices.Clip(options), timingsOpt(&timings))...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bitmaps, timings, nil
+}
+
+func (vs *virtualScreen) CaptureByDisplay(options ...DisplayCaptureOption) ([]DisplayCapture, error) {
+	captureOptions := &displayCaptureOption{}
+	for _, opt := range options {
+		opt(captureOptions)
+	}
+	displays := captureOptions.Displays
+	if len(displays) == 0 {
+		pd, err := vs.GetPrimaryDisplay()
+		if err != nil {
+			return nil, err
+		}
+		displays = []Display{pd}
+	}
+
+	// pin the displays so the captures are taken from exactly the ones being paired,
+	// and record the display of each capture, since a partial capture skips the displays that failed
+	var captured []Display
+	bitmaps, err := vs.CaptureBmp(append(slices.Clip(options), DisplaysOpt(displays), capturedOpt(&captured))...)
+	if err != nil && len(bitmaps) == 0 {
+		return nil, err
+	}
+	if len(bitmaps) != len(captured) {
+		return nil, fmt.Errorf("expected %d captures, got %d", len(captured), len(bitmaps))
+	}
+
+	captures := make([]DisplayCapture, len(bitmaps))
+	for i := range bitmaps {
+		captures[i] = DisplayCapture{Display: captured[i], BMP: bitmaps[i]}
+	}
+	return captures, err
+}
+
+func (vs *virtualScreen) CaptureChanges(options ...DisplayCaptureOption) (BMP, image.Rectangle, bool, error) {
+	frames, err := vs.CaptureBmp(options...)
+	if err != nil {
+		return BMP{}, image.Rectangle{}, false, err
+	}
+	if len(frames) != 1 {
+		return BMP{}, image.Rectangle{}, false, fmt.Errorf("CaptureChanges captures a single display, got %d frames", len(frames))
+	}
+	frame := &frames[0]
+	if frame.InfoHeader.BiBitCount != 24 && frame.InfoHeader.BiBitCount != 32 {
+		return BMP{}, image.Rectangle{}, false, fmt.Errorf("unsupported pixel format for change detection: %d-bit", frame.InfoHeader.BiBitCount)
+	}
+
+	vs.mu.Lock()
+	prev := vs.lastFrame
+	vs.lastFrame = frame
+	vs.mu.Unlock()
+
+	rect := image.Rect(0, 0, frame.Width, frame.Height)
+	if prev != nil && prev.Width == frame.Width && prev.Height == frame.Height && prev.InfoHeader.BiBitCount == frame.InfoHeader.BiBitCount {
+		var changed bool
+		if frame.DirtyRects != nil && frame.frameSource != 0 && frame.frameSource == prev.frameSource && frame.frameSeq == prev.frameSeq+1 {
+			// the dirty rects of a duplicated frame cover every change since the previous frame, so the frames don't have to be compared
+			rect, changed = unionRects(frame.DirtyRects)
+		} else {
+			rect, changed, err = diffBounds(prev, frame)
+			if err != nil {
+				return BMP{}, image.Rectangle{}, false, err
+			}
+		}
+		if !changed {
+			return BMP{}, image.Rectangle{}, false, nil
+		}
+	}
+
+	region, err := frame.crop(rect)
+	if err != nil {
+		return BMP{}, image.Rectangle{}, false, err
+	}
+	return *region, rect, true, nil
+}
+
+// defaultStreamInterval is how often StreamCapture captures the display without change notifications when no interval is given.
+const defaultStreamInterval = 100 * time.Millisecond
+
+func (vs *virtualScreen) StreamCapture(ctx context.Context, interval time.Duration, fn func(frame BMP) error, options ...DisplayCaptureOption) error {
+	captureOptions := &displayCaptureOption{}
+	for _, opt := range options {
+		opt(captureOptions)
+	}
+	if len(captureOptions.Displays) > 1 {
+		return fmt.Errorf("StreamCapture captures a single display, got %d", len(captureOptions.Displays))
+	}
+	if len(captureOptions.Displays) == 0 {
+		pd, err := vs.GetPrimaryDisplay()
+		if err != nil {
+			return err
+		}
+		captureOptions.Displays = []Display{pd}
+		options = append(slices.Clip(options), DisplaysOpt(captureOptions.Displays))
+	}
+	if interval <= 0 {
+		interval = defaultStreamInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	notify := true
+	var prev *BMP
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var frame *BMP
+		if notify {
+			changed, ok, err := doAwaitChange(ctx, captureOptions.Displays[0], captureOptions, prev == nil)
+			if err != nil {
+				return err
+			}
+			// without change notifications the stream falls back to capturing on the ticker for good
+			notify = ok
+			frame = changed
+		}
+		if frame == nil {
+			if prev != nil {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-ticker.C:
+				}
+			}
+			frames, err := vs.CaptureBmpCtx(ctx, options...)
+			if err != nil {
+				return err
+			}
+			if prev != nil && prev.Equal(&frames[0]) {
+				continue
+			}
+			frame = &frames[0]
+		}
+
+		if err := fn(*frame); err != nil {
+			return err
+		}
+		prev = frame
+	}
+}
+
+func (vs *virtualScreen) GetActiveDisplay() (Display, error) {
+	x, y, err := doGetCursorPosition()
+	if err != nil {
+		return Display{}, fmt.Errorf("failed to get the cursor position: %w", err)
+	}
+
+	displays := vs.Displays
+	if displays == nil {
+		displays, err = vs.DetectDisplays()
+		if err != nil {
+			return Display{}, err
+		}
+	}
+	if d, ok := displayAt(displays, x, y); ok {
+		return d, nil
+	}
+	return vs.GetPrimaryDisplay()
+}
+
 func (vs *virtualScreen) GetPrimaryDisplay() (Display, error) {
 	displays := vs.Displays
 
@@ -6,6 +6,18 @@ type displayCaptureOption struct {
 	Displays []Display
 	BitCount int      // acceptable values: 1, 4, 8, 16, 24, 32
 	Bounds   [4]int32 // left, right, top, bottom bounds for the capture area
+
+	ExcludeWindows []uintptr // handles of windows to keep out of the capture, only supported on Windows
+	WaitVSync      bool      // wait for the next composed frame before capturing, only supported on Windows
+	Grayscale      bool      // capture grayscale pixels, stored with equal color channels
+	RasterOp       uint32    // the BitBlt raster operation of the capture, zero for SRCCOPY, only supported on Windows
+	Duplication    bool      // capture with the DXGI desktop duplication API, falling back to BitBlt, only supported on Windows
+	Partial        bool      // return the displays that were captured when others fail, along with their errors
+	TopDown        bool      // store the rows of every capture top to bottom, with a negative BiHeight
+	Reuse          *BMP      // a BMP no longer in use whose pixel buffer the capture writes into, nil to allocate a new buffer, only supported on Windows
+
+	timings  *[]CaptureTiming // receives the timing of each display capture, nil if the capture is not timed
+	captured *[]Display       // receives the display of each capture, nil if they are not recorded
 }
 
 type DisplayCaptureOption func(*displayCaptureOption)
@@ -36,3 +48,106 @@ func BoundsOpt(bounds [4]int32) DisplayCaptureOption {
 		opt.Bounds = bounds
 	}
 }
+
+// ExcludeWindowOpt keeps the window with the given handle out of the capture, such as an overlay drawn by the automation itself.
+// The window is excluded from capture through its display affinity, or hidden for the duration of the capture if that is not possible, and restored afterwards.
+// It can be passed multiple times to exclude several windows. This option is only supported on Windows and is ignored elsewhere.
+//
+// Parameters:
+//   - handle: The HWND of the window to exclude.
+func ExcludeWindowOpt(handle uintptr) DisplayCaptureOption {
+	return func(opt *displayCaptureOption) {
+		opt.ExcludeWindows = append(opt.ExcludeWindows, handle)
+	}
+}
+
+// WaitVSyncOpt waits for the desktop compositor to present the next frame before each display is captured.
+// Capturing right after a frame has been composed avoids grabbing a half-rendered frame, which reduces flaky matches on animated UIs at the cost of up to one frame of latency.
+// This option is only supported on Windows, where it uses DwmFlush, and is ignored elsewhere.
+func WaitVSyncOpt() DisplayCaptureOption {
+	return func(opt *displayCaptureOption) {
+		opt.WaitVSync = true
+	}
+}
+
+// GrayscaleOpt captures grayscale pixels directly, stored as 24-bit or 32-bit BMPs whose color channels all hold the pixel's luma.
+// This saves a separate conversion pass per frame in pipelines that match in grayscale, and the returned BMPs have their Grayscale flag set.
+// On Windows the capture must use a bit count of 24 or 32, on Linux the conversion is done by ImageMagick while capturing.
+func GrayscaleOpt() DisplayCaptureOption {
+	return func(opt *displayCaptureOption) {
+		opt.Grayscale = true
+	}
+}
+
+// RasterOpOpt sets the BitBlt raster operation used to copy the screen, for specialized captures such as inverted ones.
+// The operation combines the screen with a blank bitmap, so operations that read the destination see black.
+// The default is SRCCOPY, and CAPTUREBLT can be OR-ed with any operation, or passed alone with SRCCOPY implied, to include layered windows in the capture.
+// The operations are the raster operation constants of the Windows tools package, such as NOTSRCCOPY.
+// This option is only supported on Windows and is ignored elsewhere.
+//
+// Parameters:
+//   - rop: The raster operation, 0 for SRCCOPY.
+func RasterOpOpt(rop uint32) DisplayCaptureOption {
+	return func(opt *displayCaptureOption) {
+		opt.RasterOp = rop
+	}
+}
+
+// DesktopDuplicationOpt captures with the DXGI desktop duplication API instead of BitBlt, which keeps up with high frame rates
+// and includes hardware accelerated surfaces that BitBlt misses. The captured BMPs report the regions that changed since the previous capture in DirtyRects.
+// Each display is duplicated on its first capture and the duplication is kept for later captures, see CloseDesktopDuplications.
+// The capture falls back to BitBlt when the duplication is not available, such as in a remote desktop session, on Windows before 8 or for a rotated display,
+// and for captures it does not support: bit counts other than 24 and 32, a raster operation set with RasterOpOpt, or bounds outside of a single display.
+// This option is only supported on Windows and is ignored elsewhere.
+func DesktopDuplicationOpt() DisplayCaptureOption {
+	return func(opt *displayCaptureOption) {
+		opt.Duplication = true
+	}
+}
+
+// PartialCaptureOpt keeps capturing the remaining displays when the capture of one of them fails, rather than discarding every capture.
+// The capture returns the BMPs of the displays that succeeded, in the order of the displays, together with an error joining a *DisplayCaptureError
+// for each display that failed, so a dashboard monitoring several displays still gets the ones that work. Use CaptureByDisplay to tell which displays the BMPs belong to.
+// A context that is done still stops the whole capture.
+func PartialCaptureOpt() DisplayCaptureOption {
+	return func(opt *displayCaptureOption) {
+		opt.Partial = true
+	}
+}
+
+// TopDownOpt stores the rows of every captured BMP from top to bottom, marked by a negative BiHeight, regardless of the platform.
+// Captures on Windows are always top-down, while the BMPs ImageMagick writes on Linux are bottom-up, so code reading the pixel data directly
+// would otherwise have to check the sign of BiHeight. ToBinary writes the negative BiHeight, so the serialized file stays a valid top-down BMP.
+func TopDownOpt() DisplayCaptureOption {
+	return func(opt *displayCaptureOption) {
+		opt.TopDown = true
+	}
+}
+
+// ReuseBufferOpt captures into the pixel buffer of a BMP that is no longer in use, instead of allocating a new buffer for every capture,
+// which saves an allocation per frame when the same region is captured over and over, such as by a watcher polling it.
+// The buffer is only reused when it is large enough, and only by the first display captured, so the captures of several displays never share it.
+// The pixels of bmp are overwritten, it must not be read after the capture other than through the returned BMP.
+// This option is only supported on Windows and is ignored elsewhere, where the capture is decoded from the output of ImageMagick.
+//
+// Parameters:
+//   - bmp: The BMP whose pixel buffer is reused, nil to allocate a new buffer.
+func ReuseBufferOpt(bmp *BMP) DisplayCaptureOption {
+	return func(opt *displayCaptureOption) {
+		opt.Reuse = bmp
+	}
+}
+
+// timingsOpt records the timing of each display capture into timings, used by CaptureBmpTimed.
+func timingsOpt(timings *[]CaptureTiming) DisplayCaptureOption {
+	return func(opt *displayCaptureOption) {
+		opt.timings = timings
+	}
+}
+
+// capturedOpt records the display of each capture into captured, used by CaptureByDisplay to pair partial captures with their displays.
+func capturedOpt(captured *[]Display) DisplayCaptureOption {
+	return func(opt *displayCaptureOption) {
+		opt.captured = captured
+	}
+}
@@ -1,11 +1,138 @@
 package display
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"unsafe"
+	"image"
+	_ "image/jpeg" // registers the JPEG decoder for LoadImage
+	_ "image/png"  // registers the PNG decoder for LoadImage
+	"math"
+	"slices"
+	"time"
 )
 
+// NewBMP creates a new top-down 24-bit BMP of the given size filled with a solid color.
+// The headers are filled in so the BMP can be serialized with ToBinary, and each row is padded to 4 bytes like any other 24-bit BMP.
+// This is useful for building synthetic images, such as a background to Paste a template into, or a mask.
+//
+// Parameters:
+//   - width: The width of the BMP in pixels, must be greater than 0.
+//   - height: The height of the BMP in pixels, must be greater than 0.
+//   - r: The red component of the fill color.
+//   - g: The green component of the fill color.
+//   - b: The blue component of the fill color.
+//
+// Returns:
+//   - *BMP: A pointer to the new BMP, or nil if the width or height is not greater than 0.
+func NewBMP(width, height int, r, g, b uint8) *BMP {
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+
+	bmp := newBlankBMP(width, height, 24)
+	rowSize := (width*3 + 3) & ^3
+	for row := range height {
+		rowStart := row * rowSize
+		for col := range width {
+			// pixels are stored in BGR order
+			pixelStart := rowStart + col*3
+			bmp.Data[pixelStart] = b
+			bmp.Data[pixelStart+1] = g
+			bmp.Data[pixelStart+2] = r
+		}
+	}
+	return bmp
+}
+
+// newBlankBMP creates a new top-down BMP of the given size and bit depth with zeroed pixel data and filled in headers.
+// 8-bit BMPs get room for a full 256 entry color table between the headers and the pixel data, the table itself is left for the caller to fill.
+//
+// Parameters:
+//   - width: The width of the BMP in pixels.
+//   - height: The height of the BMP in pixels.
+//   - bitCount: The bit depth of the BMP, one of 8, 24 or 32.
+//
+// Returns:
+//   - *BMP: A pointer to the new BMP.
+func newBlankBMP(width, height, bitCount int) *BMP {
+	return newBMPInto(make([]byte, calcBmpSize(width, height, bitCount/8, bitCount)), width, height, bitCount)
+}
+
+// newBMPInto creates a BMP of the given size and bit depth around a zeroed pixel buffer, with the same headers as newBlankBMP.
+//
+// Parameters:
+//   - data: The pixel buffer, exactly the size of the pixel data of the BMP.
+//   - width: The width of the BMP.
+//   - height: The height of the BMP.
+//   - bitCount: The bit depth of the BMP.
+//
+// Returns:
+//   - *BMP: A pointer to the new BMP.
+func newBMPInto(data []byte, width, height, bitCount int) *BMP {
+
+	ppm := calcPixelsPerMeter(96)
+	infoHeader := buildBitMapInfoHeader(int32(width), int32(height), ppm, ppm, uint16(bitCount), 0)
+	infoHeader.BiSizeImage = uint32(len(data))
+	headerSize := infoHeader.BiSize
+	if bitCount == 8 {
+		infoHeader.BiClrUsed = 256
+		headerSize += 256 * 4
+	}
+	fileHeader := buildBitMapHeader(headerSize, uint32(len(data)))
+
+	return &BMP{
+		FileHeader: *fileHeader,
+		InfoHeader: *infoHeader,
+		Data:       data,
+		Width:      width,
+		Height:     height,
+	}
+}
+
+// LoadImage decodes BMP, PNG or JPEG data from a byte slice into a BMP, the format is detected from the data itself.
+// BMP data is parsed with LoadBmp, while PNG and JPEG data is decoded into a new top-down 24-bit BMP, any alpha channel is dropped.
+// This is useful for templates that are embedded into the binary as regular image assets.
+//
+// Parameters:
+//   - data: A byte slice containing the encoded image.
+//
+// Returns:
+//   - *BMP: A pointer to a BMP struct containing the decoded image.
+//   - error: An error if the data is not a supported image format or can not be decoded.
+func LoadImage(data []byte) (*BMP, error) {
+	if bytes.HasPrefix(data, []byte("BM")) {
+		return LoadBmp(data)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	bmp := NewBMP(bounds.Dx(), bounds.Dy(), 0, 0, 0)
+	if bmp == nil {
+		return nil, fmt.Errorf("invalid %s image size: %dx%d", format, bounds.Dx(), bounds.Dy())
+	}
+
+	rowSize := (bmp.Width*3 + 3) & ^3
+	for row := range bmp.Height {
+		rowStart := row * rowSize
+		for col := range bmp.Width {
+			r, g, b, _ := img.At(bounds.Min.X+col, bounds.Min.Y+row).RGBA()
+			// pixels are stored in BGR order, and RGBA returns 16-bit components
+			pixelStart := rowStart + col*3
+			bmp.Data[pixelStart] = uint8(b >> 8)
+			bmp.Data[pixelStart+1] = uint8(g >> 8)
+			bmp.Data[pixelStart+2] = uint8(r >> 8)
+		}
+	}
+	return bmp, nil
+}
+
 // LoadBmp parses BMP data from a byte slice and extracts the raw pixel data, width, and height.
 //
 // Parameters:
@@ -47,32 +174,94 @@ func LoadBmp(data []byte) (*BMP, error) {
 		BiClrImportant:  binary.LittleEndian.Uint32(data[50:54]),
 	}
 
+	// V4 and V5 headers extend the info header with color masks and color space fields, which only matter for bitfield masks,
+	// the pixel data is still located through OffBits
+	if infoHeader.BiSize < bitmapInfoHeaderSize {
+		return nil, fmt.Errorf("unsupported BMP info header size: %d, expected at least %d", infoHeader.BiSize, bitmapInfoHeaderSize)
+	}
+	if len(data) < 14+int(infoHeader.BiSize) {
+		return nil, fmt.Errorf("invalid BMP data: too small for a %d byte info header", infoHeader.BiSize)
+	}
+
 	// Validate the BMP format
+	// masks describing the usual pixel layout, which is common for V4 and V5 headers, are the same as no compression at all
+	bitfields := infoHeader.BiCompression == biBitfields
+	if bitfields {
+		if err := validateBitfieldMasks(data, infoHeader); err != nil {
+			return nil, err
+		}
+		infoHeader.BiCompression = 0
+	}
 	if infoHeader.BiCompression != 0 {
 		return nil, fmt.Errorf("unsupported BMP format (must be uncompressed)")
 	}
 
+	var bmp *BMP
+	var err error
 	switch infoHeader.BiBitCount {
 	case 32:
-		return processBmp32bit(data, fileHeader, infoHeader)
+		bmp, err = processBmp32bit(data, fileHeader, infoHeader)
 	case 24:
-		return processBmp24bit(data, fileHeader, infoHeader)
+		bmp, err = processBmp24bit(data, fileHeader, infoHeader)
 	case 16:
-		return processBmp16bit(data, fileHeader, infoHeader)
+		bmp, err = processBmp16bit(data, fileHeader, infoHeader)
 	case 8:
-		return processBmp8bit(data, fileHeader, infoHeader)
+		bmp, err = processBmp8bit(data, fileHeader, infoHeader)
 	case 4:
-		return processBmp4bit(data, fileHeader, infoHeader)
+		bmp, err = processBmp4bit(data, fileHeader, infoHeader)
 	case 1:
-		return processBmp1bit(data, fileHeader, infoHeader)
+		bmp, err = processBmp1bit(data, fileHeader, infoHeader)
 	default:
 		return nil, fmt.Errorf("unsupported BMP bit count: %d", infoHeader.BiBitCount)
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	// ToBinary only writes a BITMAPINFOHEADER, so the headers are reduced to one and the offsets moved back by the bytes that are dropped,
+	// the extended header fields and any masks following a BITMAPINFOHEADER
+	dropped := bmp.InfoHeader.BiSize - bitmapInfoHeaderSize
+	if bitfields && bmp.InfoHeader.BiSize == bitmapInfoHeaderSize {
+		dropped = 12
+	}
+	bmp.InfoHeader.BiSize = bitmapInfoHeaderSize
+	bmp.FileHeader.OffBits -= dropped
+	bmp.FileHeader.Size -= min(dropped, bmp.FileHeader.Size)
+	return bmp, nil
+}
+
+// validateBitfieldMasks checks that the color masks of a BI_BITFIELDS BMP describe the layout the pixel data is decoded with,
+// 8 bits per channel in BGRA order for 32-bit BMPs, and 5-6-5 bits per channel for 16-bit BMPs.
+// The masks follow a BITMAPINFOHEADER, and are the first fields past it in V4 and V5 headers, so they are at the same offset either way.
+//
+// Parameters:
+//   - data: The BMP file data.
+//   - infoHeader: The info header of the BMP.
+//
+// Returns:
+//   - error: An error if the masks are missing or describe a different layout.
+func validateBitfieldMasks(data []byte, infoHeader bitmapInfoHeader) error {
+	masksOffset := 14 + int(bitmapInfoHeaderSize)
+	if len(data) < masksOffset+12 {
+		return fmt.Errorf("invalid BMP data: too small for the bitfield masks")
+	}
+	red := binary.LittleEndian.Uint32(data[masksOffset : masksOffset+4])
+	green := binary.LittleEndian.Uint32(data[masksOffset+4 : masksOffset+8])
+	blue := binary.LittleEndian.Uint32(data[masksOffset+8 : masksOffset+12])
+
+	switch {
+	case infoHeader.BiBitCount == 32 && red == 0x00FF0000 && green == 0x0000FF00 && blue == 0x000000FF:
+		return nil
+	case infoHeader.BiBitCount == 16 && red == 0xF800 && green == 0x07E0 && blue == 0x001F:
+		return nil
+	default:
+		return fmt.Errorf("unsupported %d-bit BMP bitfield masks: red 0x%x, green 0x%x, blue 0x%x", infoHeader.BiBitCount, red, green, blue)
+	}
 }
 
 func buildBitMapInfoHeader(width, height, ppmX, ppmY int32, bitCount uint16, compressionMode uint32) *bitmapInfoHeader {
 	return &bitmapInfoHeader{
-		BiSize:          uint32(unsafe.Sizeof(bitmapInfoHeader{})),
+		BiSize:          bitmapInfoHeaderSize,
 		BiWidth:         width,
 		BiHeight:        -height,
 		BiPlanes:        1,
@@ -238,7 +427,7 @@ func processBmp8bit(data []byte, fileHeader bitmapHeader, infoHeader bitmapInfoH
 		dstOffset := y * width * 3
 		for x := 0; x < width; x++ {
 			// Get the color index
-			colorIndex := rawPixelData[srcOffset+x]
+			colorIndex := int(rawPixelData[srcOffset+x])
 
 			// Look up the RGB values in the color table
 			blue := colorTable[colorIndex*4+0]
@@ -370,3 +559,610 @@ func processBmp1bit(data []byte, fileHeader bitmapHeader, infoHeader bitmapInfoH
 
 	return &BMP{FileHeader: fileHeader, InfoHeader: infoHeader, Data: pixelData, Width: width, Height: height}, nil
 }
+
+// pixelLayout returns the number of bytes per pixel and the row size of the BMP's pixel data.
+// 24 and 32 bit data is stored as is with each row padded to 4 bytes, while lower bit depths are decoded by LoadBmp into 3 bytes per pixel without row padding.
+//
+// Returns:
+//   - int: The number of bytes per pixel in the pixel data.
+//   - int: The size of a row in the pixel data, including padding.
+//   - error: An error if the layout of the pixel data cannot be determined or does not match the dimensions of the BMP.
+func (b *BMP) pixelLayout() (int, int, error) {
+	var bytesPerPixel, rowSize int
+	switch {
+	case b.InfoHeader.BiBitCount == 32:
+		bytesPerPixel = 4
+		rowSize = (b.Width*4 + 3) & ^3
+	case b.InfoHeader.BiBitCount == 24:
+		bytesPerPixel = 3
+		rowSize = (b.Width*3 + 3) & ^3
+	case len(b.Data) == b.Width*b.Height*3:
+		bytesPerPixel = 3
+		rowSize = b.Width * 3
+	default:
+		return 0, 0, fmt.Errorf("unsupported pixel data layout for %d bit BMP", b.InfoHeader.BiBitCount)
+	}
+
+	if len(b.Data) < rowSize*b.Height {
+		return 0, 0, fmt.Errorf("invalid BMP data: expected at least %d bytes of pixel data, got %d", rowSize*b.Height, len(b.Data))
+	}
+	return bytesPerPixel, rowSize, nil
+}
+
+// dataRow maps a row counted from the top of the image to the row index in the BMP's pixel data, accounting for bottom-up BMPs.
+//
+// Parameters:
+//   - row: The row counted from the top of the image.
+//
+// Returns:
+//   - int: The index of the row in the pixel data.
+func (b *BMP) dataRow(row int) int {
+	if b.InfoHeader.BiHeight > 0 {
+		return b.Height - 1 - row
+	}
+	return row
+}
+
+// flipTopDown reverses the rows of a bottom-up BMP in place and negates its BiHeight, so it is stored top-down. A top-down BMP is left unchanged.
+// The rows are swapped as they are stored, so it works for every bit depth, including the row padding.
+func (b *BMP) flipTopDown() {
+	if b.InfoHeader.BiHeight <= 0 || b.Height <= 1 {
+		return
+	}
+	rowSize := len(b.Data) / b.Height
+	tmp := make([]byte, rowSize)
+	for top, bottom := 0, b.Height-1; top < bottom; top, bottom = top+1, bottom-1 {
+		topRow := b.Data[top*rowSize : (top+1)*rowSize]
+		bottomRow := b.Data[bottom*rowSize : (bottom+1)*rowSize]
+		copy(tmp, topRow)
+		copy(topRow, bottomRow)
+		copy(bottomRow, tmp)
+	}
+	b.InfoHeader.BiHeight = -b.InfoHeader.BiHeight
+}
+
+// bgrPixels returns the pixels of the BMP as top-down rows of 3 byte BGR pixels without row padding, regardless of how the BMP is stored.
+// Besides the layouts handled by pixelLayout, 8-bit BMPs holding palette indices, such as those created by ConvertTo, are resolved through the color table.
+//
+// Returns:
+//   - []byte: The BGR pixel data of the BMP.
+//   - error: An error if the layout of the pixel data is not supported.
+func (b *BMP) bgrPixels() ([]byte, error) {
+	pixels := make([]byte, b.Width*b.Height*3)
+
+	if b.InfoHeader.BiBitCount == 8 && len(b.Data) == calcBmpSize(b.Width, b.Height, 1, 8) {
+		rowSize := (b.Width + 3) & ^3
+		for row := range b.Height {
+			srcOffset := b.dataRow(row) * rowSize
+			for col := range b.Width {
+				entry := b.ColorTable[b.Data[srcOffset+col]]
+				copy(pixels[(row*b.Width+col)*3:], entry[:3])
+			}
+		}
+		return pixels, nil
+	}
+
+	bytesPerPixel, rowSize, err := b.pixelLayout()
+	if err != nil {
+		return nil, err
+	}
+	for row := range b.Height {
+		srcOffset := b.dataRow(row) * rowSize
+		for col := range b.Width {
+			src := srcOffset + col*bytesPerPixel
+			copy(pixels[(row*b.Width+col)*3:], b.Data[src:src+3])
+		}
+	}
+	return pixels, nil
+}
+
+// buildPalette332 builds a fixed 256 color palette with 3 bits of red, 3 bits of green and 2 bits of blue, spread evenly over the full range of each channel.
+// The index of a color is its quantized channels packed as RRRGGGBB, see paletteIndex332.
+//
+// Returns:
+//   - [256][4]uint8: The palette as BMP color table entries in BGR order with a reserved zero byte.
+func buildPalette332() [256][4]uint8 {
+	var palette [256][4]uint8
+	for i := range palette {
+		palette[i] = [4]uint8{
+			uint8((i & 0x03) * 255 / 3),
+			uint8((i >> 2 & 0x07) * 255 / 7),
+			uint8((i >> 5) * 255 / 7),
+			0,
+		}
+	}
+	return palette
+}
+
+// paletteIndex332 maps a color to the nearest entry of the palette built by buildPalette332.
+//
+// Parameters:
+//   - r: The red component of the color.
+//   - g: The green component of the color.
+//   - b: The blue component of the color.
+//
+// Returns:
+//   - uint8: The index of the nearest palette entry.
+func paletteIndex332(r, g, b uint8) uint8 {
+	ri := (int(r)*7 + 127) / 255
+	gi := (int(g)*7 + 127) / 255
+	bi := (int(b)*3 + 127) / 255
+	return uint8(ri<<5 | gi<<2 | bi)
+}
+
+// grayscalePixels replaces the color channels of every pixel with the pixel's luma in place, using the ITU-R BT.601 weights.
+// The pixel data must be 24-bit or 32-bit with each row padded to 4 bytes, the alpha channel of 32-bit pixels is left untouched.
+//
+// Parameters:
+//   - data: The pixel data to convert.
+//   - width: The width of the image in pixels.
+//   - height: The height of the image in pixels.
+//   - bytesPerPixel: The number of bytes per pixel, 3 or 4.
+func grayscalePixels(data []byte, width, height, bytesPerPixel int) {
+	rowSize := (width*bytesPerPixel + 3) & ^3
+	for row := range height {
+		rowStart := row * rowSize
+		for col := range width {
+			// pixels are stored in BGR order
+			px := data[rowStart+col*bytesPerPixel : rowStart+col*bytesPerPixel+3]
+			luma := uint8((114*int(px[0]) + 587*int(px[1]) + 299*int(px[2]) + 500) / 1000)
+			px[0], px[1], px[2] = luma, luma, luma
+		}
+	}
+}
+
+// gaussianKernel builds a normalized one-dimensional Gaussian kernel, used by GaussianBlur.
+//
+// Parameters:
+//   - sigma: The standard deviation of the Gaussian in pixels, greater than zero.
+//
+// Returns:
+//   - []float64: The weights of the kernel, which sum to 1, spanning three standard deviations on each side of its center.
+func gaussianKernel(sigma float64) []float64 {
+	half := int(math.Ceil(3 * sigma))
+	kernel := make([]float64, 2*half+1)
+	sum := 0.0
+	for i := range kernel {
+		d := float64(i - half)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// windowPiece is the part of a window that is on a single display.
+type windowPiece struct {
+	display Display
+	rect    image.Rectangle // the part of the window on the display, in virtual screen coordinates
+}
+
+// windowPieces splits the bounds of a window into the parts that are on each display.
+//
+// Parameters:
+//   - bounds: The bounds of the window, in virtual screen coordinates.
+//   - displays: The displays of the virtual screen.
+//
+// Returns:
+//   - []windowPiece: The non-empty intersections of the window with each display, in the order of the displays, none if the window is off screen.
+func windowPieces(bounds image.Rectangle, displays []Display) []windowPiece {
+	var pieces []windowPiece
+	for _, d := range displays {
+		displayRect := image.Rect(int(d.X), int(d.Y), int(d.X)+d.Width, int(d.Y)+d.Height)
+		if rect := bounds.Intersect(displayRect); !rect.Empty() {
+			pieces = append(pieces, windowPiece{display: d, rect: rect})
+		}
+	}
+	return pieces
+}
+
+// localBounds converts the part of the window on the display to the bounds of a capture of that display.
+//
+// Returns:
+//   - [4]int32: The left, right, top and bottom of the part, relative to the top-left corner of the display, as taken by BoundsOpt.
+func (p windowPiece) localBounds() [4]int32 {
+	local := p.rect.Sub(image.Pt(int(p.display.X), int(p.display.Y)))
+	return [4]int32{int32(local.Min.X), int32(local.Max.X), int32(local.Min.Y), int32(local.Max.Y)}
+}
+
+// stitchPieces combines the captures of the parts of a window on each display into a single BMP of the whole window.
+// The BMP has the pixel format of the first capture, and the parts of the window without a capture are left black.
+//
+// Parameters:
+//   - bounds: The bounds of the window, in virtual screen coordinates.
+//   - pieces: The parts of the window on each display.
+//   - captures: The capture of each piece, in the same order.
+//
+// Returns:
+//   - *BMP: The stitched BMP, top-down.
+//   - error: An error if the captures have different or unsupported pixel formats, or do not match the size of their piece.
+func stitchPieces(bounds image.Rectangle, pieces []windowPiece, captures []BMP) (*BMP, error) {
+	bitCount := int(captures[0].InfoHeader.BiBitCount)
+	if bitCount != 8 && bitCount != 24 && bitCount != 32 {
+		return nil, fmt.Errorf("stitching a window spanning several displays requires an 8, 24 or 32-bit capture, got %d-bit", bitCount)
+	}
+	stitched := newBlankBMP(bounds.Dx(), bounds.Dy(), bitCount)
+	stitched.ColorTable = captures[0].ColorTable
+	stitched.Grayscale = captures[0].Grayscale
+
+	for i, piece := range pieces {
+		capture := &captures[i]
+		if capture.Width != piece.rect.Dx() || capture.Height != piece.rect.Dy() {
+			return nil, fmt.Errorf("capture of size %dx%d does not match the window piece %v", capture.Width, capture.Height, piece.rect)
+		}
+		offset := piece.rect.Min.Sub(bounds.Min)
+		if err := stitched.Paste(capture, offset.X, offset.Y); err != nil {
+			return nil, err
+		}
+	}
+	return stitched, nil
+}
+
+// displayAt finds the display containing a point of the virtual screen.
+//
+// Parameters:
+//   - displays: The displays to search.
+//   - x: The x-coordinate of the point.
+//   - y: The y-coordinate of the point.
+//
+// Returns:
+//   - Display: The first display whose bounds contain the point.
+//   - bool: True if a display contains the point, false otherwise.
+func displayAt(displays []Display, x, y int32) (Display, bool) {
+	for _, d := range displays {
+		if d.Contains(x, y) {
+			return d, true
+		}
+	}
+	return Display{}, false
+}
+
+// diffBounds finds the smallest rectangle containing every pixel that differs between two BMPs of the same size and pixel format.
+//
+// Parameters:
+//   - prev: The earlier BMP.
+//   - cur: The later BMP.
+//
+// Returns:
+//   - image.Rectangle: The bounds of the differing pixels, relative to the top-left corner of the BMPs.
+//   - bool: True if any pixel differs, false otherwise.
+//   - error: An error if the pixel data of either BMP can not be read.
+func diffBounds(prev, cur *BMP) (image.Rectangle, bool, error) {
+	prevBytesPerPixel, prevRowSize, err := prev.pixelLayout()
+	if err != nil {
+		return image.Rectangle{}, false, err
+	}
+	bytesPerPixel, rowSize, err := cur.pixelLayout()
+	if err != nil {
+		return image.Rectangle{}, false, err
+	}
+	if bytesPerPixel != prevBytesPerPixel {
+		return image.Rectangle{}, false, fmt.Errorf("pixel formats differ: %d and %d bytes per pixel", prevBytesPerPixel, bytesPerPixel)
+	}
+
+	rowBytes := cur.Width * bytesPerPixel
+	bounds := image.Rectangle{}
+	changed := false
+	for row := range cur.Height {
+		prevOffset := prev.dataRow(row) * prevRowSize
+		curOffset := cur.dataRow(row) * rowSize
+		prevRow := prev.Data[prevOffset : prevOffset+rowBytes]
+		curRow := cur.Data[curOffset : curOffset+rowBytes]
+		if bytes.Equal(prevRow, curRow) {
+			continue
+		}
+
+		// only the columns outside of the bounds found so far can widen them, so scan inwards from both ends of the row
+		left := 0
+		for left < cur.Width && bytes.Equal(prevRow[left*bytesPerPixel:(left+1)*bytesPerPixel], curRow[left*bytesPerPixel:(left+1)*bytesPerPixel]) {
+			left++
+		}
+		right := cur.Width
+		for right > left && bytes.Equal(prevRow[(right-1)*bytesPerPixel:right*bytesPerPixel], curRow[(right-1)*bytesPerPixel:right*bytesPerPixel]) {
+			right--
+		}
+
+		rowBounds := image.Rect(left, row, right, row+1)
+		if changed {
+			bounds = bounds.Union(rowBounds)
+		} else {
+			bounds = rowBounds
+			changed = true
+		}
+	}
+	return bounds, changed, nil
+}
+
+// diffRects finds the groups of touching pixels that differ by more than a tolerance between two BMPs of the same size and pixel format.
+// Each row is scanned for runs of changed pixels, and a run is merged into every group it touches on the row above or its own row,
+// so the rows are only compared once and no mask of the changed pixels is kept.
+//
+// Parameters:
+//   - prev: The earlier BMP.
+//   - cur: The later BMP.
+//   - tolerance: The largest difference of a color channel that is not a change.
+//
+// Returns:
+//   - []image.Rectangle: The bounds of each group of changed pixels, relative to the top-left corner of the BMPs, ordered from top to bottom and left to right.
+//   - error: An error if the pixel formats differ or the pixel data of either BMP can not be read.
+func diffRects(prev, cur *BMP, tolerance uint8) ([]image.Rectangle, error) {
+	prevBytesPerPixel, prevRowSize, err := prev.pixelLayout()
+	if err != nil {
+		return nil, err
+	}
+	bytesPerPixel, rowSize, err := cur.pixelLayout()
+	if err != nil {
+		return nil, err
+	}
+	if bytesPerPixel != prevBytesPerPixel {
+		return nil, fmt.Errorf("pixel formats differ: %d and %d bytes per pixel", prevBytesPerPixel, bytesPerPixel)
+	}
+
+	rowBytes := cur.Width * bytesPerPixel
+	var open, closed []image.Rectangle
+	for row := range cur.Height {
+		prevOffset := prev.dataRow(row) * prevRowSize
+		curOffset := cur.dataRow(row) * rowSize
+		prevRow := prev.Data[prevOffset : prevOffset+rowBytes]
+		curRow := cur.Data[curOffset : curOffset+rowBytes]
+
+		// a group that did not grow on the previous row can not touch this one
+		for i := 0; i < len(open); {
+			if open[i].Max.Y < row {
+				closed = append(closed, open[i])
+				open[i] = open[len(open)-1]
+				open = open[:len(open)-1]
+				continue
+			}
+			i++
+		}
+		if bytes.Equal(prevRow, curRow) {
+			continue
+		}
+
+		for x := 0; x < cur.Width; {
+			if !pixelChanged(prevRow, curRow, x*bytesPerPixel, tolerance) {
+				x++
+				continue
+			}
+			start := x
+			for x < cur.Width && pixelChanged(prevRow, curRow, x*bytesPerPixel, tolerance) {
+				x++
+			}
+
+			run := image.Rect(start, row, x, row+1)
+			for i := 0; i < len(open); {
+				// runs touching diagonally belong to the same group
+				if open[i].Min.X <= run.Max.X && run.Min.X <= open[i].Max.X {
+					run = run.Union(open[i])
+					open[i] = open[len(open)-1]
+					open = open[:len(open)-1]
+					continue
+				}
+				i++
+			}
+			open = append(open, run)
+		}
+	}
+	rects := append(closed, open...)
+
+	// the bounds of groups shaped like an L or a U can overlap the bounds of another group, which are reported as one
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(rects) && !merged; i++ {
+			for j := i + 1; j < len(rects); j++ {
+				if rects[i].Overlaps(rects[j]) {
+					rects[i] = rects[i].Union(rects[j])
+					rects = slices.Delete(rects, j, j+1)
+					merged = true
+					break
+				}
+			}
+		}
+	}
+	slices.SortFunc(rects, func(a, b image.Rectangle) int {
+		if a.Min.Y != b.Min.Y {
+			return a.Min.Y - b.Min.Y
+		}
+		return a.Min.X - b.Min.X
+	})
+	return rects, nil
+}
+
+// pixelChanged reports whether any color channel of a pixel differs by more than a tolerance between two rows, ignoring the alpha byte of 32-bit pixels.
+//
+// Parameters:
+//   - prevRow: The row of the earlier BMP.
+//   - curRow: The row of the later BMP.
+//   - offset: The offset of the pixel within both rows.
+//   - tolerance: The largest difference of a color channel that is not a change.
+//
+// Returns:
+//   - bool: True if the pixel changed, false otherwise.
+func pixelChanged(prevRow, curRow []byte, offset int, tolerance uint8) bool {
+	for c := range 3 {
+		a, b := prevRow[offset+c], curRow[offset+c]
+		if a > b && a-b > tolerance || b > a && b-a > tolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// crop copies the pixels within the given rectangle into a new top-down BMP with the same bit depth.
+//
+// Parameters:
+//   - rect: The region to copy, relative to the top-left corner of the BMP.
+//
+// Returns:
+//   - *BMP: A pointer to the new BMP.
+//   - error: An error if the rectangle is empty or not within the BMP, or the pixel data of the BMP can not be read.
+func (b *BMP) crop(rect image.Rectangle) (*BMP, error) {
+	if rect.Empty() || !rect.In(image.Rect(0, 0, b.Width, b.Height)) {
+		return nil, fmt.Errorf("crop region %v is not within the BMP of size %dx%d", rect, b.Width, b.Height)
+	}
+	bytesPerPixel, rowSize, err := b.pixelLayout()
+	if err != nil {
+		return nil, err
+	}
+
+	dst := newBlankBMP(rect.Dx(), rect.Dy(), bytesPerPixel*8)
+	dst.Grayscale = b.Grayscale
+	dstRowSize := (dst.Width*bytesPerPixel + 3) & ^3
+	rowBytes := dst.Width * bytesPerPixel
+	for row := range dst.Height {
+		srcOffset := b.dataRow(rect.Min.Y+row)*rowSize + rect.Min.X*bytesPerPixel
+		copy(dst.Data[row*dstRowSize:row*dstRowSize+rowBytes], b.Data[srcOffset:srcOffset+rowBytes])
+	}
+	return dst, nil
+}
+
+// bgraFrameToBMP copies a region of a frame of top-down 4 byte BGRA pixel rows, such as a frame of the desktop duplication API, into a new top-down BMP.
+// For a 24-bit BMP the alpha channel is dropped, for a 32-bit BMP it is copied as is.
+//
+// Parameters:
+//   - pixels: The pixels of the frame.
+//   - pitch: The number of bytes between the starts of two rows of the frame, at least 4 bytes per pixel of its width.
+//   - region: The region of the frame to copy, relative to its top-left corner.
+//   - bitCount: The bit depth of the BMP, 24 or 32.
+//   - newBuffer: Returns the zeroed pixel buffer of the BMP for its size, nil to allocate a new one.
+//
+// Returns:
+//   - *BMP: A pointer to the new BMP.
+//   - error: An error if the bit depth is not supported, the region is empty, or the region does not fit in the pixels.
+func bgraFrameToBMP(pixels []byte, pitch int, region image.Rectangle, bitCount int, newBuffer func(size int) []byte) (*BMP, error) {
+	if bitCount != 24 && bitCount != 32 {
+		return nil, fmt.Errorf("unsupported bit count for a BGRA frame: %d", bitCount)
+	}
+	if region.Empty() || region.Min.X < 0 || region.Min.Y < 0 || region.Max.X*4 > pitch || region.Max.Y*pitch > len(pixels) {
+		return nil, fmt.Errorf("region %v is not within the frame", region)
+	}
+
+	bytesPerPixel := bitCount / 8
+	if newBuffer == nil {
+		newBuffer = func(size int) []byte { return make([]byte, size) }
+	}
+	bmp := newBMPInto(newBuffer(calcBmpSize(region.Dx(), region.Dy(), bytesPerPixel, bitCount)), region.Dx(), region.Dy(), bitCount)
+	rowSize := (bmp.Width*bytesPerPixel + 3) & ^3
+	for row := range bmp.Height {
+		src := pixels[(region.Min.Y+row)*pitch+region.Min.X*4:]
+		dst := bmp.Data[row*rowSize:]
+		if bytesPerPixel == 4 {
+			copy(dst[:bmp.Width*4], src)
+			continue
+		}
+		for col := range bmp.Width {
+			copy(dst[col*3:col*3+3], src[col*4:col*4+3])
+		}
+	}
+	return bmp, nil
+}
+
+// dirtyRectsIn translates the dirty rects of a frame into a region of it, dropping the parts outside of the region.
+//
+// Parameters:
+//   - rects: The dirty rects, relative to the top-left corner of the frame.
+//   - region: The region of the frame, relative to its top-left corner.
+//
+// Returns:
+//   - []image.Rectangle: The non-empty parts of the dirty rects within the region, relative to its top-left corner, nil if rects is nil.
+func dirtyRectsIn(rects []image.Rectangle, region image.Rectangle) []image.Rectangle {
+	if rects == nil {
+		return nil
+	}
+	inRegion := []image.Rectangle{}
+	for _, r := range rects {
+		if r = r.Intersect(region); !r.Empty() {
+			inRegion = append(inRegion, r.Sub(region.Min))
+		}
+	}
+	return inRegion
+}
+
+// unionRects returns the smallest rectangle containing all of the given rectangles.
+//
+// Parameters:
+//   - rects: The rectangles.
+//
+// Returns:
+//   - image.Rectangle: The union of the rectangles.
+//   - bool: False if there are no non-empty rectangles, true otherwise.
+func unionRects(rects []image.Rectangle) (image.Rectangle, bool) {
+	var union image.Rectangle
+	for _, r := range rects {
+		union = union.Union(r)
+	}
+	return union, !union.Empty()
+}
+
+// pixelBuffer returns a zeroed pixel buffer of the given size for a capture, reusing the buffer of the BMP given with ReuseBufferOpt when it is large enough.
+// The BMP is given up after the first call, so the captures of several displays never share its buffer.
+//
+// Parameters:
+//   - size: The size of the buffer in bytes.
+//
+// Returns:
+//   - []byte: The buffer.
+func (opt *displayCaptureOption) pixelBuffer(size int) []byte {
+	reuse := opt.Reuse
+	opt.Reuse = nil
+	if reuse == nil || cap(reuse.Data) < size {
+		return make([]byte, size)
+	}
+	buf := reuse.Data[:size]
+	clear(buf)
+	return buf
+}
+
+// captureDisplays captures each display in order, recording the timing and the display of every capture when the options ask for them.
+// The capture stops at the first display that fails, unless it is partial, in which case the failures are collected and the remaining displays are still captured.
+//
+// Parameters:
+//   - ctx: The context that cancels the capture, checked before each display.
+//   - displays: The displays to capture.
+//   - opts: The capture options.
+//   - capture: Captures a single display, filling in the Copy and Read durations of its timing.
+//
+// Returns:
+//   - []BMP: The captured bitmaps, one per display that was captured.
+//   - error: The context's error if it is done, the error of the first display that failed,
+//     or a *DisplayCaptureError for each display that failed joined with errors.Join if the capture is partial.
+func captureDisplays(ctx context.Context, displays []Display, opts *displayCaptureOption, capture func(display Display, timing *CaptureTiming) (*BMP, error)) ([]BMP, error) {
+	var bitmaps []BMP
+	var errs []error
+	for _, display := range displays {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		timing := CaptureTiming{Display: display}
+		started := time.Now()
+
+		bmp, err := capture(display, &timing)
+		if err != nil {
+			// a cancelled capture is never partial, nothing after it was captured
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			if !opts.Partial {
+				return nil, err
+			}
+			errs = append(errs, &DisplayCaptureError{Display: display, Err: err})
+			continue
+		}
+		if opts.TopDown {
+			bmp.flipTopDown()
+		}
+
+		bitmaps = append(bitmaps, *bmp)
+		if opts.captured != nil {
+			*opts.captured = append(*opts.captured, display)
+		}
+		if opts.timings != nil {
+			timing.Total = time.Since(started)
+			*opts.timings = append(*opts.timings, timing)
+		}
+	}
+	return bitmaps, errors.Join(errs...)
+}
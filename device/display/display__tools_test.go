@@ -0,0 +1,661 @@
+package display
+
+import (
+	"context"
+	"encoding/binary"
+	"image"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPixelBufferReusesOnce(t *testing.T) {
+	reuse := NewBMP(4, 4, 9, 9, 9)
+	opt := &displayCaptureOption{}
+	ReuseBufferOpt(reuse)(opt)
+
+	buf := opt.pixelBuffer(len(reuse.Data))
+	if &buf[0] != &reuse.Data[0] {
+		t.Fatal("the buffer of the BMP given with ReuseBufferOpt was not reused")
+	}
+	for i, v := range buf {
+		if v != 0 {
+			t.Fatalf("byte %d of the reused buffer = %d, want it zeroed", i, v)
+		}
+	}
+	if next := opt.pixelBuffer(len(reuse.Data)); &next[0] == &reuse.Data[0] {
+		t.Error("the buffer was reused by a second capture")
+	}
+}
+
+func TestPixelBufferTooSmall(t *testing.T) {
+	reuse := NewBMP(2, 2, 0, 0, 0)
+	opt := &displayCaptureOption{Reuse: reuse}
+	if buf := opt.pixelBuffer(len(reuse.Data) * 4); len(buf) != len(reuse.Data)*4 || &buf[0] == &reuse.Data[0] {
+		t.Error("a buffer too small for the capture was reused")
+	}
+}
+
+func TestBgraFrameToBMPReusesBuffer(t *testing.T) {
+	const pitch = 8 * 4
+	pixels := make([]byte, pitch*4)
+	for i := range pixels {
+		pixels[i] = byte(i)
+	}
+	region := image.Rect(1, 1, 4, 3)
+
+	want, err := bgraFrameToBMP(pixels, pitch, region, 24, nil)
+	if err != nil {
+		t.Fatalf("bgraFrameToBMP() error = %v", err)
+	}
+	opt := &displayCaptureOption{Reuse: NewBMP(8, 8, 255, 255, 255)}
+	reused := &opt.Reuse.Data[0]
+	got, err := bgraFrameToBMP(pixels, pitch, region, 24, opt.pixelBuffer)
+	if err != nil {
+		t.Fatalf("bgraFrameToBMP() error = %v", err)
+	}
+	if &got.Data[0] != reused {
+		t.Error("the frame was not copied into the reused buffer")
+	}
+	if string(got.Data) != string(want.Data) || got.InfoHeader != want.InfoHeader {
+		t.Error("the BMP copied into a reused buffer differs from a new one, the row padding must be cleared")
+	}
+}
+
+func TestWindowPieces(t *testing.T) {
+	primary := Display{X: 0, Y: 0, Width: 1920, Height: 1080, Primary: true}
+	right := Display{X: 1920, Y: 0, Width: 1280, Height: 1024}
+	left := Display{X: -1280, Y: 0, Width: 1280, Height: 1024}
+	above := Display{X: 0, Y: -1080, Width: 1920, Height: 1080}
+
+	type piece struct {
+		display Display
+		rect    image.Rectangle
+		local   [4]int32
+	}
+	tests := []struct {
+		name     string
+		bounds   image.Rectangle
+		displays []Display
+		want     []piece
+	}{
+		{
+			name:     "inside one display",
+			bounds:   image.Rect(100, 200, 500, 600),
+			displays: []Display{primary, right},
+			want:     []piece{{primary, image.Rect(100, 200, 500, 600), [4]int32{100, 500, 200, 600}}},
+		},
+		{
+			name:     "across displays side by side",
+			bounds:   image.Rect(1800, 100, 2000, 300),
+			displays: []Display{primary, right},
+			want: []piece{
+				{primary, image.Rect(1800, 100, 1920, 300), [4]int32{1800, 1920, 100, 300}},
+				{right, image.Rect(1920, 100, 2000, 300), [4]int32{0, 80, 100, 300}},
+			},
+		},
+		{
+			name:     "across a display at negative coordinates",
+			bounds:   image.Rect(-100, 1000, 100, 1100),
+			displays: []Display{left, primary},
+			want: []piece{
+				{left, image.Rect(-100, 1000, 0, 1024), [4]int32{1180, 1280, 1000, 1024}},
+				{primary, image.Rect(0, 1000, 100, 1080), [4]int32{0, 100, 1000, 1080}},
+			},
+		},
+		{
+			name:     "across stacked displays",
+			bounds:   image.Rect(10, -50, 60, 50),
+			displays: []Display{primary, above},
+			want: []piece{
+				{primary, image.Rect(10, 0, 60, 50), [4]int32{10, 60, 0, 50}},
+				{above, image.Rect(10, -50, 60, 0), [4]int32{10, 60, 1030, 1080}},
+			},
+		},
+		{
+			name:     "across four displays",
+			bounds:   image.Rect(1900, -10, 1940, 10),
+			displays: []Display{primary, right, above, {X: 1920, Y: -1024, Width: 1280, Height: 1024}},
+			want: []piece{
+				{primary, image.Rect(1900, 0, 1920, 10), [4]int32{1900, 1920, 0, 10}},
+				{right, image.Rect(1920, 0, 1940, 10), [4]int32{0, 20, 0, 10}},
+				{above, image.Rect(1900, -10, 1920, 0), [4]int32{1900, 1920, 1070, 1080}},
+				{Display{X: 1920, Y: -1024, Width: 1280, Height: 1024}, image.Rect(1920, -10, 1940, 0), [4]int32{0, 20, 1014, 1024}},
+			},
+		},
+		{
+			name:     "touching the edge of a display",
+			bounds:   image.Rect(0, 0, 100, 100),
+			displays: []Display{left, primary},
+			want:     []piece{{primary, image.Rect(0, 0, 100, 100), [4]int32{0, 100, 0, 100}}},
+		},
+		{
+			name:     "partly off screen",
+			bounds:   image.Rect(1800, 1000, 2000, 1200),
+			displays: []Display{primary},
+			want:     []piece{{primary, image.Rect(1800, 1000, 1920, 1080), [4]int32{1800, 1920, 1000, 1080}}},
+		},
+		{
+			name:     "in the gap below a shorter display",
+			bounds:   image.Rect(2000, 1030, 2100, 1070),
+			displays: []Display{primary, right},
+			want:     nil,
+		},
+		{
+			name:     "off screen",
+			bounds:   image.Rect(-5000, -5000, -4000, -4000),
+			displays: []Display{primary, right},
+			want:     nil,
+		},
+		{
+			name:     "empty window",
+			bounds:   image.Rect(100, 100, 100, 200),
+			displays: []Display{primary},
+			want:     nil,
+		},
+	}
+	for _, tt := range tests {
+		var got []piece
+		for _, p := range windowPieces(tt.bounds, tt.displays) {
+			got = append(got, piece{p.display, p.rect, p.localBounds()})
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: windowPieces(%v) = %+v, want %+v", tt.name, tt.bounds, got, tt.want)
+		}
+	}
+}
+
+// coordBMP creates a BMP whose pixels encode their own coordinates, red is the x-coordinate, green the y-coordinate and blue the given id.
+func coordBMP(t *testing.T, width, height int, id uint8) BMP {
+	t.Helper()
+	bmp := NewBMP(width, height, 0, 0, 0)
+	for y := range height {
+		for x := range width {
+			if err := bmp.SetPixel(x, y, uint8(x), uint8(y), id); err != nil {
+				t.Fatalf("SetPixel(%d, %d) error = %v", x, y, err)
+			}
+		}
+	}
+	return *bmp
+}
+
+func TestStitchPieces(t *testing.T) {
+	// a 30x20 window at 90,30 across a 100x60 display and a shorter 80x40 display to its right,
+	// its bottom right corner hangs below the shorter display
+	wide := Display{X: 0, Y: 0, Width: 100, Height: 60}
+	short := Display{X: 100, Y: 0, Width: 80, Height: 40}
+	bounds := image.Rect(90, 30, 120, 50)
+	pieces := windowPieces(bounds, []Display{wide, short})
+	if len(pieces) != 2 {
+		t.Fatalf("windowPieces() = %d pieces, want 2", len(pieces))
+	}
+	captures := []BMP{coordBMP(t, 10, 20, 1), coordBMP(t, 20, 10, 2)}
+
+	stitched, err := stitchPieces(bounds, pieces, captures)
+	if err != nil {
+		t.Fatalf("stitchPieces() error = %v", err)
+	}
+	if stitched.Width != 30 || stitched.Height != 20 {
+		t.Fatalf("stitched size = %dx%d, want 30x20", stitched.Width, stitched.Height)
+	}
+	for y := range 20 {
+		for x := range 30 {
+			var want [3]uint8
+			switch {
+			case x < 10:
+				want = [3]uint8{uint8(x), uint8(y), 1}
+			case y < 10:
+				want = [3]uint8{uint8(x - 10), uint8(y), 2}
+			}
+			r, g, b, err := stitched.Pixel(x, y)
+			if err != nil {
+				t.Fatalf("Pixel(%d, %d) error = %v", x, y, err)
+			}
+			if got := [3]uint8{r, g, b}; got != want {
+				t.Fatalf("stitched pixel %d,%d = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestStitchPiecesErrors(t *testing.T) {
+	bounds := image.Rect(90, 30, 120, 50)
+	pieces := windowPieces(bounds, []Display{{Width: 100, Height: 60}, {X: 100, Width: 80, Height: 40}})
+
+	if _, err := stitchPieces(bounds, pieces, []BMP{coordBMP(t, 10, 20, 1), coordBMP(t, 20, 11, 2)}); err == nil {
+		t.Error("stitchPieces() with a capture of the wrong size succeeded")
+	}
+
+	first := coordBMP(t, 10, 20, 1)
+	first.InfoHeader.BiBitCount = 16
+	if _, err := stitchPieces(bounds, pieces, []BMP{first, coordBMP(t, 20, 10, 2)}); err == nil {
+		t.Error("stitchPieces() with a 16-bit capture succeeded")
+	}
+
+	second := coordBMP(t, 20, 10, 2)
+	converted, err := second.ConvertTo(32)
+	if err != nil {
+		t.Fatalf("ConvertTo(32) error = %v", err)
+	}
+	if _, err := stitchPieces(bounds, pieces, []BMP{coordBMP(t, 10, 20, 1), *converted}); err == nil {
+		t.Error("stitchPieces() with a 24-bit and a 32-bit capture succeeded")
+	}
+}
+
+// cannedFrame is a 5x3 frame of BGRA pixels as the desktop duplication API maps it, with 8 bytes of padding at the end of every row.
+// Each pixel encodes its own coordinates, blue is the x-coordinate, green the y-coordinate, red is 0x80 and alpha is 0xA0 plus the x-coordinate.
+const cannedFramePitch = 5*4 + 8
+
+var cannedFrame = func() []byte {
+	frame := make([]byte, 3*cannedFramePitch)
+	for i := range frame {
+		// the padding must never end up in a BMP
+		frame[i] = 0xEE
+	}
+	for y := range 3 {
+		for x := range 5 {
+			copy(frame[y*cannedFramePitch+x*4:], []byte{byte(x), byte(y), 0x80, 0xA0 + byte(x)})
+		}
+	}
+	return frame
+}()
+
+func TestBgraFrameToBMP(t *testing.T) {
+	tests := []struct {
+		name     string
+		region   image.Rectangle
+		bitCount int
+	}{
+		{name: "24-bit region", region: image.Rect(1, 1, 4, 3), bitCount: 24},
+		{name: "32-bit region", region: image.Rect(1, 1, 4, 3), bitCount: 32},
+		{name: "24-bit whole frame", region: image.Rect(0, 0, 5, 3), bitCount: 24},
+		{name: "32-bit whole frame", region: image.Rect(0, 0, 5, 3), bitCount: 32},
+		{name: "single pixel", region: image.Rect(4, 2, 5, 3), bitCount: 24},
+	}
+	for _, tt := range tests {
+		bmp, err := bgraFrameToBMP(cannedFrame, cannedFramePitch, tt.region, tt.bitCount, nil)
+		if err != nil {
+			t.Fatalf("%s: bgraFrameToBMP() error = %v", tt.name, err)
+		}
+		if err := bmp.Validate(); err != nil {
+			t.Fatalf("%s: the BMP is not valid: %v", tt.name, err)
+		}
+		if bmp.Width != tt.region.Dx() || bmp.Height != tt.region.Dy() || int(bmp.InfoHeader.BiBitCount) != tt.bitCount {
+			t.Fatalf("%s: BMP is %dx%d at %d bits, want %dx%d at %d bits", tt.name, bmp.Width, bmp.Height, bmp.InfoHeader.BiBitCount, tt.region.Dx(), tt.region.Dy(), tt.bitCount)
+		}
+
+		bytesPerPixel := tt.bitCount / 8
+		rowSize := (bmp.Width*bytesPerPixel + 3) &^ 3
+		for y := range bmp.Height {
+			row := bmp.Data[y*rowSize : (y+1)*rowSize]
+			for x := range bmp.Width {
+				fx, fy := tt.region.Min.X+x, tt.region.Min.Y+y
+				want := []byte{byte(fx), byte(fy), 0x80, 0xA0 + byte(fx)}[:bytesPerPixel]
+				if got := row[x*bytesPerPixel : (x+1)*bytesPerPixel]; string(got) != string(want) {
+					t.Errorf("%s: pixel %d,%d = % x, want % x from frame pixel %d,%d", tt.name, x, y, got, want, fx, fy)
+				}
+			}
+			for i, v := range row[bmp.Width*bytesPerPixel:] {
+				if v != 0 {
+					t.Errorf("%s: padding byte %d of row %d = %#x, want 0", tt.name, i, y, v)
+				}
+			}
+		}
+	}
+}
+
+func TestBgraFrameToBMPErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		region   image.Rectangle
+		bitCount int
+	}{
+		{name: "16-bit", region: image.Rect(0, 0, 2, 2), bitCount: 16},
+		{name: "8-bit", region: image.Rect(0, 0, 2, 2), bitCount: 8},
+		{name: "empty region", region: image.Rect(2, 2, 2, 3), bitCount: 24},
+		{name: "negative x", region: image.Rect(-1, 0, 2, 2), bitCount: 24},
+		{name: "negative y", region: image.Rect(0, -1, 2, 2), bitCount: 24},
+		{name: "beyond the pitch", region: image.Rect(0, 0, 8, 2), bitCount: 24},
+		{name: "beyond the last row", region: image.Rect(0, 2, 2, 4), bitCount: 32},
+	}
+	for _, tt := range tests {
+		if bmp, err := bgraFrameToBMP(cannedFrame, cannedFramePitch, tt.region, tt.bitCount, nil); err == nil {
+			t.Errorf("%s: bgraFrameToBMP(%v, %d bits) = %dx%d BMP, want an error", tt.name, tt.region, tt.bitCount, bmp.Width, bmp.Height)
+		}
+	}
+}
+
+func TestDirtyRectsIn(t *testing.T) {
+	region := image.Rect(100, 50, 300, 250)
+	tests := []struct {
+		name  string
+		rects []image.Rectangle
+		want  []image.Rectangle
+	}{
+		{name: "not reported", rects: nil, want: nil},
+		{name: "nothing changed", rects: []image.Rectangle{}, want: []image.Rectangle{}},
+		{name: "inside", rects: []image.Rectangle{image.Rect(120, 60, 140, 80)}, want: []image.Rectangle{image.Rect(20, 10, 40, 30)}},
+		{name: "whole region", rects: []image.Rectangle{region}, want: []image.Rectangle{image.Rect(0, 0, 200, 200)}},
+		{name: "whole frame", rects: []image.Rectangle{image.Rect(0, 0, 1920, 1080)}, want: []image.Rectangle{image.Rect(0, 0, 200, 200)}},
+		{name: "clipped at the top left", rects: []image.Rectangle{image.Rect(90, 40, 110, 60)}, want: []image.Rectangle{image.Rect(0, 0, 10, 10)}},
+		{name: "clipped at the bottom right", rects: []image.Rectangle{image.Rect(290, 240, 310, 260)}, want: []image.Rectangle{image.Rect(190, 190, 200, 200)}},
+		{name: "outside", rects: []image.Rectangle{image.Rect(0, 0, 50, 50), image.Rect(400, 400, 500, 500)}, want: []image.Rectangle{}},
+		{name: "touching the edge", rects: []image.Rectangle{image.Rect(300, 50, 320, 70), image.Rect(100, 30, 120, 50)}, want: []image.Rectangle{}},
+		{
+			name:  "mixed",
+			rects: []image.Rectangle{image.Rect(0, 0, 10, 10), image.Rect(150, 100, 160, 110), image.Rect(250, 200, 400, 400)},
+			want:  []image.Rectangle{image.Rect(50, 50, 60, 60), image.Rect(150, 150, 200, 200)},
+		},
+	}
+	for _, tt := range tests {
+		got := dirtyRectsIn(tt.rects, region)
+		if (got == nil) != (tt.want == nil) || !slices.Equal(got, tt.want) {
+			t.Errorf("%s: dirtyRectsIn(%v) = %v, want %v", tt.name, tt.rects, got, tt.want)
+		}
+	}
+}
+
+// testBmpColors are the colors of the 2x2 test BMPs, top row first, chosen so a 5-6-5 16-bit pixel holds them exactly.
+var testBmpColors = [2][2][3]uint8{
+	{{248, 0, 0}, {0, 252, 0}},
+	{{0, 0, 248}, {248, 252, 248}},
+}
+
+// bmpFile describes a 2x2 BMP file to encode with encodeBmpFile.
+type bmpFile struct {
+	headerSize  uint32    // 40 for a BITMAPINFOHEADER, 108 for a BITMAPV4HEADER, 124 for a BITMAPV5HEADER
+	bitCount    uint16    // 16, 24 or 32
+	compression uint32    // 0 for BI_RGB, biBitfields for BI_BITFIELDS
+	masks       [3]uint32 // the red, green and blue masks, written after a BITMAPINFOHEADER or within a V4 or V5 header for BI_BITFIELDS
+}
+
+// encodeBmpFile encodes the testBmpColors as a bottom-up BMP file, the way image editors write V4 and V5 files.
+func encodeBmpFile(f bmpFile) []byte {
+	le := binary.LittleEndian
+	masksAfterHeader := f.compression == biBitfields && f.headerSize == bitmapInfoHeaderSize
+	header := make([]byte, f.headerSize)
+	le.PutUint32(header[0:], f.headerSize)
+	le.PutUint32(header[4:], 2)
+	le.PutUint32(header[8:], 2)
+	le.PutUint16(header[12:], 1)
+	le.PutUint16(header[14:], f.bitCount)
+	le.PutUint32(header[16:], f.compression)
+	le.PutUint32(header[24:], 2835)
+	le.PutUint32(header[28:], 2835)
+	if f.headerSize > bitmapInfoHeaderSize {
+		le.PutUint32(header[40:], f.masks[0])
+		le.PutUint32(header[44:], f.masks[1])
+		le.PutUint32(header[48:], f.masks[2])
+		if f.bitCount == 32 {
+			le.PutUint32(header[52:], 0xFF000000)
+		}
+		copy(header[56:], "BGRs") // LCS_sRGB
+	}
+	if masksAfterHeader {
+		for _, mask := range f.masks {
+			header = le.AppendUint32(header, mask)
+		}
+	}
+
+	bytesPerPixel := int(f.bitCount) / 8
+	rowSize := (2*bytesPerPixel + 3) &^ 3
+	pixels := make([]byte, 2*rowSize)
+	for y := range 2 {
+		// the rows are stored bottom-up
+		row := pixels[(1-y)*rowSize:]
+		for x, c := range testBmpColors[y] {
+			px := row[x*bytesPerPixel:]
+			switch f.bitCount {
+			case 16:
+				le.PutUint16(px, uint16(c[0]>>3)<<11|uint16(c[1]>>2)<<5|uint16(c[2]>>3))
+			case 24:
+				copy(px, []byte{c[2], c[1], c[0]})
+			case 32:
+				copy(px, []byte{c[2], c[1], c[0], 0xFF})
+			}
+		}
+	}
+
+	offBits := 14 + len(header)
+	file := make([]byte, 14, offBits+len(pixels))
+	copy(file, "BM")
+	le.PutUint32(file[2:], uint32(offBits+len(pixels)))
+	le.PutUint32(file[10:], uint32(offBits))
+	file = append(file, header...)
+	return append(file, pixels...)
+}
+
+// checkTestBmpColors checks that a BMP holds the testBmpColors.
+func checkTestBmpColors(t *testing.T, name string, bmp *BMP) {
+	t.Helper()
+	if bmp.Width != 2 || bmp.Height != 2 {
+		t.Fatalf("%s: size = %dx%d, want 2x2", name, bmp.Width, bmp.Height)
+	}
+	for y := range 2 {
+		for x := range 2 {
+			r, g, b, err := bmp.Pixel(x, y)
+			if err != nil {
+				t.Fatalf("%s: Pixel(%d, %d) error = %v", name, x, y, err)
+			}
+			if got := [3]uint8{r, g, b}; got != testBmpColors[y][x] {
+				t.Errorf("%s: pixel %d,%d = %v, want %v", name, x, y, got, testBmpColors[y][x])
+			}
+		}
+	}
+}
+
+func TestLoadBmpExtendedHeaders(t *testing.T) {
+	bgra := [3]uint32{0x00FF0000, 0x0000FF00, 0x000000FF}
+	rgb565 := [3]uint32{0xF800, 0x07E0, 0x001F}
+	tests := []struct {
+		name string
+		file bmpFile
+		// the bytes dropped from the file when the headers are reduced to a BITMAPINFOHEADER
+		dropped uint32
+	}{
+		{name: "info header 24-bit", file: bmpFile{headerSize: 40, bitCount: 24}},
+		{name: "info header 32-bit bitfields", file: bmpFile{headerSize: 40, bitCount: 32, compression: biBitfields, masks: bgra}, dropped: 12},
+		{name: "info header 16-bit bitfields", file: bmpFile{headerSize: 40, bitCount: 16, compression: biBitfields, masks: rgb565}, dropped: 12},
+		{name: "v4 24-bit", file: bmpFile{headerSize: 108, bitCount: 24}, dropped: 68},
+		{name: "v4 32-bit bitfields", file: bmpFile{headerSize: 108, bitCount: 32, compression: biBitfields, masks: bgra}, dropped: 68},
+		{name: "v5 24-bit", file: bmpFile{headerSize: 124, bitCount: 24}, dropped: 84},
+		{name: "v5 32-bit", file: bmpFile{headerSize: 124, bitCount: 32}, dropped: 84},
+		{name: "v5 32-bit bitfields", file: bmpFile{headerSize: 124, bitCount: 32, compression: biBitfields, masks: bgra}, dropped: 84},
+		{name: "v5 16-bit bitfields", file: bmpFile{headerSize: 124, bitCount: 16, compression: biBitfields, masks: rgb565}, dropped: 84},
+	}
+	for _, tt := range tests {
+		data := encodeBmpFile(tt.file)
+		bmp, err := LoadBmp(data)
+		if err != nil {
+			t.Errorf("%s: LoadBmp() error = %v", tt.name, err)
+			continue
+		}
+		checkTestBmpColors(t, tt.name, bmp)
+
+		if bmp.InfoHeader.BiSize != bitmapInfoHeaderSize || bmp.InfoHeader.BiCompression != 0 {
+			t.Errorf("%s: info header size %d and compression %d, want it reduced to an uncompressed BITMAPINFOHEADER", tt.name, bmp.InfoHeader.BiSize, bmp.InfoHeader.BiCompression)
+		}
+		wantOffBits := binary.LittleEndian.Uint32(data[10:]) - tt.dropped
+		if bmp.FileHeader.OffBits != wantOffBits || bmp.FileHeader.Size != uint32(len(data))-tt.dropped {
+			t.Errorf("%s: offset %d and size %d, want %d and %d", tt.name, bmp.FileHeader.OffBits, bmp.FileHeader.Size, wantOffBits, uint32(len(data))-tt.dropped)
+		}
+	}
+}
+
+func TestLoadBmpExtendedHeaderRoundTrip(t *testing.T) {
+	for _, file := range []bmpFile{
+		{headerSize: 108, bitCount: 24},
+		{headerSize: 124, bitCount: 32, compression: biBitfields, masks: [3]uint32{0x00FF0000, 0x0000FF00, 0x000000FF}},
+		{headerSize: 40, bitCount: 32, compression: biBitfields, masks: [3]uint32{0x00FF0000, 0x0000FF00, 0x000000FF}},
+	} {
+		bmp, err := LoadBmp(encodeBmpFile(file))
+		if err != nil {
+			t.Fatalf("LoadBmp(%+v) error = %v", file, err)
+		}
+		data := bmp.ToBinary()
+		if size := binary.LittleEndian.Uint32(data[2:]); uint32(len(data)) != size {
+			t.Errorf("%+v: ToBinary() wrote %d bytes, but the file header says %d", file, len(data), size)
+		}
+		reloaded, err := LoadBmp(data)
+		if err != nil {
+			t.Fatalf("%+v: LoadBmp(ToBinary()) error = %v", file, err)
+		}
+		checkTestBmpColors(t, "round trip", reloaded)
+		if !reloaded.Equal(bmp) {
+			t.Errorf("%+v: the BMP written by ToBinary differs from the loaded one", file)
+		}
+	}
+}
+
+func TestLoadBmpExtendedHeaderErrors(t *testing.T) {
+	v5 := encodeBmpFile(bmpFile{headerSize: 124, bitCount: 24})
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{
+			name:    "truncated v5 header",
+			data:    v5[:14+100],
+			wantErr: "too small for a 124 byte info header",
+		},
+		{
+			name: "core header",
+			data: func() []byte {
+				data := encodeBmpFile(bmpFile{headerSize: 40, bitCount: 24})
+				binary.LittleEndian.PutUint32(data[14:], 12)
+				return data
+			}(),
+			wantErr: "unsupported BMP info header size: 12",
+		},
+		{
+			name:    "rgba masks",
+			data:    encodeBmpFile(bmpFile{headerSize: 124, bitCount: 32, compression: biBitfields, masks: [3]uint32{0xFF000000, 0x00FF0000, 0x0000FF00}}),
+			wantErr: "unsupported 32-bit BMP bitfield masks",
+		},
+		{
+			name:    "555 masks",
+			data:    encodeBmpFile(bmpFile{headerSize: 108, bitCount: 16, compression: biBitfields, masks: [3]uint32{0x7C00, 0x03E0, 0x001F}}),
+			wantErr: "unsupported 16-bit BMP bitfield masks",
+		},
+		{
+			name:    "missing masks",
+			data:    encodeBmpFile(bmpFile{headerSize: 40, bitCount: 32, compression: biBitfields})[:14+40+8],
+			wantErr: "too small for the bitfield masks",
+		},
+		{
+			name: "run length encoded",
+			data: func() []byte {
+				data := encodeBmpFile(bmpFile{headerSize: 124, bitCount: 24})
+				binary.LittleEndian.PutUint32(data[14+16:], 1) // BI_RLE8
+				return data
+			}(),
+			wantErr: "must be uncompressed",
+		},
+	}
+	for _, tt := range tests {
+		_, err := LoadBmp(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: LoadBmp() error = %v, want an error containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+// bottomUpCopy copies a top-down BMP into the bottom-up layout, with its last row stored first and a positive BiHeight.
+func bottomUpCopy(bmp *BMP) *BMP {
+	bottomUp := *bmp
+	bottomUp.InfoHeader.BiHeight = int32(bmp.Height)
+	bottomUp.Data = make([]byte, len(bmp.Data))
+	rowSize := len(bmp.Data) / bmp.Height
+	for row := range bmp.Height {
+		copy(bottomUp.Data[(bmp.Height-1-row)*rowSize:], bmp.Data[row*rowSize:(row+1)*rowSize])
+	}
+	return &bottomUp
+}
+
+// rowBMP creates a 24-bit top-down BMP whose rows are each filled with their own color, with padding after every row.
+func rowBMP(t *testing.T, height int) *BMP {
+	t.Helper()
+	bmp := NewBMP(3, height, 0, 0, 0)
+	for y := range height {
+		for x := range 3 {
+			if err := bmp.SetPixel(x, y, uint8(y*40), uint8(x), 200); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return bmp
+}
+
+func TestFlipTopDown(t *testing.T) {
+	for _, height := range []int{1, 2, 3, 4} {
+		want := rowBMP(t, height)
+		bmp := bottomUpCopy(want)
+		bmp.flipTopDown()
+		if height > 1 && bmp.InfoHeader.BiHeight != -int32(height) {
+			t.Errorf("height %d: BiHeight = %d after flipTopDown, want %d", height, bmp.InfoHeader.BiHeight, -height)
+		}
+		if !slices.Equal(bmp.Data, want.Data) {
+			t.Errorf("height %d: flipped data = %v, want %v", height, bmp.Data, want.Data)
+		}
+
+		// flipping a BMP that is already top-down leaves it as it is
+		topDown := rowBMP(t, height)
+		topDown.flipTopDown()
+		if topDown.InfoHeader.BiHeight != want.InfoHeader.BiHeight || !slices.Equal(topDown.Data, want.Data) {
+			t.Errorf("height %d: flipTopDown changed a top-down BMP", height)
+		}
+	}
+
+	// a flipped file serializes as a top-down BMP with the same pixels
+	loaded, err := LoadBmp(encodeBmpFile(bmpFile{headerSize: 40, bitCount: 24}))
+	if err != nil {
+		t.Fatalf("LoadBmp() error = %v", err)
+	}
+	if loaded.InfoHeader.BiHeight <= 0 {
+		t.Fatalf("the generated BMP has BiHeight %d, want it stored bottom-up", loaded.InfoHeader.BiHeight)
+	}
+	loaded.flipTopDown()
+	reloaded, err := LoadBmp(loaded.ToBinary())
+	if err != nil {
+		t.Fatalf("LoadBmp(ToBinary()) error = %v", err)
+	}
+	if reloaded.InfoHeader.BiHeight != -2 {
+		t.Errorf("the serialized BMP has BiHeight %d, want -2", reloaded.InfoHeader.BiHeight)
+	}
+	checkTestBmpColors(t, "flipped", reloaded)
+}
+
+func TestCaptureDisplaysTopDown(t *testing.T) {
+	want := rowBMP(t, 3)
+	displays := []Display{{Width: 3, Height: 3, Primary: true}, {X: 3, Width: 3, Height: 3}}
+	// the first display captures bottom-up like ImageMagick on Linux, the second top-down like Windows
+	capture := func(display Display, timing *CaptureTiming) (*BMP, error) {
+		if display.Primary {
+			return bottomUpCopy(want), nil
+		}
+		return rowBMP(t, 3), nil
+	}
+
+	for _, topDown := range []bool{false, true} {
+		opts := &displayCaptureOption{}
+		if topDown {
+			TopDownOpt()(opts)
+		}
+		bitmaps, err := captureDisplays(context.Background(), displays, opts, capture)
+		if err != nil || len(bitmaps) != 2 {
+			t.Fatalf("captureDisplays() = %d bitmaps, %v, want 2, nil", len(bitmaps), err)
+		}
+		if got := bitmaps[0].InfoHeader.BiHeight > 0; got == topDown {
+			t.Errorf("top-down %v: the first capture is bottom-up %v", topDown, got)
+		}
+		for i, bmp := range bitmaps {
+			if bmp.InfoHeader.BiHeight > 0 {
+				continue
+			}
+			if !slices.Equal(bmp.Data, want.Data) || bmp.InfoHeader.BiHeight != -3 {
+				t.Errorf("top-down %v: capture %d has BiHeight %d and data %v, want -3 and %v", topDown, i, bmp.InfoHeader.BiHeight, bmp.Data, want.Data)
+			}
+		}
+	}
+}
@@ -5,11 +5,13 @@ package display
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	linux "github.com/Carmen-Shannon/automation/tools/_linux"
 )
@@ -52,13 +54,32 @@ func NewVirtualScreen() VirtualScreen {
 
 }
 
-func (vs *virtualScreen) CaptureBmp(options ...DisplayCaptureOption) ([]BMP, error) {
+// CloseDesktopDuplications does nothing on linux, the desktop duplication of DesktopDuplicationOpt is only supported on Windows.
+func CloseDesktopDuplications() {}
+
+// doAwaitChange reports that change notifications are not available on linux, so StreamCapture captures on a timer.
+//
+// Returns:
+//   - *BMP: Always nil.
+//   - bool: Always false.
+//   - error: Always nil.
+func doAwaitChange(ctx context.Context, display Display, opts *displayCaptureOption, current bool) (*BMP, bool, error) {
+	return nil, false, nil
+}
+
+func (vs *virtualScreen) CaptureBmpCtx(ctx context.Context, options ...DisplayCaptureOption) ([]BMP, error) {
 	displayCaptureOptions := &displayCaptureOption{}
 	for _, opt := range options {
 		opt(displayCaptureOptions)
 	}
 	// Always output 24bpp, regardless of input or display format
 	displayCaptureOptions.BitCount = 24
+	if err := linux.CheckX11Session("capture the screen"); err != nil {
+		return nil, err
+	}
+	if err := linux.RequireTool("import"); err != nil {
+		return nil, err
+	}
 
 	var displays []Display
 	if len(displayCaptureOptions.Displays) == 0 {
@@ -71,19 +92,14 @@ func (vs *virtualScreen) CaptureBmp(options ...DisplayCaptureOption) ([]BMP, err
 		displays = displayCaptureOptions.Displays
 	}
 
-	var bitmaps []BMP
-	for _, display := range displays {
+	return captureDisplays(ctx, displays, displayCaptureOptions, func(display Display, timing *CaptureTiming) (*BMP, error) {
 		var left, top, right, bottom int32
 		if displayCaptureOptions.Bounds != [4]int32{} {
-			left = display.X + displayCaptureOptions.Bounds[0]
-			right = display.X + displayCaptureOptions.Bounds[1]
-			top = display.Y + displayCaptureOptions.Bounds[2]
-			bottom = display.Y + displayCaptureOptions.Bounds[3]
+			left, top = display.ToGlobal(displayCaptureOptions.Bounds[0], displayCaptureOptions.Bounds[2])
+			right, bottom = display.ToGlobal(displayCaptureOptions.Bounds[1], displayCaptureOptions.Bounds[3])
 		} else {
-			left = display.X
-			top = display.Y
-			right = display.X + int32(display.Width)
-			bottom = display.Y + int32(display.Height)
+			left, top = display.ToGlobal(0, 0)
+			right, bottom = display.ToGlobal(int32(display.Width), int32(display.Height))
 		}
 
 		width := int(right - left)
@@ -96,26 +112,59 @@ func (vs *virtualScreen) CaptureBmp(options ...DisplayCaptureOption) ([]BMP, err
 		// -window root: capture the root window
 		// -crop WxH+X+Y: region to capture
 		// bmp3: ensures 24bpp BMP output
-		geometry := fmt.Sprintf("%dx%d+%d+%d", width, height, left, top)
-		cmd := exec.Command("import", "-window", "root", "-crop", geometry, "-depth", "8", "-type", "TrueColor", "-define", "bmp:format=bmp3", "bmp:-")
+		// the root window starts at the top-left corner of the virtual screen, so a monitor left of or above the origin is at a positive offset in it
+		originX, originY := min(vs.Left, 0), min(vs.Bottom, 0)
+		geometry := fmt.Sprintf("%dx%d+%d+%d", width, height, left-originX, top-originY)
+		args := []string{"-window", "root", "-crop", geometry, "-depth", "8"}
+		if displayCaptureOptions.Grayscale {
+			// convert to gray while capturing, TrueColor below still stores the gray value in every channel
+			args = append(args, "-colorspace", "Gray")
+		}
+		args = append(args, "-type", "TrueColor", "-define", "bmp:format=bmp3", "bmp:-")
+		// import is killed if the context is done while it runs
+		cmd := exec.CommandContext(ctx, "import", args...)
 		var bmpBuf bytes.Buffer
 		cmd.Stdout = &bmpBuf
+		copyStarted := time.Now()
 		if err := cmd.Run(); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
 			return nil, fmt.Errorf("failed to run import: %w", err)
 		}
+		timing.Copy = time.Since(copyStarted)
 
 		// Parse the BMP data (assuming you have a LoadBmp or similar function)
+		readStarted := time.Now()
 		bmp, err := LoadBmp(bmpBuf.Bytes())
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse BMP: %w", err)
 		}
-		bitmaps = append(bitmaps, *bmp)
-	}
+		timing.Read = time.Since(readStarted)
+		bmp.Grayscale = displayCaptureOptions.Grayscale
+		return bmp, nil
+	})
+}
 
-	return bitmaps, nil
+// doGetCursorPosition retrieves the position of the mouse cursor in virtual screen coordinates, using the shared X connection.
+//
+// Returns:
+//   - int32: The x-coordinate of the cursor.
+//   - int32: The y-coordinate of the cursor.
+//   - error: An error if the position could not be retrieved.
+func doGetCursorPosition() (int32, int32, error) {
+	return linux.QueryPointerPosition()
 }
 
 func (vs *virtualScreen) DetectDisplays() ([]Display, error) {
+	// xrandr reports no displays at all on wayland, rather than failing
+	if err := linux.CheckX11Session("detect the displays"); err != nil {
+		return nil, err
+	}
+	if err := linux.RequireTool("xrandr"); err != nil {
+		return nil, err
+	}
+
 	// Execute the `xrandr` command to get display information
 	output, err := linux.ExecuteXrandr()
 	if err != nil {
@@ -138,19 +187,15 @@ func extractDisplaysFromXrandrOutput(output string) []Display {
 				displayEntry.Primary = true
 			}
 			// checking for the connected displays example: eDP-1 connected primary 1920x1080+0+0
-			// Regular expression to match the resolution format
-			re := regexp.MustCompile(`\d+x\d+\+\d+\+\d+`)
-			match := re.FindString(line)
-			if match != "" {
-				match = strings.Split(match, " ")[0]
-				res := strings.Split(match, "x")
-				// at this point res looks like ["1920","1080+0+-69"]
-				width, _ := strconv.Atoi(res[0])
-				yRes := strings.Split(res[1], "+")
-				// at this point yRes looks like ["1080","0","-69"]
-				height, _ := strconv.Atoi(yRes[0])
-				x, _ := strconv.ParseInt(yRes[1], 10, 32)
-				y, _ := strconv.ParseInt(yRes[2], 10, 32)
+			// a monitor left of or above the origin has a negative offset, which xrandr prints as 1920x1080-1920+0 or 1920x1080+-1920+0
+			re := regexp.MustCompile(`(\d+)x(\d+)(\+-?\d+|-\d+)(\+-?\d+|-\d+)`)
+			match := re.FindStringSubmatch(line)
+			if match != nil {
+				// at this point match looks like ["1920x1080+0+-69","1920","1080","+0","+-69"]
+				width, _ := strconv.Atoi(match[1])
+				height, _ := strconv.Atoi(match[2])
+				x := parseXrandrOffset(match[3])
+				y := parseXrandrOffset(match[4])
 
 				displayEntry.Width = width
 				displayEntry.Height = height
@@ -177,6 +222,18 @@ func extractDisplaysFromXrandrOutput(output string) []Display {
 	return displays
 }
 
+// parseXrandrOffset parses an offset of an xrandr geometry, such as +0, -69 or +-69.
+//
+// Parameters:
+//   - offset: The offset, including its leading sign.
+//
+// Returns:
+//   - int64: The parsed offset, zero if it is malformed.
+func parseXrandrOffset(offset string) int64 {
+	value, _ := strconv.ParseInt(strings.TrimPrefix(offset, "+"), 10, 32)
+	return value
+}
+
 func extractRawPixelData(xwdOutput []byte, width, height int) ([]byte, error) {
 	// The XWD file format includes a header before the pixel data.
 	// The header size is typically 100 bytes, but this may vary depending on the X server.
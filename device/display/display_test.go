@@ -0,0 +1,137 @@
+package display
+
+import (
+	"slices"
+	"testing"
+)
+
+// splitBMP creates a BMP whose left half is black and right half is white, a single hard vertical edge down its middle.
+func splitBMP(t *testing.T, width, height int) *BMP {
+	t.Helper()
+	bmp := NewBMP(width, height, 0, 0, 0)
+	for y := range height {
+		for x := width / 2; x < width; x++ {
+			if err := bmp.SetPixel(x, y, 255, 255, 255); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return bmp
+}
+
+// edgeRow reads the edge magnitudes of one row of a SobelEdges result, failing the test unless every pixel is gray.
+func edgeRow(t *testing.T, edges *BMP, y int) []uint8 {
+	t.Helper()
+	row := make([]uint8, edges.Width)
+	for x := range edges.Width {
+		r, g, b, err := edges.Pixel(x, y)
+		if err != nil {
+			t.Fatalf("Pixel(%d, %d) error = %v", x, y, err)
+		}
+		if r != g || g != b {
+			t.Fatalf("edge pixel %d,%d = %d, %d, %d, want gray", x, y, r, g, b)
+		}
+		row[x] = r
+	}
+	return row
+}
+
+func TestSobelEdges(t *testing.T) {
+	flat, err := NewBMP(5, 4, 120, 40, 200).SobelEdges()
+	if err != nil {
+		t.Fatalf("SobelEdges() error = %v", err)
+	}
+	for y := range flat.Height {
+		if row := edgeRow(t, flat, y); slices.ContainsFunc(row, func(m uint8) bool { return m != 0 }) {
+			t.Errorf("a flat BMP has edges %v in row %d, want none", row, y)
+		}
+	}
+
+	split := splitBMP(t, 6, 4)
+	original := slices.Clone(split.Data)
+	edges, err := split.SobelEdges()
+	if err != nil {
+		t.Fatalf("SobelEdges() error = %v", err)
+	}
+	if !slices.Equal(split.Data, original) {
+		t.Error("SobelEdges() modified the source BMP")
+	}
+	if !edges.Grayscale || edges.InfoHeader.BiBitCount != 24 || edges.InfoHeader.BiHeight >= 0 {
+		t.Errorf("edges are grayscale %v, %d-bit with height %d, want a grayscale top-down 24-bit BMP", edges.Grayscale, edges.InfoHeader.BiBitCount, edges.InfoHeader.BiHeight)
+	}
+	// the edge between black and white is at full intensity on both sides, including the top and bottom rows that repeat their edge pixels
+	want := []uint8{0, 0, 255, 255, 0, 0}
+	for y := range edges.Height {
+		if row := edgeRow(t, edges, y); !slices.Equal(row, want) {
+			t.Errorf("row %d edges = %v, want %v", y, row, want)
+		}
+	}
+}
+
+func TestSobelEdgesIgnoresColor(t *testing.T) {
+	// a light control on a dark background and its inverted, dark on light rendering have edges of the same strength
+	light := NewBMP(8, 8, 30, 30, 30)
+	dark := NewBMP(8, 8, 225, 225, 225)
+	for y := 2; y < 6; y++ {
+		for x := 2; x < 6; x++ {
+			if err := light.SetPixel(x, y, 225, 225, 225); err != nil {
+				t.Fatal(err)
+			}
+			if err := dark.SetPixel(x, y, 30, 30, 30); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	lightEdges, err := light.SobelEdges()
+	if err != nil {
+		t.Fatalf("SobelEdges() error = %v", err)
+	}
+	darkEdges, err := dark.SobelEdges()
+	if err != nil {
+		t.Fatalf("SobelEdges() error = %v", err)
+	}
+	if !lightEdges.Equal(darkEdges) {
+		t.Error("the edges of the light and the dark rendering differ")
+	}
+}
+
+func TestSobelEdgesPixelFormats(t *testing.T) {
+	split := splitBMP(t, 6, 3)
+	want, err := split.SobelEdges()
+	if err != nil {
+		t.Fatalf("SobelEdges() error = %v", err)
+	}
+
+	wide, err := split.ConvertTo(32)
+	if err != nil {
+		t.Fatalf("ConvertTo(32) error = %v", err)
+	}
+	wide.Data[3] = 7
+	wideEdges, err := wide.SobelEdges()
+	if err != nil {
+		t.Fatalf("SobelEdges() error = %v", err)
+	}
+	if wideEdges.InfoHeader.BiBitCount != 32 {
+		t.Errorf("the edges of a 32-bit BMP are %d-bit, want 32-bit", wideEdges.InfoHeader.BiBitCount)
+	}
+	if wideEdges.Data[3] != 7 || wideEdges.Data[7] != 255 {
+		t.Errorf("edge alpha bytes = %d, %d, want the source alpha 7, 255", wideEdges.Data[3], wideEdges.Data[7])
+	}
+
+	// the 32-bit and the bottom-up copies have the same edges as the top-down 24-bit BMP
+	for name, bmp := range map[string]*BMP{"32-bit": wide, "bottom-up": bottomUpCopy(split)} {
+		edges, err := bmp.SobelEdges()
+		if err != nil {
+			t.Fatalf("%s: SobelEdges() error = %v", name, err)
+		}
+		for y := range want.Height {
+			if got, wantRow := edgeRow(t, edges, y), edgeRow(t, want, y); !slices.Equal(got, wantRow) {
+				t.Errorf("%s: row %d edges = %v, want %v", name, y, got, wantRow)
+			}
+		}
+	}
+
+	if _, err := (&BMP{Width: 2, Height: 2, Data: make([]byte, 5)}).SobelEdges(); err == nil {
+		t.Error("SobelEdges() of unreadable pixel data error = nil, want an error")
+	}
+}
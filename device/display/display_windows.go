@@ -4,79 +4,32 @@
 package display
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"unsafe"
+	"image"
+	"sync"
+	"time"
 
 	"github.com/Carmen-Shannon/automation/tools"
 	windows "github.com/Carmen-Shannon/automation/tools/_windows"
 )
 
-// devMode represents the device mode for a display
-type devMode struct {
-	DeviceName    [32]uint16 // dmDeviceName: Friendly name of the display device
-	SpecVersion   uint16     // dmSpecVersion: Version number of the DEVMODE structure
-	DriverVersion uint16     // dmDriverVersion: Driver version number
-	Size          uint16     // dmSize: Size of the DEVMODE structure
-	DriverExtra   uint16     // dmDriverExtra: Size of private driver data
-	Fields        uint32     // dmFields: Flags indicating which fields are initialized
-
-	// Union: dmPosition or printer-specific fields
-	PositionX          int32  // dmPosition.x: X-coordinate of the display position
-	PositionY          int32  // dmPosition.y: Y-coordinate of the display position
-	DisplayOrientation uint32 // dmDisplayOrientation: Orientation of the display
-	DisplayFixedOutput uint32 // dmDisplayFixedOutput: Fixed output settings for the display
-
-	Color       int16      // dmColor: Color or monochrome setting
-	Duplex      int16      // dmDuplex: Duplex printing setting
-	YResolution int16      // dmYResolution: Y-resolution for printers
-	TTOption    int16      // dmTTOption: TrueType font option
-	Collate     int16      // dmCollate: Collation setting for printers
-	FormName    [32]uint16 // dmFormName: Form name for printers
-	LogPixels   uint16     // dmLogPixels: Logical pixels per inch
-
-	BitsPerPel uint32 // dmBitsPerPel: Color resolution in bits per pixel
-	PelsWidth  uint32 // dmPelsWidth: Width of the display in pixels
-	PelsHeight uint32 // dmPelsHeight: Height of the display in pixels
-
-	// Union: dmDisplayFlags or dmNup
-	DisplayFlags     uint32 // dmDisplayFlags: Display mode flags
-	DisplayFrequency uint32 // dmDisplayFrequency: Refresh rate in hertz
-
-	ICMMethod     uint32 // dmICMMethod: ICM handling method
-	ICMIntent     uint32 // dmICMIntent: ICM intent
-	MediaType     uint32 // dmMediaType: Media type for printers
-	DitherType    uint32 // dmDitherType: Dithering method
-	Reserved1     uint32 // dmReserved1: Reserved; must be zero
-	Reserved2     uint32 // dmReserved2: Reserved; must be zero
-	PanningWidth  uint32 // dmPanningWidth: Panning width; must be zero
-	PanningHeight uint32 // dmPanningHeight: Panning height; must be zero
-}
-
-// displayDevice represents the DISPLAY_DEVICE structure.
-type displayDevice struct {
-	Size         uint32
-	DeviceName   [32]uint16
-	DeviceString [128]uint16
-	StateFlags   uint32
-	DeviceID     [128]uint16
-	DeviceKey    [128]uint16
-}
-
 func NewVirtualScreen() VirtualScreen {
 	// Retrieve the virtual screen's top-left corner
-	left, _, _ := windows.GetSystemMetrics.Call(uintptr(windows.SM_XVIRTUALSCREEN))
-	bottom, _, _ := windows.GetSystemMetrics.Call(uintptr(windows.SM_YVIRTUALSCREEN))
+	left := windows.GetSystemMetrics(windows.SM_XVIRTUALSCREEN)
+	bottom := windows.GetSystemMetrics(windows.SM_YVIRTUALSCREEN)
 
 	// Retrieve the virtual screen's dimensions
-	right, _, _ := windows.GetSystemMetrics.Call(uintptr(windows.SM_CXVIRTUALSCREEN))
-	top, _, _ := windows.GetSystemMetrics.Call(uintptr(windows.SM_CYVIRTUALSCREEN))
+	right := windows.GetSystemMetrics(windows.SM_CXVIRTUALSCREEN)
+	top := windows.GetSystemMetrics(windows.SM_CYVIRTUALSCREEN)
 
 	// Construct the VirtualScreen struct
 	vs := virtualScreen{
-		Left:   int32(left),
-		Right:  int32(right),
-		Top:    int32(top),
-		Bottom: int32(bottom),
+		Left:   left,
+		Right:  right,
+		Top:    top,
+		Bottom: bottom,
 	}
 	displays, err := vs.DetectDisplays()
 	if err != nil {
@@ -87,7 +40,7 @@ func NewVirtualScreen() VirtualScreen {
 	return &vs
 }
 
-func (vs *virtualScreen) CaptureBmp(options ...DisplayCaptureOption) ([]BMP, error) {
+func (vs *virtualScreen) CaptureBmpCtx(ctx context.Context, options ...DisplayCaptureOption) ([]BMP, error) {
 	displayCaptureOptions := &displayCaptureOption{}
 	for _, opt := range options {
 		opt(displayCaptureOptions)
@@ -95,6 +48,9 @@ func (vs *virtualScreen) CaptureBmp(options ...DisplayCaptureOption) ([]BMP, err
 	if displayCaptureOptions.BitCount == 0 {
 		displayCaptureOptions.BitCount = 24 // Default to 24 bits per pixel if not specified
 	}
+	if displayCaptureOptions.Grayscale && displayCaptureOptions.BitCount != 24 && displayCaptureOptions.BitCount != 32 {
+		return nil, fmt.Errorf("grayscale capture requires a bit count of 24 or 32, got %d", displayCaptureOptions.BitCount)
+	}
 
 	var displays []Display
 	if len(displayCaptureOptions.Displays) == 0 {
@@ -107,35 +63,25 @@ func (vs *virtualScreen) CaptureBmp(options ...DisplayCaptureOption) ([]BMP, err
 		displays = displayCaptureOptions.Displays
 	}
 
-	var bitmaps []BMP
-	for _, display := range displays {
-		// Get the device context of the entire screen
-		hdcScreen, err := windows.GetScreenDC()
-		if err != nil {
-			return nil, err
-		}
-		defer windows.ReleaseDC.Call(0, hdcScreen)
-
-		// Create a compatible device context
-		hdcMem, err := windows.CreateMemoryDC(hdcScreen)
+	// keep the excluded windows out of the capture until every display has been captured
+	for _, hwnd := range displayCaptureOptions.ExcludeWindows {
+		restore, err := windows.ExcludeWindowFromCapture(hwnd)
 		if err != nil {
 			return nil, err
 		}
-		defer windows.DeleteDC.Call(hdcMem)
+		defer restore()
+	}
 
+	return captureDisplays(ctx, displays, displayCaptureOptions, func(display Display, timing *CaptureTiming) (*BMP, error) {
 		var left, top, right, bottom int32
 		if displayCaptureOptions.Bounds != [4]int32{} {
 			// Use the specified bounds, adjusted to be relative to the current display
-			left = display.X + displayCaptureOptions.Bounds[0]
-			right = display.X + displayCaptureOptions.Bounds[1]
-			top = display.Y + displayCaptureOptions.Bounds[2]
-			bottom = display.Y + displayCaptureOptions.Bounds[3]
+			left, top = display.ToGlobal(displayCaptureOptions.Bounds[0], displayCaptureOptions.Bounds[2])
+			right, bottom = display.ToGlobal(displayCaptureOptions.Bounds[1], displayCaptureOptions.Bounds[3])
 		} else {
 			// Default to the entire display
-			left = display.X
-			top = display.Y
-			right = display.X + int32(display.Width)
-			bottom = display.Y + int32(display.Height)
+			left, top = display.ToGlobal(0, 0)
+			right, bottom = display.ToGlobal(int32(display.Width), int32(display.Height))
 		}
 
 		// Calculate the width and height based on the bounds
@@ -145,12 +91,41 @@ func (vs *virtualScreen) CaptureBmp(options ...DisplayCaptureOption) ([]BMP, err
 			return nil, fmt.Errorf("invalid capture bounds: width=%d, height=%d", width, height)
 		}
 
+		// align the capture to a fully composed frame
+		if displayCaptureOptions.WaitVSync {
+			if err := windows.WaitForVSync(); err != nil {
+				return nil, err
+			}
+		}
+
+		if displayCaptureOptions.Duplication && displayCaptureOptions.RasterOp == 0 && (displayCaptureOptions.BitCount == 24 || displayCaptureOptions.BitCount == 32) {
+			region := image.Rect(int(left-display.X), int(top-display.Y), int(right-display.X), int(bottom-display.Y))
+			// any failure of the duplication falls back to BitBlt below
+			if bmp, err := captureDuplicated(display, region, displayCaptureOptions, timing, 0); err == nil {
+				return bmp, nil
+			}
+		}
+
+		// Get the device context of the entire screen
+		hdcScreen, err := windows.GetScreenDC()
+		if err != nil {
+			return nil, err
+		}
+		defer windows.ReleaseScreenDC(hdcScreen)
+
+		// Create a compatible device context
+		hdcMem, err := windows.CreateMemoryDC(hdcScreen)
+		if err != nil {
+			return nil, err
+		}
+		defer windows.DeleteMemoryDC(hdcMem)
+
 		// Create a compatible bitmap
 		hBitmap, err := windows.CreateBitmap(hdcScreen, width, height)
 		if err != nil {
 			return nil, err
 		}
-		defer windows.DeleteObject.Call(hBitmap)
+		defer windows.DeleteBitmap(hBitmap)
 
 		// Select the bitmap into the memory device context
 		oldBitmap, err := windows.SelectBitmap(hdcMem, hBitmap)
@@ -166,73 +141,228 @@ func (vs *virtualScreen) CaptureBmp(options ...DisplayCaptureOption) ([]BMP, err
 		sourceY := top
 
 		// Copy the screen contents into the memory device context
-		err = windows.CopyScreenToMemory(hdcMem, hdcScreen, 0, 0, width, height, int(sourceX), int(sourceY))
+		copyStarted := time.Now()
+		err = windows.CopyScreenToMemory(hdcMem, hdcScreen, 0, 0, width, height, int(sourceX), int(sourceY), displayCaptureOptions.RasterOp)
 		if err != nil {
 			return nil, err
 		}
+		timing.Copy = time.Since(copyStarted)
 
-		dpiX, _, _ := windows.GetDeviceCaps.Call(hdcScreen, uintptr(windows.LOGPIXELSX)) // Horizontal DPI
-		dpiY, _, _ := windows.GetDeviceCaps.Call(hdcScreen, uintptr(windows.LOGPIXELSY)) // Vertical DPI
+		dpiX := windows.GetDeviceCaps(hdcScreen, windows.LOGPIXELSX) // Horizontal DPI
+		dpiY := windows.GetDeviceCaps(hdcScreen, windows.LOGPIXELSY) // Vertical DPI
 
 		// Convert DPI to pixels per meter
 		pixelsPerMeterX := calcPixelsPerMeter(float64(dpiX))
 		pixelsPerMeterY := calcPixelsPerMeter(float64(dpiY))
 
 		// Retrieve the bitmap data
-		var bmpInfo bitmapInfo
 		infoHeader := buildBitMapInfoHeader(int32(width), int32(height), pixelsPerMeterX, pixelsPerMeterY, uint16(displayCaptureOptions.BitCount), windows.BI_RGB)
-		bmpInfo.BmiHeader = *infoHeader
+		bmpInfo := windows.BitmapInfo{BmiHeader: windows.BitmapInfoHeader(*infoHeader)}
 
 		bytesPerPixel := tools.CalcBytesPerPixel(displayCaptureOptions.BitCount)
 		bitmapSize := calcBmpSize(width, height, bytesPerPixel, displayCaptureOptions.BitCount)
 
-		// Allocate memory for the bitmap data
-		bitmapData := make([]byte, bitmapSize)
+		// Allocate memory for the bitmap data, or reuse the buffer given with ReuseBufferOpt
+		bitmapData := displayCaptureOptions.pixelBuffer(bitmapSize)
+
+		// GetDIBits can not be interrupted, so this is the last point to give up on the display before the expensive copy
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
 		// Get the bitmap data
-		ret, _, err := windows.GetDIBits.Call(
-			hdcMem, hBitmap, 0, uintptr(height),
-			uintptr(unsafe.Pointer(&bitmapData[0])),
-			uintptr(unsafe.Pointer(&bmpInfo)),
-			uintptr(windows.DIB_RGB_COLORS),
-		)
-		if ret == 0 {
-			return nil, fmt.Errorf("failed to retrieve bitmap data: %w", err)
+		readStarted := time.Now()
+		if err := windows.GetBitmapBits(hdcMem, hBitmap, height, bitmapData, &bmpInfo); err != nil {
+			return nil, err
+		}
+		timing.Read = time.Since(readStarted)
+		if displayCaptureOptions.Grayscale {
+			grayscalePixels(bitmapData, width, height, bytesPerPixel)
 		}
 
 		fileHeader := buildBitMapHeader(bmpInfo.BmiHeader.BiSize, uint32(len(bitmapData)))
-		bitmaps = append(bitmaps, BMP{
+		return &BMP{
 			FileHeader: *fileHeader,
-			InfoHeader: bmpInfo.BmiHeader,
+			InfoHeader: bitmapInfoHeader(bmpInfo.BmiHeader),
 			Data:       bitmapData,
 			Width:      width,
 			Height:     height,
-		})
+			Grayscale:  displayCaptureOptions.Grayscale,
+		}, nil
+	})
+}
+
+// duplications holds the desktop duplication of every display captured with DesktopDuplicationOpt, keyed by the top-left corner of the display.
+// The lock is held while a duplication is used, since a duplication is not safe for concurrent use.
+var duplications = struct {
+	mu       sync.Mutex
+	byOrigin map[image.Point]*duplication
+	nextID   uint64
+}{byOrigin: make(map[image.Point]*duplication)}
+
+// duplication is a cached desktop duplication of a display.
+type duplication struct {
+	*windows.OutputDuplication
+	id uint64 // identifies the duplication in the BMPs captured from it, starting at 1
+}
+
+// captureDuplicated captures a region of a display with its desktop duplication, starting the duplication if the display was not duplicated yet.
+// A duplication that fails is closed, and a duplication whose access was lost is replaced once.
+//
+// Parameters:
+//   - display: The display to capture.
+//   - region: The region to capture, relative to the top-left corner of the display.
+//   - opts: The capture options, the bit count must be 24 or 32.
+//   - timing: The timing of the capture, its Copy and Read durations are filled in.
+//   - wait: How long to wait for the display to change, zero captures the latest frame right away.
+//
+// Returns:
+//   - *BMP: The captured region, with the regions that changed since the previous duplicated capture of the display.
+//   - error: An error if the display can not be duplicated or the region is not within its frame.
+func captureDuplicated(display Display, region image.Rectangle, opts *displayCaptureOption, timing *CaptureTiming, wait time.Duration) (*BMP, error) {
+	duplications.mu.Lock()
+	defer duplications.mu.Unlock()
+
+	origin := image.Pt(int(display.X), int(display.Y))
+	for attempt := 0; ; attempt++ {
+		dup, ok := duplications.byOrigin[origin]
+		if !ok {
+			output, err := windows.NewOutputDuplication(display.X, display.Y)
+			if err != nil {
+				return nil, err
+			}
+			duplications.nextID++
+			dup = &duplication{OutputDuplication: output, id: duplications.nextID}
+			duplications.byOrigin[origin] = dup
+		}
+
+		copyStarted := time.Now()
+		frame, err := dup.Frame(wait)
+		if err != nil {
+			dup.Close()
+			delete(duplications.byOrigin, origin)
+			if errors.Is(err, windows.ErrDuplicationAccessLost) && attempt == 0 {
+				continue
+			}
+			return nil, err
+		}
+		timing.Copy = time.Since(copyStarted)
+
+		readStarted := time.Now()
+		bmp, err := bgraFrameToBMP(frame.Pixels, frame.Pitch, region, opts.BitCount, opts.pixelBuffer)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Grayscale {
+			grayscalePixels(bmp.Data, bmp.Width, bmp.Height, opts.BitCount/8)
+			bmp.Grayscale = true
+		}
+		timing.Read = time.Since(readStarted)
+
+		var dirty []image.Rectangle
+		if frame.DirtyRects != nil {
+			dirty = make([]image.Rectangle, len(frame.DirtyRects))
+			for i, r := range frame.DirtyRects {
+				dirty[i] = image.Rect(int(r.Left), int(r.Top), int(r.Right), int(r.Bottom))
+			}
+		}
+		bmp.DirtyRects = dirtyRectsIn(dirty, region)
+		bmp.frameSource, bmp.frameSeq = dup.id, frame.Seq
+		return bmp, nil
+	}
+}
+
+// streamWaitSlice bounds how long doAwaitChange waits for a change notification at a time, so a stream notices promptly that its context is done.
+const streamWaitSlice = 100 * time.Millisecond
+
+// doAwaitChange waits for the display to change with its desktop duplication, if the capture options ask for it.
+// The duplication only delivers a frame once the screen was updated, so no frames are captured while the display is static.
+//
+// Parameters:
+//   - ctx: The context that stops the wait.
+//   - display: The display to wait on.
+//   - opts: The capture options, only DesktopDuplicationOpt captures enable the wait.
+//   - current: Whether to return the current frame right away instead of waiting for a change, such as for the first frame of a stream.
+//
+// Returns:
+//   - *BMP: The changed frame, with the regions that changed in DirtyRects, nil if the display can not be waited on.
+//   - bool: False if change notifications are not available for the capture, such as when the display can not be duplicated, true otherwise.
+//   - error: The context's error once it is done.
+func doAwaitChange(ctx context.Context, display Display, opts *displayCaptureOption, current bool) (*BMP, bool, error) {
+	bitCount := opts.BitCount
+	if bitCount == 0 {
+		bitCount = 24
+	}
+	if !opts.Duplication || opts.RasterOp != 0 || (bitCount != 24 && bitCount != 32) {
+		return nil, false, nil
 	}
+	frameOpts := *opts
+	frameOpts.BitCount = bitCount
 
-	return bitmaps, nil
+	region := image.Rect(0, 0, display.Width, display.Height)
+	if opts.Bounds != [4]int32{} {
+		region = image.Rect(int(opts.Bounds[0]), int(opts.Bounds[2]), int(opts.Bounds[1]), int(opts.Bounds[3]))
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, true, err
+		}
+		wait := streamWaitSlice
+		if current {
+			wait = 0
+		}
+		var timing CaptureTiming
+		bmp, err := captureDuplicated(display, region, &frameOpts, &timing, wait)
+		if err != nil {
+			return nil, false, nil
+		}
+		if current {
+			return bmp, true, nil
+		}
+		// a frame without dirty rects in the region is either unchanged, or only changed elsewhere on the display
+		if bmp.DirtyRects == nil || len(bmp.DirtyRects) > 0 {
+			return bmp, true, nil
+		}
+	}
+}
+
+// CloseDesktopDuplications stops the desktop duplications started by captures taken with DesktopDuplicationOpt and releases their resources, such as at shutdown.
+// The next capture taken with the option starts a new duplication.
+func CloseDesktopDuplications() {
+	duplications.mu.Lock()
+	defer duplications.mu.Unlock()
+	for origin, dup := range duplications.byOrigin {
+		dup.Close()
+		delete(duplications.byOrigin, origin)
+	}
+}
+
+// doGetCursorPosition retrieves the position of the mouse cursor in virtual screen coordinates, using GetCursorPos.
+//
+// Returns:
+//   - int32: The x-coordinate of the cursor.
+//   - int32: The y-coordinate of the cursor.
+//   - error: An error if the position could not be retrieved.
+func doGetCursorPosition() (int32, int32, error) {
+	return windows.GetCursorPos()
 }
 
 func (vs *virtualScreen) DetectDisplays() ([]Display, error) {
 	var displays []Display
-	var device displayDevice
-	device.Size = uint32(unsafe.Sizeof(device))
 
 	for i := 0; ; i++ {
-		ret, _, _ := windows.EnumDisplayDevices.Call(0, uintptr(i), uintptr(unsafe.Pointer(&device)), uintptr(0x00000001))
-		if ret == 0 {
+		device, ok := windows.EnumDisplayDevices(i)
+		if !ok {
 			break
 		}
 
 		// Skip devices that are not attached to the desktop
-		if device.StateFlags&0x00000001 == 0 { // DISPLAY_DEVICE_ATTACHED_TO_DESKTOP
+		if device.StateFlags&windows.DISPLAY_DEVICE_ATTACHED_TO_DESKTOP == 0 {
 			continue
 		}
 
-		var dm devMode
-		dm.Size = uint16(unsafe.Sizeof(dm))
-		ret, _, _ = windows.EnumDisplaySettings.Call(uintptr(unsafe.Pointer(&device.DeviceName)), uintptr(0xFFFFFFFF), uintptr(unsafe.Pointer(&dm)))
-		if ret == 0 {
+		dm, err := windows.GetCurrentDisplaySettings(device.DeviceName)
+		if err != nil {
 			continue
 		}
 		var primary bool
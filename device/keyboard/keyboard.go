@@ -1,3 +1,122 @@
 package keyboard
 
-type KeyCode uint16
\ No newline at end of file
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/Carmen-Shannon/automation/device/keyboard/key_codes"
+)
+
+type KeyCode uint16
+
+// keyPollInterval is how often WaitForKey polls the state of the key.
+const keyPollInterval = 10 * time.Millisecond
+
+// IsKeyPressed reports whether a key is currently held down as the OS sees it.
+// This includes keys held down by the user as well as ones pressed by KeyPress, so it can be used for an abort key,
+// or to check whether injected modifiers are still down.
+//
+// Parameters:
+//   - code: The key code of the key to query.
+//
+// Returns:
+//   - bool: True if the key is held down, otherwise false.
+//   - error: An error if the key code is invalid or the state could not be queried, otherwise nil.
+func IsKeyPressed(code key_codes.KeyCode) (bool, error) {
+	if code == 0 {
+		return false, errors.New("invalid key code entered")
+	}
+	return doIsKeyPressed(code)
+}
+
+// PressRune presses the key that types a character on the current keyboard layout, together with the modifiers it needs, such as shift for an uppercase letter.
+// The options are the same as for KeyPress, except the key codes, which are replaced by the ones of the character.
+//
+// Parameters:
+//   - r: The character to press the key of.
+//   - options: Optional parameters for the key press, such as the duration.
+//
+// Returns:
+//   - error: An error if the character has no key on the current platform and layout, or the key press fails, otherwise nil.
+func PressRune(r rune, options ...KeyboardPressOption) error {
+	keyCodes, err := runeKeyCodes(r)
+	if err != nil {
+		return err
+	}
+	return KeyPress(append(slices.Clip(options), KeyCodeOpt(keyCodes))...)
+}
+
+// WaitForKey blocks until a key is held down, polling its state.
+//
+// Parameters:
+//   - ctx: The context that bounds how long to wait for the key.
+//   - code: The key code of the key to wait for.
+//
+// Returns:
+//   - error: The context's error if it is done before the key is pressed, an error if the state could not be queried, otherwise nil.
+func WaitForKey(ctx context.Context, code key_codes.KeyCode) error {
+	ticker := time.NewTicker(keyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		pressed, err := IsKeyPressed(code)
+		if err != nil {
+			return err
+		}
+		if pressed {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// pressKeys presses the keys in order, holds them for the duration, then releases them in reverse order, so modifiers are let go of last.
+// If a key fails to go down, the keys already pressed are released before the error is returned, so none are left stuck down in the OS.
+//
+// Parameters:
+//   - codes: The platform key codes to press, modifiers first.
+//   - duration: How long to hold the keys down.
+//   - down: The function that sends the key down event of a key.
+//   - up: The function that sends the key up event of a key.
+//
+// Returns:
+//   - error: The error of the key that failed to go down, or the first error encountered while releasing the keys, otherwise nil.
+func pressKeys(codes []uint8, duration time.Duration, down, up func(code uint8) error) error {
+	for i, code := range codes {
+		if err := down(code); err != nil {
+			_ = releaseKeys(codes[:i], up)
+			return err
+		}
+	}
+
+	if duration > 0 {
+		time.Sleep(duration)
+	}
+
+	return releaseKeys(codes, up)
+}
+
+// releaseKeys sends a key up event for each of the given key codes in reverse order.
+// Every key is released even if one of the events fails, so that no key is left stuck down in the OS.
+//
+// Parameters:
+//   - codes: The platform key codes to release, in the order they were pressed.
+//   - up: The function that sends the key up event of a key.
+//
+// Returns:
+//   - error: The first error encountered while releasing the keys, otherwise nil.
+func releaseKeys(codes []uint8, up func(code uint8) error) error {
+	var firstErr error
+	for i := len(codes) - 1; i >= 0; i-- {
+		if err := up(codes[i]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
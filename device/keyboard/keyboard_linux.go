@@ -5,13 +5,29 @@ package keyboard
 
 import (
 	"errors"
+	"fmt"
 	"slices"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/Carmen-Shannon/automation/device/keyboard/key_codes"
 	linux "github.com/Carmen-Shannon/automation/tools/_linux"
 )
 
+// KeyPress presses the keys given by the options together, holds them for the duration, then releases them.
+// The key codes are keysyms, which are mapped to the keys of the current keyboard layout and pressed through the XTEST extension,
+// so a key code names a symbol rather than a physical key and the keys pressed for it depend on the layout. A keysym on the shifted level of a key
+// is pressed together with shift, and keysyms the layout lacks are pressed with xdotool instead, which remaps a spare key for them. Use Type to type text.
+//
+// Parameters:
+//   - options: The keyboard press options, such as the key codes and duration.
+//
+// Returns:
+//   - error: An error if a key code is invalid or the keys could not be pressed, otherwise nil.
 func KeyPress(options ...KeyboardPressOption) error {
 	kbpOpt := &keyboardPressOption{}
 	for _, opt := range options {
@@ -20,6 +36,58 @@ func KeyPress(options ...KeyboardPressOption) error {
 	if slices.Contains(kbpOpt.KeyCodes, 0) {
 		return errors.New("invalid key code entered")
 	}
+	if err := linux.CheckX11Session("press keys"); err != nil {
+		return err
+	}
+
+	keycodes, ok, err := keycodesForPress(kbpOpt.KeyCodes)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return keyPressXdotool(kbpOpt)
+	}
+
+	codes := make([]uint8, len(keycodes))
+	for i, keycode := range keycodes {
+		codes[i] = byte(keycode)
+	}
+	return pressKeys(codes, time.Duration(kbpOpt.Duration)*time.Millisecond, keyDown, keyUp)
+}
+
+// keyDown sends the key press event of a keycode through the XTEST extension.
+//
+// Parameters:
+//   - keycode: The keycode of the key.
+//
+// Returns:
+//   - error: An error if the event could not be sent, otherwise nil.
+func keyDown(keycode uint8) error {
+	return linux.FakeInput(linux.FakeEvent{Type: xproto.KeyPress, Detail: keycode})
+}
+
+// keyUp sends the key release event of a keycode through the XTEST extension.
+//
+// Parameters:
+//   - keycode: The keycode of the key.
+//
+// Returns:
+//   - error: An error if the event could not be sent, otherwise nil.
+func keyUp(keycode uint8) error {
+	return linux.FakeInput(linux.FakeEvent{Type: xproto.KeyRelease, Detail: keycode})
+}
+
+// keyPressXdotool presses the keys given by the options with xdotool, which remaps a spare key for keysyms the current layout lacks.
+//
+// Parameters:
+//   - kbpOpt: The keyboard press options.
+//
+// Returns:
+//   - error: An error if xdotool is not installed or fails, otherwise nil.
+func keyPressXdotool(kbpOpt *keyboardPressOption) error {
+	if err := linux.RequireTool("xdotool"); err != nil {
+		return err
+	}
 
 	action := []string{}
 	for _, keyCode := range kbpOpt.KeyCodes {
@@ -30,6 +98,8 @@ func KeyPress(options ...KeyboardPressOption) error {
 	actionStr := strings.Join(action, "+")
 	err := linux.ExecuteXdotoolKeyDown(actionStr)
 	if err != nil {
+		// xdotool may have pressed some of the keys before failing, release them so none are left stuck down
+		_ = linux.ExecuteXdotoolKeyUp(actionStr)
 		return err
 	}
 
@@ -43,3 +113,213 @@ func KeyPress(options ...KeyboardPressOption) error {
 	}
 	return nil
 }
+
+// keycodesForPress maps the keysyms of a key press to the keycodes to press, in order, on the current keyboard layout.
+// A keysym found only on the shifted level of a key is preceded by shift, unless shift is pressed anyway.
+//
+// Parameters:
+//   - codes: The keysyms to press.
+//
+// Returns:
+//   - []xproto.Keycode: The keycodes to press, in order.
+//   - bool: False if a keysym is not on the first two levels of any key, in which case no keycodes are returned.
+//   - error: An error if the keyboard mapping could not be retrieved.
+func keycodesForPress(codes []key_codes.KeyCode) ([]xproto.Keycode, bool, error) {
+	var keycodes []xproto.Keycode
+	found := true
+	err := linux.WithXConn(func(conn *xgb.Conn, _ xproto.Window) error {
+		mapping, minKeycode, err := keyboardMapping(conn)
+		if err != nil {
+			return err
+		}
+		perKeycode := int(mapping.KeysymsPerKeycode)
+		shift, _, hasShift := keycodeForKeysym(mapping.Keysyms, perKeycode, minKeycode, xkShiftL)
+		for _, code := range codes {
+			keycode, shifted, ok := keycodeForKeysym(mapping.Keysyms, perKeycode, minKeycode, xproto.Keysym(code))
+			if !ok || (shifted && !hasShift) {
+				found = false
+				return nil
+			}
+			if shifted && !slices.Contains(keycodes, shift) {
+				keycodes = append(keycodes, shift)
+			}
+			if !slices.Contains(keycodes, keycode) {
+				keycodes = append(keycodes, keycode)
+			}
+		}
+		return nil
+	})
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return keycodes, true, nil
+}
+
+// xkShiftL is the keysym of the left shift key.
+const xkShiftL = 0xffe1
+
+// keyboardMapping retrieves the keysyms of every keycode of the keyboard.
+//
+// Parameters:
+//   - conn: The X connection.
+//
+// Returns:
+//   - *xproto.GetKeyboardMappingReply: The keyboard mapping.
+//   - xproto.Keycode: The first keycode of the mapping.
+//   - error: An error if the mapping could not be retrieved.
+func keyboardMapping(conn *xgb.Conn) (*xproto.GetKeyboardMappingReply, xproto.Keycode, error) {
+	setup := xproto.Setup(conn)
+	count := byte(setup.MaxKeycode - setup.MinKeycode + 1)
+	mapping, err := xproto.GetKeyboardMapping(conn, setup.MinKeycode, count).Reply()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get keyboard mapping: %w", err)
+	}
+	return mapping, setup.MinKeycode, nil
+}
+
+// Type types text with xdotool, which resolves each character to a key of the current keyboard layout,
+// so the text comes out the same on any layout, rather than assuming the layout of the key codes is US.
+//
+// Parameters:
+//   - text: The text to type.
+//
+// Returns:
+//   - error: An error if xdotool fails, otherwise nil.
+func Type(text string) error {
+	if text == "" {
+		return nil
+	}
+	if err := linux.CheckX11Session("type text"); err != nil {
+		return err
+	}
+	if err := linux.RequireTool("xdotool"); err != nil {
+		return err
+	}
+	return linux.ExecuteXdotoolType(text)
+}
+
+// runeKeyCodes translates a character to its keysym.
+// KeyPress presses shift for keysyms on the shifted level of a key, and remaps a spare key for keysyms the layout lacks,
+// so no modifiers are added here.
+//
+// Parameters:
+//   - r: The character.
+//
+// Returns:
+//   - []key_codes.KeyCode: The keysym of the character.
+//   - error: An error if the character is a control character or not a valid character, which have no keysym.
+func runeKeyCodes(r rune) ([]key_codes.KeyCode, error) {
+	switch {
+	case r == '\n' || r == '\r':
+		return []key_codes.KeyCode{0xff0d}, nil // XK_Return
+	case r == '\t':
+		return []key_codes.KeyCode{0xff09}, nil // XK_Tab
+	case r < 0x20 || (r >= 0x7f && r < 0xa0) || r > unicode.MaxRune || !utf8.ValidRune(r):
+		return nil, fmt.Errorf("no key types %q", r)
+	case r <= 0xff:
+		// the keysyms of Latin-1 characters are their code points
+		return []key_codes.KeyCode{key_codes.KeyCode(r)}, nil
+	default:
+		// every other character has a unicode keysym
+		return []key_codes.KeyCode{key_codes.KeyCode(0x01000000 + r)}, nil
+	}
+}
+
+// doIsKeyPressed reports whether a key is currently held down, using XQueryKeymap.
+// The keymap is indexed by keycode, so every keycode the keysym of the key is mapped to is checked.
+//
+// Parameters:
+//   - code: The keysym of the key.
+//
+// Returns:
+//   - bool: True if the key is held down, otherwise false.
+//   - error: An error if the key is not mapped to any keycode or the X server could not be queried, otherwise nil.
+func doIsKeyPressed(code key_codes.KeyCode) (bool, error) {
+	var down bool
+	err := linux.WithXConn(func(conn *xgb.Conn, _ xproto.Window) error {
+		mapping, minKeycode, err := keyboardMapping(conn)
+		if err != nil {
+			return err
+		}
+		keycodes := keycodesForKeysym(mapping.Keysyms, int(mapping.KeysymsPerKeycode), minKeycode, xproto.Keysym(code))
+		if len(keycodes) == 0 {
+			return fmt.Errorf("key code %#x is not mapped to any key", uint32(code))
+		}
+
+		keymap, err := xproto.QueryKeymap(conn).Reply()
+		if err != nil {
+			return fmt.Errorf("failed to query keymap: %w", err)
+		}
+		for _, keycode := range keycodes {
+			if keymapKeyDown(keymap.Keys, keycode) {
+				down = true
+				return nil
+			}
+		}
+		return nil
+	})
+	return down, err
+}
+
+// keycodesForKeysym finds the keycodes a keysym is mapped to in a keyboard mapping.
+//
+// Parameters:
+//   - keysyms: The keysyms of the keyboard mapping, keysymsPerKeycode for each keycode starting from minKeycode.
+//   - keysymsPerKeycode: The number of keysyms of each keycode.
+//   - minKeycode: The first keycode of the mapping.
+//   - keysym: The keysym to find.
+//
+// Returns:
+//   - []xproto.Keycode: The keycodes the keysym is mapped to, in ascending order.
+func keycodesForKeysym(keysyms []xproto.Keysym, keysymsPerKeycode int, minKeycode xproto.Keycode, keysym xproto.Keysym) []xproto.Keycode {
+	if keysymsPerKeycode <= 0 {
+		return nil
+	}
+	var keycodes []xproto.Keycode
+	for i := 0; i+keysymsPerKeycode <= len(keysyms); i += keysymsPerKeycode {
+		if slices.Contains(keysyms[i:i+keysymsPerKeycode], keysym) {
+			keycodes = append(keycodes, minKeycode+xproto.Keycode(i/keysymsPerKeycode))
+		}
+	}
+	return keycodes
+}
+
+// keycodeForKeysym finds the key a keysym is on in a keyboard mapping, preferring keys that type it without shift.
+//
+// Parameters:
+//   - keysyms: The keysyms of the keyboard mapping, keysymsPerKeycode for each keycode starting from minKeycode.
+//   - keysymsPerKeycode: The number of keysyms of each keycode.
+//   - minKeycode: The first keycode of the mapping.
+//   - keysym: The keysym to find.
+//
+// Returns:
+//   - xproto.Keycode: The keycode of the key.
+//   - bool: True if the keysym is on the shifted level of the key, false if it is on its first level.
+//   - bool: True if the keysym is on the first or shifted level of any key, false otherwise.
+func keycodeForKeysym(keysyms []xproto.Keysym, keysymsPerKeycode int, minKeycode xproto.Keycode, keysym xproto.Keysym) (xproto.Keycode, bool, bool) {
+	for level := range min(keysymsPerKeycode, 2) {
+		for i := level; i < len(keysyms); i += keysymsPerKeycode {
+			if keysyms[i] == keysym {
+				return minKeycode + xproto.Keycode(i/keysymsPerKeycode), level == 1, true
+			}
+		}
+	}
+	return 0, false, false
+}
+
+// keymapKeyDown decodes whether a key is down from the keymap returned by XQueryKeymap.
+// The keymap is a bit vector with one bit per keycode, the bit for keycode N is bit N%8 of byte N/8.
+//
+// Parameters:
+//   - keys: The keymap.
+//   - keycode: The keycode of the key.
+//
+// Returns:
+//   - bool: True if the key is down, otherwise false.
+func keymapKeyDown(keys []byte, keycode xproto.Keycode) bool {
+	idx := int(keycode) / 8
+	if idx >= len(keys) {
+		return false
+	}
+	return keys[idx]&(1<<(keycode%8)) != 0
+}
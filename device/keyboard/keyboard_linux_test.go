@@ -0,0 +1,121 @@
+//go:build linux
+// +build linux
+
+package keyboard
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// cannedKeymap is an XQueryKeymap reply with keycode 38 (a), 50 (Shift_L) and 255 held down.
+var cannedKeymap = func() []byte {
+	keys := make([]byte, 32)
+	keys[4] = 0x40  // keycode 38 is bit 6 of byte 4
+	keys[6] = 0x04  // keycode 50 is bit 2 of byte 6
+	keys[31] = 0x80 // keycode 255 is bit 7 of byte 31
+	return keys
+}()
+
+func TestKeymapKeyDown(t *testing.T) {
+	tests := []struct {
+		keycode xproto.Keycode
+		keys    []byte
+		want    bool
+	}{
+		{keycode: 38, keys: cannedKeymap, want: true},
+		{keycode: 50, keys: cannedKeymap, want: true},
+		{keycode: 255, keys: cannedKeymap, want: true},
+		{keycode: 39, keys: cannedKeymap, want: false},
+		{keycode: 37, keys: cannedKeymap, want: false},
+		{keycode: 8, keys: cannedKeymap, want: false},
+		{keycode: 38, keys: make([]byte, 32), want: false},
+		// a short reply does not cover the keycode
+		{keycode: 255, keys: cannedKeymap[:8], want: false},
+	}
+	for _, tt := range tests {
+		if got := keymapKeyDown(tt.keys, tt.keycode); got != tt.want {
+			t.Errorf("keymapKeyDown(%d bytes, %d) = %v, want %v", len(tt.keys), tt.keycode, got, tt.want)
+		}
+	}
+}
+
+// cannedMapping is a GetKeyboardMapping reply with two keysyms per keycode, starting from keycode 8.
+// The a key is keycode 38, and the Shift_L keysym is on both keycode 50 and keycode 62, as on layouts that map both shift keys to it.
+var cannedMapping = func() []xproto.Keysym {
+	keysyms := make([]xproto.Keysym, 2*(70-8))
+	set := func(keycode int, syms ...xproto.Keysym) {
+		copy(keysyms[(keycode-8)*2:], syms)
+	}
+	set(38, 0x61, 0x41) // a, A
+	set(10, 0x31, 0x21) // 1, !
+	set(50, 0xffe1)     // Shift_L
+	set(62, 0xffe1)     // Shift_L
+	return keysyms
+}()
+
+func TestKeycodesForKeysym(t *testing.T) {
+	tests := []struct {
+		name   string
+		keysym xproto.Keysym
+		want   []xproto.Keycode
+	}{
+		{name: "first level", keysym: 0x61, want: []xproto.Keycode{38}},
+		{name: "shifted level", keysym: 0x21, want: []xproto.Keycode{10}},
+		{name: "on several keys", keysym: 0xffe1, want: []xproto.Keycode{50, 62}},
+		{name: "unmapped", keysym: 0xff0d, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keycodesForKeysym(cannedMapping, 2, 8, tt.keysym); !slices.Equal(got, tt.want) {
+				t.Errorf("keycodesForKeysym(%#x) = %v, want %v", tt.keysym, got, tt.want)
+			}
+		})
+	}
+	if got := keycodesForKeysym(cannedMapping, 0, 8, 0x61); got != nil {
+		t.Errorf("keycodesForKeysym() with no keysyms per keycode = %v, want nil", got)
+	}
+}
+
+func TestKeyDownFromCannedReplies(t *testing.T) {
+	// the decoding doIsKeyPressed does with the replies of the X server
+	pressed := func(keysym xproto.Keysym) bool {
+		for _, keycode := range keycodesForKeysym(cannedMapping, 2, 8, keysym) {
+			if keymapKeyDown(cannedKeymap, keycode) {
+				return true
+			}
+		}
+		return false
+	}
+	if !pressed(0x61) {
+		t.Error("a is not pressed, want it pressed")
+	}
+	if !pressed(0xffe1) {
+		t.Error("Shift_L is not pressed, want it pressed on keycode 50")
+	}
+	if pressed(0x31) {
+		t.Error("1 is pressed, want it released")
+	}
+}
+
+func TestKeycodeForKeysymPrefersFirstLevel(t *testing.T) {
+	tests := []struct {
+		keysym      xproto.Keysym
+		wantKeycode xproto.Keycode
+		wantShift   bool
+		wantFound   bool
+	}{
+		{keysym: 0x61, wantKeycode: 38, wantShift: false, wantFound: true},
+		{keysym: 0x41, wantKeycode: 38, wantShift: true, wantFound: true},
+		{keysym: 0x21, wantKeycode: 10, wantShift: true, wantFound: true},
+		{keysym: 0xff0d, wantFound: false},
+	}
+	for _, tt := range tests {
+		keycode, shift, found := keycodeForKeysym(cannedMapping, 2, 8, tt.keysym)
+		if keycode != tt.wantKeycode || shift != tt.wantShift || found != tt.wantFound {
+			t.Errorf("keycodeForKeysym(%#x) = %d, %v, %v, want %d, %v, %v", tt.keysym, keycode, shift, found, tt.wantKeycode, tt.wantShift, tt.wantFound)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package keyboard
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// fakeKeys records the key events sent to it, and fails the down event of the key codes in failDown and the up event of those in failUp.
+type fakeKeys struct {
+	down, up         []uint8
+	failDown, failUp []uint8
+}
+
+var errFakeKey = errors.New("fake key event failed")
+
+func (f *fakeKeys) keyDown(code uint8) error {
+	if slices.Contains(f.failDown, code) {
+		return errFakeKey
+	}
+	f.down = append(f.down, code)
+	return nil
+}
+
+func (f *fakeKeys) keyUp(code uint8) error {
+	if slices.Contains(f.failUp, code) {
+		return errFakeKey
+	}
+	f.up = append(f.up, code)
+	return nil
+}
+
+func TestPressKeysReleasesInReverseOrder(t *testing.T) {
+	f := &fakeKeys{}
+	if err := pressKeys([]uint8{1, 2, 3}, 0, f.keyDown, f.keyUp); err != nil {
+		t.Fatalf("pressKeys() error = %v", err)
+	}
+	if want := []uint8{1, 2, 3}; !slices.Equal(f.down, want) {
+		t.Errorf("keys pressed = %v, want %v", f.down, want)
+	}
+	if want := []uint8{3, 2, 1}; !slices.Equal(f.up, want) {
+		t.Errorf("keys released = %v, want %v", f.up, want)
+	}
+}
+
+func TestPressKeysReleasesPressedKeysWhenAKeyFails(t *testing.T) {
+	f := &fakeKeys{failDown: []uint8{2}}
+	err := pressKeys([]uint8{1, 2, 3}, 0, f.keyDown, f.keyUp)
+	if !errors.Is(err, errFakeKey) {
+		t.Fatalf("pressKeys() error = %v, want %v", err, errFakeKey)
+	}
+	if want := []uint8{1}; !slices.Equal(f.down, want) {
+		t.Errorf("keys pressed = %v, want %v, no key may be pressed after the one that failed", f.down, want)
+	}
+	if want := []uint8{1}; !slices.Equal(f.up, want) {
+		t.Errorf("keys released = %v, want every key that was pressed, %v", f.up, want)
+	}
+}
+
+func TestPressKeysReleasesEveryKeyWhenAReleaseFails(t *testing.T) {
+	f := &fakeKeys{failUp: []uint8{2}}
+	err := pressKeys([]uint8{1, 2, 3}, 0, f.keyDown, f.keyUp)
+	if !errors.Is(err, errFakeKey) {
+		t.Fatalf("pressKeys() error = %v, want %v", err, errFakeKey)
+	}
+	if want := []uint8{3, 1}; !slices.Equal(f.up, want) {
+		t.Errorf("keys released = %v, want %v, the keys around the failed release must still be released", f.up, want)
+	}
+}
@@ -7,8 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"slices"
+	"strings"
 	"time"
 
+	"github.com/Carmen-Shannon/automation/device/keyboard/key_codes"
 	windows "github.com/Carmen-Shannon/automation/tools/_windows"
 )
 
@@ -31,23 +33,95 @@ func KeyPress(options ...KeyboardPressOption) error {
 		return errors.New("invalid key code entered")
 	}
 
-	for _, keyCode := range kbpOpt.KeyCodes {
-		ret, _, err := windows.KeybdEvent.Call(uintptr(keyCode), 0, 0, 0)
-		if ret == 0 {
-			return fmt.Errorf("failed to send key event: %v", err)
-		}
+	codes := make([]uint8, len(kbpOpt.KeyCodes))
+	for i, keyCode := range kbpOpt.KeyCodes {
+		codes[i] = uint8(keyCode)
 	}
+	return pressKeys(codes, time.Duration(kbpOpt.Duration)*time.Millisecond, keyDown, keyUp)
+}
 
-	if kbpOpt.Duration > 0 {
-		time.Sleep(time.Duration(kbpOpt.Duration) * time.Millisecond)
-	}
+// keyDown sends the key down event of a virtual key with keybd_event.
+//
+// Parameters:
+//   - vk: The virtual key code of the key.
+//
+// Returns:
+//   - error: An error if the event could not be sent, otherwise nil.
+func keyDown(vk uint8) error {
+	return windows.KeybdEvent(vk, 0)
+}
 
-	for _, keyCode := range kbpOpt.KeyCodes {
-		ret, _, err := windows.KeybdEvent.Call(uintptr(keyCode), 0, 2, 0)
-		if ret == 0 {
-			return fmt.Errorf("failed to send key event: %v", err)
+// keyUp sends the key up event of a virtual key with keybd_event.
+//
+// Parameters:
+//   - vk: The virtual key code of the key.
+//
+// Returns:
+//   - error: An error if the event could not be sent, otherwise nil.
+func keyUp(vk uint8) error {
+	return windows.KeybdEvent(vk, windows.KEYEVENTF_KEYUP)
+}
+
+// Type types text by sending each character as a unicode key event with SendInput, so the text does not depend on the keyboard layout.
+// Line breaks and tabs are sent as the enter and tab keys instead, which applications handle more reliably than the characters.
+// The whole text is sent at once, so input from the user is not interleaved with it.
+//
+// Parameters:
+//   - text: The text to type.
+//
+// Returns:
+//   - error: An error if not all of the text could be sent, such as when the input is blocked, otherwise nil.
+func Type(text string) error {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var inputs []windows.Input
+	for _, r := range text {
+		switch r {
+		case '\n', '\r':
+			inputs = append(inputs, windows.KeyDownInput(windows.VK_RETURN), windows.KeyUpInput(windows.VK_RETURN))
+		case '\t':
+			inputs = append(inputs, windows.KeyDownInput(windows.VK_TAB), windows.KeyUpInput(windows.VK_TAB))
+		default:
+			inputs = append(inputs, windows.UnicodeCharInput(r)...)
 		}
 	}
+	_, err := windows.SendInputs(inputs)
+	return err
+}
+
+// runeKeyCodes translates a character to the virtual key codes that type it on the current keyboard layout, modifiers first.
+//
+// Parameters:
+//   - r: The character.
+//
+// Returns:
+//   - []key_codes.KeyCode: The virtual key codes of the modifiers and the key.
+//   - error: An error if the layout has no key that types the character.
+func runeKeyCodes(r rune) ([]key_codes.KeyCode, error) {
+	vk, shift, ok := windows.VkKeyScan(r)
+	if !ok {
+		return nil, fmt.Errorf("no key types %q on the current keyboard layout", r)
+	}
+	var keyCodes []key_codes.KeyCode
+	if shift&1 != 0 {
+		keyCodes = append(keyCodes, windows.VK_SHIFT)
+	}
+	if shift&2 != 0 {
+		keyCodes = append(keyCodes, windows.VK_CONTROL)
+	}
+	if shift&4 != 0 {
+		keyCodes = append(keyCodes, windows.VK_MENU)
+	}
+	return append(keyCodes, key_codes.KeyCode(vk)), nil
+}
 
-	return nil
+// doIsKeyPressed reports whether a key is currently held down, using GetAsyncKeyState.
+//
+// Parameters:
+//   - code: The virtual key code of the key.
+//
+// Returns:
+//   - bool: True if the key is held down, otherwise false.
+//   - error: Always nil, GetAsyncKeyState does not report failures.
+func doIsKeyPressed(code key_codes.KeyCode) (bool, error) {
+	return windows.IsKeyDown(int(code)), nil
 }
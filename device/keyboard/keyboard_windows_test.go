@@ -0,0 +1,39 @@
+//go:build windows
+// +build windows
+
+package keyboard
+
+import (
+	"testing"
+
+	windows "github.com/Carmen-Shannon/automation/tools/_windows"
+)
+
+func TestKeyStateDecoding(t *testing.T) {
+	// states as returned by GetAsyncKeyState and GetKeyState, the high bit is the key being down and the low bit the toggle
+	tests := []struct {
+		name        string
+		state       uint16
+		wantDown    bool
+		wantToggled bool
+	}{
+		{name: "released", state: 0x0000, wantDown: false, wantToggled: false},
+		{name: "down", state: 0x8000, wantDown: true, wantToggled: false},
+		{name: "down and toggled", state: 0x8001, wantDown: true, wantToggled: true},
+		{name: "toggled", state: 0x0001, wantDown: false, wantToggled: true},
+		{name: "every other bit", state: 0x7FFE, wantDown: false, wantToggled: false},
+		{name: "every bit", state: 0xFFFF, wantDown: true, wantToggled: true},
+		// GetKeyState returns a SHORT, a key that is down reads as a negative value
+		{name: "negative short", state: 0xFF80, wantDown: true, wantToggled: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := windows.KeyStateDown(tt.state); got != tt.wantDown {
+				t.Errorf("KeyStateDown(%#04x) = %v, want %v", tt.state, got, tt.wantDown)
+			}
+			if got := windows.KeyStateToggled(tt.state); got != tt.wantToggled {
+				t.Errorf("KeyStateToggled(%#04x) = %v, want %v", tt.state, got, tt.wantToggled)
+			}
+		})
+	}
+}
@@ -1,16 +1,33 @@
 package mouse
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"image"
 	"math"
 	"math/rand"
 	"sync"
 	"time"
 
+	"github.com/Carmen-Shannon/automation/device"
 	"github.com/Carmen-Shannon/automation/device/display"
 )
 
+// WheelDelta is the rotation of the mouse wheel by a single notch, the unit of Scroll and WatchWheel.
+// High-resolution wheels rotate by fractions of it.
+const WheelDelta = 120
+
+// ErrArrivalNotConfirmed is the error reported by MoveAndWait when the cursor is not seen at the target before the timeout.
+var ErrArrivalNotConfirmed = errors.New("the mouse cursor did not arrive at the target")
+
+const (
+	// arrivalTolerance is how far, in pixels on each axis, the cursor may be from the target for MoveAndWait to consider it arrived
+	arrivalTolerance = 1
+	// arrivalPollInterval is how often MoveAndWait polls the position of the cursor
+	arrivalPollInterval = 10 * time.Millisecond
+)
+
 type mouse struct {
 	mu   sync.Mutex
 	done chan struct{}
@@ -25,19 +42,25 @@ var (
 	pd *display.Display
 )
 
-func NewMouse() Mouse {
-	var m mouse
-	m.mu = sync.Mutex{}
-	m.done = nil
-
+// NewMouse creates a new mouse, seeded with the current position of the mouse cursor.
+// Relative movement starts from the cached position, so if the position can not be detected, such as on a headless machine,
+// an error is returned instead of a mouse starting from a made up origin.
+//
+// Returns:
+//   - Mouse: The new mouse, nil if the position of the mouse cursor could not be detected.
+//   - error: An error if the position of the mouse cursor could not be detected.
+func NewMouse() (Mouse, error) {
 	x, y, err := doGetMousePosition()
 	if err != nil {
-		return &m
+		return nil, fmt.Errorf("failed to detect the mouse position: %w", err)
 	}
 
-	m.x = x
-	m.y = y
-	return &m
+	return &mouse{
+		mu:   sync.Mutex{},
+		done: nil,
+		x:    x,
+		y:    y,
+	}, nil
 }
 
 // Mouse is an interface that defines the methods for mouse operations.
@@ -57,6 +80,34 @@ type Mouse interface {
 	//   - error: An error if the move operation fails, otherwise nil.
 	Move(x, y int32, options ...MouseMoveOption) error
 
+	// MoveAndWait moves the mouse like Move, then polls the position of the cursor reported by the OS until it is at the target.
+	// Unlike the Done channel of Move, which only signals that the movement finished, this confirms the cursor actually arrived,
+	// which matters when other software, such as accessibility tools or pointer constraints, may interfere with the cursor.
+	// If the cursor is not seen at the target, the cached position is updated to where the cursor was last seen.
+	//
+	// Parameters:
+	//   - x: The x-coordinate to move the mouse to.
+	//   - y: The y-coordinate to move the mouse to.
+	//   - timeout: How long to wait for the cursor to arrive once the movement finished.
+	//   - options: Optional parameters for the mouse movement, such as display and velocity.
+	//
+	// Returns:
+	//   - error: An error wrapping ErrArrivalNotConfirmed if the cursor did not arrive within the timeout, an error if the move fails, otherwise nil.
+	MoveAndWait(x, y int32, timeout time.Duration, options ...MouseMoveOption) error
+
+	// MovePath moves the mouse through each point of a path in order, as a single gesture, such as to trace a shape or follow a menu.
+	// The options apply to every segment of the path, and the Done channel is closed once the whole path was traveled.
+	// No other movement or click of this mouse is interleaved with the gesture, they wait until it finished.
+	// Every point is validated before the mouse moves, so a path with a point outside of the virtual screen bounds is not started.
+	//
+	// Parameters:
+	//   - points: The points to move through, relative to the display, the same as the coordinates given to Move.
+	//   - options: Optional parameters for the mouse movement, such as display and velocity.
+	//
+	// Returns:
+	//   - error: An error if the path is empty, a point is outside of the virtual screen bounds or a movement fails, otherwise nil.
+	MovePath(points []image.Point, options ...MouseMoveOption) error
+
 	// Click performs a mouse click at the current mouse position.
 	// The default click is a left click with no duration, an instant click down and up.
 	// To modify this behavior, you can pass in a list of MouseClickOptions to customize the click action.
@@ -68,20 +119,45 @@ type Mouse interface {
 	//   - error: An error if the click operation fails, otherwise nil.
 	Click(options ...MouseClickOption) error
 
+	// Scroll rotates the mouse wheel at the current mouse position, which scrolls the window under the cursor.
+	// On linux the rotation is rounded to whole notches, since X11 reports each notch as a press of button 4 or 5.
+	//
+	// Parameters:
+	//   - delta: The rotation of the wheel, in multiples of WheelDelta per notch, positive away from the user, which scrolls up.
+	//
+	// Returns:
+	//   - error: An error if the wheel rotation could not be sent, otherwise nil.
+	Scroll(delta int32) error
+
 	// GetCurrentPosition retrieves the current position of the mouse cursor.
 	// The position is returned as a tuple of (x, y) coordinates.
-	// If the position cannot be determined, (0, 0) is returned.
-	// The NewMouse function should be called prior to calling this function, otherwise it will always return (0, 0)
+	// The position is the one detected by NewMouse, updated by every Move, it does not reflect movement made outside of this mouse.
 	//
 	// Returns:
 	//   - x: The current x-coordinate of the mouse cursor.
 	//   - y: The current y-coordinate of the mouse cursor.
 	GetCurrentPosition() (int, int)
+
+	// GetButtonState reports whether the given mouse button is currently held down.
+	// This reflects the physical state of the button, so it includes presses made by the user as well as simulated ones.
+	// It is useful for avoiding a click while a button is already down, or for verifying the state of a drag.
+	//
+	// Parameters:
+	//   - button: The button to query (1 for left, 2 for middle, 3 for right).
+	//
+	// Returns:
+	//   - pressed: True if the button is currently held down, otherwise false.
+	//   - err: An error if the button is invalid or the state could not be queried, otherwise nil.
+	GetButtonState(button int) (pressed bool, err error)
 }
 
 var _ Mouse = (*mouse)(nil) // compile-time check to ensure that mouse implements Mouse
 
 func (m *mouse) Click(options ...MouseClickOption) error {
+	// a click is never interleaved with a movement in progress
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	clickOptions := &mouseClickOption{}
 	for _, opt := range options {
 		opt(clickOptions)
@@ -91,6 +167,10 @@ func (m *mouse) Click(options ...MouseClickOption) error {
 		clickOptions.Left = true
 	}
 
+	if clickOptions.Simultaneous {
+		return m.chordClick(clickOptions)
+	}
+
 	// Perform the click(s) based on the options
 	if clickOptions.Left {
 		err := m.doMouseClick(1, clickOptions.Duration)
@@ -116,15 +196,132 @@ func (m *mouse) Click(options ...MouseClickOption) error {
 	return nil
 }
 
+// chordClick presses all of the buttons selected in the click options down together, holds them for the click duration, then releases them.
+// If pressing a button fails, the buttons that were already pressed are released before returning.
+//
+// Parameters:
+//   - clickOptions: The click options selecting the buttons and the duration.
+//
+// Returns:
+//   - error: An error if pressing or releasing any of the buttons fails, otherwise nil.
+func (m *mouse) chordClick(clickOptions *mouseClickOption) error {
+	var buttons []int
+	if clickOptions.Left {
+		buttons = append(buttons, 1)
+	}
+	if clickOptions.Right {
+		buttons = append(buttons, 3)
+	}
+	if clickOptions.Middle {
+		buttons = append(buttons, 2)
+	}
+
+	var pressed []int
+	var err error
+	for _, btn := range buttons {
+		if err = m.doMouseDown(btn); err != nil {
+			err = fmt.Errorf("failed to press mouse button %d: %w", btn, err)
+			break
+		}
+		pressed = append(pressed, btn)
+	}
+
+	if err == nil && clickOptions.Duration > 0 {
+		time.Sleep(time.Duration(clickOptions.Duration) * time.Millisecond)
+	}
+
+	// release in reverse order, returning the first error
+	for i := len(pressed) - 1; i >= 0; i-- {
+		if upErr := m.doMouseUp(pressed[i]); upErr != nil && err == nil {
+			err = fmt.Errorf("failed to release mouse button %d: %w", pressed[i], upErr)
+		}
+	}
+	return err
+}
+
+// CursorPosition retrieves the position of the mouse cursor as the OS reports it, unlike GetCurrentPosition of a Mouse,
+// so it includes movement made by the user, such as for recording the cursor while a workflow is demonstrated.
+//
+// Returns:
+//   - int32: The x-coordinate of the cursor, in virtual screen coordinates.
+//   - int32: The y-coordinate of the cursor, in virtual screen coordinates.
+//   - error: An error if the position of the cursor could not be retrieved.
+func CursorPosition() (int32, int32, error) {
+	return doGetMousePosition()
+}
+
+// WatchWheel reports the rotation of the mouse wheel by the user, such as for recording a workflow demonstrated by hand,
+// until the context is done, at which point the channel is closed. Rotations are dropped while the receiver does not keep up.
+// On windows the wheel is observed with a low-level mouse hook. X11 only reports the wheel to the window under the cursor, or to a client grabbing the pointer,
+// so on linux it can not be watched and an error wrapping errors.ErrUnsupported is returned.
+//
+// Parameters:
+//   - ctx: The context that stops the watch.
+//
+// Returns:
+//   - <-chan int32: The rotation of every wheel event, in multiples of WheelDelta per notch, positive away from the user.
+//   - error: An error wrapping errors.ErrUnsupported on linux, an error if the hook could not be installed.
+func WatchWheel(ctx context.Context) (<-chan int32, error) {
+	return doWatchWheel(ctx)
+}
+
+func (m *mouse) Scroll(delta int32) error {
+	// a scroll is never interleaved with a movement in progress
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if delta == 0 {
+		return nil
+	}
+	if err := m.doScroll(delta); err != nil {
+		return fmt.Errorf("failed to scroll: %w", err)
+	}
+	return nil
+}
+
+func (m *mouse) GetButtonState(button int) (bool, error) {
+	if button < 1 || button > 3 {
+		return false, fmt.Errorf("invalid mouse button: %d", button)
+	}
+	return doGetButtonState(button)
+}
+
 func (m *mouse) GetCurrentPosition() (int, int) {
 	return int(m.x), int(m.y)
 }
 
 func (m *mouse) Move(x, y int32, options ...MouseMoveOption) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.movePath([]image.Point{image.Pt(int(x), int(y))}, options)
+}
+
+func (m *mouse) MovePath(points []image.Point, options ...MouseMoveOption) error {
+	if len(points) == 0 {
+		return errors.New("the path has no points")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.movePath(points, options)
+}
+
+// movePath moves the mouse through each point of a path in order, as a single gesture.
+// Every point is validated before the mouse moves, the options apply to the whole gesture, and the Done channel is closed once it finished.
+// The caller must hold the lock of the mouse, so no other movement or click of the mouse is interleaved with the gesture.
+//
+// Parameters:
+//   - points: The points to move through, relative to the display of the options.
+//   - options: Optional parameters for the mouse movement, such as display and velocity.
+//
+// Returns:
+//   - error: An error if a point is outside the virtual screen bounds or a movement fails, otherwise nil.
+func (m *mouse) movePath(points []image.Point, options []MouseMoveOption) error {
 	moveOptions := &mouseMoveOption{}
 	for _, opt := range options {
 		opt(moveOptions)
 	}
+	if err := moveOptions.applyProfile(); err != nil {
+		return err
+	}
 	if moveOptions.Done != nil {
 		m.done = moveOptions.Done
 		defer func() {
@@ -146,50 +343,122 @@ func (m *mouse) Move(x, y int32, options ...MouseMoveOption) error {
 		moveOptions.Display = pd
 	}
 
-	absoluteX := moveOptions.Display.X + x
-	absoluteY := moveOptions.Display.Y + y
+	targets := make([]image.Point, len(points))
+	for i, p := range points {
+		absoluteX, absoluteY := moveOptions.Display.ToGlobal(int32(p.X), int32(p.Y))
+
+		// Validate the coordinates against the virtual screen bounds
+		if (absoluteX < vs.GetLeft() || absoluteX > vs.GetRight()) ||
+			(absoluteY > vs.GetTop() || absoluteY < vs.GetBottom()) {
+			return errors.New("coordinates are outside the virtual screen bounds for display")
+		}
+		targets[i] = image.Pt(int(absoluteX), int(absoluteY))
+	}
+
+	if moveOptions.BlockInput {
+		release, err := device.BlockInput(context.Background())
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
 
-	// Validate the coordinates against the virtual screen bounds
-	if (absoluteX < vs.GetLeft() || absoluteX > vs.GetRight()) ||
-		(absoluteY > vs.GetTop() || absoluteY < vs.GetBottom()) {
-		return errors.New("coordinates are outside the virtual screen bounds for display")
+	for _, target := range targets {
+		if err := m.moveUnlocked(int32(target.X), int32(target.Y), moveOptions); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
+// moveUnlocked moves the mouse to a point of the virtual screen, in one step or along a curve if the options have a velocity,
+// and caches it as the current position. The caller must hold the lock of the mouse.
+//
+// Parameters:
+//   - x: The x-coordinate to move the mouse to, in virtual screen coordinates.
+//   - y: The y-coordinate to move the mouse to, in virtual screen coordinates.
+//   - moveOptions: The options of the movement, with the profile already applied.
+//
+// Returns:
+//   - error: An error if the movement fails, otherwise nil.
+func (m *mouse) moveUnlocked(x, y int32, moveOptions *mouseMoveOption) error {
 	// If velocity is not set or is zero, perform the movement in one step
 	if moveOptions.Velocity <= 0 {
-		err := m.doMouseMove(absoluteX, absoluteY)
-		if err != nil {
+		if err := m.doMouseMove(x, y); err != nil {
 			return err
 		}
-		m.x = absoluteX
-		m.y = absoluteY
-		return nil
 	} else {
-		err := m.moveWithVelocity(absoluteX, absoluteY, moveOptions.Velocity, moveOptions.Jitter, moveOptions.Display)
-		if err != nil {
+		if err := m.moveWithVelocity(x, y, moveOptions.Velocity, moveOptions.Jitter, moveOptions.Easing, moveOptions.Display); err != nil {
 			return err
 		}
-		m.x = absoluteX
-		m.y = absoluteY
-		return nil
 	}
+	m.x = x
+	m.y = y
+	return nil
+}
+
+func (m *mouse) MoveAndWait(x, y int32, timeout time.Duration, options ...MouseMoveOption) error {
+	// the lock is held until the arrival is confirmed, so no other movement can take the cursor away in between
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.movePath([]image.Point{image.Pt(int(x), int(y))}, options); err != nil {
+		return err
+	}
+	// the move leaves the absolute target as the cached position
+	targetX, targetY := m.x, m.y
+
+	deadline := time.Now().Add(timeout)
+	for {
+		curX, curY, err := doGetMousePosition()
+		if err != nil {
+			return fmt.Errorf("failed to confirm the mouse position: %w", err)
+		}
+		if abs32(curX-targetX) <= arrivalTolerance && abs32(curY-targetY) <= arrivalTolerance {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			m.x, m.y = curX, curY
+			return fmt.Errorf("%w: expected (%d, %d), cursor is at (%d, %d)", ErrArrivalNotConfirmed, targetX, targetY, curX, curY)
+		}
+		time.Sleep(min(arrivalPollInterval, time.Until(deadline)))
+	}
+}
+
+// abs32 returns the absolute value of v.
+//
+// Parameters:
+//   - v: The value.
+//
+// Returns:
+//   - int32: The absolute value of v.
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
 }
 
 // moveWithVelocity moves the mouse to the specified coordinates with a parabolic curve and velocity.
 // It uses a quadratic bezier curve for smooth movement and allows for jitter in the velocity.
 // The function takes the target coordinates, velocity, and jitter as parameters, along with the display information.
 // The function calculates the distance to the target coordinates and determines the number of steps needed for the movement based on the velocity and refresh rate.
+// The caller must hold the lock of the mouse for the whole movement, and cache the target as the current position once it returns.
 //
 // Parameters:
 //   - x: The target x-coordinate to move the mouse to.
 //   - y: The target y-coordinate to move the mouse to.
 //   - velocity: The base velocity for the movement, used to determine the speed of the mouse.
 //   - jitter: The amount of jitter to apply to the velocity, allowing for slight variations in speed.
+//   - easing: The easing function applied to the progress along the curve, easeSmoothstep if nil.
 //   - disp: The display information, used to determine the refresh rate for the movement.
 //
 // Returns:
 //   - error: An error if the movement fails, otherwise nil.
-func (m *mouse) moveWithVelocity(x, y int32, velocity, jitter int, disp *display.Display) error {
+func (m *mouse) moveWithVelocity(x, y int32, velocity, jitter int, easing func(float64) float64, disp *display.Display) error {
+	if easing == nil {
+		easing = easeSmoothstep
+	}
 	startX, startY := m.x, m.y
 	deltaX := float64(x - startX)
 	deltaY := float64(y - startY)
@@ -211,9 +480,6 @@ func (m *mouse) moveWithVelocity(x, y int32, velocity, jitter int, disp *display
 	controlX := float64(startX) + deltaX/2 + float64(rand.Intn(2*jitter+1)-jitter)
 	controlY := float64(startY) + deltaY/2 + float64(rand.Intn(2*jitter+1)-jitter)
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	currentVelocity := float64(velocity) // Start with the base velocity
 
 	for i := 1; i <= steps; i++ {
@@ -232,7 +498,7 @@ func (m *mouse) moveWithVelocity(x, y int32, velocity, jitter int, disp *display
 		t := float64(i) / float64(steps)
 
 		// Apply the easing function to t
-		easedT := 3*t*t - 2*t*t*t
+		easedT := easing(t)
 
 		// Calculate the parabolic curve point using the quadratic bezier formula
 		currentX := (1-easedT)*(1-easedT)*float64(startX) + 2*(1-easedT)*easedT*controlX + easedT*easedT*float64(x)
@@ -250,8 +516,5 @@ func (m *mouse) moveWithVelocity(x, y int32, velocity, jitter int, disp *display
 	if err != nil {
 		return fmt.Errorf("failed to move mouse to final position: %w", err)
 	}
-
-	m.x = x
-	m.y = y
 	return nil
 }
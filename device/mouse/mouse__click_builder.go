@@ -5,6 +5,8 @@ type mouseClickOption struct {
 	Right    bool
 	Middle   bool
 	Duration int
+
+	Simultaneous bool
 }
 
 type MouseClickOption func(*mouseClickOption)
@@ -32,3 +34,11 @@ func DurationOpt(duration int) MouseClickOption {
 		opt.Duration = duration
 	}
 }
+
+// SimultaneousOpt presses all of the selected buttons together as a chord, instead of clicking each of them one after another.
+// Every selected button is pressed down, held for the click duration, then all of them are released.
+func SimultaneousOpt() MouseClickOption {
+	return func(opt *mouseClickOption) {
+		opt.Simultaneous = true
+	}
+}
@@ -1,12 +1,80 @@
 package mouse
 
-import "github.com/Carmen-Shannon/automation/device/display"
+import (
+	"fmt"
+	"math"
+
+	"github.com/Carmen-Shannon/automation/device/display"
+)
 
 type mouseMoveOption struct {
 	Velocity int
 	Jitter   int
+	Easing   func(t float64) float64
+	Profile  string
 	Done     chan struct{}
 	Display  *display.Display
+
+	BlockInput bool
+}
+
+// moveProfile is a named combination of movement settings, see ProfileOpt.
+type moveProfile struct {
+	Velocity int
+	Jitter   int
+	Easing   func(t float64) float64
+}
+
+// moveProfiles are the humanization presets selectable with ProfileOpt, keyed by name.
+// Velocity is in pixels per second, and jitter in pixels.
+var moveProfiles = map[string]moveProfile{
+	// a steady, slightly wobbly movement that speeds up and slows down like a hand
+	"natural": {Velocity: 900, Jitter: 15, Easing: easeSmoothstep},
+	// a quick flick that decelerates into the target
+	"fast": {Velocity: 2500, Jitter: 5, Easing: easeOutQuad},
+	// a slow, straight movement that settles gently on the target
+	"precise": {Velocity: 400, Jitter: 0, Easing: easeInOutSine},
+	// a slow, meandering movement
+	"lazy": {Velocity: 300, Jitter: 40, Easing: easeSmoothstep},
+}
+
+// easeSmoothstep accelerates from the start and decelerates into the end, the default easing of a movement.
+func easeSmoothstep(t float64) float64 {
+	return 3*t*t - 2*t*t*t
+}
+
+// easeOutQuad starts at full speed and decelerates into the end.
+func easeOutQuad(t float64) float64 {
+	return 1 - (1-t)*(1-t)
+}
+
+// easeInOutSine accelerates and decelerates more gently than easeSmoothstep.
+func easeInOutSine(t float64) float64 {
+	return (1 - math.Cos(math.Pi*t)) / 2
+}
+
+// applyProfile fills the settings of the movement that were not set by other options from its profile, if it has one.
+//
+// Returns:
+//   - error: An error if the profile is not one of the presets.
+func (opt *mouseMoveOption) applyProfile() error {
+	if opt.Profile == "" {
+		return nil
+	}
+	profile, ok := moveProfiles[opt.Profile]
+	if !ok {
+		return fmt.Errorf("unknown movement profile: %q", opt.Profile)
+	}
+	if opt.Velocity == 0 {
+		opt.Velocity = profile.Velocity
+	}
+	if opt.Jitter == 0 {
+		opt.Jitter = profile.Jitter
+	}
+	if opt.Easing == nil {
+		opt.Easing = profile.Easing
+	}
+	return nil
 }
 
 type MouseMoveOption func(*mouseMoveOption)
@@ -51,3 +119,35 @@ func DoneSignalOpt(done chan struct{}) MouseMoveOption {
 		opt.Done = done
 	}
 }
+
+// EasingOpt sets the easing function of the movement, which maps the progress of the movement in time to the progress along its path.
+// It only applies to movements with a velocity.
+//
+// Parameters:
+//   - easing: A function mapping t in [0, 1] to the eased progress, it should return 0 for 0 and 1 for 1.
+func EasingOpt(easing func(t float64) float64) MouseMoveOption {
+	return func(opt *mouseMoveOption) {
+		opt.Easing = easing
+	}
+}
+
+// ProfileOpt selects a named humanization preset, which sets the velocity, jitter and easing of the movement together.
+// The presets are "natural", "fast", "precise" and "lazy", and make a good starting point when tuning the individual settings.
+// VelocityOpt, JitterOpt and EasingOpt override the matching setting of the preset regardless of the order the options are given in.
+// Move returns an error if the name is not one of the presets.
+//
+// Parameters:
+//   - name: The name of the preset.
+func ProfileOpt(name string) MouseMoveOption {
+	return func(opt *mouseMoveOption) {
+		opt.Profile = name
+	}
+}
+
+// BlockInputOpt blocks the input of the user for the duration of the movement, so bumping the mouse can not throw off a movement in progress.
+// Move returns an error if the input can not be blocked, see device.BlockInput for the requirements on each OS.
+func BlockInputOpt() MouseMoveOption {
+	return func(opt *mouseMoveOption) {
+		opt.BlockInput = true
+	}
+}
@@ -4,44 +4,102 @@
 package mouse
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/BurntSushi/xgb"
 	"github.com/BurntSushi/xgb/xproto"
 	linux "github.com/Carmen-Shannon/automation/tools/_linux"
 )
 
-var xConn *xgb.Conn
-
-func initXGB() error {
-	var err error
-	xConn, err = xgb.NewConn()
-	return err
-}
-
 func (m *mouse) doMouseMove(x, y int32) error {
-	if xConn == nil {
-		if err := initXGB(); err != nil {
-			return err
+	return linux.WithXConn(func(conn *xgb.Conn, root xproto.Window) error {
+		if err := xproto.WarpPointerChecked(conn, 0, root, 0, 0, 0, 0, int16(x), int16(y)).Check(); err != nil {
+			return fmt.Errorf("failed to move the pointer: %w", err)
 		}
+		return nil
+	})
+}
+
+func doGetButtonState(btn int) (bool, error) {
+	var mask uint16
+	switch btn {
+	case 1:
+		mask = xproto.KeyButMaskButton1
+	case 2:
+		mask = xproto.KeyButMaskButton2
+	case 3:
+		mask = xproto.KeyButMaskButton3
+	default:
+		return false, fmt.Errorf("unsupported mouse button: %d", btn)
 	}
-	root := xproto.Setup(xConn).DefaultScreen(xConn).Root
-	xproto.WarpPointer(xConn, 0, root, 0, 0, 0, 0, int16(x), int16(y))
-	return nil
+
+	var down bool
+	err := linux.WithXConn(func(conn *xgb.Conn, root xproto.Window) error {
+		reply, err := xproto.QueryPointer(conn, root).Reply()
+		if err != nil {
+			return fmt.Errorf("failed to query pointer: %w", err)
+		}
+		down = reply.Mask&mask != 0
+		return nil
+	})
+	return down, err
 }
 
 func doGetMousePosition() (int32, int32, error) {
-	x, y, err := linux.ExecuteXdotoolGetMousePosition()
+	// this is called by NewMouse, so a mouse is never created on wayland, where the X server can not move or click anything
+	if err := linux.CheckX11Session("get the mouse position"); err != nil {
+		return 0, 0, err
+	}
+	x, y, err := linux.QueryPointerPosition()
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to get mouse position: %w", err)
 	}
 	return x, y, nil
 }
 
+func (m *mouse) doMouseDown(btn int) error {
+	return linux.FakeInput(linux.FakeEvent{Type: xproto.ButtonPress, Detail: byte(btn)})
+}
+
+func (m *mouse) doMouseUp(btn int) error {
+	return linux.FakeInput(linux.FakeEvent{Type: xproto.ButtonRelease, Detail: byte(btn)})
+}
+
 func (m *mouse) doMouseClick(btn int, duration int) error {
-	err := linux.ExecuteXdotoolClick(btn, duration)
-	if err != nil {
+	if duration <= 0 {
+		return linux.FakeInput(
+			linux.FakeEvent{Type: xproto.ButtonPress, Detail: byte(btn)},
+			linux.FakeEvent{Type: xproto.ButtonRelease, Detail: byte(btn)},
+		)
+	}
+
+	if err := m.doMouseDown(btn); err != nil {
 		return err
 	}
-	return nil
+	time.Sleep(time.Duration(duration) * time.Millisecond)
+	return m.doMouseUp(btn)
+}
+
+func (m *mouse) doScroll(delta int32) error {
+	// each notch is a click of button 4 to scroll up or button 5 to scroll down, a partial notch still scrolls once
+	button := byte(4)
+	if delta < 0 {
+		button, delta = 5, -delta
+	}
+	notches := max((delta+WheelDelta/2)/WheelDelta, 1)
+	events := make([]linux.FakeEvent, 0, notches*2)
+	for range notches {
+		events = append(events,
+			linux.FakeEvent{Type: xproto.ButtonPress, Detail: button},
+			linux.FakeEvent{Type: xproto.ButtonRelease, Detail: button},
+		)
+	}
+	return linux.FakeInput(events...)
+}
+
+func doWatchWheel(ctx context.Context) (<-chan int32, error) {
+	return nil, fmt.Errorf("watching the mouse wheel on linux: %w", errors.ErrUnsupported)
 }
@@ -4,9 +4,10 @@
 package mouse
 
 import (
+	"context"
 	"errors"
+	"runtime"
 	"time"
-	"unsafe"
 
 	windows "github.com/Carmen-Shannon/automation/tools/_windows"
 )
@@ -20,16 +21,32 @@ import (
 //   - (int32, int32): The x and y coordinates of the mouse cursor.
 //   - error: An error if the retrieval fails, otherwise nil.
 func doGetMousePosition() (int32, int32, error) {
-	var p struct {
-		x int32
-		y int32
-	}
-	ret, _, err := windows.GetCursorPos.Call(uintptr(unsafe.Pointer(&p)))
-	if ret == 0 {
-		return 0, 0, err
+	return windows.GetCursorPos()
+}
+
+// doGetButtonState reports whether the given mouse button is currently held down.
+// It uses the GetAsyncKeyState Windows API, where the most significant bit of the result is set if the button is down.
+//
+// Parameters:
+//   - btn: The button to query (1 for left, 2 for middle, 3 for right).
+//
+// Returns:
+//   - bool: True if the button is held down, otherwise false.
+//   - error: An error if the button is not recognized, otherwise nil.
+func doGetButtonState(btn int) (bool, error) {
+	var vk int
+	switch btn {
+	case 1:
+		vk = windows.VK_LBUTTON
+	case 2:
+		vk = windows.VK_MBUTTON
+	case 3:
+		vk = windows.VK_RBUTTON
+	default:
+		return false, errors.New("unsupported mouse button")
 	}
 
-	return p.x, p.y, nil
+	return windows.IsKeyDown(vk), nil
 }
 
 // doMouseClick performs a mouse click at the current mouse position.
@@ -44,7 +61,7 @@ func doGetMousePosition() (int32, int32, error) {
 // Returns:
 //   - error: An error if the click operation fails, otherwise nil.
 func (m *mouse) doMouseClick(btn int, duration int) error {
-	var downFlags, upFlags uintptr
+	var downFlags, upFlags uint32
 	if btn == 1 {
 		downFlags |= windows.MOUSEEVENTF_LEFTDOWN
 		upFlags |= windows.MOUSEEVENTF_LEFTUP
@@ -58,13 +75,61 @@ func (m *mouse) doMouseClick(btn int, duration int) error {
 		upFlags |= windows.MOUSEEVENTF_MIDDLEUP
 	}
 
-	windows.MouseEvent.Call(downFlags, 0, 0, 0, 0)
+	windows.MouseEvent(downFlags)
 
 	if duration > 0 {
 		time.Sleep(time.Duration(duration) * time.Millisecond)
 	}
 
-	windows.MouseEvent.Call(upFlags, 0, 0, 0, 0)
+	windows.MouseEvent(upFlags)
+	return nil
+}
+
+// doMouseDown presses the given mouse button down at the current mouse position, without releasing it.
+//
+// Parameters:
+//   - btn: The button to press (1 for left, 2 for middle, 3 for right).
+//
+// Returns:
+//   - error: An error if the button is not recognized, otherwise nil.
+func (m *mouse) doMouseDown(btn int) error {
+	var flags uint32
+	switch btn {
+	case 1:
+		flags = windows.MOUSEEVENTF_LEFTDOWN
+	case 2:
+		flags = windows.MOUSEEVENTF_MIDDLEDOWN
+	case 3:
+		flags = windows.MOUSEEVENTF_RIGHTDOWN
+	default:
+		return errors.New("unsupported mouse button")
+	}
+
+	windows.MouseEvent(flags)
+	return nil
+}
+
+// doMouseUp releases the given mouse button at the current mouse position.
+//
+// Parameters:
+//   - btn: The button to release (1 for left, 2 for middle, 3 for right).
+//
+// Returns:
+//   - error: An error if the button is not recognized, otherwise nil.
+func (m *mouse) doMouseUp(btn int) error {
+	var flags uint32
+	switch btn {
+	case 1:
+		flags = windows.MOUSEEVENTF_LEFTUP
+	case 2:
+		flags = windows.MOUSEEVENTF_MIDDLEUP
+	case 3:
+		flags = windows.MOUSEEVENTF_RIGHTUP
+	default:
+		return errors.New("unsupported mouse button")
+	}
+
+	windows.MouseEvent(flags)
 	return nil
 }
 
@@ -75,9 +140,62 @@ func (m *mouse) doMouseClick(btn int, duration int) error {
 //   - x: The x-coordinate to move the mouse to.
 //   - y: The y-coordinate to move the mouse to.
 func (m *mouse) doMouseMove(x, y int32) error {
-	ret, _, err := windows.SetCursorPos.Call(uintptr(x), uintptr(y))
-	if ret == 0 {
-		return errors.New("failed to move the mouse: " + err.Error())
+	return windows.SetCursorPos(x, y)
+}
+
+// doScroll rotates the mouse wheel at the current mouse position with SendInput.
+//
+// Parameters:
+//   - delta: The rotation of the wheel, in multiples of WheelDelta per notch, positive away from the user.
+//
+// Returns:
+//   - error: An error if the input was not sent.
+func (m *mouse) doScroll(delta int32) error {
+	_, err := windows.SendInputs([]windows.Input{windows.MouseWheelInput(delta)})
+	return err
+}
+
+// doWatchWheel reports the wheel rotations seen by a low-level mouse hook.
+// The hook is called from a message loop, which runs on a goroutine locked to its own OS thread until the context is done.
+func doWatchWheel(ctx context.Context) (<-chan int32, error) {
+	// the hook must return quickly, so the rotations are buffered and dropped when the receiver falls behind
+	deltas := make(chan int32, 64)
+	type started struct {
+		threadID uint32
+		err      error
 	}
-	return nil
+	ready := make(chan started, 1)
+
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		defer close(deltas)
+
+		// the queue must exist before the thread ID is handed out, or the quit message could be posted before there is a queue to receive it
+		windows.EnsureMessageQueue()
+		hook, err := windows.SetMouseWheelHook(func(delta int32) {
+			select {
+			case deltas <- delta:
+			default:
+			}
+		})
+		if err != nil {
+			ready <- started{err: err}
+			return
+		}
+		defer windows.UnhookMouseWheel(hook)
+		ready <- started{threadID: windows.GetCurrentThreadID()}
+
+		_ = windows.RunMessageLoop()
+	}()
+
+	s := <-ready
+	if s.err != nil {
+		return nil, s.err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = windows.PostThreadQuit(s.threadID)
+	}()
+	return deltas, nil
 }
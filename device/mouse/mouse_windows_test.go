@@ -0,0 +1,83 @@
+//go:build windows
+// +build windows
+
+package mouse
+
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+
+	windows "github.com/Carmen-Shannon/automation/tools/_windows"
+)
+
+// structLayout is the size of a Win32 structure and the offsets of the fields that move with the pointer size.
+type structLayout struct {
+	name    string
+	size    uintptr
+	offsets map[string]uintptr
+}
+
+// win32Layouts are the layouts of the input structures in the Win32 ABI, by GOARCH, as declared in WinUser.h.
+var win32Layouts = map[string][]structLayout{
+	"386": {
+		{name: "INPUT", size: 28, offsets: map[string]uintptr{"union": 4}},
+		{name: "MOUSEINPUT", size: 24, offsets: map[string]uintptr{"mouseData": 8, "dwFlags": 12, "dwExtraInfo": 20}},
+		{name: "KEYBDINPUT", size: 16, offsets: map[string]uintptr{"wScan": 2, "dwFlags": 4, "dwExtraInfo": 12}},
+		{name: "HARDWAREINPUT", size: 8, offsets: map[string]uintptr{"wParamL": 4, "wParamH": 6}},
+		{name: "MSLLHOOKSTRUCT", size: 24, offsets: map[string]uintptr{"mouseData": 8, "dwExtraInfo": 20}},
+	},
+	"amd64": {
+		{name: "INPUT", size: 40, offsets: map[string]uintptr{"union": 8}},
+		{name: "MOUSEINPUT", size: 32, offsets: map[string]uintptr{"mouseData": 8, "dwFlags": 12, "dwExtraInfo": 24}},
+		{name: "KEYBDINPUT", size: 24, offsets: map[string]uintptr{"wScan": 2, "dwFlags": 4, "dwExtraInfo": 16}},
+		{name: "HARDWAREINPUT", size: 8, offsets: map[string]uintptr{"wParamL": 4, "wParamH": 6}},
+		{name: "MSLLHOOKSTRUCT", size: 32, offsets: map[string]uintptr{"mouseData": 8, "dwExtraInfo": 24}},
+	},
+}
+
+// goLayouts returns the layouts of the Go declarations of the input structures SendInput and the mouse wheel hook rely on.
+func goLayouts() []structLayout {
+	var in windows.Input
+	var mi windows.MouseInput
+	var ki windows.KeybdInput
+	var hi windows.HardwareInput
+	var ms windows.MsllHookStruct
+	return []structLayout{
+		// the union field of Input is unexported, its offset is where the accessors point
+		{name: "INPUT", size: unsafe.Sizeof(in), offsets: map[string]uintptr{"union": uintptr(unsafe.Pointer(in.Mouse())) - uintptr(unsafe.Pointer(&in))}},
+		{name: "MOUSEINPUT", size: unsafe.Sizeof(mi), offsets: map[string]uintptr{"mouseData": unsafe.Offsetof(mi.MouseData), "dwFlags": unsafe.Offsetof(mi.DwFlags), "dwExtraInfo": unsafe.Offsetof(mi.DwExtraInfo)}},
+		{name: "KEYBDINPUT", size: unsafe.Sizeof(ki), offsets: map[string]uintptr{"wScan": unsafe.Offsetof(ki.WScan), "dwFlags": unsafe.Offsetof(ki.DwFlags), "dwExtraInfo": unsafe.Offsetof(ki.DwExtraInfo)}},
+		{name: "HARDWAREINPUT", size: unsafe.Sizeof(hi), offsets: map[string]uintptr{"wParamL": unsafe.Offsetof(hi.WParamL), "wParamH": unsafe.Offsetof(hi.WParamH)}},
+		{name: "MSLLHOOKSTRUCT", size: unsafe.Sizeof(ms), offsets: map[string]uintptr{"mouseData": unsafe.Offsetof(ms.MouseData), "dwExtraInfo": unsafe.Offsetof(ms.DwExtraInfo)}},
+	}
+}
+
+func TestInputStructLayout(t *testing.T) {
+	want, ok := win32Layouts[runtime.GOARCH]
+	if !ok {
+		t.Skipf("no reference layout for %s", runtime.GOARCH)
+	}
+	for i, got := range goLayouts() {
+		w := want[i]
+		if got.size != w.size {
+			t.Errorf("sizeof(%s) = %d, want %d", w.name, got.size, w.size)
+		}
+		for field, offset := range w.offsets {
+			if got.offsets[field] != offset {
+				t.Errorf("offsetof(%s.%s) = %d, want %d", w.name, field, got.offsets[field], offset)
+			}
+		}
+	}
+}
+
+func TestInputUnionMembersShareStorage(t *testing.T) {
+	in := windows.KeyDownInput(0x41)
+	if in.Type != windows.INPUT_KEYBOARD || in.Keybd().WVk != 0x41 {
+		t.Fatalf("KeyDownInput(0x41) = type %d, vk %#x, want a keyboard input for vk 0x41", in.Type, in.Keybd().WVk)
+	}
+	// the virtual-key code is the low word of the first field of the union, which MOUSEINPUT reads as dx
+	if got := in.Mouse().Dx & 0xFFFF; got != 0x41 {
+		t.Errorf("the union read as a mouse input has dx %#x, want the virtual-key code in its low word", got)
+	}
+}
@@ -0,0 +1,167 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Carmen-Shannon/automation/device/window"
+)
+
+const (
+	// windowPollInterval is how often WaitForWindow polls the windows of the process
+	windowPollInterval = 50 * time.Millisecond
+	// terminateGracePeriod is how long Terminate waits for the process to exit after asking it to close, before killing it
+	terminateGracePeriod = 5 * time.Second
+)
+
+// ErrProcessExited is the error reported by WaitForWindow when the process exits before its window appears.
+var ErrProcessExited = errors.New("the process exited")
+
+// Proc is a process started with Launch.
+type Proc struct {
+	PID int // the ID of the process
+
+	cmd  *exec.Cmd
+	done chan struct{} // closed once the process has exited
+	err  error         // the error the process exited with, set before done is closed
+}
+
+// Launch starts an executable as a new process, such as the application an automation is about to drive.
+// The process runs independently of the caller, and is reaped in the background once it exits.
+//
+// Parameters:
+//   - path: The path of the executable, or its name to look it up in the PATH.
+//   - args: The arguments to pass to the executable.
+//
+// Returns:
+//   - *Proc: The started process.
+//   - error: An error if the process could not be started.
+func Launch(path string, args ...string) (*Proc, error) {
+	cmd := exec.Command(path, args...)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to launch %s: %w", path, err)
+	}
+
+	p := &Proc{
+		PID:  cmd.Process.Pid,
+		cmd:  cmd,
+		done: make(chan struct{}),
+	}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// WaitForWindow blocks until a visible top-level window of the process whose title contains the given text, ignoring case, is listed.
+// Windows are correlated to the process by their PID, so windows opened by other processes the process starts, such as those of a launcher, are not found.
+//
+// Parameters:
+//   - ctx: The context that bounds how long to wait for the window.
+//   - titleSubstr: The text to look for in the window title, empty matches any window of the process.
+//
+// Returns:
+//   - window.WindowInfo: The first matching window, in the order of window.List.
+//   - error: The context's error if it is done first, an error wrapping ErrProcessExited if the process exits first,
+//     or an error if the windows could not be listed.
+func (p *Proc) WaitForWindow(ctx context.Context, titleSubstr string) (window.WindowInfo, error) {
+	return waitForWindow(ctx, p.PID, titleSubstr, window.FindByPID, p.done)
+}
+
+// waitForWindow polls the windows of a process until one of them has a title containing the given text.
+//
+// Parameters:
+//   - ctx: The context that bounds how long to wait.
+//   - pid: The ID of the process.
+//   - titleSubstr: The text to look for in the window title.
+//   - findByPID: The function listing the windows of a process.
+//   - exited: A channel that is closed once the process has exited.
+//
+// Returns:
+//   - window.WindowInfo: The first matching window.
+//   - error: The context's error, an error wrapping ErrProcessExited, or the error of findByPID.
+func waitForWindow(ctx context.Context, pid int, titleSubstr string, findByPID func(pid int) ([]window.WindowInfo, error), exited <-chan struct{}) (window.WindowInfo, error) {
+	titleSubstr = strings.ToLower(titleSubstr)
+	ticker := time.NewTicker(windowPollInterval)
+	defer ticker.Stop()
+
+	for {
+		windows, err := findByPID(pid)
+		if err != nil {
+			return window.WindowInfo{}, err
+		}
+		for _, w := range windows {
+			if strings.Contains(strings.ToLower(w.Title), titleSubstr) {
+				return w, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return window.WindowInfo{}, ctx.Err()
+		case <-exited:
+			return window.WindowInfo{}, fmt.Errorf("%w before its window appeared: process %d", ErrProcessExited, pid)
+		case <-ticker.C:
+		}
+	}
+}
+
+// Terminate ends the process, and waits for it to exit.
+// A graceful termination first asks the process to close, by posting WM_CLOSE to its windows on Windows or sending it SIGTERM on Linux,
+// and only kills it if it is still running after a grace period of 5 seconds. Otherwise the process is killed right away.
+//
+// Parameters:
+//   - graceful: Whether to ask the process to close before killing it.
+//
+// Returns:
+//   - error: An error if the process could not be killed, nil if it has exited, including when it had already exited.
+func (p *Proc) Terminate(graceful bool) error {
+	return terminate(graceful, terminateGracePeriod, func() error { return doRequestClose(p.PID, p.cmd.Process) }, p.cmd.Process.Kill, p.done)
+}
+
+// terminate asks a process to close if graceful, waiting up to the grace period for it to exit, then kills it and waits for it to exit.
+//
+// Parameters:
+//   - graceful: Whether to ask the process to close before killing it.
+//   - grace: How long to wait for the process to exit after asking it to close.
+//   - requestClose: The function asking the process to close.
+//   - kill: The function killing the process.
+//   - exited: A channel that is closed once the process has exited.
+//
+// Returns:
+//   - error: The error of kill if the process could not be killed, otherwise nil.
+func terminate(graceful bool, grace time.Duration, requestClose, kill func() error, exited <-chan struct{}) error {
+	select {
+	case <-exited:
+		return nil
+	default:
+	}
+
+	// a process that can not be asked to close, such as one without windows on Windows, is killed right away
+	if graceful && requestClose() == nil {
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-exited:
+			return nil
+		case <-timer.C:
+		}
+	}
+
+	if err := kill(); err != nil {
+		// the process may have exited on its own since it was checked
+		select {
+		case <-exited:
+			return nil
+		default:
+		}
+		return fmt.Errorf("failed to kill the process: %w", err)
+	}
+	<-exited
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"os"
+	"syscall"
+)
+
+// doRequestClose asks a process to close by sending it SIGTERM.
+//
+// Parameters:
+//   - pid: The ID of the process.
+//   - proc: The process.
+//
+// Returns:
+//   - error: An error if the signal could not be sent.
+func doRequestClose(pid int, proc *os.Process) error {
+	return proc.Signal(syscall.SIGTERM)
+}
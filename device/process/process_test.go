@@ -0,0 +1,243 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Carmen-Shannon/automation/device/window"
+)
+
+// fakeWindows lists the windows of processes as they appear over successive polls.
+type fakeWindows struct {
+	mu    sync.Mutex
+	polls [][]window.WindowInfo // the windows listed by each poll, the last one is repeated once they run out
+	err   error                 // returned instead of the windows by the poll at errAt
+	errAt int
+	calls int
+}
+
+func (f *fakeWindows) findByPID(pid int) ([]window.WindowInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	call := f.calls
+	f.calls++
+	if f.err != nil && call == f.errAt {
+		return nil, f.err
+	}
+	if len(f.polls) == 0 {
+		return nil, nil
+	}
+	// windows of other processes are never listed for the PID, as window.FindByPID filters them
+	var windows []window.WindowInfo
+	for _, w := range f.polls[min(call, len(f.polls)-1)] {
+		if w.PID == pid {
+			windows = append(windows, w)
+		}
+	}
+	return windows, nil
+}
+
+func (f *fakeWindows) pollCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func TestWaitForWindowAppearsLater(t *testing.T) {
+	f := &fakeWindows{polls: [][]window.WindowInfo{
+		nil,
+		{{Handle: 1, Title: "Splash", PID: 42}},
+		{{Handle: 1, Title: "Splash", PID: 42}, {Handle: 9, Title: "Untitled - Editor", PID: 7}},
+		{{Handle: 2, Title: "Untitled - Editor", PID: 42}, {Handle: 1, Title: "Splash", PID: 42}},
+	}}
+	got, err := waitForWindow(context.Background(), 42, "EDITOR", f.findByPID, nil)
+	if err != nil {
+		t.Fatalf("waitForWindow() error = %v", err)
+	}
+	if got.Handle != 2 {
+		t.Errorf("waitForWindow() = window %d, want 2, the editor window of the process", got.Handle)
+	}
+	if calls := f.pollCount(); calls != 4 {
+		t.Errorf("windows polled %d times, want 4", calls)
+	}
+}
+
+func TestWaitForWindowAnyTitle(t *testing.T) {
+	f := &fakeWindows{polls: [][]window.WindowInfo{
+		{{Handle: 9, Title: "Other", PID: 7}},
+		{{Handle: 3, Title: "", PID: 42}, {Handle: 4, Title: "Main", PID: 42}},
+	}}
+	got, err := waitForWindow(context.Background(), 42, "", f.findByPID, nil)
+	if err != nil {
+		t.Fatalf("waitForWindow() error = %v", err)
+	}
+	if got.Handle != 3 {
+		t.Errorf("waitForWindow() = window %d, want the first window of the process, 3", got.Handle)
+	}
+}
+
+func TestWaitForWindowPollInterval(t *testing.T) {
+	f := &fakeWindows{polls: [][]window.WindowInfo{nil, nil, {{Handle: 1, Title: "Main", PID: 42}}}}
+	start := time.Now()
+	if _, err := waitForWindow(context.Background(), 42, "main", f.findByPID, nil); err != nil {
+		t.Fatalf("waitForWindow() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 2*windowPollInterval {
+		t.Errorf("waitForWindow() took %v for 3 polls, want at least 2 poll intervals of %v", elapsed, windowPollInterval)
+	}
+}
+
+func TestWaitForWindowProcessExits(t *testing.T) {
+	f := &fakeWindows{polls: [][]window.WindowInfo{{{Handle: 9, Title: "Launcher", PID: 42}}}}
+	exited := make(chan struct{})
+	time.AfterFunc(2*windowPollInterval, func() { close(exited) })
+
+	_, err := waitForWindow(context.Background(), 42, "editor", f.findByPID, exited)
+	if !errors.Is(err, ErrProcessExited) {
+		t.Fatalf("waitForWindow() error = %v, want %v", err, ErrProcessExited)
+	}
+	if calls := f.pollCount(); calls < 2 {
+		t.Errorf("windows polled %d times, want polling until the process exited", calls)
+	}
+}
+
+func TestWaitForWindowFindsWindowOfExitedProcess(t *testing.T) {
+	// the window is looked for before the exit is noticed, so a window listed by the first poll is still found
+	f := &fakeWindows{polls: [][]window.WindowInfo{{{Handle: 1, Title: "Main", PID: 42}}}}
+	exited := make(chan struct{})
+	close(exited)
+	got, err := waitForWindow(context.Background(), 42, "main", f.findByPID, exited)
+	if err != nil || got.Handle != 1 {
+		t.Errorf("waitForWindow() = window %d, error %v, want window 1", got.Handle, err)
+	}
+}
+
+func TestWaitForWindowContextDone(t *testing.T) {
+	f := &fakeWindows{}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*windowPollInterval)
+	defer cancel()
+	if _, err := waitForWindow(ctx, 42, "main", f.findByPID, make(chan struct{})); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waitForWindow() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if calls := f.pollCount(); calls < 2 {
+		t.Errorf("windows polled %d times, want polling until the deadline", calls)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	f = &fakeWindows{}
+	if _, err := waitForWindow(ctx, 42, "main", f.findByPID, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("waitForWindow() error = %v, want %v", err, context.Canceled)
+	}
+	if calls := f.pollCount(); calls != 1 {
+		t.Errorf("windows polled %d times with a cancelled context, want 1", calls)
+	}
+}
+
+func TestWaitForWindowListError(t *testing.T) {
+	errList := errors.New("failed to enumerate windows")
+	f := &fakeWindows{err: errList, errAt: 1}
+	if _, err := waitForWindow(context.Background(), 42, "main", f.findByPID, nil); !errors.Is(err, errList) {
+		t.Fatalf("waitForWindow() error = %v, want %v", err, errList)
+	}
+	if calls := f.pollCount(); calls != 2 {
+		t.Errorf("windows polled %d times, want 2, polling must stop at the first error", calls)
+	}
+}
+
+// fakeProcess is a process that exits when asked to close if it is cooperative, and always when killed.
+type fakeProcess struct {
+	cooperative bool
+	closeErr    error
+	killErr     error
+	exited      chan struct{}
+	once        sync.Once
+	closes      int
+	kills       int
+}
+
+func newFakeProcess(cooperative bool) *fakeProcess {
+	return &fakeProcess{cooperative: cooperative, exited: make(chan struct{})}
+}
+
+func (p *fakeProcess) exit() { p.once.Do(func() { close(p.exited) }) }
+
+func (p *fakeProcess) requestClose() error {
+	p.closes++
+	if p.closeErr != nil {
+		return p.closeErr
+	}
+	if p.cooperative {
+		p.exit()
+	}
+	return nil
+}
+
+func (p *fakeProcess) kill() error {
+	p.kills++
+	if p.killErr != nil {
+		return p.killErr
+	}
+	p.exit()
+	return nil
+}
+
+func TestTerminate(t *testing.T) {
+	tests := []struct {
+		name        string
+		graceful    bool
+		cooperative bool
+		closeErr    error
+		wantCloses  int
+		wantKills   int
+	}{
+		{name: "kill", graceful: false, cooperative: true, wantCloses: 0, wantKills: 1},
+		{name: "graceful", graceful: true, cooperative: true, wantCloses: 1, wantKills: 0},
+		{name: "graceful ignored", graceful: true, cooperative: false, wantCloses: 1, wantKills: 1},
+		{name: "graceful without windows", graceful: true, closeErr: errors.New("no windows to close"), wantCloses: 1, wantKills: 1},
+	}
+	for _, tt := range tests {
+		p := newFakeProcess(tt.cooperative)
+		p.closeErr = tt.closeErr
+		if err := terminate(tt.graceful, 10*time.Millisecond, p.requestClose, p.kill, p.exited); err != nil {
+			t.Errorf("%s: terminate() error = %v", tt.name, err)
+		}
+		if p.closes != tt.wantCloses || p.kills != tt.wantKills {
+			t.Errorf("%s: asked to close %d times and killed %d times, want %d and %d", tt.name, p.closes, p.kills, tt.wantCloses, tt.wantKills)
+		}
+	}
+}
+
+func TestTerminateExitedProcess(t *testing.T) {
+	p := newFakeProcess(true)
+	p.exit()
+	if err := terminate(true, time.Second, p.requestClose, p.kill, p.exited); err != nil {
+		t.Errorf("terminate() error = %v", err)
+	}
+	if p.closes != 0 || p.kills != 0 {
+		t.Errorf("an exited process was asked to close %d times and killed %d times, want neither", p.closes, p.kills)
+	}
+}
+
+func TestTerminateKillFails(t *testing.T) {
+	errKill := errors.New("operation not permitted")
+	p := newFakeProcess(false)
+	p.killErr = errKill
+	if err := terminate(false, time.Second, p.requestClose, p.kill, p.exited); !errors.Is(err, errKill) {
+		t.Errorf("terminate() error = %v, want %v", err, errKill)
+	}
+
+	// a process that exited on its own while it was killed is not a failure
+	p = newFakeProcess(false)
+	p.killErr = errKill
+	kill := func() error {
+		p.exit()
+		return p.kill()
+	}
+	if err := terminate(false, time.Second, p.requestClose, kill, p.exited); err != nil {
+		t.Errorf("terminate() error = %v, want nil for a process that exited while being killed", err)
+	}
+}
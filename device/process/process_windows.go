@@ -0,0 +1,41 @@
+//go:build windows
+// +build windows
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Carmen-Shannon/automation/device/window"
+	windows "github.com/Carmen-Shannon/automation/tools/_windows"
+)
+
+// doRequestClose asks a process to close by posting WM_CLOSE to each of its visible top-level windows, since Windows has no SIGTERM.
+//
+// Parameters:
+//   - pid: The ID of the process.
+//   - proc: The process.
+//
+// Returns:
+//   - error: An error if the process has no windows to close, or the message could not be posted to any of them.
+func doRequestClose(pid int, proc *os.Process) error {
+	wins, err := window.FindByPID(pid)
+	if err != nil {
+		return err
+	}
+	if len(wins) == 0 {
+		return fmt.Errorf("process %d has no windows to close", pid)
+	}
+	var errs []error
+	for _, w := range wins {
+		if err := windows.RequestClose(w.Handle); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == len(wins) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
@@ -0,0 +1,423 @@
+package window
+
+import (
+	"context"
+	"errors"
+	"image"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// focusPollInterval is how often WaitForFocus polls the active window.
+const focusPollInterval = 10 * time.Millisecond
+
+// WindowInfo describes a top-level window.
+// The bounds are in virtual screen coordinates, the same coordinate space as the X and Y of a display.Display.
+type WindowInfo struct {
+	Handle uintptr // the HWND of the window on Windows, the X window ID on Linux
+	Title  string
+	PID    int // the ID of the process that owns the window, 0 if it is not known
+	X      int32
+	Y      int32
+	Width  int
+	Height int
+}
+
+// WindowState is the show state of a window.
+type WindowState int
+
+const (
+	WindowNormal    WindowState = iota // the window is neither minimized nor maximized
+	WindowMinimized                    // the window is minimized
+	WindowMaximized                    // the window is maximized
+)
+
+// String returns the name of the window state.
+//
+// Returns:
+//   - string: The name of the window state.
+func (s WindowState) String() string {
+	switch s {
+	case WindowMinimized:
+		return "minimized"
+	case WindowMaximized:
+		return "maximized"
+	default:
+		return "normal"
+	}
+}
+
+// List lists the visible top-level windows, in Z order from the topmost to the bottommost.
+// On Linux the windows are read from the _NET_CLIENT_LIST_STACKING of an EWMH compliant window manager,
+// or its _NET_CLIENT_LIST, which is in the order the windows were mapped, if the window manager does not provide the stacking order.
+//
+// Returns:
+//   - []WindowInfo: The visible top-level windows.
+//   - error: An error if the windows could not be enumerated.
+func List() ([]WindowInfo, error) {
+	return doList()
+}
+
+// Activate brings a window to the foreground and gives it the keyboard focus, restoring it first if it is minimized, so injected input goes to it.
+// Activation is asynchronous on Linux, where it is requested from the window manager, use WaitForFocus to know when it took effect.
+//
+// Parameters:
+//   - w: The window to activate.
+//
+// Returns:
+//   - error: An error if the window could not be activated, such as when Windows refuses to give up the foreground.
+func Activate(w WindowInfo) error {
+	return doActivate(w.Handle)
+}
+
+// Foreground returns the window that currently has the keyboard focus.
+//
+// Returns:
+//   - WindowInfo: The foreground window.
+//   - error: An error if there is no foreground window, such as while the focus is changing, or it could not be queried.
+func Foreground() (WindowInfo, error) {
+	handle, err := doActiveWindow()
+	if err != nil {
+		return WindowInfo{}, err
+	}
+	if handle == 0 {
+		return WindowInfo{}, errors.New("there is no foreground window")
+	}
+	return doDescribe(handle)
+}
+
+// WatchForeground reports every change of the foreground window, such as when the user switches to another application.
+// Repeated reports of the same window are dropped, so each value received is a different window than the one before,
+// starting with a different window than the one in the foreground when the watch started.
+// The channel is closed once the context is done, or if watching fails.
+// Windows that are gone by the time they are reported are skipped.
+//
+// Parameters:
+//   - ctx: The context that stops the watch.
+//
+// Returns:
+//   - <-chan WindowInfo: The channel receiving the new foreground windows.
+//   - error: An error if the watch could not be started.
+func WatchForeground(ctx context.Context) (<-chan WindowInfo, error) {
+	initial, err := doActiveWindow()
+	if err != nil {
+		return nil, err
+	}
+	handles, err := doWatchForeground(ctx)
+	if err != nil {
+		return nil, err
+	}
+	windows := make(chan WindowInfo)
+	go forwardForeground(ctx, initial, handles, windows, doDescribe)
+	return windows, nil
+}
+
+// forwardForeground forwards the handles of foreground changes as window descriptions, dropping repeats of the previous window.
+// It closes the output channel once the handles channel is closed or the context is done.
+//
+// Parameters:
+//   - ctx: The context that stops forwarding.
+//   - last: The handle of the window in the foreground before the first change, 0 if it is not known.
+//   - handles: The handles of the foreground windows, as reported.
+//   - out: The channel to send the window descriptions to.
+//   - describe: The function describing a window, which fails for windows that no longer exist.
+func forwardForeground(ctx context.Context, last uintptr, handles <-chan uintptr, out chan<- WindowInfo, describe func(uintptr) (WindowInfo, error)) {
+	defer close(out)
+	for {
+		var handle uintptr
+		select {
+		case <-ctx.Done():
+			return
+		case h, ok := <-handles:
+			if !ok {
+				return
+			}
+			handle = h
+		}
+		if handle == 0 || handle == last {
+			continue
+		}
+		info, err := describe(handle)
+		if err != nil {
+			continue
+		}
+		last = handle
+		select {
+		case out <- info:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Minimize minimizes a window.
+// On Linux this is a request to the window manager, which applies it asynchronously.
+//
+// Parameters:
+//   - w: The window to minimize.
+//
+// Returns:
+//   - error: An error if the window could not be minimized.
+func Minimize(w WindowInfo) error {
+	return doMinimize(w.Handle)
+}
+
+// Maximize maximizes a window.
+// On Linux this is a request to the window manager, which applies it asynchronously.
+//
+// Parameters:
+//   - w: The window to maximize.
+//
+// Returns:
+//   - error: An error if the window could not be maximized.
+func Maximize(w WindowInfo) error {
+	return doMaximize(w.Handle)
+}
+
+// Restore restores a minimized or maximized window to its normal size and position.
+// Restoring a minimized window before capturing it is needed for the capture to show its current content.
+// On Linux this is a request to the window manager, which applies it asynchronously.
+//
+// Parameters:
+//   - w: The window to restore.
+//
+// Returns:
+//   - error: An error if the window could not be restored.
+func Restore(w WindowInfo) error {
+	return doRestore(w.Handle)
+}
+
+// ClientBounds returns the bounds of the client area of a window, its content without the borders and title bar, in virtual screen coordinates.
+// On Linux the bounds of a WindowInfo already are those of the client window, since the decorations belong to a frame of the window manager.
+//
+// Parameters:
+//   - w: The window.
+//
+// Returns:
+//   - image.Rectangle: The bounds of the client area.
+//   - error: An error if the bounds could not be queried, such as when the window no longer exists.
+func ClientBounds(w WindowInfo) (image.Rectangle, error) {
+	return doClientBounds(w.Handle)
+}
+
+// State reports whether a window is minimized, maximized, or neither.
+//
+// Parameters:
+//   - w: The window.
+//
+// Returns:
+//   - WindowState: The state of the window.
+//   - error: An error if the state could not be queried.
+func State(w WindowInfo) (WindowState, error) {
+	return doState(w.Handle)
+}
+
+// WaitForFocus blocks until a window is the active window, polling the active window.
+//
+// Parameters:
+//   - ctx: The context that bounds how long to wait for the window to get the focus.
+//   - w: The window to wait for.
+//
+// Returns:
+//   - error: The context's error if it is done before the window gets the focus, an error if the active window could not be queried, otherwise nil.
+func WaitForFocus(ctx context.Context, w WindowInfo) error {
+	return waitForFocus(ctx, w.Handle, doActiveWindow)
+}
+
+// waitForFocus polls the active window until it is the given window or the context is done.
+//
+// Parameters:
+//   - ctx: The context that bounds how long to wait.
+//   - handle: The handle of the window to wait for.
+//   - activeWindow: The function returning the handle of the active window.
+//
+// Returns:
+//   - error: The context's error if it is done before the window is active, the error of activeWindow if it fails, otherwise nil.
+func waitForFocus(ctx context.Context, handle uintptr, activeWindow func() (uintptr, error)) error {
+	ticker := time.NewTicker(focusPollInterval)
+	defer ticker.Stop()
+
+	for {
+		active, err := activeWindow()
+		if err != nil {
+			return err
+		}
+		if active == handle {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// FindByTitle lists the visible top-level windows whose title contains the given text, ignoring case.
+//
+// Parameters:
+//   - substr: The text to look for in the window titles.
+//
+// Returns:
+//   - []WindowInfo: The matching windows, in the same order as List.
+//   - error: An error if the windows could not be enumerated.
+func FindByTitle(substr string) ([]WindowInfo, error) {
+	windows, err := List()
+	if err != nil {
+		return nil, err
+	}
+	return filterByTitle(windows, substr), nil
+}
+
+// FindByPID lists the visible top-level windows owned by a process.
+//
+// Parameters:
+//   - pid: The ID of the process.
+//
+// Returns:
+//   - []WindowInfo: The windows of the process, in the same order as List.
+//   - error: An error if the windows could not be enumerated.
+func FindByPID(pid int) ([]WindowInfo, error) {
+	return findByPID(pid, List)
+}
+
+// findByPID lists the windows owned by a process.
+//
+// Parameters:
+//   - pid: The ID of the process.
+//   - list: The function listing the windows.
+//
+// Returns:
+//   - []WindowInfo: The windows of the process, in the same order as list.
+//   - error: The error of list.
+func findByPID(pid int, list func() ([]WindowInfo, error)) ([]WindowInfo, error) {
+	windows, err := list()
+	if err != nil {
+		return nil, err
+	}
+	var matches []WindowInfo
+	for _, w := range windows {
+		if w.PID == pid {
+			matches = append(matches, w)
+		}
+	}
+	return matches, nil
+}
+
+// FindByProcessName lists the visible top-level windows owned by processes with the given executable name.
+// The names are compared ignoring case and a trailing .exe, so "notepad", "Notepad.exe" and "NOTEPAD" all match notepad.exe.
+// Windows whose process can not be resolved to a name, such as those of protected processes, are skipped.
+//
+// Parameters:
+//   - name: The name of the executable, without its directory.
+//
+// Returns:
+//   - []WindowInfo: The windows of the matching processes, in the same order as List.
+//   - error: An error if the windows could not be enumerated.
+func FindByProcessName(name string) ([]WindowInfo, error) {
+	return findByProcessName(name, List, doProcessNames)
+}
+
+// findByProcessName lists the windows owned by processes with the given executable name.
+//
+// Parameters:
+//   - name: The name of the executable.
+//   - list: The function listing the windows.
+//   - processNames: The function returning the names a process is known by, nil if the process can not be resolved.
+//
+// Returns:
+//   - []WindowInfo: The windows of the matching processes, in the same order as list.
+//   - error: The error of list.
+func findByProcessName(name string, list func() ([]WindowInfo, error), processNames func(pid int) []string) ([]WindowInfo, error) {
+	windows, err := list()
+	if err != nil {
+		return nil, err
+	}
+	return filterByProcessName(windows, name, processNames), nil
+}
+
+// filterByProcessName keeps the windows whose process has the given executable name, resolving the names of each process once.
+//
+// Parameters:
+//   - windows: The windows to filter.
+//   - name: The name of the executable.
+//   - processNames: The function returning the names a process is known by, nil if the process can not be resolved.
+//
+// Returns:
+//   - []WindowInfo: The matching windows, in their original order.
+func filterByProcessName(windows []WindowInfo, name string, processNames func(pid int) []string) []WindowInfo {
+	name = normalizeProcessName(name)
+	matchesByPID := make(map[int]bool)
+	var matches []WindowInfo
+	for _, w := range windows {
+		if w.PID == 0 {
+			continue
+		}
+		match, ok := matchesByPID[w.PID]
+		if !ok {
+			for _, candidate := range processNames(w.PID) {
+				if normalizeProcessName(candidate) == name {
+					match = true
+					break
+				}
+			}
+			matchesByPID[w.PID] = match
+		}
+		if match {
+			matches = append(matches, w)
+		}
+	}
+	return matches
+}
+
+// normalizeProcessName normalizes an executable name for comparison, dropping its directory, case and a trailing .exe.
+//
+// Parameters:
+//   - name: The name or path of the executable.
+//
+// Returns:
+//   - string: The normalized name.
+func normalizeProcessName(name string) string {
+	// both separators are handled so Windows paths are normalized on any platform
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.TrimSuffix(name, ".exe")
+}
+
+// filterByTitle keeps the windows whose title contains the given text, ignoring case.
+//
+// Parameters:
+//   - windows: The windows to filter.
+//   - substr: The text to look for in the window titles.
+//
+// Returns:
+//   - []WindowInfo: The matching windows, in their original order.
+func filterByTitle(windows []WindowInfo, substr string) []WindowInfo {
+	substr = strings.ToLower(substr)
+	var matches []WindowInfo
+	for _, w := range windows {
+		if strings.Contains(strings.ToLower(w.Title), substr) {
+			matches = append(matches, w)
+		}
+	}
+	return matches
+}
+
+// decodeUTF16Title decodes a window title from the UTF-16 code units Windows stores it in, cutting it at the first NUL.
+// Characters outside the Basic Multilingual Plane are surrogate pairs, an unpaired surrogate is decoded as U+FFFD.
+//
+// Parameters:
+//   - text: The code units of the title.
+//
+// Returns:
+//   - string: The title.
+func decodeUTF16Title(text []uint16) string {
+	if i := slices.Index(text, 0); i >= 0 {
+		text = text[:i]
+	}
+	return string(utf16.Decode(text))
+}
@@ -0,0 +1,485 @@
+//go:build linux
+// +build linux
+
+package window
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+var xConn *xgb.Conn
+
+func initXGB() error {
+	var err error
+	xConn, err = xgb.NewConn()
+	return err
+}
+
+func doList() ([]WindowInfo, error) {
+	if xConn == nil {
+		if err := initXGB(); err != nil {
+			return nil, err
+		}
+	}
+	root := xproto.Setup(xConn).DefaultScreen(xConn).Root
+
+	// the stacking order is from the bottommost to the topmost window
+	ids, stacked, err := clientList(func(name string) (*xproto.GetPropertyReply, error) {
+		return getProperty(root, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stacked {
+		slices.Reverse(ids)
+	}
+
+	var infos []WindowInfo
+	for _, id := range ids {
+		win := xproto.Window(id)
+		info, visible, err := describeWindow(root, win)
+		if err != nil {
+			// the window was destroyed while enumerating
+			continue
+		}
+		if visible {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// clientList reads the windows managed by the window manager, in stacking order if the window manager provides it.
+//
+// Parameters:
+//   - rootProperty: The function that reads a property of the root window.
+//
+// Returns:
+//   - []uint32: The X window IDs of the managed windows.
+//   - bool: True if the windows are in stacking order, from the bottommost to the topmost, false if they are in the order they were mapped.
+//   - error: An error if the window manager provides neither list.
+func clientList(rootProperty func(name string) (*xproto.GetPropertyReply, error)) ([]uint32, bool, error) {
+	if stacking, err := rootProperty("_NET_CLIENT_LIST_STACKING"); err == nil && stacking.Format == 32 {
+		return parseCardinals(stacking.Value), true, nil
+	}
+	list, err := rootProperty("_NET_CLIENT_LIST")
+	if err != nil {
+		return nil, false, err
+	}
+	if list.Format != 32 {
+		return nil, false, errors.New("the window manager does not provide _NET_CLIENT_LIST")
+	}
+	return parseCardinals(list.Value), false, nil
+}
+
+// doProcessNames returns the names of a process from /proc, its comm, which the kernel truncates to 15 bytes,
+// and the name of its executable, which is only readable for processes of the same user.
+func doProcessNames(pid int) []string {
+	return procNames(pid, os.ReadFile, os.Readlink)
+}
+
+// procNames reads the names of a process from its comm file and exe link under /proc.
+//
+// Parameters:
+//   - pid: The ID of the process.
+//   - readFile: The function reading a file.
+//   - readlink: The function reading the target of a symbolic link.
+//
+// Returns:
+//   - []string: The names that could be read, nil if neither could.
+func procNames(pid int, readFile func(name string) ([]byte, error), readlink func(name string) (string, error)) []string {
+	var names []string
+	if comm, err := readFile(fmt.Sprintf("/proc/%d/comm", pid)); err == nil {
+		names = append(names, strings.TrimSpace(string(comm)))
+	}
+	if exe, err := readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		names = append(names, filepath.Base(exe))
+	}
+	return names
+}
+
+func doActivate(handle uintptr) error {
+	if xConn == nil {
+		if err := initXGB(); err != nil {
+			return err
+		}
+	}
+
+	// source indication 2 marks the request as coming from a pager, which window managers honor without focus stealing prevention,
+	// the window manager also maps the window if it is minimized
+	if err := sendRootMessage(xproto.Window(handle), "_NET_ACTIVE_WINDOW", 2, xproto.TimeCurrentTime, 0); err != nil {
+		return fmt.Errorf("failed to request the activation of the window: %w", err)
+	}
+	return nil
+}
+
+func doMinimize(handle uintptr) error {
+	if xConn == nil {
+		if err := initXGB(); err != nil {
+			return err
+		}
+	}
+	// clients can not set _NET_WM_STATE_HIDDEN, minimizing is requested through the ICCCM WM_CHANGE_STATE message instead
+	if err := sendRootMessage(xproto.Window(handle), "WM_CHANGE_STATE", iconicState); err != nil {
+		return fmt.Errorf("failed to request minimizing the window: %w", err)
+	}
+	return nil
+}
+
+func doMaximize(handle uintptr) error {
+	return setMaximized(handle, netWMStateAdd)
+}
+
+func doRestore(handle uintptr) error {
+	if err := setMaximized(handle, netWMStateRemove); err != nil {
+		return err
+	}
+	state, err := doState(handle)
+	if err != nil {
+		return err
+	}
+	// activating a minimized window maps it again
+	if state == WindowMinimized {
+		return doActivate(handle)
+	}
+	return nil
+}
+
+func doState(handle uintptr) (WindowState, error) {
+	if xConn == nil {
+		if err := initXGB(); err != nil {
+			return WindowNormal, err
+		}
+	}
+	prop, err := getProperty(xproto.Window(handle), "_NET_WM_STATE")
+	if err != nil {
+		return WindowNormal, err
+	}
+
+	atoms := make(map[string]uint32, 3)
+	for _, name := range []string{"_NET_WM_STATE_HIDDEN", "_NET_WM_STATE_MAXIMIZED_VERT", "_NET_WM_STATE_MAXIMIZED_HORZ"} {
+		atom, err := internAtom(name)
+		if err != nil {
+			return WindowNormal, err
+		}
+		atoms[name] = uint32(atom)
+	}
+	return decodeNetWMState(parseCardinals(prop.Value), atoms["_NET_WM_STATE_HIDDEN"], atoms["_NET_WM_STATE_MAXIMIZED_VERT"], atoms["_NET_WM_STATE_MAXIMIZED_HORZ"]), nil
+}
+
+const (
+	iconicState      = 3 // the ICCCM WM_STATE of a minimized window
+	netWMStateRemove = 0 // the _NET_WM_STATE action that removes a state
+	netWMStateAdd    = 1 // the _NET_WM_STATE action that adds a state
+)
+
+// setMaximized adds or removes both maximized states of a window.
+//
+// Parameters:
+//   - handle: The X window ID of the window.
+//   - action: netWMStateAdd to maximize the window, netWMStateRemove to unmaximize it.
+//
+// Returns:
+//   - error: An error if the request could not be sent.
+func setMaximized(handle uintptr, action uint32) error {
+	if xConn == nil {
+		if err := initXGB(); err != nil {
+			return err
+		}
+	}
+	vert, err := internAtom("_NET_WM_STATE_MAXIMIZED_VERT")
+	if err != nil {
+		return err
+	}
+	horz, err := internAtom("_NET_WM_STATE_MAXIMIZED_HORZ")
+	if err != nil {
+		return err
+	}
+	// source indication 2 marks the request as coming from a pager, like the activation request
+	if err := sendRootMessage(xproto.Window(handle), "_NET_WM_STATE", action, uint32(vert), uint32(horz), 2); err != nil {
+		return fmt.Errorf("failed to request the maximized state of the window: %w", err)
+	}
+	return nil
+}
+
+// decodeNetWMState decodes the state of a window from the atoms of its _NET_WM_STATE property.
+// A hidden window is minimized, and a window is only maximized if it is maximized both vertically and horizontally.
+//
+// Parameters:
+//   - states: The atoms of the _NET_WM_STATE property.
+//   - hidden: The atom of _NET_WM_STATE_HIDDEN.
+//   - maxVert: The atom of _NET_WM_STATE_MAXIMIZED_VERT.
+//   - maxHorz: The atom of _NET_WM_STATE_MAXIMIZED_HORZ.
+//
+// Returns:
+//   - WindowState: The state of the window.
+func decodeNetWMState(states []uint32, hidden, maxVert, maxHorz uint32) WindowState {
+	var isVert, isHorz bool
+	for _, state := range states {
+		switch state {
+		case hidden:
+			return WindowMinimized
+		case maxVert:
+			isVert = true
+		case maxHorz:
+			isHorz = true
+		}
+	}
+	if isVert && isHorz {
+		return WindowMaximized
+	}
+	return WindowNormal
+}
+
+// internAtom looks up an atom by name, creating it if it does not exist yet.
+//
+// Parameters:
+//   - name: The name of the atom.
+//
+// Returns:
+//   - xproto.Atom: The atom.
+//   - error: An error if the atom could not be looked up.
+func internAtom(name string) (xproto.Atom, error) {
+	reply, err := xproto.InternAtom(xConn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up atom %s: %w", name, err)
+	}
+	return reply.Atom, nil
+}
+
+// sendRootMessage sends a client message about a window to the root window, which is how requests are made to the window manager.
+//
+// Parameters:
+//   - win: The window the message is about.
+//   - messageType: The name of the message type atom.
+//   - data: The data of the message, up to five values.
+//
+// Returns:
+//   - error: An error if the message could not be sent.
+func sendRootMessage(win xproto.Window, messageType string, data ...uint32) error {
+	atom, err := internAtom(messageType)
+	if err != nil {
+		return err
+	}
+	values := make([]uint32, 5)
+	copy(values, data)
+	event := xproto.ClientMessageEvent{
+		Format: 32,
+		Window: win,
+		Type:   atom,
+		Data:   xproto.ClientMessageDataUnionData32New(values),
+	}
+	root := xproto.Setup(xConn).DefaultScreen(xConn).Root
+	mask := uint32(xproto.EventMaskSubstructureRedirect | xproto.EventMaskSubstructureNotify)
+	return xproto.SendEventChecked(xConn, false, root, mask, string(event.Bytes())).Check()
+}
+
+func doActiveWindow() (uintptr, error) {
+	if xConn == nil {
+		if err := initXGB(); err != nil {
+			return 0, err
+		}
+	}
+	root := xproto.Setup(xConn).DefaultScreen(xConn).Root
+
+	active, err := getProperty(root, "_NET_ACTIVE_WINDOW")
+	if err != nil {
+		return 0, err
+	}
+	windows := parseCardinals(active.Value)
+	if active.Format != 32 || len(windows) == 0 {
+		return 0, errors.New("the window manager does not provide _NET_ACTIVE_WINDOW")
+	}
+	return uintptr(windows[0]), nil
+}
+
+func doClientBounds(handle uintptr) (image.Rectangle, error) {
+	info, err := doDescribe(handle)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	return image.Rect(int(info.X), int(info.Y), int(info.X)+info.Width, int(info.Y)+info.Height), nil
+}
+
+func doDescribe(handle uintptr) (WindowInfo, error) {
+	if xConn == nil {
+		if err := initXGB(); err != nil {
+			return WindowInfo{}, err
+		}
+	}
+	root := xproto.Setup(xConn).DefaultScreen(xConn).Root
+	info, _, err := describeWindow(root, xproto.Window(handle))
+	return info, err
+}
+
+// doWatchForeground reports changes of _NET_ACTIVE_WINDOW from the PropertyNotify events of the root window.
+// The events are read from a connection of their own, which is closed once the context is done to stop waiting for them.
+func doWatchForeground(ctx context.Context) (<-chan uintptr, error) {
+	conn, err := xgb.NewConn()
+	if err != nil {
+		return nil, err
+	}
+	root := xproto.Setup(conn).DefaultScreen(conn).Root
+	atom, err := xproto.InternAtom(conn, false, uint16(len("_NET_ACTIVE_WINDOW")), "_NET_ACTIVE_WINDOW").Reply()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to look up atom _NET_ACTIVE_WINDOW: %w", err)
+	}
+	if err := xproto.ChangeWindowAttributesChecked(conn, root, xproto.CwEventMask, []uint32{xproto.EventMaskPropertyChange}).Check(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to listen for property changes of the root window: %w", err)
+	}
+
+	events := make(chan uintptr)
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		defer close(events)
+		for {
+			ev, xErr := conn.WaitForEvent()
+			if ev == nil && xErr == nil {
+				// the connection was closed
+				return
+			}
+			if !isActiveWindowEvent(ev, atom.Atom) {
+				continue
+			}
+			active, err := doActiveWindow()
+			if err != nil || active == 0 {
+				continue
+			}
+			select {
+			case events <- active:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// isActiveWindowEvent reports whether an X event is a change of the _NET_ACTIVE_WINDOW property.
+//
+// Parameters:
+//   - ev: The event.
+//   - activeWindow: The atom of _NET_ACTIVE_WINDOW.
+//
+// Returns:
+//   - bool: True if the event reports that the active window property changed, false otherwise.
+func isActiveWindowEvent(ev xgb.Event, activeWindow xproto.Atom) bool {
+	notify, ok := ev.(xproto.PropertyNotifyEvent)
+	return ok && notify.Atom == activeWindow && notify.State == xproto.PropertyNewValue
+}
+
+// describeWindow reads the title, process ID and bounds of a window.
+//
+// Parameters:
+//   - root: The root window, which the bounds are translated to.
+//   - win: The window.
+//
+// Returns:
+//   - WindowInfo: The description of the window.
+//   - bool: True if the window is viewable, false if it or one of its ancestors is unmapped, such as when it is minimized.
+//   - error: An error if the window could not be queried.
+func describeWindow(root, win xproto.Window) (WindowInfo, bool, error) {
+	attrs, err := xproto.GetWindowAttributes(xConn, win).Reply()
+	if err != nil {
+		return WindowInfo{}, false, err
+	}
+	geom, err := xproto.GetGeometry(xConn, xproto.Drawable(win)).Reply()
+	if err != nil {
+		return WindowInfo{}, false, err
+	}
+	// the geometry is relative to the parent, which is usually a frame of the window manager
+	pos, err := xproto.TranslateCoordinates(xConn, win, root, 0, 0).Reply()
+	if err != nil {
+		return WindowInfo{}, false, err
+	}
+
+	info := WindowInfo{
+		Handle: uintptr(win),
+		X:      int32(pos.DstX),
+		Y:      int32(pos.DstY),
+		Width:  int(geom.Width),
+		Height: int(geom.Height),
+	}
+
+	if name, err := getProperty(win, "_NET_WM_NAME"); err == nil && len(name.Value) > 0 {
+		info.Title = decodeTitle(name.Value)
+	} else if name, err := getProperty(win, "WM_NAME"); err == nil {
+		info.Title = decodeTitle(name.Value)
+	}
+	if pid, err := getProperty(win, "_NET_WM_PID"); err == nil && pid.Format == 32 {
+		if pids := parseCardinals(pid.Value); len(pids) > 0 {
+			info.PID = int(pids[0])
+		}
+	}
+
+	return info, attrs.MapState == xproto.MapStateViewable, nil
+}
+
+// getProperty reads a property of a window, of any type.
+//
+// Parameters:
+//   - win: The window.
+//   - name: The name of the property.
+//
+// Returns:
+//   - *xproto.GetPropertyReply: The property, with an empty value if the window does not have it.
+//   - error: An error if the property could not be read.
+func getProperty(win xproto.Window, name string) (*xproto.GetPropertyReply, error) {
+	atom, err := xproto.InternAtom(xConn, true, uint16(len(name)), name).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up atom %s: %w", name, err)
+	}
+	// the length is in 32-bit units, this is large enough for any list of windows or title
+	prop, err := xproto.GetProperty(xConn, false, win, atom.Atom, xproto.GetPropertyTypeAny, 0, 1<<16).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read property %s: %w", name, err)
+	}
+	return prop, nil
+}
+
+// parseCardinals decodes the value of a property of format 32, such as a CARDINAL or WINDOW list, as sent by the X server.
+// xgb decodes every reply in little-endian byte order, so the values are read the same way.
+//
+// Parameters:
+//   - value: The raw value of the property.
+//
+// Returns:
+//   - []uint32: The decoded values, a trailing partial value is ignored.
+func parseCardinals(value []byte) []uint32 {
+	values := make([]uint32, 0, len(value)/4)
+	for i := 0; i+4 <= len(value); i += 4 {
+		values = append(values, uint32(value[i])|uint32(value[i+1])<<8|uint32(value[i+2])<<16|uint32(value[i+3])<<24)
+	}
+	return values
+}
+
+// decodeTitle decodes the value of a window title property, cutting it at the first NUL since some clients pad the value with them.
+// _NET_WM_NAME is UTF-8, while WM_NAME is usually Latin-1 but is treated as UTF-8 as well, which is what most clients actually set.
+//
+// Parameters:
+//   - value: The raw value of the property.
+//
+// Returns:
+//   - string: The title.
+func decodeTitle(value []byte) string {
+	if i := bytes.IndexByte(value, 0); i >= 0 {
+		value = value[:i]
+	}
+	return strings.ToValidUTF8(string(value), "�")
+}
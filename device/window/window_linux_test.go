@@ -0,0 +1,261 @@
+//go:build linux
+// +build linux
+
+package window
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// cannedClientList is the value of a _NET_CLIENT_LIST_STACKING property listing windows 0x03a00007, 0x04000003 and 0x00e0000a,
+// as the X server sends it, in little-endian byte order.
+var cannedClientList = []byte{
+	0x07, 0x00, 0xa0, 0x03,
+	0x03, 0x00, 0x00, 0x04,
+	0x0a, 0x00, 0xe0, 0x00,
+}
+
+func TestParseCardinals(t *testing.T) {
+	tests := []struct {
+		name  string
+		value []byte
+		want  []uint32
+	}{
+		{name: "client list", value: cannedClientList, want: []uint32{0x03a00007, 0x04000003, 0x00e0000a}},
+		{name: "pid", value: []byte{0x39, 0x30, 0x00, 0x00}, want: []uint32{12345}},
+		{name: "max value", value: []byte{0xff, 0xff, 0xff, 0xff}, want: []uint32{0xffffffff}},
+		{name: "empty", value: nil, want: []uint32{}},
+		{name: "partial value", value: []byte{0x01, 0x02, 0x03}, want: []uint32{}},
+		{name: "trailing partial value", value: append(slices.Clone(cannedClientList), 0x01, 0x02), want: []uint32{0x03a00007, 0x04000003, 0x00e0000a}},
+	}
+	for _, tt := range tests {
+		if got := parseCardinals(tt.value); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: parseCardinals(% x) = %#x, want %#x", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeTitle(t *testing.T) {
+	tests := []struct {
+		name  string
+		value []byte
+		want  string
+	}{
+		{name: "empty", value: nil, want: ""},
+		{name: "ascii", value: []byte("xterm"), want: "xterm"},
+		{name: "utf-8", value: []byte("Größe – 設定 \U0001F600"), want: "Größe – 設定 \U0001F600"},
+		{name: "nul padded", value: []byte("Terminal\x00\x00\x00"), want: "Terminal"},
+		{name: "nul separated", value: []byte("first\x00second"), want: "first"},
+		// a Latin-1 WM_NAME of "café", é is 0xe9 which is not valid UTF-8
+		{name: "latin-1", value: []byte{'c', 'a', 'f', 0xe9}, want: "caf�"},
+		{name: "truncated utf-8", value: []byte{'a', 0xe8, 0xa8}, want: "a�"},
+	}
+	for _, tt := range tests {
+		if got := decodeTitle(tt.value); got != tt.want {
+			t.Errorf("%s: decodeTitle(% x) = %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+// cannedRootProperties answers property reads of the root window from canned replies, a property that is not in the map
+// is returned with format 0 and an empty value, like the X server does for a property the window does not have.
+func cannedRootProperties(props map[string]*xproto.GetPropertyReply) func(name string) (*xproto.GetPropertyReply, error) {
+	return func(name string) (*xproto.GetPropertyReply, error) {
+		if prop, ok := props[name]; ok {
+			return prop, nil
+		}
+		return &xproto.GetPropertyReply{}, nil
+	}
+}
+
+func TestClientList(t *testing.T) {
+	mapped := []byte{0x0a, 0x00, 0xe0, 0x00, 0x07, 0x00, 0xa0, 0x03}
+	errRead := errors.New("read failed")
+	tests := []struct {
+		name        string
+		props       func(name string) (*xproto.GetPropertyReply, error)
+		want        []uint32
+		wantStacked bool
+		wantErr     bool
+	}{
+		{
+			name: "stacking order is preferred",
+			props: cannedRootProperties(map[string]*xproto.GetPropertyReply{
+				"_NET_CLIENT_LIST_STACKING": {Format: 32, Value: cannedClientList},
+				"_NET_CLIENT_LIST":          {Format: 32, Value: mapped},
+			}),
+			want:        []uint32{0x03a00007, 0x04000003, 0x00e0000a},
+			wantStacked: true,
+		},
+		{
+			name: "mapping order without stacking order",
+			props: cannedRootProperties(map[string]*xproto.GetPropertyReply{
+				"_NET_CLIENT_LIST": {Format: 32, Value: mapped},
+			}),
+			want: []uint32{0x00e0000a, 0x03a00007},
+		},
+		{
+			name: "stacking order of the wrong format",
+			props: cannedRootProperties(map[string]*xproto.GetPropertyReply{
+				"_NET_CLIENT_LIST_STACKING": {Format: 8, Value: []byte("garbage")},
+				"_NET_CLIENT_LIST":          {Format: 32, Value: mapped},
+			}),
+			want: []uint32{0x00e0000a, 0x03a00007},
+		},
+		{
+			name: "stacking order read error",
+			props: func(name string) (*xproto.GetPropertyReply, error) {
+				if name == "_NET_CLIENT_LIST_STACKING" {
+					return nil, errRead
+				}
+				return &xproto.GetPropertyReply{Format: 32, Value: mapped}, nil
+			},
+			want: []uint32{0x00e0000a, 0x03a00007},
+		},
+		{
+			name:    "no list",
+			props:   cannedRootProperties(nil),
+			wantErr: true,
+		},
+		{
+			name:    "client list read error",
+			props:   func(name string) (*xproto.GetPropertyReply, error) { return nil, errRead },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, stacked, err := clientList(tt.props)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: clientList() error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) || stacked != tt.wantStacked {
+			t.Errorf("%s: clientList() = %#x, stacked %v, want %#x, stacked %v", tt.name, got, stacked, tt.want, tt.wantStacked)
+		}
+	}
+}
+
+// the atoms a window manager interned for the _NET_WM_STATE values, the numbers are whatever the X server assigned
+const (
+	atomHidden  = 0x1a3
+	atomMaxVert = 0x1a5
+	atomMaxHorz = 0x1a6
+	atomAbove   = 0x1a9
+	atomFocused = 0x1c2
+)
+
+// netWMState encodes a _NET_WM_STATE property value of the given atoms, as the X server sends it.
+func netWMState(atoms ...uint32) []byte {
+	value := make([]byte, 0, 4*len(atoms))
+	for _, atom := range atoms {
+		value = append(value, byte(atom), byte(atom>>8), byte(atom>>16), byte(atom>>24))
+	}
+	return value
+}
+
+func TestDecodeNetWMState(t *testing.T) {
+	tests := []struct {
+		name  string
+		value []byte
+		want  WindowState
+	}{
+		{name: "no state", value: nil, want: WindowNormal},
+		{name: "focused", value: netWMState(atomFocused), want: WindowNormal},
+		{name: "hidden", value: netWMState(atomHidden), want: WindowMinimized},
+		{name: "maximized", value: netWMState(atomMaxVert, atomMaxHorz), want: WindowMaximized},
+		{name: "maximized in any order", value: netWMState(atomFocused, atomMaxHorz, atomAbove, atomMaxVert), want: WindowMaximized},
+		{name: "only vertically maximized", value: netWMState(atomMaxVert, atomFocused), want: WindowNormal},
+		{name: "only horizontally maximized", value: netWMState(atomMaxHorz), want: WindowNormal},
+		// a maximized window that is minimized keeps its maximized states
+		{name: "minimized while maximized", value: netWMState(atomMaxVert, atomMaxHorz, atomHidden), want: WindowMinimized},
+		{name: "hidden first", value: netWMState(atomHidden, atomMaxVert, atomMaxHorz), want: WindowMinimized},
+		{name: "trailing partial atom", value: append(netWMState(atomMaxVert, atomMaxHorz), 0xa3, 0x01), want: WindowMaximized},
+	}
+	for _, tt := range tests {
+		if got := decodeNetWMState(parseCardinals(tt.value), atomHidden, atomMaxVert, atomMaxHorz); got != tt.want {
+			t.Errorf("%s: decodeNetWMState(% x) = %v, want %v", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestProcNames(t *testing.T) {
+	files := map[string]string{
+		"/proc/100/comm": "gnome-text-edit\n",
+		"/proc/200/comm": "bash\n",
+	}
+	links := map[string]string{
+		"/proc/100/exe": "/usr/bin/gnome-text-editor",
+		"/proc/300/exe": "/opt/app/bin/app",
+	}
+	readFile := func(name string) ([]byte, error) {
+		if content, ok := files[name]; ok {
+			return []byte(content), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	readlink := func(name string) (string, error) {
+		if target, ok := links[name]; ok {
+			return target, nil
+		}
+		// the exe link of a process of another user can not be read
+		return "", os.ErrPermission
+	}
+
+	tests := []struct {
+		pid  int
+		want []string
+	}{
+		{pid: 100, want: []string{"gnome-text-edit", "gnome-text-editor"}},
+		{pid: 200, want: []string{"bash"}},
+		{pid: 300, want: []string{"app"}},
+		{pid: 400, want: nil},
+	}
+	for _, tt := range tests {
+		if got := procNames(tt.pid, readFile, readlink); !slices.Equal(got, tt.want) {
+			t.Errorf("procNames(%d) = %q, want %q", tt.pid, got, tt.want)
+		}
+	}
+}
+
+func TestIsActiveWindowEvent(t *testing.T) {
+	const activeWindow, clientList xproto.Atom = 0x160, 0x161
+	tests := []struct {
+		name string
+		ev   xgb.Event
+		want bool
+	}{
+		{name: "new value", ev: xproto.PropertyNotifyEvent{Window: 0x1e7, Atom: activeWindow, State: xproto.PropertyNewValue}, want: true},
+		{name: "deleted", ev: xproto.PropertyNotifyEvent{Window: 0x1e7, Atom: activeWindow, State: xproto.PropertyDelete}, want: false},
+		{name: "other property", ev: xproto.PropertyNotifyEvent{Window: 0x1e7, Atom: clientList, State: xproto.PropertyNewValue}, want: false},
+		{name: "other event", ev: xproto.FocusInEvent{Event: 0x1e7}, want: false},
+		{name: "pointer event", ev: &xproto.PropertyNotifyEvent{Window: 0x1e7, Atom: activeWindow, State: xproto.PropertyNewValue}, want: false},
+		{name: "nil", ev: nil, want: false},
+	}
+	for _, tt := range tests {
+		if got := isActiveWindowEvent(tt.ev, activeWindow); got != tt.want {
+			t.Errorf("%s: isActiveWindowEvent(%v) = %v, want %v", tt.name, tt.ev, got, tt.want)
+		}
+	}
+}
+
+// TestIsActiveWindowEventFromWire decodes a PropertyNotify event as the X server sends it, to check the event xgb hands out is recognized.
+func TestIsActiveWindowEventFromWire(t *testing.T) {
+	wire := make([]byte, 32)
+	wire[0] = xproto.PropertyNotify
+	copy(wire[4:8], []byte{0xe7, 0x01, 0x00, 0x00})  // the root window 0x1e7
+	copy(wire[8:12], []byte{0x60, 0x01, 0x00, 0x00}) // the atom 0x160
+	wire[16] = xproto.PropertyNewValue
+	ev := xproto.PropertyNotifyEventNew(wire)
+	if !isActiveWindowEvent(ev, 0x160) {
+		t.Errorf("isActiveWindowEvent(%v) = false, want true", ev)
+	}
+	if isActiveWindowEvent(ev, 0x161) {
+		t.Errorf("isActiveWindowEvent(%v) for another atom = true, want false", ev)
+	}
+}
@@ -0,0 +1,352 @@
+package window
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func TestDecodeUTF16Title(t *testing.T) {
+	tests := []struct {
+		name string
+		text []uint16
+		want string
+	}{
+		{name: "empty", text: nil, want: ""},
+		{name: "ascii", text: utf16.Encode([]rune("Untitled - Notepad")), want: "Untitled - Notepad"},
+		{name: "bmp", text: utf16.Encode([]rune("Größe – 設定")), want: "Größe – 設定"},
+		// U+1F600 is the surrogate pair D83D DE00
+		{name: "surrogate pair", text: []uint16{'h', 'i', 0xD83D, 0xDE00}, want: "hi\U0001F600"},
+		{name: "nul terminated", text: []uint16{'a', 'b', 0, 'c'}, want: "ab"},
+		{name: "leading nul", text: []uint16{0, 'a'}, want: ""},
+		{name: "unpaired high surrogate", text: []uint16{'a', 0xD83D, 'b'}, want: "a�b"},
+		{name: "unpaired low surrogate", text: []uint16{0xDE00, 'b'}, want: "�b"},
+		{name: "truncated pair", text: []uint16{'a', 0xD83D}, want: "a�"},
+	}
+	for _, tt := range tests {
+		if got := decodeUTF16Title(tt.text); got != tt.want {
+			t.Errorf("%s: decodeUTF16Title(%#04x) = %q, want %q", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFilterByTitle(t *testing.T) {
+	windows := []WindowInfo{
+		{Handle: 1, Title: "Untitled - Notepad"},
+		{Handle: 2, Title: "notes.txt - NOTEPAD"},
+		{Handle: 3, Title: "Calculator"},
+		{Handle: 4, Title: ""},
+	}
+	tests := []struct {
+		substr string
+		want   []uintptr
+	}{
+		{substr: "notepad", want: []uintptr{1, 2}},
+		{substr: "NOTES", want: []uintptr{2}},
+		{substr: "calc", want: []uintptr{3}},
+		{substr: "paint", want: nil},
+		{substr: "", want: []uintptr{1, 2, 3, 4}},
+	}
+	for _, tt := range tests {
+		var got []uintptr
+		for _, w := range filterByTitle(windows, tt.substr) {
+			got = append(got, w.Handle)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("filterByTitle(%q) = handles %v, want %v", tt.substr, got, tt.want)
+		}
+	}
+}
+
+// activeSequence returns an active window function that reports the given windows in turn, and then the last one forever.
+func activeSequence(calls *int, handles ...uintptr) func() (uintptr, error) {
+	return func() (uintptr, error) {
+		i := min(*calls, len(handles)-1)
+		*calls++
+		return handles[i], nil
+	}
+}
+
+func TestWaitForFocusReturnsOnceActive(t *testing.T) {
+	var calls int
+	if err := waitForFocus(context.Background(), 0x42, activeSequence(&calls, 0x42)); err != nil {
+		t.Fatalf("waitForFocus() error = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("active window polled %d times, want 1 for a window that is already active", calls)
+	}
+
+	calls = 0
+	start := time.Now()
+	if err := waitForFocus(context.Background(), 0x42, activeSequence(&calls, 0x1, 0x2, 0x42, 0x1)); err != nil {
+		t.Fatalf("waitForFocus() error = %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("active window polled %d times, want 3, polling must stop once the window is active", calls)
+	}
+	if elapsed := time.Since(start); elapsed < 2*focusPollInterval {
+		t.Errorf("waitForFocus() took %v for 3 polls, want at least 2 poll intervals of %v", elapsed, focusPollInterval)
+	}
+}
+
+func TestWaitForFocusReturnsActiveWindowError(t *testing.T) {
+	errActive := errors.New("no active window")
+	var calls int
+	err := waitForFocus(context.Background(), 0x42, func() (uintptr, error) {
+		calls++
+		if calls == 2 {
+			return 0, errActive
+		}
+		return 0x1, nil
+	})
+	if !errors.Is(err, errActive) {
+		t.Fatalf("waitForFocus() error = %v, want %v", err, errActive)
+	}
+	if calls != 2 {
+		t.Errorf("active window polled %d times, want 2, polling must stop at the first error", calls)
+	}
+}
+
+func TestWaitForFocusStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*focusPollInterval)
+	defer cancel()
+	var calls int
+	err := waitForFocus(ctx, 0x42, activeSequence(&calls, 0x1))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waitForFocus() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if calls < 2 {
+		t.Errorf("active window polled %d times, want it polled until the deadline", calls)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	if err := waitForFocus(ctx, 0x42, activeSequence(&calls, 0x1)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("waitForFocus() error = %v, want %v", err, context.Canceled)
+	}
+	if calls != 1 {
+		t.Errorf("active window polled %d times with a cancelled context, want 1", calls)
+	}
+}
+
+func TestWindowStateString(t *testing.T) {
+	tests := []struct {
+		state WindowState
+		want  string
+	}{
+		{state: WindowNormal, want: "normal"},
+		{state: WindowMinimized, want: "minimized"},
+		{state: WindowMaximized, want: "maximized"},
+		{state: WindowState(42), want: "normal"},
+	}
+	for _, tt := range tests {
+		if got := tt.state.String(); got != tt.want {
+			t.Errorf("WindowState(%d).String() = %q, want %q", int(tt.state), got, tt.want)
+		}
+	}
+}
+
+// listedWindows are the windows of a fake enumeration, notepad and calc are two processes, PID 0 is a window whose process is not known.
+var listedWindows = []WindowInfo{
+	{Handle: 1, Title: "Untitled - Notepad", PID: 100},
+	{Handle: 2, Title: "Calculator", PID: 200},
+	{Handle: 3, Title: "Find", PID: 100},
+	{Handle: 4, Title: "Desktop", PID: 0},
+	{Handle: 5, Title: "Untitled - Notepad", PID: 300},
+	{Handle: 6, Title: "Task Manager", PID: 400},
+}
+
+func listOf(windows []WindowInfo, err error) func() ([]WindowInfo, error) {
+	return func() ([]WindowInfo, error) { return windows, err }
+}
+
+func handles(windows []WindowInfo) []uintptr {
+	var got []uintptr
+	for _, w := range windows {
+		got = append(got, w.Handle)
+	}
+	return got
+}
+
+func TestNormalizeProcessName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "notepad", want: "notepad"},
+		{name: "Notepad.exe", want: "notepad"},
+		{name: "NOTEPAD.EXE", want: "notepad"},
+		{name: `C:\Windows\System32\notepad.exe`, want: "notepad"},
+		{name: `\\?\C:\Program Files\App\App.Exe`, want: "app"},
+		{name: "/usr/bin/gnome-calculator", want: "gnome-calculator"},
+		{name: "  firefox\n", want: "firefox"},
+		{name: "my.exe.exe", want: "my.exe"},
+		{name: "exe", want: "exe"},
+		{name: "", want: ""},
+		{name: `C:\dir\`, want: ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeProcessName(tt.name); got != tt.want {
+			t.Errorf("normalizeProcessName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindByPID(t *testing.T) {
+	got, err := findByPID(100, listOf(listedWindows, nil))
+	if err != nil {
+		t.Fatalf("findByPID() error = %v", err)
+	}
+	if want := []uintptr{1, 3}; !slices.Equal(handles(got), want) {
+		t.Errorf("findByPID(100) = handles %v, want %v", handles(got), want)
+	}
+	if got, _ := findByPID(999, listOf(listedWindows, nil)); len(got) != 0 {
+		t.Errorf("findByPID(999) = handles %v, want none", handles(got))
+	}
+
+	errList := errors.New("enumeration failed")
+	if _, err := findByPID(100, listOf(nil, errList)); !errors.Is(err, errList) {
+		t.Errorf("findByPID() error = %v, want %v", err, errList)
+	}
+}
+
+func TestFindByProcessName(t *testing.T) {
+	names := map[int][]string{
+		100: {"notepad.exe"},
+		200: {`C:\Windows\System32\CalculatorApp.exe`},
+		// the comm of a Linux process is truncated to 15 bytes, the executable name is not
+		300: {"gnome-text-edit", "gnome-text-editor"},
+		// 400 is a protected process whose names can not be resolved
+	}
+	resolved := make(map[int]int)
+	processNames := func(pid int) []string {
+		resolved[pid]++
+		return names[pid]
+	}
+
+	tests := []struct {
+		name string
+		want []uintptr
+	}{
+		{name: "Notepad", want: []uintptr{1, 3}},
+		{name: "NOTEPAD.EXE", want: []uintptr{1, 3}},
+		{name: "calculatorapp", want: []uintptr{2}},
+		{name: "gnome-text-editor", want: []uintptr{5}},
+		{name: "gnome-text-edit", want: []uintptr{5}},
+		{name: "taskmgr", want: nil},
+		{name: "", want: nil},
+	}
+	for _, tt := range tests {
+		clear(resolved)
+		got, err := findByProcessName(tt.name, listOf(listedWindows, nil), processNames)
+		if err != nil {
+			t.Fatalf("findByProcessName(%q) error = %v", tt.name, err)
+		}
+		if !slices.Equal(handles(got), tt.want) {
+			t.Errorf("findByProcessName(%q) = handles %v, want %v", tt.name, handles(got), tt.want)
+		}
+		if _, ok := resolved[0]; ok {
+			t.Errorf("findByProcessName(%q) resolved the names of PID 0", tt.name)
+		}
+		for pid, n := range resolved {
+			if n != 1 {
+				t.Errorf("findByProcessName(%q) resolved the names of PID %d %d times, want once", tt.name, pid, n)
+			}
+		}
+	}
+
+	errList := errors.New("enumeration failed")
+	if _, err := findByProcessName("notepad", listOf(nil, errList), processNames); !errors.Is(err, errList) {
+		t.Errorf("findByProcessName() error = %v, want %v", err, errList)
+	}
+}
+
+// describeExcept describes every window by its handle, except the given ones which are reported as gone.
+func describeExcept(gone ...uintptr) func(uintptr) (WindowInfo, error) {
+	return func(handle uintptr) (WindowInfo, error) {
+		if slices.Contains(gone, handle) {
+			return WindowInfo{}, errors.New("invalid window handle")
+		}
+		return WindowInfo{Handle: handle}, nil
+	}
+}
+
+func TestForwardForegroundDropsRepeats(t *testing.T) {
+	tests := []struct {
+		name   string
+		last   uintptr
+		events []uintptr
+		gone   []uintptr
+		want   []uintptr
+	}{
+		{name: "changes", last: 1, events: []uintptr{2, 3, 1}, want: []uintptr{2, 3, 1}},
+		{name: "initial window", last: 1, events: []uintptr{1, 1, 2}, want: []uintptr{2}},
+		{name: "unknown initial window", last: 0, events: []uintptr{1, 2}, want: []uintptr{1, 2}},
+		{name: "repeats", last: 1, events: []uintptr{2, 2, 2, 3, 3, 2}, want: []uintptr{2, 3, 2}},
+		// the foreground window is briefly none while the focus moves
+		{name: "no window", last: 1, events: []uintptr{0, 2, 0, 2, 0, 0, 3}, want: []uintptr{2, 3}},
+		// a window that is gone does not become the last window, so a repeat of the one before it is still dropped
+		{name: "gone window", last: 1, events: []uintptr{2, 9, 2, 9, 3}, gone: []uintptr{9}, want: []uintptr{2, 3}},
+		{name: "no events", last: 1, events: nil, want: nil},
+	}
+	for _, tt := range tests {
+		handles := make(chan uintptr, len(tt.events))
+		for _, h := range tt.events {
+			handles <- h
+		}
+		close(handles)
+		out := make(chan WindowInfo)
+		go forwardForeground(context.Background(), tt.last, handles, out, describeExcept(tt.gone...))
+
+		var got []uintptr
+		for info := range out {
+			got = append(got, info.Handle)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: forwarded %v from events %v, want %v", tt.name, got, tt.events, tt.want)
+		}
+	}
+}
+
+func TestForwardForegroundStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	handles := make(chan uintptr)
+	out := make(chan WindowInfo)
+	go forwardForeground(ctx, 1, handles, out, describeExcept())
+
+	handles <- 2
+	if info := <-out; info.Handle != 2 {
+		t.Fatalf("forwarded %d, want 2", info.Handle)
+	}
+	cancel()
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Fatal("forwarded a window after the context was done")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("output channel not closed after the context was done")
+	}
+
+	// forwarding also stops while it waits for the window to be received
+	ctx, cancel = context.WithCancel(context.Background())
+	handles = make(chan uintptr, 1)
+	out = make(chan WindowInfo)
+	done := make(chan struct{})
+	go func() {
+		forwardForeground(ctx, 1, handles, out, describeExcept())
+		close(done)
+	}()
+	handles <- 2
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("forwardForeground() did not return after the context was done while sending")
+	}
+}
@@ -0,0 +1,258 @@
+//go:build windows
+// +build windows
+
+package window
+
+import (
+	"context"
+	"errors"
+	"image"
+	"runtime"
+
+	windows "github.com/Carmen-Shannon/automation/tools/_windows"
+)
+
+func doList() ([]WindowInfo, error) {
+	var infos []WindowInfo
+	err := windows.EnumWindows(func(hwnd uintptr) bool {
+		if !windows.IsWindowVisible(hwnd) {
+			return true
+		}
+		info, err := doDescribe(hwnd)
+		if err != nil {
+			// the window was destroyed while enumerating
+			return true
+		}
+		infos = append(infos, info)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+func doDescribe(hwnd uintptr) (WindowInfo, error) {
+	rect, err := windows.GetWindowRect(hwnd)
+	if err != nil {
+		return WindowInfo{}, err
+	}
+	return WindowInfo{
+		Handle: hwnd,
+		Title:  decodeUTF16Title(windows.GetWindowText(hwnd)),
+		PID:    int(windows.GetWindowProcessID(hwnd)),
+		X:      rect.Left,
+		Y:      rect.Top,
+		Width:  int(rect.Right - rect.Left),
+		Height: int(rect.Bottom - rect.Top),
+	}, nil
+}
+
+// foregroundAPI holds the Windows functions doActivate uses to change the foreground window.
+type foregroundAPI struct {
+	isIconic      func(hwnd uintptr) bool
+	restore       func(hwnd uintptr)
+	setForeground func(hwnd uintptr) bool
+	foreground    func() uintptr
+	pressAlt      func()
+	currentThread func() uint32
+	windowThread  func(hwnd uintptr) uint32
+	attachInput   func(from, to uint32, attach bool) error
+	bringToTop    func(hwnd uintptr) error
+}
+
+// systemForeground is the foregroundAPI backed by user32 and kernel32.
+var systemForeground = foregroundAPI{
+	isIconic:      windows.IsIconic,
+	restore:       windows.RestoreWindow,
+	setForeground: windows.SetForegroundWindow,
+	foreground:    windows.GetForegroundWindow,
+	pressAlt: func() {
+		// keybd_event does not report whether the events were sent, so the result is only judged by the foreground window
+		_ = windows.KeybdEvent(windows.VK_MENU, 0)
+		_ = windows.KeybdEvent(windows.VK_MENU, windows.KEYEVENTF_KEYUP)
+	},
+	currentThread: windows.GetCurrentThreadID,
+	windowThread:  windows.GetWindowThreadID,
+	attachInput:   windows.AttachThreadInput,
+	bringToTop:    windows.BringWindowToTop,
+}
+
+func doActivate(hwnd uintptr) error {
+	return activate(hwnd, systemForeground)
+}
+
+// activate brings a window to the foreground.
+// Windows restricts which process may set the foreground window, so when a plain SetForegroundWindow is refused,
+// an alt key press is synthesized to make this process the one that received the last input event, and failing that,
+// the input of this thread is attached to the thread of the current foreground window so they share the foreground state.
+//
+// Parameters:
+//   - hwnd: The handle of the window.
+//   - api: The functions used to change the foreground window.
+//
+// Returns:
+//   - error: An error if the window is not the foreground window after every attempt.
+func activate(hwnd uintptr, api foregroundAPI) error {
+	if api.isIconic(hwnd) {
+		api.restore(hwnd)
+	}
+	if tryForeground(hwnd, api) {
+		return nil
+	}
+
+	api.pressAlt()
+	if tryForeground(hwnd, api) {
+		return nil
+	}
+
+	// the thread ID is only meaningful while the goroutine stays on the same OS thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	current := api.currentThread()
+	foreground := api.windowThread(api.foreground())
+	if foreground != 0 && foreground != current {
+		if err := api.attachInput(current, foreground, true); err == nil {
+			defer api.attachInput(current, foreground, false)
+		}
+	}
+	_ = api.bringToTop(hwnd)
+	if tryForeground(hwnd, api) {
+		return nil
+	}
+	return errors.New("failed to activate the window, Windows refused to change the foreground window")
+}
+
+// tryForeground asks for a window to be brought to the foreground, and reports whether it is the foreground window afterwards.
+//
+// Parameters:
+//   - hwnd: The handle of the window.
+//   - api: The functions used to change the foreground window.
+//
+// Returns:
+//   - bool: True if the window is the foreground window, false otherwise.
+func tryForeground(hwnd uintptr, api foregroundAPI) bool {
+	return api.setForeground(hwnd) && api.foreground() == hwnd
+}
+
+func doMinimize(handle uintptr) error {
+	windows.ShowWindow(handle, windows.SW_MINIMIZE)
+	return nil
+}
+
+func doMaximize(handle uintptr) error {
+	windows.ShowWindow(handle, windows.SW_MAXIMIZE)
+	return nil
+}
+
+func doRestore(handle uintptr) error {
+	windows.RestoreWindow(handle)
+	return nil
+}
+
+func doState(handle uintptr) (WindowState, error) {
+	wp, err := windows.GetWindowPlacement(handle)
+	if err != nil {
+		return WindowNormal, err
+	}
+	return decodeShowCmd(wp.ShowCmd), nil
+}
+
+// decodeShowCmd decodes the state of a window from the show command reported by GetWindowPlacement.
+//
+// Parameters:
+//   - showCmd: The show command.
+//
+// Returns:
+//   - WindowState: The state of the window.
+func decodeShowCmd(showCmd uint32) WindowState {
+	switch showCmd {
+	case windows.SW_SHOWMINIMIZED:
+		return WindowMinimized
+	case windows.SW_MAXIMIZE:
+		return WindowMaximized
+	default:
+		return WindowNormal
+	}
+}
+
+func doClientBounds(hwnd uintptr) (image.Rectangle, error) {
+	r, err := windows.GetClientScreenRect(hwnd)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+	return image.Rect(int(r.Left), int(r.Top), int(r.Right), int(r.Bottom)), nil
+}
+
+func doProcessNames(pid int) []string {
+	path, err := windows.GetProcessImageName(uint32(pid))
+	if err != nil {
+		return nil
+	}
+	return []string{path}
+}
+
+func doActiveWindow() (uintptr, error) {
+	return windows.GetForegroundWindow(), nil
+}
+
+// doWatchForeground reports foreground window changes from an EVENT_SYSTEM_FOREGROUND hook.
+// The hook delivers its events through a message loop, which runs on a goroutine locked to its own OS thread until the context is done.
+func doWatchForeground(ctx context.Context) (<-chan uintptr, error) {
+	events := make(chan uintptr)
+	type started struct {
+		threadID uint32
+		err      error
+	}
+	ready := make(chan started, 1)
+
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		defer close(events)
+
+		// the queue must exist before the thread ID is handed out, or the quit message could be posted before there is a queue to receive it
+		windows.EnsureMessageQueue()
+		hook, err := windows.SetWinEventHook(windows.EVENT_SYSTEM_FOREGROUND, windows.EVENT_SYSTEM_FOREGROUND, func(event uint32, hwnd uintptr, idObject, idChild int32) {
+			if !isForegroundEvent(event, hwnd, idObject, idChild) {
+				return
+			}
+			select {
+			case events <- hwnd:
+			case <-ctx.Done():
+			}
+		})
+		if err != nil {
+			ready <- started{err: err}
+			return
+		}
+		defer windows.UnhookWinEvent(hook)
+		ready <- started{threadID: windows.GetCurrentThreadID()}
+
+		_ = windows.RunMessageLoop()
+	}()
+
+	s := <-ready
+	if s.err != nil {
+		return nil, s.err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = windows.PostThreadQuit(s.threadID)
+	}()
+	return events, nil
+}
+
+// isForegroundEvent reports whether a window event is a change of the foreground window itself, rather than of one of its objects.
+//
+// Parameters:
+//   - event: The EVENT_ constant of the event.
+//   - hwnd: The handle of the window the event is about.
+//   - idObject: The object the event is about.
+//   - idChild: The child of the object the event is about.
+//
+// Returns:
+//   - bool: True if the event reports a new foreground window, false otherwise.
+func isForegroundEvent(event uint32, hwnd uintptr, idObject, idChild int32) bool {
+	return event == windows.EVENT_SYSTEM_FOREGROUND && hwnd != 0 && idObject == windows.OBJID_WINDOW && idChild == windows.CHILDID_SELF
+}
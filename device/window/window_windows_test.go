@@ -0,0 +1,212 @@
+//go:build windows
+// +build windows
+
+package window
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"unsafe"
+
+	windows "github.com/Carmen-Shannon/automation/tools/_windows"
+)
+
+// fakeForeground records the calls doActivate makes, and refuses the first refused calls of SetForegroundWindow.
+type fakeForeground struct {
+	calls     []string
+	iconic    bool
+	refused   int  // the number of SetForegroundWindow calls refused before one is honored, -1 refuses every call
+	lying     bool // SetForegroundWindow reports success without changing the foreground window
+	sets      int
+	fg        uintptr
+	fgThread  uint32 // the thread of the window that is in the foreground at the start
+	current   uint32
+	attachErr error
+}
+
+func (f *fakeForeground) api() foregroundAPI {
+	start := f.fg
+	return foregroundAPI{
+		isIconic: func(uintptr) bool {
+			f.calls = append(f.calls, "isIconic")
+			return f.iconic
+		},
+		restore: func(uintptr) { f.calls = append(f.calls, "restore") },
+		setForeground: func(hwnd uintptr) bool {
+			f.calls = append(f.calls, "setForeground")
+			f.sets++
+			if f.lying {
+				return true
+			}
+			if f.refused < 0 || f.sets <= f.refused {
+				return false
+			}
+			f.fg = hwnd
+			return true
+		},
+		foreground: func() uintptr {
+			f.calls = append(f.calls, "foreground")
+			return f.fg
+		},
+		pressAlt: func() { f.calls = append(f.calls, "pressAlt") },
+		currentThread: func() uint32 {
+			f.calls = append(f.calls, "currentThread")
+			return f.current
+		},
+		windowThread: func(hwnd uintptr) uint32 {
+			f.calls = append(f.calls, "windowThread")
+			if hwnd == start {
+				return f.fgThread
+			}
+			return 0
+		},
+		attachInput: func(from, to uint32, attach bool) error {
+			if from != f.current || to != f.fgThread {
+				f.calls = append(f.calls, "attach wrong threads")
+			} else if attach {
+				f.calls = append(f.calls, "attach")
+			} else {
+				f.calls = append(f.calls, "detach")
+			}
+			return f.attachErr
+		},
+		bringToTop: func(uintptr) error {
+			f.calls = append(f.calls, "bringToTop")
+			return nil
+		},
+	}
+}
+
+func TestActivateStepOrder(t *testing.T) {
+	const hwnd uintptr = 0x42
+	attachSteps := []string{"currentThread", "foreground", "windowThread", "attach", "bringToTop", "setForeground"}
+	tests := []struct {
+		name      string
+		f         *fakeForeground
+		wantCalls []string
+		wantErr   bool
+	}{
+		{
+			name:      "honored at once",
+			f:         &fakeForeground{},
+			wantCalls: []string{"isIconic", "setForeground", "foreground"},
+		},
+		{
+			name:      "minimized window is restored first",
+			f:         &fakeForeground{iconic: true},
+			wantCalls: []string{"isIconic", "restore", "setForeground", "foreground"},
+		},
+		{
+			name:      "honored after the alt key press",
+			f:         &fakeForeground{refused: 1},
+			wantCalls: []string{"isIconic", "setForeground", "pressAlt", "setForeground", "foreground"},
+		},
+		{
+			name:      "honored after attaching the thread input",
+			f:         &fakeForeground{refused: 2},
+			wantCalls: slices.Concat([]string{"isIconic", "setForeground", "pressAlt", "setForeground"}, attachSteps, []string{"foreground", "detach"}),
+		},
+		{
+			name:      "refused every time",
+			f:         &fakeForeground{refused: -1},
+			wantCalls: slices.Concat([]string{"isIconic", "setForeground", "pressAlt", "setForeground"}, attachSteps, []string{"detach"}),
+			wantErr:   true,
+		},
+		{
+			name:      "reported success without changing the foreground window",
+			f:         &fakeForeground{lying: true},
+			wantCalls: slices.Concat([]string{"isIconic", "setForeground", "foreground", "pressAlt", "setForeground", "foreground"}, attachSteps, []string{"foreground", "detach"}),
+			wantErr:   true,
+		},
+		{
+			name:      "failed attach is not detached",
+			f:         &fakeForeground{refused: -1, attachErr: errors.New("access denied")},
+			wantCalls: slices.Concat([]string{"isIconic", "setForeground", "pressAlt", "setForeground"}, attachSteps),
+			wantErr:   true,
+		},
+		{
+			name:      "foreground window of the same thread is not attached",
+			f:         &fakeForeground{refused: -1, fgThread: 3},
+			wantCalls: []string{"isIconic", "setForeground", "pressAlt", "setForeground", "currentThread", "foreground", "windowThread", "bringToTop", "setForeground"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		tt.f.fg = 0x99
+		tt.f.current = 3
+		if tt.f.fgThread == 0 {
+			tt.f.fgThread = 7
+		}
+		err := activate(hwnd, tt.f.api())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: activate() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if !slices.Equal(tt.f.calls, tt.wantCalls) {
+			t.Errorf("%s: calls = %v, want %v", tt.name, tt.f.calls, tt.wantCalls)
+		}
+	}
+}
+
+// placementFixture builds the WINDOWPLACEMENT GetWindowPlacement fills in, from its fields as the 11 DWORDs and LONGs of the C structure.
+func placementFixture(t *testing.T, flags, showCmd uint32, normal windows.Rect) windows.WindowPlacement {
+	t.Helper()
+	raw := [11]uint32{44, flags, showCmd, 0xffff8300, 0xffff8300, 0xffffffff, 0xffffffff,
+		uint32(normal.Left), uint32(normal.Top), uint32(normal.Right), uint32(normal.Bottom)}
+	if size := unsafe.Sizeof(windows.WindowPlacement{}); size != unsafe.Sizeof(raw) {
+		t.Fatalf("WindowPlacement is %d bytes, want %d", size, unsafe.Sizeof(raw))
+	}
+	return *(*windows.WindowPlacement)(unsafe.Pointer(&raw))
+}
+
+func TestDecodeShowCmdFromPlacement(t *testing.T) {
+	const wpfRestoreToMaximized = 0x2
+	normal := windows.Rect{Left: 100, Top: 80, Right: 900, Bottom: 680}
+	tests := []struct {
+		name      string
+		placement windows.WindowPlacement
+		want      WindowState
+	}{
+		{name: "normal", placement: placementFixture(t, 0, 1, normal), want: WindowNormal},
+		{name: "minimized", placement: placementFixture(t, 0, windows.SW_SHOWMINIMIZED, normal), want: WindowMinimized},
+		{name: "maximized", placement: placementFixture(t, 0, windows.SW_MAXIMIZE, normal), want: WindowMaximized},
+		// a maximized window that was minimized restores to maximized, but is minimized until then
+		{name: "minimized from maximized", placement: placementFixture(t, wpfRestoreToMaximized, windows.SW_SHOWMINIMIZED, normal), want: WindowMinimized},
+		{name: "hidden", placement: placementFixture(t, 0, windows.SW_HIDE, normal), want: WindowNormal},
+	}
+	for _, tt := range tests {
+		if tt.placement.RcNormalPosition != normal {
+			t.Fatalf("%s: placement fixture normal position = %+v, want %+v", tt.name, tt.placement.RcNormalPosition, normal)
+		}
+		if got := decodeShowCmd(tt.placement.ShowCmd); got != tt.want {
+			t.Errorf("%s: decodeShowCmd(%d) = %v, want %v", tt.name, tt.placement.ShowCmd, got, tt.want)
+		}
+	}
+}
+
+func TestIsForegroundEvent(t *testing.T) {
+	const (
+		eventObjectFocus = 0x8005
+		objIDClient      = -4
+		objIDCaret       = -8
+	)
+	tests := []struct {
+		name              string
+		event             uint32
+		hwnd              uintptr
+		idObject, idChild int32
+		want              bool
+	}{
+		{name: "foreground window", event: windows.EVENT_SYSTEM_FOREGROUND, hwnd: 0x42, idObject: windows.OBJID_WINDOW, idChild: windows.CHILDID_SELF, want: true},
+		{name: "no window", event: windows.EVENT_SYSTEM_FOREGROUND, hwnd: 0, idObject: windows.OBJID_WINDOW, idChild: windows.CHILDID_SELF, want: false},
+		{name: "client area", event: windows.EVENT_SYSTEM_FOREGROUND, hwnd: 0x42, idObject: objIDClient, idChild: windows.CHILDID_SELF, want: false},
+		{name: "caret", event: windows.EVENT_SYSTEM_FOREGROUND, hwnd: 0x42, idObject: objIDCaret, idChild: windows.CHILDID_SELF, want: false},
+		{name: "child", event: windows.EVENT_SYSTEM_FOREGROUND, hwnd: 0x42, idObject: windows.OBJID_WINDOW, idChild: 3, want: false},
+		{name: "other event", event: eventObjectFocus, hwnd: 0x42, idObject: windows.OBJID_WINDOW, idChild: windows.CHILDID_SELF, want: false},
+	}
+	for _, tt := range tests {
+		if got := isForegroundEvent(tt.event, tt.hwnd, tt.idObject, tt.idChild); got != tt.want {
+			t.Errorf("%s: isForegroundEvent(%#x, %#x, %d, %d) = %v, want %v", tt.name, tt.event, tt.hwnd, tt.idObject, tt.idChild, got, tt.want)
+		}
+	}
+}
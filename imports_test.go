@@ -0,0 +1,57 @@
+package automation
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const modulePath = "github.com/Carmen-Shannon/automation"
+
+// TestImportGraph checks that the packages compile for every supported platform, and that the automation package
+// only pulls in the platform packages of the platform it is built for, so one platform's wrappers never leak into another's build.
+func TestImportGraph(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the go command")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go command is not available")
+	}
+
+	platforms := []struct {
+		goos      string
+		cgo       bool     // whether the build needs cgo, which is only available when building for the host platform
+		forbidden []string // import path prefixes the build for this platform must not depend on
+	}{
+		{goos: "linux", cgo: true, forbidden: []string{modulePath + "/tools/_windows", modulePath + "/tools/windows"}},
+		{goos: "windows", forbidden: []string{modulePath + "/tools/_linux", modulePath + "/tools/windows", "github.com/BurntSushi/xgb"}},
+	}
+	for _, platform := range platforms {
+		t.Run(platform.goos, func(t *testing.T) {
+			goCmd := func(args ...string) string {
+				t.Helper()
+				cmd := exec.Command(goTool, args...)
+				cmd.Env = append(os.Environ(), "GOOS="+platform.goos, "GOARCH=amd64")
+				out, err := cmd.CombinedOutput()
+				if err != nil {
+					t.Fatalf("go %s: %v\n%s", strings.Join(args, " "), err, out)
+				}
+				return string(out)
+			}
+
+			if !platform.cgo || platform.goos == runtime.GOOS {
+				goCmd("build", "./...")
+			}
+			for _, dep := range strings.Fields(goCmd("list", "-deps", ".")) {
+				for _, prefix := range platform.forbidden {
+					if dep == prefix || strings.HasPrefix(dep, prefix+"/") {
+						t.Errorf("the automation package depends on %s when built for %s", dep, platform.goos)
+					}
+				}
+			}
+		})
+	}
+}
@@ -12,11 +12,101 @@ package linux
 import "C"
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"sync"
 	"time"
+
+	"github.com/Carmen-Shannon/automation/tools"
+	"github.com/Carmen-Shannon/automation/tools/x11"
 )
 
+// WaylandOptInEnv is the environment variable that lets the X11 tools run in a Wayland session when set to any non-empty value.
+// This is only useful when the windows to automate run under XWayland, native Wayland windows stay out of reach of the X11 tools.
+const WaylandOptInEnv = "AUTOMATION_ALLOW_WAYLAND"
+
+var (
+	waylandOnce sync.Once
+	wayland     bool // whether the session is a Wayland session without the opt-in, detected once per process
+)
+
+// CheckX11Session reports an error if the process runs in a Wayland session, where the X11 tools misbehave silently instead of failing.
+// The session type is detected on the first call, see x11.IsWaylandSession, and the check is skipped when WaylandOptInEnv is set.
+//
+// Parameters:
+//   - operation: The operation being attempted, used in the error.
+//
+// Returns:
+//   - error: tools.ErrWaylandSession wrapped with the operation if the session is a Wayland session, nil otherwise.
+func CheckX11Session(operation string) error {
+	waylandOnce.Do(func() {
+		wayland = os.Getenv(WaylandOptInEnv) == "" && x11.IsWaylandSession(os.Getenv, loginctlSessionType)
+	})
+	if wayland {
+		return fmt.Errorf("%s: %w", operation, tools.ErrWaylandSession)
+	}
+	return nil
+}
+
+// loginctlSessionType asks loginctl for the type of the login session, see x11.LoginctlSessionType.
+//
+// Returns:
+//   - string: The type of the session, empty if it is not known.
+func loginctlSessionType() string {
+	return x11.LoginctlSessionType(os.Getenv, commandOutput)
+}
+
+// commandOutput runs a command and returns its standard output.
+//
+// Parameters:
+//   - name: The name or path of the command.
+//   - args: The arguments of the command.
+//
+// Returns:
+//   - []byte: The standard output of the command.
+//   - error: An error if the command could not be run or exited with an error.
+func commandOutput(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).Output()
+}
+
+// DependencyStatus is the status of an external tool the linux implementation relies on, see CheckDependencies.
+type DependencyStatus = x11.DependencyStatus
+
+// CheckDependencies checks which of the external tools the display, mouse and keyboard rely on are installed, and their versions.
+// Applications can run it at startup to report every missing tool at once, rather than failing on the first operation that needs one.
+//
+// Returns:
+//   - []DependencyStatus: The status of every tool.
+func CheckDependencies() []DependencyStatus {
+	return x11.CheckDependencies(exec.LookPath, commandCombinedOutput)
+}
+
+// commandCombinedOutput runs a command and returns its combined standard output and standard error.
+//
+// Parameters:
+//   - name: The name or path of the command.
+//   - args: The arguments of the command.
+//
+// Returns:
+//   - []byte: The combined output of the command.
+//   - error: An error if the command could not be run or exited with an error.
+func commandCombinedOutput(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+// RequireTool checks that an external tool is installed before it is used.
+//
+// Parameters:
+//   - tool: The name of the tool, one of the tools reported by CheckDependencies.
+//
+// Returns:
+//   - error: tools.ErrMissingDependency wrapped with the tool and the packages that provide it if the tool is not installed, nil otherwise.
+func RequireTool(tool string) error {
+	return x11.RequireTool(tool, exec.LookPath)
+}
+
 // XKeysymToString converts an X KeySym value to its string representation.
 func XKeysymToString(keysym uint32) string {
 	// Call the XKeysymToString function from the X11 library
@@ -33,7 +123,7 @@ func ExecuteXrandr() ([]byte, error) {
 }
 
 func ExecuteXdotoolMouseMove(x, y int32) error {
-	err := exec.Command("xdotool", "mousemove", fmt.Sprintf("%d", x), fmt.Sprintf("%d", y)).Run()
+	err := exec.Command("xdotool", x11.XdotoolMouseMoveArgs(x, y)...).Run()
 	if err != nil {
 		return err
 	}
@@ -56,43 +146,84 @@ func ExecuteXdotoolGetMousePosition() (int32, int32, error) {
 	return x, y, nil
 }
 
+// ExecuteXdotoolClick clicks a mouse button with xdotool.
+// An instant click is a single xdotool click, while a click with a duration presses the button, holds it, then releases it.
+//
+// Parameters:
+//   - button: The button to click (1 for left, 2 for middle, 3 for right).
+//   - duration: The time to hold the button down in milliseconds, 0 for an instant click.
+//
+// Returns:
+//   - error: An error if xdotool fails to press or release the button.
 func ExecuteXdotoolClick(button int, duration int) error {
-	// Simulate the button press
-	if duration == 0 {
-		err := exec.Command("xdotool", "click", fmt.Sprintf("%d", button)).Run()
-		if err != nil {
-			return fmt.Errorf("failed to click mouse button %d: %w", button, err)
+	for i, args := range x11.XdotoolClickArgs(button, duration) {
+		// the button is held between the mousedown and the mouseup of a click with a duration
+		if i > 0 {
+			time.Sleep(time.Duration(duration) * time.Millisecond)
+		}
+		if err := runXdotoolButton(args, button); err != nil {
+			return err
 		}
-		return nil
-	}
-	
-	err := exec.Command("xdotool", "mousedown", fmt.Sprintf("%d", button)).Run()
-	if err != nil {
-		return fmt.Errorf("failed to press mouse button %d: %w", button, err)
 	}
+	return nil
+}
 
-	time.Sleep(time.Duration(duration) * time.Millisecond)
+func ExecuteXdotoolMouseDown(button int) error {
+	return runXdotoolButton(x11.XdotoolButtonArgs("mousedown", button), button)
+}
 
-	// Simulate the button release
-	err = exec.Command("xdotool", "mouseup", fmt.Sprintf("%d", button)).Run()
-	if err != nil {
-		return fmt.Errorf("failed to release mouse button %d: %w", button, err)
-	}
+func ExecuteXdotoolMouseUp(button int) error {
+	return runXdotoolButton(x11.XdotoolButtonArgs("mouseup", button), button)
+}
 
+// runXdotoolButton runs an xdotool command built by x11.XdotoolButtonArgs, describing the action in the error if it fails.
+//
+// Parameters:
+//   - args: The arguments of the command.
+//   - button: The button the command acts on.
+//
+// Returns:
+//   - error: An error if xdotool fails.
+func runXdotoolButton(args []string, button int) error {
+	if err := exec.Command("xdotool", args...).Run(); err != nil {
+		return fmt.Errorf("failed to %s mouse button %d: %w", buttonVerbs[args[0]], button, err)
+	}
 	return nil
 }
 
+// buttonVerbs describes the xdotool button commands in errors.
+var buttonVerbs = map[string]string{
+	"click":     "click",
+	"mousedown": "press",
+	"mouseup":   "release",
+}
+
 func ExecuteXdotoolKeyDown(keySym string) error {
-	return exec.Command("xdotool", "keydown", keySym).Run()
+	return exec.Command("xdotool", x11.XdotoolKeyArgs("keydown", keySym)...).Run()
 }
 
 func ExecuteXdotoolKeyUp(keySym string) error {
-	return exec.Command("xdotool", "keyup", keySym).Run()
+	return exec.Command("xdotool", x11.XdotoolKeyArgs("keyup", keySym)...).Run()
+}
+
+// ExecuteXdotoolType types text with xdotool.
+// xdotool resolves every character to a keycode of the current keyboard layout, remapping a spare keycode for characters the layout lacks,
+// so the typed text does not depend on the layout. Modifiers held down while typing are released first and restored afterwards.
+//
+// Parameters:
+//   - text: The text to type.
+//
+// Returns:
+//   - error: An error if xdotool fails.
+func ExecuteXdotoolType(text string) error {
+	if out, err := exec.Command("xdotool", x11.XdotoolTypeArgs(text)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to type text: %w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
 }
 
 func ExecuteXwd(x, y, width, height int) ([]byte, error) {
-	// Construct the `xwd` command
-	cmd := exec.Command("xwd", "-root", "-silent", "-geometry", fmt.Sprintf("%dx%d+%d+%d", width, height, x, y))
+	cmd := exec.Command("xwd", x11.XwdArgs(x, y, width, height)...)
 
 	// Capture the output of the command
 	var out bytes.Buffer
@@ -103,3 +234,100 @@ func ExecuteXwd(x, y, width, height int) ([]byte, error) {
 
 	return out.Bytes(), nil
 }
+
+// clipboardTool is a command line clipboard tool, with the arguments that read, write and clear the clipboard selection.
+type clipboardTool struct {
+	name    string
+	wayland bool // the tool only works on a Wayland session
+	read    []string
+	write   []string // the text to write is passed on stdin
+	clear   []string // nil if the tool can not clear the clipboard, in which case empty text is written instead
+}
+
+// clipboardTools are the supported clipboard tools, in order of preference.
+var clipboardTools = []clipboardTool{
+	{name: "wl-paste", wayland: true, read: []string{"wl-paste", "--no-newline"}, write: []string{"wl-copy"}, clear: []string{"wl-copy", "--clear"}},
+	{name: "xclip", read: []string{"xclip", "-selection", "clipboard", "-o"}, write: []string{"xclip", "-selection", "clipboard", "-i"}},
+	{name: "xsel", read: []string{"xsel", "--clipboard", "--output"}, write: []string{"xsel", "--clipboard", "--input"}, clear: []string{"xsel", "--clipboard", "--clear"}},
+}
+
+// findClipboardTool finds the first installed clipboard tool that works on the current session.
+// The Wayland tools are only used when WAYLAND_DISPLAY is set, the X tools work on both X and XWayland.
+//
+// Returns:
+//   - clipboardTool: The clipboard tool.
+//   - error: An error if none of the clipboard tools is installed.
+func findClipboardTool() (clipboardTool, error) {
+	wayland := os.Getenv("WAYLAND_DISPLAY") != ""
+	for _, tool := range clipboardTools {
+		if tool.wayland && !wayland {
+			continue
+		}
+		// wl-paste and wl-copy ship together, checking the reading command is enough for every tool
+		if _, err := exec.LookPath(tool.read[0]); err == nil {
+			return tool, nil
+		}
+	}
+	return clipboardTool{}, errors.New("no clipboard tool found, install wl-clipboard, xclip or xsel")
+}
+
+// ExecuteClipboardRead reads the text on the clipboard with the first available clipboard tool.
+//
+// Returns:
+//   - []byte: The UTF-8 text on the clipboard.
+//   - error: An error if no clipboard tool is installed or it fails, such as when the clipboard holds no text.
+func ExecuteClipboardRead() ([]byte, error) {
+	tool, err := findClipboardTool()
+	if err != nil {
+		return nil, err
+	}
+	var out, stderr bytes.Buffer
+	cmd := exec.Command(tool.read[0], tool.read[1:]...)
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to read the clipboard with %s: %w: %s", tool.name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out.Bytes(), nil
+}
+
+// ExecuteClipboardWrite writes text to the clipboard with the first available clipboard tool.
+// The tools keep running in the background to serve the selection, so this returns once the text has been handed over.
+//
+// Parameters:
+//   - text: The UTF-8 text to write.
+//
+// Returns:
+//   - error: An error if no clipboard tool is installed or it fails.
+func ExecuteClipboardWrite(text []byte) error {
+	tool, err := findClipboardTool()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(tool.write[0], tool.write[1:]...)
+	cmd.Stdin = bytes.NewReader(text)
+	// the output is not captured, the forked process serving the selection would keep the pipe open and Run would wait for it
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to write the clipboard with %s: %w", tool.name, err)
+	}
+	return nil
+}
+
+// ExecuteClipboardClear clears the clipboard with the first available clipboard tool.
+// Tools that can not clear the clipboard write empty text to it instead.
+//
+// Returns:
+//   - error: An error if no clipboard tool is installed or it fails.
+func ExecuteClipboardClear() error {
+	tool, err := findClipboardTool()
+	if err != nil {
+		return err
+	}
+	if tool.clear == nil {
+		return ExecuteClipboardWrite(nil)
+	}
+	if out, err := exec.Command(tool.clear[0], tool.clear[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to clear the clipboard with %s: %w: %s", tool.name, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+//go:build linux
+// +build linux
+
+package linux
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgb/xtest"
+
+	"github.com/Carmen-Shannon/automation/tools/x11"
+)
+
+// sharedX is the X connection used by the mouse, keyboard and display on linux, with the XTEST extension initialized on it.
+var sharedX = x11.NewConnManager(
+	func() (x11.Conn, error) {
+		conn, err := xgb.NewConn()
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	},
+	func(conn x11.Conn) error {
+		return xtest.Init(conn.(*xgb.Conn))
+	},
+)
+
+// withX runs fn with the shared X connection, see x11.ConnManager.Do.
+//
+// Parameters:
+//   - fn: The function making the requests, given the connection, the root window of its default screen and the error initializing XTEST on it.
+//
+// Returns:
+//   - error: An error if the X server can not be reached, otherwise the error returned by fn.
+func withX(fn func(conn *xgb.Conn, root xproto.Window, xtestErr error) error) error {
+	return sharedX.Do(func(c x11.Conn, xtestErr error) error {
+		conn := c.(*xgb.Conn)
+		return fn(conn, xproto.Setup(conn).DefaultScreen(conn).Root, xtestErr)
+	})
+}
+
+// WithXConn runs fn with the shared X connection, opening it on first use.
+// The connection is locked while fn runs, so the requests of concurrent callers are never interleaved, and fn must not call WithXConn itself.
+// If the connection turns out to be lost, such as when the X server restarted, fn is retried once on a new connection.
+//
+// Parameters:
+//   - fn: The function making the requests, given the connection and the root window of its default screen.
+//
+// Returns:
+//   - error: An error if the X server can not be reached, otherwise the error returned by fn.
+func WithXConn(fn func(conn *xgb.Conn, root xproto.Window) error) error {
+	return withX(func(conn *xgb.Conn, root xproto.Window, _ error) error {
+		return fn(conn, root)
+	})
+}
+
+// CloseXConn closes the shared X connection, such as at shutdown. The next call to WithXConn opens a new connection.
+func CloseXConn() {
+	sharedX.Close()
+}
+
+// QueryPointerPosition retrieves the position of the mouse cursor on the root window, which spans the whole virtual screen.
+//
+// Returns:
+//   - int32: The x-coordinate of the cursor.
+//   - int32: The y-coordinate of the cursor.
+//   - error: An error if the X server could not be queried.
+func QueryPointerPosition() (int32, int32, error) {
+	var x, y int32
+	err := WithXConn(func(conn *xgb.Conn, root xproto.Window) error {
+		reply, err := xproto.QueryPointer(conn, root).Reply()
+		if err != nil {
+			return fmt.Errorf("failed to query pointer: %w", err)
+		}
+		x, y = int32(reply.RootX), int32(reply.RootY)
+		return nil
+	})
+	return x, y, err
+}
+
+// FakeEvent is a synthetic input event sent with FakeInput.
+type FakeEvent struct {
+	Type   byte // the event type, one of xproto.KeyPress, xproto.KeyRelease, xproto.ButtonPress or xproto.ButtonRelease
+	Detail byte // the keycode of a key event, or the button of a button event
+}
+
+// FakeInput sends synthetic input events through the XTEST extension, as if they came from a real device.
+// The events are sent in order and the call returns once the X server has processed them.
+//
+// Parameters:
+//   - events: The events to send, each a type such as xproto.ButtonPress or xproto.KeyRelease and its detail, the button or the keycode.
+//
+// Returns:
+//   - error: An error if the XTEST extension is not available or the X server rejected an event.
+func FakeInput(events ...FakeEvent) error {
+	return withX(func(conn *xgb.Conn, root xproto.Window, xtestErr error) error {
+		if xtestErr != nil {
+			return fmt.Errorf("the XTEST extension is not available: %w", xtestErr)
+		}
+		for _, ev := range events {
+			if err := xtest.FakeInputChecked(conn, ev.Type, ev.Detail, 0, root, 0, 0, 0).Check(); err != nil {
+				return fmt.Errorf("failed to send input: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// GrabInput grabs the pointer and the keyboard on the root window, so input from the real devices is delivered to this process instead of other applications.
+// The grab lasts until UngrabInput is called or the connection is closed, which the X server also does when the process exits.
+// Note that synthetic input sent with FakeInput is subject to the grab as well, only pointer motion still reaches other applications.
+//
+// Returns:
+//   - error: An error if the pointer or the keyboard could not be grabbed, such as when another client already grabbed them, in which case nothing is grabbed.
+func GrabInput() error {
+	return WithXConn(func(conn *xgb.Conn, root xproto.Window) error {
+		const pointerEvents = xproto.EventMaskButtonPress | xproto.EventMaskButtonRelease | xproto.EventMaskPointerMotion
+		pointer, err := xproto.GrabPointer(conn, false, root, pointerEvents, xproto.GrabModeAsync, xproto.GrabModeAsync, xproto.WindowNone, xproto.CursorNone, xproto.TimeCurrentTime).Reply()
+		if err != nil {
+			return fmt.Errorf("failed to grab the pointer: %w", err)
+		}
+		if pointer.Status != xproto.GrabStatusSuccess {
+			return fmt.Errorf("failed to grab the pointer: grab status %d", pointer.Status)
+		}
+
+		keyboard, err := xproto.GrabKeyboard(conn, false, root, xproto.TimeCurrentTime, xproto.GrabModeAsync, xproto.GrabModeAsync).Reply()
+		if err == nil && keyboard.Status != xproto.GrabStatusSuccess {
+			err = fmt.Errorf("grab status %d", keyboard.Status)
+		}
+		if err != nil {
+			_ = xproto.UngrabPointerChecked(conn, xproto.TimeCurrentTime).Check()
+			return fmt.Errorf("failed to grab the keyboard: %w", err)
+		}
+		return nil
+	})
+}
+
+// UngrabInput releases the pointer and keyboard grabs made by GrabInput.
+//
+// Returns:
+//   - error: An error if the X server could not be reached or rejected the request.
+func UngrabInput() error {
+	return WithXConn(func(conn *xgb.Conn, root xproto.Window) error {
+		pointerErr := xproto.UngrabPointerChecked(conn, xproto.TimeCurrentTime).Check()
+		keyboardErr := xproto.UngrabKeyboardChecked(conn, xproto.TimeCurrentTime).Check()
+		if err := errors.Join(pointerErr, keyboardErr); err != nil {
+			return fmt.Errorf("failed to release the input grab: %w", err)
+		}
+		return nil
+	})
+}
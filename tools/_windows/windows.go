@@ -5,32 +5,104 @@ package windows
 
 import (
 	"fmt"
+	"os"
+	"sync"
 	"syscall"
+	"unicode/utf16"
+	"unsafe"
+
+	"github.com/Carmen-Shannon/automation/tools/win32"
 )
 
 var (
 	// User32 DLL calls
 	User32              = syscall.NewLazyDLL("user32.dll")
-	EnumDisplayDevices  = User32.NewProc("EnumDisplayDevicesW")
-	EnumDisplaySettings = User32.NewProc("EnumDisplaySettingsW")
-	GetSystemMetrics    = User32.NewProc("GetSystemMetrics")
-	SetCursorPos        = User32.NewProc("SetCursorPos")
-	GetCursorPos        = User32.NewProc("GetCursorPos")
-	MouseEvent          = User32.NewProc("mouse_event")
-	KeybdEvent          = User32.NewProc("keybd_event")
+	enumDisplayDevices  = User32.NewProc("EnumDisplayDevicesW")
+	enumDisplaySettings = User32.NewProc("EnumDisplaySettingsW")
+	getSystemMetrics    = User32.NewProc("GetSystemMetrics")
+	setCursorPos        = User32.NewProc("SetCursorPos")
+	getCursorPos        = User32.NewProc("GetCursorPos")
+	mouseEvent          = User32.NewProc("mouse_event")
+	keybdEvent          = User32.NewProc("keybd_event")
+	getAsyncKeyState    = User32.NewProc("GetAsyncKeyState")
+	getKeyState         = User32.NewProc("GetKeyState")
+	vkKeyScan           = User32.NewProc("VkKeyScanW")
+	sendInput           = User32.NewProc("SendInput")
+	blockInput          = User32.NewProc("BlockInput")
 	getDC               = User32.NewProc("GetDC")
-	ReleaseDC           = User32.NewProc("ReleaseDC")
+	releaseDC           = User32.NewProc("ReleaseDC")
+
+	isWindow                 = User32.NewProc("IsWindow")
+	isWindowVisible          = User32.NewProc("IsWindowVisible")
+	showWindow               = User32.NewProc("ShowWindow")
+	getWindowDisplayAffinity = User32.NewProc("GetWindowDisplayAffinity")
+	setWindowDisplayAffinity = User32.NewProc("SetWindowDisplayAffinity")
+	enumWindows              = User32.NewProc("EnumWindows")
+	getWindowTextLength      = User32.NewProc("GetWindowTextLengthW")
+	getWindowText            = User32.NewProc("GetWindowTextW")
+	getWindowThreadProcessId = User32.NewProc("GetWindowThreadProcessId")
+	getWindowRect            = User32.NewProc("GetWindowRect")
+	getClientRect            = User32.NewProc("GetClientRect")
+	clientToScreen           = User32.NewProc("ClientToScreen")
+	getForegroundWindow      = User32.NewProc("GetForegroundWindow")
+	setForegroundWindow      = User32.NewProc("SetForegroundWindow")
+	bringWindowToTop         = User32.NewProc("BringWindowToTop")
+	isIconic                 = User32.NewProc("IsIconic")
+	attachThreadInput        = User32.NewProc("AttachThreadInput")
+	getWindowPlacement       = User32.NewProc("GetWindowPlacement")
+	setWinEventHook          = User32.NewProc("SetWinEventHook")
+	unhookWinEvent           = User32.NewProc("UnhookWinEvent")
+	setWindowsHookEx         = User32.NewProc("SetWindowsHookExW")
+	unhookWindowsHookEx      = User32.NewProc("UnhookWindowsHookEx")
+	callNextHookEx           = User32.NewProc("CallNextHookEx")
+	getMessage               = User32.NewProc("GetMessageW")
+	peekMessage              = User32.NewProc("PeekMessageW")
+	dispatchMessage          = User32.NewProc("DispatchMessageW")
+	postThreadMessage        = User32.NewProc("PostThreadMessageW")
+	postMessage              = User32.NewProc("PostMessageW")
+
+	setProcessDpiAwarenessContext = User32.NewProc("SetProcessDpiAwarenessContext")
+	setProcessDPIAware            = User32.NewProc("SetProcessDPIAware")
+
+	openClipboard              = User32.NewProc("OpenClipboard")
+	closeClipboard             = User32.NewProc("CloseClipboard")
+	emptyClipboard             = User32.NewProc("EmptyClipboard")
+	getClipboardData           = User32.NewProc("GetClipboardData")
+	setClipboardData           = User32.NewProc("SetClipboardData")
+	isClipboardFormatAvailable = User32.NewProc("IsClipboardFormatAvailable")
+
+	// Kernel32 DLL calls
+	Kernel32                  = syscall.NewLazyDLL("kernel32.dll")
+	getCurrentThreadId        = Kernel32.NewProc("GetCurrentThreadId")
+	getModuleHandle           = Kernel32.NewProc("GetModuleHandleW")
+	openProcess               = Kernel32.NewProc("OpenProcess")
+	closeHandle               = Kernel32.NewProc("CloseHandle")
+	queryFullProcessImageName = Kernel32.NewProc("QueryFullProcessImageNameW")
+	globalAlloc               = Kernel32.NewProc("GlobalAlloc")
+	globalFree                = Kernel32.NewProc("GlobalFree")
+	globalLock                = Kernel32.NewProc("GlobalLock")
+	globalUnlock              = Kernel32.NewProc("GlobalUnlock")
+	globalSize                = Kernel32.NewProc("GlobalSize")
+	rtlMoveMemory             = Kernel32.NewProc("RtlMoveMemory")
 
 	// GDI32 DLL calls
 	Gdi32                  = syscall.NewLazyDLL("gdi32.dll")
 	createCompatibleDC     = Gdi32.NewProc("CreateCompatibleDC")
-	DeleteDC               = Gdi32.NewProc("DeleteDC")
+	deleteDC               = Gdi32.NewProc("DeleteDC")
 	createCompatibleBitmap = Gdi32.NewProc("CreateCompatibleBitmap")
 	selectObject           = Gdi32.NewProc("SelectObject")
-	DeleteObject           = Gdi32.NewProc("DeleteObject")
+	deleteObject           = Gdi32.NewProc("DeleteObject")
 	bitBlt                 = Gdi32.NewProc("BitBlt")
-	GetDIBits              = Gdi32.NewProc("GetDIBits")
-	GetDeviceCaps          = Gdi32.NewProc("GetDeviceCaps")
+	getDIBits              = Gdi32.NewProc("GetDIBits")
+	getDeviceCaps          = Gdi32.NewProc("GetDeviceCaps")
+
+	// DWM API DLL calls
+	Dwmapi   = syscall.NewLazyDLL("dwmapi.dll")
+	dwmFlush = Dwmapi.NewProc("DwmFlush")
+
+	// Shcore DLL calls
+	Shcore                 = syscall.NewLazyDLL("shcore.dll")
+	setProcessDpiAwareness = Shcore.NewProc("SetProcessDpiAwareness")
 )
 
 const (
@@ -47,23 +119,101 @@ const (
 	MOUSEEVENTF_RIGHTUP    = 0x0010 // The right button is up flag
 	MOUSEEVENTF_MIDDLEDOWN = 0x0020 // The middle button is down flag
 	MOUSEEVENTF_MIDDLEUP   = 0x0040 // The middle button is up flag
+	MOUSEEVENTF_MOVE       = 0x0001 // The mouse moved flag
+	MOUSEEVENTF_ABSOLUTE   = 0x8000 // The movement is in normalized absolute coordinates flag
+	MOUSEEVENTF_WHEEL      = 0x0800 // The wheel was rotated flag, by the amount in the mouse data
+	WHEEL_DELTA            = 120    // The wheel rotation of a single notch
 
-	// these are for the SendInput function as flags, they are unused because SendInput sucks and doesn't work????
+	// Virtual key codes for the mouse buttons, used with GetAsyncKeyState
+	VK_LBUTTON = 0x01 // The left mouse button
+	VK_RBUTTON = 0x02 // The right mouse button
+	VK_MBUTTON = 0x04 // The middle mouse button
+	VK_TAB     = 0x09 // The tab key
+	VK_RETURN  = 0x0D // The enter key
+	VK_SHIFT   = 0x10 // The shift key
+	VK_CONTROL = 0x11 // The ctrl key
+	VK_MENU    = 0x12 // The alt key
+
+	// Input types and keyboard flags for the SendInput function
+	INPUT_MOUSE           = 0      // Mouse input type
 	INPUT_KEYBOARD        = 1      // Keyboard input type
+	INPUT_HARDWARE        = 2      // Hardware input type
 	KEYEVENTF_EXTENDEDKEY = 0x0001 // Extended key flag for keyboard input
 	KEYEVENTF_KEYUP       = 0x0002 // Key up flag for keyboard input
 	KEYEVENTF_UNICODE     = 0x0004 // Unicode flag for keyboard input
 	KEYEVENTF_SCANCODE    = 0x0008 // Scan code flag for keyboard input
 
 	// GDI constants
-	SRCCOPY                  = 0x00CC0020
+	SRCCOPY                  = 0x00CC0020 // Copies the source directly to the destination
+	NOTSRCCOPY               = 0x00330008 // Copies the inverted source to the destination
+	SRCINVERT                = 0x00660046 // Combines the source and destination with XOR
+	SRCAND                   = 0x008800C6 // Combines the source and destination with AND
+	SRCPAINT                 = 0x00EE0086 // Combines the source and destination with OR
+	CAPTUREBLT               = 0x40000000 // Includes layered windows in the copy, OR-ed with another raster operation
 	BI_RGB                   = 0
 	DIB_RGB_COLORS           = 0
 	LOGPIXELSX               = 88         // Logical pixels/inch in the X direction
 	LOGPIXELSY               = 90         // Logical pixels/inch in the Y direction
 	MONITOR_DEFAULTTONEAREST = 0x00000002 // Default monitor option for MonitorFromRect function
+
+	// Display device constants
+	EDD_GET_DEVICE_INTERFACE_NAME      = 0x00000001 // Retrieve the device interface name with EnumDisplayDevices
+	DISPLAY_DEVICE_ATTACHED_TO_DESKTOP = 0x00000001 // The display device is part of the desktop
+	ENUM_CURRENT_SETTINGS              = 0xFFFFFFFF // Retrieve the current settings with EnumDisplaySettings
+
+	// Window display affinity and show window constants
+	WDA_EXCLUDEFROMCAPTURE = 0x00000011 // The window is excluded from screen captures, Windows 10 version 2004 and later
+	SW_HIDE                = 0          // Hides the window
+	SW_SHOWNA              = 8          // Shows the window in its current state without activating it
+	SW_SHOWMINIMIZED       = 2          // Activates the window and displays it minimized, also reported by GetWindowPlacement for a minimized window
+	SW_MAXIMIZE            = 3          // Activates the window and displays it maximized, also reported by GetWindowPlacement for a maximized window
+	SW_MINIMIZE            = 6          // Minimizes the window and activates the next top-level window
+	SW_RESTORE             = 9          // Restores a minimized or maximized window to its normal size and position
+
+	// Clipboard and global memory constants
+	CF_UNICODETEXT = 13     // Clipboard format of NUL terminated UTF-16 text
+	GMEM_MOVEABLE  = 0x0002 // Allocates movable global memory, required for clipboard data
+
+	// Window event hook and message constants
+	EVENT_SYSTEM_FOREGROUND = 0x0003 // The foreground window changed
+	WINEVENT_OUTOFCONTEXT   = 0x0000 // The hook callback is called on the hooking thread, from its message loop
+	OBJID_WINDOW            = 0      // The event is about the window itself
+	CHILDID_SELF            = 0      // The event is about the object itself rather than one of its children
+	WM_CLOSE                = 0x0010 // Asks a window to close, as if the user clicked its close button
+	WM_QUIT                 = 0x0012 // Ends a message loop
+	PM_NOREMOVE             = 0x0000 // Leaves peeked messages in the queue
+	WH_MOUSE_LL             = 14     // A low-level mouse hook, called for every mouse input of the system before it is delivered
+	WM_MOUSEWHEEL           = 0x020A // The vertical wheel of the mouse was rotated
+
+	// Process access rights
+	PROCESS_QUERY_LIMITED_INFORMATION = 0x1000 // Allows querying the image name of a process, granted for most processes of other users
 )
 
+// DPIAwarenessOptOutEnv is the environment variable that keeps the process from being made DPI aware when this package is loaded, when set to any non-empty value.
+// Opting out leaves the DPI awareness to the application, such as through its manifest, at the cost of virtualized coordinates on scaled displays otherwise.
+const DPIAwarenessOptOutEnv = "AUTOMATION_DPI_UNAWARE"
+
+func init() {
+	// the awareness has to be declared before the first call that reports coordinates, so it is done as soon as the package is loaded
+	if os.Getenv(DPIAwarenessOptOutEnv) != "" {
+		return
+	}
+	// failing is not fatal, the process keeps working with virtualized coordinates on scaled displays
+	_ = SetDPIAware()
+}
+
+// SetDPIAware declares the process as per-monitor DPI aware, so coordinates, sizes and captures are reported in physical pixels on high-DPI displays.
+// It is called when the package is loaded unless DPIAwarenessOptOutEnv is set, and falls back through the APIs of older Windows versions:
+// SetProcessDpiAwarenessContext with per-monitor awareness v2 on Windows 10 version 1703 and later,
+// SetProcessDpiAwareness with per-monitor awareness on Windows 8.1 and later, and SetProcessDPIAware otherwise, which is system DPI awareness.
+// If the awareness was already set, such as by the manifest of the application, it is left as is and no error is returned.
+//
+// Returns:
+//   - error: An error if none of the APIs could set the DPI awareness.
+func SetDPIAware() error {
+	return win32.SetDPIAware(setProcessDpiAwarenessContext, setProcessDpiAwareness, setProcessDPIAware)
+}
+
 type BitmapInfoHeader struct {
 	BiSize          uint32
 	BiWidth         int32
@@ -91,6 +241,467 @@ type BitmapHeader struct {
 	OffBits   uint32
 }
 
+// Rect represents the RECT structure, the right and bottom edges are exclusive.
+type Rect struct {
+	Left   int32
+	Top    int32
+	Right  int32
+	Bottom int32
+}
+
+// Point represents the POINT structure.
+type Point struct {
+	X int32
+	Y int32
+}
+
+// WindowPlacement represents the WINDOWPLACEMENT structure, the show state and restored bounds of a window.
+type WindowPlacement struct {
+	Length           uint32
+	Flags            uint32
+	ShowCmd          uint32
+	PtMinPosition    Point
+	PtMaxPosition    Point
+	RcNormalPosition Rect
+}
+
+// Msg represents the MSG structure, a message from a thread's message queue.
+type Msg struct {
+	Hwnd     uintptr
+	Message  uint32
+	WParam   uintptr
+	LParam   uintptr
+	Time     uint32
+	Pt       Point
+	LPrivate uint32
+}
+
+// MouseInput represents the MOUSEINPUT structure, a synthesized mouse event.
+type MouseInput struct {
+	Dx          int32
+	Dy          int32
+	MouseData   uint32
+	DwFlags     uint32
+	Time        uint32
+	DwExtraInfo uintptr
+}
+
+// KeybdInput represents the KEYBDINPUT structure, a synthesized keyboard event.
+type KeybdInput struct {
+	WVk         uint16
+	WScan       uint16
+	DwFlags     uint32
+	Time        uint32
+	DwExtraInfo uintptr
+}
+
+// HardwareInput represents the HARDWAREINPUT structure, a synthesized event from an input device other than a keyboard or mouse.
+type HardwareInput struct {
+	UMsg    uint32
+	WParamL uint16
+	WParamH uint16
+}
+
+// Input represents the INPUT structure passed to SendInput.
+// The structure holds a union of MouseInput, KeybdInput and HardwareInput, which Go has no equivalent of,
+// so the union is declared as its largest member, MouseInput, which also gives it the alignment of the union,
+// and the other members are written over it through the Keybd and Hardware accessors.
+type Input struct {
+	Type uint32
+	mi   MouseInput
+}
+
+// the sizes of the structures in the Win32 ABI, 28 and 40 bytes for INPUT with 4 and 8 byte pointers respectively
+const (
+	ptrSize           = unsafe.Sizeof(uintptr(0))
+	inputSize         = 28 + (ptrSize/4-1)*12
+	mouseInputSize    = 24 + (ptrSize/4-1)*8
+	keybdInputSize    = 16 + (ptrSize/4-1)*8
+	hardwareInputSize = 8
+)
+
+// compile-time checks that the structures match the sizes SendInput expects, a mismatch makes SendInput fail with ERROR_INVALID_PARAMETER
+var (
+	_ [unsafe.Sizeof(Input{}) - inputSize]byte
+	_ [inputSize - unsafe.Sizeof(Input{})]byte
+	_ [unsafe.Sizeof(MouseInput{}) - mouseInputSize]byte
+	_ [mouseInputSize - unsafe.Sizeof(MouseInput{})]byte
+	_ [unsafe.Sizeof(KeybdInput{}) - keybdInputSize]byte
+	_ [keybdInputSize - unsafe.Sizeof(KeybdInput{})]byte
+	_ [unsafe.Sizeof(HardwareInput{}) - hardwareInputSize]byte
+	_ [hardwareInputSize - unsafe.Sizeof(HardwareInput{})]byte
+	// the union starts after the type, padded to the alignment of a pointer
+	_ [unsafe.Offsetof(Input{}.mi) - ptrSize]byte
+	_ [ptrSize - unsafe.Offsetof(Input{}.mi)]byte
+)
+
+// Mouse returns the mouse event held by the input, valid if its type is INPUT_MOUSE.
+func (in *Input) Mouse() *MouseInput {
+	return &in.mi
+}
+
+// Keybd returns the keyboard event held by the input, valid if its type is INPUT_KEYBOARD.
+func (in *Input) Keybd() *KeybdInput {
+	return (*KeybdInput)(unsafe.Pointer(&in.mi))
+}
+
+// Hardware returns the hardware event held by the input, valid if its type is INPUT_HARDWARE.
+func (in *Input) Hardware() *HardwareInput {
+	return (*HardwareInput)(unsafe.Pointer(&in.mi))
+}
+
+// MouseMoveInput creates an input that moves the mouse cursor relative to its current position.
+// The movement is subject to the mouse speed and acceleration settings of the system.
+//
+// Parameters:
+//   - dx: The distance to move the cursor horizontally, in pixels.
+//   - dy: The distance to move the cursor vertically, in pixels.
+//
+// Returns:
+//   - Input: The mouse input.
+func MouseMoveInput(dx, dy int32) Input {
+	in := Input{Type: INPUT_MOUSE}
+	*in.Mouse() = MouseInput{Dx: dx, Dy: dy, DwFlags: MOUSEEVENTF_MOVE}
+	return in
+}
+
+// MouseButtonInput creates an input that presses or releases mouse buttons at the current cursor position.
+//
+// Parameters:
+//   - flags: The MOUSEEVENTF_ button flags of the event, such as MOUSEEVENTF_LEFTDOWN.
+//
+// Returns:
+//   - Input: The mouse input.
+func MouseButtonInput(flags uint32) Input {
+	in := Input{Type: INPUT_MOUSE}
+	*in.Mouse() = MouseInput{DwFlags: flags}
+	return in
+}
+
+// MouseWheelInput creates an input that rotates the mouse wheel.
+//
+// Parameters:
+//   - delta: The rotation of the wheel, in multiples of WHEEL_DELTA per notch, positive away from the user.
+//
+// Returns:
+//   - Input: The mouse input.
+func MouseWheelInput(delta int32) Input {
+	in := Input{Type: INPUT_MOUSE}
+	*in.Mouse() = MouseInput{MouseData: uint32(delta), DwFlags: MOUSEEVENTF_WHEEL}
+	return in
+}
+
+// KeyDownInput creates an input that presses a key.
+//
+// Parameters:
+//   - vk: The virtual key code of the key.
+//
+// Returns:
+//   - Input: The keyboard input.
+func KeyDownInput(vk uint16) Input {
+	in := Input{Type: INPUT_KEYBOARD}
+	*in.Keybd() = KeybdInput{WVk: vk}
+	return in
+}
+
+// KeyUpInput creates an input that releases a key.
+//
+// Parameters:
+//   - vk: The virtual key code of the key.
+//
+// Returns:
+//   - Input: The keyboard input.
+func KeyUpInput(vk uint16) Input {
+	in := Input{Type: INPUT_KEYBOARD}
+	*in.Keybd() = KeybdInput{WVk: vk, DwFlags: KEYEVENTF_KEYUP}
+	return in
+}
+
+// UnicodeCharInput creates the inputs that type a single character, regardless of the keyboard layout.
+// Each UTF-16 code unit of the character is sent as a key press and release, so a character outside of the basic multilingual plane takes four inputs.
+//
+// Parameters:
+//   - ch: The character to type.
+//
+// Returns:
+//   - []Input: The keyboard inputs, in the order they must be sent.
+func UnicodeCharInput(ch rune) []Input {
+	units := utf16.Encode([]rune{ch})
+	inputs := make([]Input, 0, len(units)*2)
+	for _, unit := range units {
+		down := Input{Type: INPUT_KEYBOARD}
+		*down.Keybd() = KeybdInput{WScan: unit, DwFlags: KEYEVENTF_UNICODE}
+		up := Input{Type: INPUT_KEYBOARD}
+		*up.Keybd() = KeybdInput{WScan: unit, DwFlags: KEYEVENTF_UNICODE | KEYEVENTF_KEYUP}
+		inputs = append(inputs, down, up)
+	}
+	return inputs
+}
+
+// SendInputs synthesizes the given inputs in order with SendInput, without other input being interleaved with them.
+//
+// Parameters:
+//   - inputs: The inputs to send.
+//
+// Returns:
+//   - int: The number of inputs that were inserted into the input stream.
+//   - error: An error if not every input was inserted, such as when the input is blocked by another thread or by UIPI.
+func SendInputs(inputs []Input) (int, error) {
+	if len(inputs) == 0 {
+		return 0, nil
+	}
+	ret, _, err := sendInput.Call(uintptr(len(inputs)), uintptr(unsafe.Pointer(&inputs[0])), unsafe.Sizeof(inputs[0]))
+	sent := int(ret)
+	if sent != len(inputs) {
+		return sent, fmt.Errorf("failed to send inputs, %d of %d were sent: %w", sent, len(inputs), err)
+	}
+	return sent, nil
+}
+
+// DevMode represents the DEVMODEW structure, the device mode for a display
+type DevMode struct {
+	DeviceName    [32]uint16 // dmDeviceName: Friendly name of the display device
+	SpecVersion   uint16     // dmSpecVersion: Version number of the DEVMODE structure
+	DriverVersion uint16     // dmDriverVersion: Driver version number
+	Size          uint16     // dmSize: Size of the DEVMODE structure
+	DriverExtra   uint16     // dmDriverExtra: Size of private driver data
+	Fields        uint32     // dmFields: Flags indicating which fields are initialized
+
+	// Union: dmPosition or printer-specific fields
+	PositionX          int32  // dmPosition.x: X-coordinate of the display position
+	PositionY          int32  // dmPosition.y: Y-coordinate of the display position
+	DisplayOrientation uint32 // dmDisplayOrientation: Orientation of the display
+	DisplayFixedOutput uint32 // dmDisplayFixedOutput: Fixed output settings for the display
+
+	Color       int16      // dmColor: Color or monochrome setting
+	Duplex      int16      // dmDuplex: Duplex printing setting
+	YResolution int16      // dmYResolution: Y-resolution for printers
+	TTOption    int16      // dmTTOption: TrueType font option
+	Collate     int16      // dmCollate: Collation setting for printers
+	FormName    [32]uint16 // dmFormName: Form name for printers
+	LogPixels   uint16     // dmLogPixels: Logical pixels per inch
+
+	BitsPerPel uint32 // dmBitsPerPel: Color resolution in bits per pixel
+	PelsWidth  uint32 // dmPelsWidth: Width of the display in pixels
+	PelsHeight uint32 // dmPelsHeight: Height of the display in pixels
+
+	// Union: dmDisplayFlags or dmNup
+	DisplayFlags     uint32 // dmDisplayFlags: Display mode flags
+	DisplayFrequency uint32 // dmDisplayFrequency: Refresh rate in hertz
+
+	ICMMethod     uint32 // dmICMMethod: ICM handling method
+	ICMIntent     uint32 // dmICMIntent: ICM intent
+	MediaType     uint32 // dmMediaType: Media type for printers
+	DitherType    uint32 // dmDitherType: Dithering method
+	Reserved1     uint32 // dmReserved1: Reserved; must be zero
+	Reserved2     uint32 // dmReserved2: Reserved; must be zero
+	PanningWidth  uint32 // dmPanningWidth: Panning width; must be zero
+	PanningHeight uint32 // dmPanningHeight: Panning height; must be zero
+}
+
+// DisplayDevice represents the DISPLAY_DEVICEW structure.
+type DisplayDevice struct {
+	Size         uint32
+	DeviceName   [32]uint16
+	DeviceString [128]uint16
+	StateFlags   uint32
+	DeviceID     [128]uint16
+	DeviceKey    [128]uint16
+}
+
+// GetSystemMetrics retrieves a system metric, such as the bounds of the virtual screen.
+//
+// Parameters:
+//   - index: The system metric to retrieve, one of the SM_ constants.
+//
+// Returns:
+//   - int32: The value of the metric, 0 if the metric is not known.
+func GetSystemMetrics(index int) int32 {
+	ret, _, _ := getSystemMetrics.Call(uintptr(index))
+	return int32(ret)
+}
+
+// EnumDisplayDevices retrieves the display device at the given index.
+//
+// Parameters:
+//   - index: The index of the display device, starting at 0.
+//
+// Returns:
+//   - DisplayDevice: The display device.
+//   - bool: False once the index is past the last display device, true otherwise.
+func EnumDisplayDevices(index int) (DisplayDevice, bool) {
+	var device DisplayDevice
+	device.Size = uint32(unsafe.Sizeof(device))
+	ret, _, _ := enumDisplayDevices.Call(0, uintptr(index), uintptr(unsafe.Pointer(&device)), uintptr(EDD_GET_DEVICE_INTERFACE_NAME))
+	return device, ret != 0
+}
+
+// GetCurrentDisplaySettings retrieves the current settings of a display device, such as its position, size and refresh rate.
+//
+// Parameters:
+//   - deviceName: The name of the display device, as returned by EnumDisplayDevices.
+//
+// Returns:
+//   - DevMode: The current settings of the display device.
+//   - error: An error if the settings can not be retrieved.
+func GetCurrentDisplaySettings(deviceName [32]uint16) (DevMode, error) {
+	var dm DevMode
+	dm.Size = uint16(unsafe.Sizeof(dm))
+	ret, _, err := enumDisplaySettings.Call(uintptr(unsafe.Pointer(&deviceName[0])), uintptr(ENUM_CURRENT_SETTINGS), uintptr(unsafe.Pointer(&dm)))
+	if ret == 0 {
+		return DevMode{}, fmt.Errorf("failed to retrieve display settings: %w", err)
+	}
+	return dm, nil
+}
+
+// GetCursorPos retrieves the position of the mouse cursor in screen coordinates.
+//
+// Returns:
+//   - (int32, int32): The x and y coordinates of the mouse cursor.
+//   - error: An error if the position can not be retrieved.
+func GetCursorPos() (int32, int32, error) {
+	var p struct {
+		x int32
+		y int32
+	}
+	ret, _, err := getCursorPos.Call(uintptr(unsafe.Pointer(&p)))
+	if ret == 0 {
+		return 0, 0, fmt.Errorf("failed to get the cursor position: %w", err)
+	}
+	return p.x, p.y, nil
+}
+
+// SetCursorPos moves the mouse cursor to the given screen coordinates.
+//
+// Parameters:
+//   - x: The x-coordinate to move the mouse cursor to.
+//   - y: The y-coordinate to move the mouse cursor to.
+//
+// Returns:
+//   - error: An error if the cursor can not be moved.
+func SetCursorPos(x, y int32) error {
+	ret, _, err := setCursorPos.Call(uintptr(x), uintptr(y))
+	if ret == 0 {
+		return fmt.Errorf("failed to move the mouse: %w", err)
+	}
+	return nil
+}
+
+// IsKeyDown reports whether a key or mouse button is currently held down, using GetAsyncKeyState.
+//
+// Parameters:
+//   - vk: The virtual key code of the key or mouse button, such as VK_LBUTTON.
+//
+// Returns:
+//   - bool: True if the key is held down, false otherwise.
+func IsKeyDown(vk int) bool {
+	ret, _, _ := getAsyncKeyState.Call(uintptr(vk))
+	return KeyStateDown(uint16(ret))
+}
+
+// IsKeyToggled reports whether a toggle key, such as VK_CAPITAL, is currently toggled on, using GetKeyState.
+//
+// Parameters:
+//   - vk: The virtual key code of the key.
+//
+// Returns:
+//   - bool: True if the key is toggled on, false otherwise.
+func IsKeyToggled(vk int) bool {
+	ret, _, _ := getKeyState.Call(uintptr(vk))
+	return KeyStateToggled(uint16(ret))
+}
+
+// VkKeyScan translates a character to the virtual key code and shift state that type it on the keyboard layout of the calling thread.
+//
+// Parameters:
+//   - ch: The character, only characters of the basic multilingual plane can be translated.
+//
+// Returns:
+//   - uint8: The virtual key code.
+//   - uint8: The shift state, a combination of 1 for shift, 2 for ctrl and 4 for alt.
+//   - bool: False if the layout has no key that types the character, true otherwise.
+func VkKeyScan(ch rune) (uint8, uint8, bool) {
+	if ch < 0 || ch > 0xFFFF {
+		return 0, 0, false
+	}
+	ret, _, _ := vkKeyScan.Call(uintptr(ch))
+	// both bytes are set to 0xFF when there is no key for the character
+	if uint16(ret) == 0xFFFF {
+		return 0, 0, false
+	}
+	return uint8(ret), uint8(ret >> 8), true
+}
+
+// KeyStateDown decodes whether a key is down from the state returned by GetAsyncKeyState or GetKeyState.
+// The most significant bit of the state is set while the key is down.
+//
+// Parameters:
+//   - state: The key state.
+//
+// Returns:
+//   - bool: True if the key is down, false otherwise.
+func KeyStateDown(state uint16) bool {
+	return state&0x8000 != 0
+}
+
+// KeyStateToggled decodes whether a toggle key is toggled on from the state returned by GetKeyState.
+// The least significant bit of the state is set while the key is toggled on.
+//
+// Parameters:
+//   - state: The key state.
+//
+// Returns:
+//   - bool: True if the key is toggled on, false otherwise.
+func KeyStateToggled(state uint16) bool {
+	return state&0x0001 != 0
+}
+
+// MouseEvent synthesizes a mouse button event at the current cursor position.
+// mouse_event does not report whether the event was inserted.
+//
+// Parameters:
+//   - flags: The MOUSEEVENTF_ flags of the event.
+func MouseEvent(flags uint32) {
+	mouseEvent.Call(uintptr(flags), 0, 0, 0, 0)
+}
+
+// KeybdEvent synthesizes a keystroke.
+//
+// Parameters:
+//   - vk: The virtual key code of the key.
+//   - flags: The KEYEVENTF_ flags of the event, 0 for a key press.
+//
+// Returns:
+//   - error: An error if the event was reported as not sent.
+func KeybdEvent(vk uint8, flags uint32) error {
+	ret, _, err := keybdEvent.Call(uintptr(vk), 0, uintptr(flags), 0)
+	if ret == 0 {
+		return fmt.Errorf("failed to send key event: %w", err)
+	}
+	return nil
+}
+
+// BlockInput blocks or unblocks keyboard and mouse input from reaching applications, synthetic input sent by the calling thread is still delivered.
+// Only the thread that blocked input can unblock it, and input is unblocked by the system when that thread exits or the user presses Ctrl+Alt+Del.
+// Blocking input requires the process to run elevated, or with UIAccess, otherwise it fails with an access denied error.
+//
+// Parameters:
+//   - block: True to block input, false to unblock it.
+//
+// Returns:
+//   - error: An error if the input could not be blocked or unblocked.
+func BlockInput(block bool) error {
+	var flag uintptr
+	if block {
+		flag = 1
+	}
+	ret, _, err := blockInput.Call(flag)
+	if ret == 0 {
+		return fmt.Errorf("failed to block input: %w", err)
+	}
+	return nil
+}
+
 func GetScreenDC() (uintptr, error) {
 	hdc, _, err := getDC.Call(0)
 	if hdc == 0 {
@@ -115,6 +726,88 @@ func CreateBitmap(hdc uintptr, width, height int) (uintptr, error) {
 	return hBitmap, nil
 }
 
+// ReleaseScreenDC releases a device context returned by GetScreenDC.
+//
+// Parameters:
+//   - hdc: The device context to release.
+//
+// Returns:
+//   - error: An error if the device context was not released.
+func ReleaseScreenDC(hdc uintptr) error {
+	if ret, _, _ := releaseDC.Call(0, hdc); ret == 0 {
+		return fmt.Errorf("failed to release device context 0x%x", hdc)
+	}
+	return nil
+}
+
+// DeleteMemoryDC deletes a device context created by CreateMemoryDC.
+//
+// Parameters:
+//   - hdc: The device context to delete.
+//
+// Returns:
+//   - error: An error if the device context was not deleted.
+func DeleteMemoryDC(hdc uintptr) error {
+	if ret, _, _ := deleteDC.Call(hdc); ret == 0 {
+		return fmt.Errorf("failed to delete device context 0x%x", hdc)
+	}
+	return nil
+}
+
+// DeleteBitmap deletes a bitmap created by CreateBitmap, it must not be selected into a device context.
+//
+// Parameters:
+//   - hBitmap: The bitmap to delete.
+//
+// Returns:
+//   - error: An error if the bitmap was not deleted.
+func DeleteBitmap(hBitmap uintptr) error {
+	if ret, _, _ := deleteObject.Call(hBitmap); ret == 0 {
+		return fmt.Errorf("failed to delete bitmap 0x%x", hBitmap)
+	}
+	return nil
+}
+
+// GetDeviceCaps retrieves device-specific information about a device context, such as its DPI.
+//
+// Parameters:
+//   - hdc: The device context to query.
+//   - index: The capability to retrieve, such as LOGPIXELSX.
+//
+// Returns:
+//   - int: The value of the capability.
+func GetDeviceCaps(hdc uintptr, index int) int {
+	ret, _, _ := getDeviceCaps.Call(hdc, uintptr(index))
+	return int(ret)
+}
+
+// GetBitmapBits copies the pixels of a bitmap into a buffer in the format described by the bitmap info, as an uncompressed DIB.
+//
+// Parameters:
+//   - hdc: The device context the bitmap is compatible with.
+//   - hBitmap: The bitmap to copy the pixels of, it must not be selected into a device context other than hdc.
+//   - lines: The number of scan lines to copy.
+//   - bits: The buffer to copy the pixels into, large enough for the requested format.
+//   - info: The format to copy the pixels in.
+//
+// Returns:
+//   - error: An error if the pixels can not be copied.
+func GetBitmapBits(hdc, hBitmap uintptr, lines int, bits []byte, info *BitmapInfo) error {
+	if len(bits) == 0 {
+		return fmt.Errorf("failed to retrieve bitmap data: empty buffer")
+	}
+	ret, _, err := getDIBits.Call(
+		hdc, hBitmap, 0, uintptr(lines),
+		uintptr(unsafe.Pointer(&bits[0])),
+		uintptr(unsafe.Pointer(info)),
+		uintptr(DIB_RGB_COLORS),
+	)
+	if ret == 0 {
+		return fmt.Errorf("failed to retrieve bitmap data: %w", err)
+	}
+	return nil
+}
+
 func SelectBitmap(hdc uintptr, hBitmap uintptr) (uintptr, error) {
 	oldBitmap, _, err := selectObject.Call(hdc, hBitmap)
 	if oldBitmap == 0 {
@@ -123,14 +816,617 @@ func SelectBitmap(hdc uintptr, hBitmap uintptr) (uintptr, error) {
 	return oldBitmap, nil
 }
 
-func CopyScreenToMemory(hdcDest, hdcSrc uintptr, xDest, yDest, width, height, xSrc, ySrc int) error {
+// CopyScreenToMemory copies a block of pixels from one device context to another with BitBlt.
+//
+// Parameters:
+//   - hdcDest: The destination device context.
+//   - hdcSrc: The source device context.
+//   - xDest, yDest: The top-left corner of the block in the destination.
+//   - width, height: The size of the block.
+//   - xSrc, ySrc: The top-left corner of the block in the source.
+//   - rop: The raster operation combining the source with the destination, such as SRCCOPY.
+//     Without an operation, SRCCOPY is used, so 0 or CAPTUREBLT alone copy the source.
+//
+// Returns:
+//   - error: An error if the copy failed.
+func CopyScreenToMemory(hdcDest, hdcSrc uintptr, xDest, yDest, width, height, xSrc, ySrc int, rop uint32) error {
+	if rop&^CAPTUREBLT == 0 {
+		rop |= SRCCOPY
+	}
 	ret, _, err := bitBlt.Call(
 		hdcDest, uintptr(xDest), uintptr(yDest), uintptr(width), uintptr(height),
 		hdcSrc, uintptr(xSrc), uintptr(ySrc),
-		uintptr(SRCCOPY),
+		uintptr(rop),
 	)
 	if ret == 0 {
 		return fmt.Errorf("failed to copy screen contents: %w", err)
 	}
 	return nil
 }
+
+// ExcludeWindowFromCapture keeps a window out of screen captures until the returned restore function is called.
+// It sets the window's display affinity to WDA_EXCLUDEFROMCAPTURE, which only works for windows owned by the calling process on Windows 10 version 2004 and later.
+// If the affinity can not be set, the window is hidden instead and the desktop is given a chance to recompose before returning.
+//
+// Parameters:
+//   - hwnd: The handle of the window to exclude.
+//
+// Returns:
+//   - func(): A function that restores the window's previous display affinity or visibility.
+//   - error: An error if the handle does not identify a window.
+func ExcludeWindowFromCapture(hwnd uintptr) (func(), error) {
+	if ret, _, _ := isWindow.Call(hwnd); ret == 0 {
+		return nil, fmt.Errorf("invalid window handle: 0x%x", hwnd)
+	}
+
+	var affinity uint32
+	if ret, _, _ := getWindowDisplayAffinity.Call(hwnd, uintptr(unsafe.Pointer(&affinity))); ret != 0 {
+		if ret, _, _ := setWindowDisplayAffinity.Call(hwnd, uintptr(WDA_EXCLUDEFROMCAPTURE)); ret != 0 {
+			return func() {
+				setWindowDisplayAffinity.Call(hwnd, uintptr(affinity))
+			}, nil
+		}
+	}
+
+	// fall back to hiding the window, a window that is not visible is already excluded
+	if visible, _, _ := isWindowVisible.Call(hwnd); visible == 0 {
+		return func() {}, nil
+	}
+	showWindow.Call(hwnd, uintptr(SW_HIDE))
+	// wait for the desktop to be recomposed without the window, otherwise the capture can still contain it
+	dwmFlush.Call()
+	return func() {
+		showWindow.Call(hwnd, uintptr(SW_SHOWNA))
+	}, nil
+}
+
+// WaitForVSync blocks until the desktop window manager has presented the next composed frame, using DwmFlush.
+// A screen capture taken right after it returns contains a fully rendered frame rather than one that is still being drawn.
+//
+// Returns:
+//   - error: An error if DwmFlush is not available or fails, such as when desktop composition is disabled.
+func WaitForVSync() error {
+	if err := dwmFlush.Find(); err != nil {
+		return fmt.Errorf("failed to find DwmFlush: %w", err)
+	}
+	if hr, _, _ := dwmFlush.Call(); hr != 0 {
+		return fmt.Errorf("failed to wait for the next frame: DwmFlush returned 0x%x", uint32(hr))
+	}
+	return nil
+}
+
+// OpenClipboard opens the clipboard for the calling thread, with no owner window.
+// The clipboard is opened by a single thread at a time, so this fails while another application has it open.
+// The caller must stay on the same OS thread until CloseClipboard.
+//
+// Returns:
+//   - error: An error if the clipboard could not be opened.
+func OpenClipboard() error {
+	if ret, _, err := openClipboard.Call(0); ret == 0 {
+		return fmt.Errorf("failed to open the clipboard: %w", err)
+	}
+	return nil
+}
+
+// CloseClipboard closes the clipboard opened by OpenClipboard.
+func CloseClipboard() {
+	closeClipboard.Call()
+}
+
+// EmptyClipboard removes the contents of the open clipboard.
+//
+// Returns:
+//   - error: An error if the clipboard could not be emptied, such as when it is not open.
+func EmptyClipboard() error {
+	if ret, _, err := emptyClipboard.Call(); ret == 0 {
+		return fmt.Errorf("failed to empty the clipboard: %w", err)
+	}
+	return nil
+}
+
+// GetClipboardUnicodeText reads the CF_UNICODETEXT contents of the open clipboard.
+//
+// Returns:
+//   - []uint16: The UTF-16 text on the clipboard, up to and including its NUL terminator if it has one, nil if the clipboard holds no text.
+//   - error: An error if the clipboard data could not be read.
+func GetClipboardUnicodeText() ([]uint16, error) {
+	if ret, _, _ := isClipboardFormatAvailable.Call(uintptr(CF_UNICODETEXT)); ret == 0 {
+		return nil, nil
+	}
+	h, _, err := getClipboardData.Call(uintptr(CF_UNICODETEXT))
+	if h == 0 {
+		return nil, fmt.Errorf("failed to get the clipboard data: %w", err)
+	}
+	// the memory belongs to the clipboard, it is locked for reading but never freed
+	ptr, _, err := globalLock.Call(h)
+	if ptr == 0 {
+		return nil, fmt.Errorf("failed to lock the clipboard data: %w", err)
+	}
+	defer globalUnlock.Call(h)
+
+	size, _, _ := globalSize.Call(h)
+	text := make([]uint16, size/2)
+	if len(text) > 0 {
+		rtlMoveMemory.Call(uintptr(unsafe.Pointer(&text[0])), ptr, uintptr(len(text)*2))
+	}
+	return text, nil
+}
+
+// SetClipboardUnicodeText places text on the open clipboard as CF_UNICODETEXT.
+// The clipboard must have been emptied with EmptyClipboard since it was opened, for the calling process to own it.
+//
+// Parameters:
+//   - text: The UTF-16 text, which must be NUL terminated.
+//
+// Returns:
+//   - error: An error if the memory for the text could not be allocated or the clipboard data could not be set.
+func SetClipboardUnicodeText(text []uint16) error {
+	if len(text) == 0 || text[len(text)-1] != 0 {
+		return fmt.Errorf("clipboard text must be NUL terminated")
+	}
+	size := uintptr(len(text) * 2)
+	h, _, err := globalAlloc.Call(uintptr(GMEM_MOVEABLE), size)
+	if h == 0 {
+		return fmt.Errorf("failed to allocate the clipboard data: %w", err)
+	}
+	ptr, _, err := globalLock.Call(h)
+	if ptr == 0 {
+		globalFree.Call(h)
+		return fmt.Errorf("failed to lock the clipboard data: %w", err)
+	}
+	rtlMoveMemory.Call(ptr, uintptr(unsafe.Pointer(&text[0])), size)
+	globalUnlock.Call(h)
+
+	// the clipboard takes ownership of the memory only if the data was set
+	if ret, _, err := setClipboardData.Call(uintptr(CF_UNICODETEXT), h); ret == 0 {
+		globalFree.Call(h)
+		return fmt.Errorf("failed to set the clipboard data: %w", err)
+	}
+	return nil
+}
+
+var (
+	// EnumWindows calls are serialized so the single callback can forward to the function of the current call,
+	// callbacks created with syscall.NewCallback are never released, so one is shared by every call
+	enumWindowsMu       sync.Mutex
+	enumWindowsFn       func(hwnd uintptr) bool
+	enumWindowsCallback = syscall.NewCallback(func(hwnd, _ uintptr) uintptr {
+		if enumWindowsFn(hwnd) {
+			return 1
+		}
+		return 0
+	})
+)
+
+// EnumWindows calls fn with the handle of every top-level window, in Z order from the top, until it returns false.
+//
+// Parameters:
+//   - fn: The function called with each window handle, it returns false to stop the enumeration.
+//
+// Returns:
+//   - error: An error if the enumeration failed, stopping it early with fn is not an error.
+func EnumWindows(fn func(hwnd uintptr) bool) error {
+	enumWindowsMu.Lock()
+	defer enumWindowsMu.Unlock()
+
+	stopped := false
+	enumWindowsFn = func(hwnd uintptr) bool {
+		if !fn(hwnd) {
+			stopped = true
+			return false
+		}
+		return true
+	}
+	defer func() { enumWindowsFn = nil }()
+
+	if ret, _, err := enumWindows.Call(enumWindowsCallback, 0); ret == 0 && !stopped {
+		return fmt.Errorf("failed to enumerate windows: %w", err)
+	}
+	return nil
+}
+
+// GetWindowText retrieves the title of a window as the raw UTF-16 code units Windows stores it in.
+//
+// Parameters:
+//   - hwnd: The handle of the window.
+//
+// Returns:
+//   - []uint16: The code units of the title, without the terminating NUL, empty if the window has no title.
+func GetWindowText(hwnd uintptr) []uint16 {
+	length, _, _ := getWindowTextLength.Call(hwnd)
+	if length == 0 {
+		return nil
+	}
+	buf := make([]uint16, length+1)
+	n, _, _ := getWindowText.Call(hwnd, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	return buf[:n]
+}
+
+// GetWindowProcessID retrieves the ID of the process that created a window.
+//
+// Parameters:
+//   - hwnd: The handle of the window.
+//
+// Returns:
+//   - uint32: The process ID, 0 if the window handle is invalid.
+func GetWindowProcessID(hwnd uintptr) uint32 {
+	var pid uint32
+	getWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&pid)))
+	return pid
+}
+
+// GetWindowRect retrieves the bounds of a window in screen coordinates, the same coordinate space as the virtual screen.
+//
+// Parameters:
+//   - hwnd: The handle of the window.
+//
+// Returns:
+//   - Rect: The bounds of the window.
+//   - error: An error if the bounds could not be retrieved, such as when the window handle is invalid.
+func GetWindowRect(hwnd uintptr) (Rect, error) {
+	var r Rect
+	if ret, _, err := getWindowRect.Call(hwnd, uintptr(unsafe.Pointer(&r))); ret == 0 {
+		return Rect{}, fmt.Errorf("failed to get the window bounds: %w", err)
+	}
+	return r, nil
+}
+
+// GetClientScreenRect retrieves the bounds of the client area of a window, the part inside its borders and title bar, in screen coordinates.
+//
+// Parameters:
+//   - hwnd: The handle of the window.
+//
+// Returns:
+//   - Rect: The bounds of the client area.
+//   - error: An error if the bounds could not be retrieved, such as when the window handle is invalid.
+func GetClientScreenRect(hwnd uintptr) (Rect, error) {
+	// the client rect is relative to the client area itself, so only its size is meaningful until its origin is mapped to the screen
+	var r Rect
+	if ret, _, err := getClientRect.Call(hwnd, uintptr(unsafe.Pointer(&r))); ret == 0 {
+		return Rect{}, fmt.Errorf("failed to get the client area: %w", err)
+	}
+	var origin Point
+	if ret, _, err := clientToScreen.Call(hwnd, uintptr(unsafe.Pointer(&origin))); ret == 0 {
+		return Rect{}, fmt.Errorf("failed to map the client area to the screen: %w", err)
+	}
+	return Rect{Left: origin.X, Top: origin.Y, Right: origin.X + r.Right, Bottom: origin.Y + r.Bottom}, nil
+}
+
+// IsWindowVisible reports whether a window has the WS_VISIBLE style, it may still be covered by other windows or off screen.
+//
+// Parameters:
+//   - hwnd: The handle of the window.
+//
+// Returns:
+//   - bool: True if the window is visible, false otherwise.
+func IsWindowVisible(hwnd uintptr) bool {
+	ret, _, _ := isWindowVisible.Call(hwnd)
+	return ret != 0
+}
+
+// GetForegroundWindow retrieves the window the user is currently working with, which receives keyboard input.
+//
+// Returns:
+//   - uintptr: The handle of the foreground window, 0 if there is none, such as while the focus is changing.
+func GetForegroundWindow() uintptr {
+	hwnd, _, _ := getForegroundWindow.Call()
+	return hwnd
+}
+
+// SetForegroundWindow brings a window to the foreground and gives it the keyboard focus.
+// Windows only allows this under certain conditions, such as when the calling process received the last input event,
+// otherwise the window only flashes in the taskbar.
+//
+// Parameters:
+//   - hwnd: The handle of the window.
+//
+// Returns:
+//   - bool: True if the window was brought to the foreground, false otherwise.
+func SetForegroundWindow(hwnd uintptr) bool {
+	ret, _, _ := setForegroundWindow.Call(hwnd)
+	return ret != 0
+}
+
+// BringWindowToTop brings a window to the top of the Z order.
+//
+// Parameters:
+//   - hwnd: The handle of the window.
+//
+// Returns:
+//   - error: An error if the window could not be brought to the top.
+func BringWindowToTop(hwnd uintptr) error {
+	if ret, _, err := bringWindowToTop.Call(hwnd); ret == 0 {
+		return fmt.Errorf("failed to bring the window to the top: %w", err)
+	}
+	return nil
+}
+
+// IsIconic reports whether a window is minimized.
+//
+// Parameters:
+//   - hwnd: The handle of the window.
+//
+// Returns:
+//   - bool: True if the window is minimized, false otherwise.
+func IsIconic(hwnd uintptr) bool {
+	ret, _, _ := isIconic.Call(hwnd)
+	return ret != 0
+}
+
+// RestoreWindow restores a minimized or maximized window to its normal size and position, and activates it.
+//
+// Parameters:
+//   - hwnd: The handle of the window.
+func RestoreWindow(hwnd uintptr) {
+	ShowWindow(hwnd, SW_RESTORE)
+}
+
+// GetWindowThreadID retrieves the ID of the thread that created a window.
+//
+// Parameters:
+//   - hwnd: The handle of the window.
+//
+// Returns:
+//   - uint32: The thread ID, 0 if the window handle is invalid.
+func GetWindowThreadID(hwnd uintptr) uint32 {
+	tid, _, _ := getWindowThreadProcessId.Call(hwnd, 0)
+	return uint32(tid)
+}
+
+// GetCurrentThreadID retrieves the ID of the calling OS thread.
+// The goroutine must be locked to its OS thread for the ID to stay meaningful.
+//
+// Returns:
+//   - uint32: The thread ID.
+func GetCurrentThreadID() uint32 {
+	tid, _, _ := getCurrentThreadId.Call()
+	return uint32(tid)
+}
+
+// AttachThreadInput attaches or detaches the input processing of one thread to another, so they share the keyboard focus and the foreground state.
+//
+// Parameters:
+//   - from: The ID of the thread to attach.
+//   - to: The ID of the thread to attach it to.
+//   - attach: True to attach the threads, false to detach them.
+//
+// Returns:
+//   - error: An error if the threads could not be attached or detached.
+func AttachThreadInput(from, to uint32, attach bool) error {
+	var flag uintptr
+	if attach {
+		flag = 1
+	}
+	if ret, _, err := attachThreadInput.Call(uintptr(from), uintptr(to), flag); ret == 0 {
+		return fmt.Errorf("failed to attach the thread input: %w", err)
+	}
+	return nil
+}
+
+// ShowWindow sets the show state of a window, such as SW_MINIMIZE or SW_MAXIMIZE.
+//
+// Parameters:
+//   - hwnd: The handle of the window.
+//   - cmd: The SW_ show command.
+func ShowWindow(hwnd uintptr, cmd int) {
+	showWindow.Call(hwnd, uintptr(cmd))
+}
+
+// GetWindowPlacement retrieves the show state and the restored bounds of a window.
+//
+// Parameters:
+//   - hwnd: The handle of the window.
+//
+// Returns:
+//   - WindowPlacement: The placement of the window.
+//   - error: An error if the placement could not be retrieved, such as when the window handle is invalid.
+func GetWindowPlacement(hwnd uintptr) (WindowPlacement, error) {
+	wp := WindowPlacement{Length: uint32(unsafe.Sizeof(WindowPlacement{}))}
+	if ret, _, err := getWindowPlacement.Call(hwnd, uintptr(unsafe.Pointer(&wp))); ret == 0 {
+		return WindowPlacement{}, fmt.Errorf("failed to get the window placement: %w", err)
+	}
+	return wp, nil
+}
+
+// GetProcessImageName retrieves the full path of the executable of a process.
+//
+// Parameters:
+//   - pid: The ID of the process.
+//
+// Returns:
+//   - string: The full path of the executable, such as C:\Windows\notepad.exe.
+//   - error: An error if the process could not be opened, such as when it exited or is protected, or its image name could not be queried.
+func GetProcessImageName(pid uint32) (string, error) {
+	h, _, err := openProcess.Call(uintptr(PROCESS_QUERY_LIMITED_INFORMATION), 0, uintptr(pid))
+	if h == 0 {
+		return "", fmt.Errorf("failed to open process %d: %w", pid, err)
+	}
+	defer closeHandle.Call(h)
+
+	// image paths can exceed MAX_PATH, the size is updated to the length of the path on success
+	buf := make([]uint16, 1024)
+	size := uint32(len(buf))
+	if ret, _, err := queryFullProcessImageName.Call(h, 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size))); ret == 0 {
+		return "", fmt.Errorf("failed to query the image name of process %d: %w", pid, err)
+	}
+	return syscall.UTF16ToString(buf[:size]), nil
+}
+
+// WinEventFunc is called for every event of a window event hook.
+//
+// Parameters:
+//   - event: The EVENT_ constant of the event.
+//   - hwnd: The handle of the window the event is about, 0 if it is not about a window.
+//   - idObject: The object the event is about, OBJID_WINDOW for the window itself.
+//   - idChild: The child of the object the event is about, CHILDID_SELF for the object itself.
+type WinEventFunc func(event uint32, hwnd uintptr, idObject, idChild int32)
+
+var (
+	// callbacks created with syscall.NewCallback are never released, so one is shared by every hook and forwards to the function of the hook
+	winEventMu       sync.Mutex
+	winEventFns      = make(map[uintptr]WinEventFunc)
+	winEventCallback = syscall.NewCallback(func(hook, event, hwnd, idObject, idChild, _, _ uintptr) uintptr {
+		winEventMu.Lock()
+		fn := winEventFns[hook]
+		winEventMu.Unlock()
+		if fn != nil {
+			fn(uint32(event), hwnd, int32(idObject), int32(idChild))
+		}
+		return 0
+	})
+)
+
+// SetWinEventHook installs an out-of-context hook for a range of window events.
+// The events are delivered to fn from the message loop of the calling thread, so the caller must stay on the same OS thread,
+// run RunMessageLoop, and remove the hook with UnhookWinEvent from that thread.
+//
+// Parameters:
+//   - eventMin: The first EVENT_ constant of the range.
+//   - eventMax: The last EVENT_ constant of the range.
+//   - fn: The function called for each event.
+//
+// Returns:
+//   - uintptr: The handle of the hook.
+//   - error: An error if the hook could not be installed.
+func SetWinEventHook(eventMin, eventMax uint32, fn WinEventFunc) (uintptr, error) {
+	// the lock is held while installing, so an event delivered right away already finds its function
+	winEventMu.Lock()
+	defer winEventMu.Unlock()
+	hook, _, err := setWinEventHook.Call(uintptr(eventMin), uintptr(eventMax), 0, winEventCallback, 0, 0, uintptr(WINEVENT_OUTOFCONTEXT))
+	if hook == 0 {
+		return 0, fmt.Errorf("failed to set the window event hook: %w", err)
+	}
+	winEventFns[hook] = fn
+	return hook, nil
+}
+
+// UnhookWinEvent removes a hook installed by SetWinEventHook.
+//
+// Parameters:
+//   - hook: The handle of the hook.
+func UnhookWinEvent(hook uintptr) {
+	unhookWinEvent.Call(hook)
+	winEventMu.Lock()
+	delete(winEventFns, hook)
+	winEventMu.Unlock()
+}
+
+// MsllHookStruct represents the MSLLHOOKSTRUCT structure, the mouse input passed to a low-level mouse hook.
+type MsllHookStruct struct {
+	Pt          Point
+	MouseData   uint32 // the wheel rotation in its high word for WM_MOUSEWHEEL
+	Flags       uint32
+	Time        uint32
+	DwExtraInfo uintptr
+}
+
+// MouseWheelFunc is called for every rotation of the mouse wheel seen by a mouse wheel hook.
+//
+// Parameters:
+//   - delta: The rotation of the wheel, in multiples of WHEEL_DELTA per notch, positive away from the user.
+type MouseWheelFunc func(delta int32)
+
+var (
+	// a low-level hook is called on the thread that installed it, so the function of each hook is keyed by the thread
+	mouseWheelMu       sync.Mutex
+	mouseWheelFns      = make(map[uint32]MouseWheelFunc)
+	mouseWheelCallback = syscall.NewCallback(func(nCode, wParam uintptr, info *MsllHookStruct) uintptr {
+		if int32(nCode) >= 0 && wParam == WM_MOUSEWHEEL {
+			mouseWheelMu.Lock()
+			fn := mouseWheelFns[GetCurrentThreadID()]
+			mouseWheelMu.Unlock()
+			if fn != nil {
+				fn(int32(int16(info.MouseData >> 16)))
+			}
+		}
+		ret, _, _ := callNextHookEx.Call(0, nCode, wParam, uintptr(unsafe.Pointer(info)))
+		return ret
+	})
+)
+
+// SetMouseWheelHook installs a low-level mouse hook that reports every rotation of the mouse wheel, including those of other applications.
+// The hook is called from the message loop of the calling thread, so the caller must stay on the same OS thread, run RunMessageLoop,
+// and remove the hook with UnhookMouseWheel from that thread. The system removes a hook that takes too long, so fn must return quickly.
+//
+// Parameters:
+//   - fn: The function called for each rotation.
+//
+// Returns:
+//   - uintptr: The handle of the hook.
+//   - error: An error if the hook could not be installed.
+func SetMouseWheelHook(fn MouseWheelFunc) (uintptr, error) {
+	mouseWheelMu.Lock()
+	defer mouseWheelMu.Unlock()
+	module, _, _ := getModuleHandle.Call(0)
+	hook, _, err := setWindowsHookEx.Call(uintptr(WH_MOUSE_LL), mouseWheelCallback, module, 0)
+	if hook == 0 {
+		return 0, fmt.Errorf("failed to set the mouse hook: %w", err)
+	}
+	mouseWheelFns[GetCurrentThreadID()] = fn
+	return hook, nil
+}
+
+// UnhookMouseWheel removes a hook installed by SetMouseWheelHook, it must be called from the thread that installed it.
+//
+// Parameters:
+//   - hook: The handle of the hook.
+func UnhookMouseWheel(hook uintptr) {
+	unhookWindowsHookEx.Call(hook)
+	mouseWheelMu.Lock()
+	delete(mouseWheelFns, GetCurrentThreadID())
+	mouseWheelMu.Unlock()
+}
+
+// EnsureMessageQueue creates the message queue of the calling thread, if it does not have one yet.
+// A thread only gets a message queue once it calls certain functions, and messages posted to it with PostThreadQuit before then are lost.
+func EnsureMessageQueue() {
+	var msg Msg
+	peekMessage.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0, uintptr(PM_NOREMOVE))
+}
+
+// RunMessageLoop retrieves and dispatches the messages of the calling thread until it receives WM_QUIT.
+//
+// Returns:
+//   - error: An error if retrieving a message failed.
+func RunMessageLoop() error {
+	var msg Msg
+	for {
+		// GetMessage returns 0 for WM_QUIT and -1 on error
+		ret, _, err := getMessage.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0)
+		switch int32(ret) {
+		case 0:
+			return nil
+		case -1:
+			return fmt.Errorf("failed to get a message: %w", err)
+		}
+		dispatchMessage.Call(uintptr(unsafe.Pointer(&msg)))
+	}
+}
+
+// PostThreadQuit posts WM_QUIT to a thread, which ends its RunMessageLoop.
+//
+// Parameters:
+//   - threadID: The ID of the thread.
+//
+// Returns:
+//   - error: An error if the message could not be posted, such as when the thread has exited.
+func PostThreadQuit(threadID uint32) error {
+	if ret, _, err := postThreadMessage.Call(uintptr(threadID), uintptr(WM_QUIT), 0, 0); ret == 0 {
+		return fmt.Errorf("failed to post the quit message: %w", err)
+	}
+	return nil
+}
+
+// RequestClose posts WM_CLOSE to a window, asking it to close the way the user would, the window may prompt the user or refuse.
+//
+// Parameters:
+//   - hwnd: The handle of the window.
+//
+// Returns:
+//   - error: An error if the message could not be posted, such as when the window no longer exists.
+func RequestClose(hwnd uintptr) error {
+	if ret, _, err := postMessage.Call(hwnd, uintptr(WM_CLOSE), 0, 0); ret == 0 {
+		return fmt.Errorf("failed to post the close message: %w", err)
+	}
+	return nil
+}
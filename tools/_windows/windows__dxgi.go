@@ -0,0 +1,430 @@
+//go:build windows
+// +build windows
+
+package windows
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	// DXGI and Direct3D 11 DLL calls, used by the desktop duplication
+	Dxgi               = syscall.NewLazyDLL("dxgi.dll")
+	createDXGIFactory1 = Dxgi.NewProc("CreateDXGIFactory1")
+	D3d11              = syscall.NewLazyDLL("d3d11.dll")
+	d3d11CreateDevice  = D3d11.NewProc("D3D11CreateDevice")
+)
+
+const (
+	DXGI_ERROR_NOT_FOUND               = 0x887A0002
+	DXGI_ERROR_MORE_DATA               = 0x887A0003
+	DXGI_ERROR_UNSUPPORTED             = 0x887A0004
+	DXGI_ERROR_NOT_CURRENTLY_AVAILABLE = 0x887A0022
+	DXGI_ERROR_ACCESS_LOST             = 0x887A0026
+	DXGI_ERROR_WAIT_TIMEOUT            = 0x887A0027
+	DXGI_FORMAT_B8G8R8A8_UNORM         = 87
+	DXGI_MODE_ROTATION_UNSPECIFIED     = 0
+	DXGI_MODE_ROTATION_IDENTITY        = 1
+	D3D_DRIVER_TYPE_UNKNOWN            = 0
+	D3D11_SDK_VERSION                  = 7
+	D3D11_USAGE_STAGING                = 3
+	D3D11_CPU_ACCESS_READ              = 0x20000
+	D3D11_MAP_READ                     = 1
+)
+
+// the vtable indices of the COM methods used by the desktop duplication, counted from the first IUnknown method
+const (
+	methodQueryInterface = 0
+	methodRelease        = 2
+
+	factoryEnumAdapters = 7  // IDXGIFactory::EnumAdapters
+	adapterEnumOutputs  = 7  // IDXGIAdapter::EnumOutputs
+	outputGetDesc       = 7  // IDXGIOutput::GetDesc
+	outputDuplicate     = 22 // IDXGIOutput1::DuplicateOutput
+
+	duplicationGetDesc          = 7  // IDXGIOutputDuplication::GetDesc
+	duplicationAcquireNextFrame = 8  // IDXGIOutputDuplication::AcquireNextFrame
+	duplicationGetDirtyRects    = 9  // IDXGIOutputDuplication::GetFrameDirtyRects
+	duplicationReleaseFrame     = 14 // IDXGIOutputDuplication::ReleaseFrame
+
+	deviceCreateTexture2D = 5  // ID3D11Device::CreateTexture2D
+	contextMap            = 14 // ID3D11DeviceContext::Map
+	contextUnmap          = 15 // ID3D11DeviceContext::Unmap
+	contextCopyResource   = 47 // ID3D11DeviceContext::CopyResource
+)
+
+var (
+	iidIDXGIFactory1   = comGUID{0x770aae78, 0xf26f, 0x4dba, [8]byte{0xa8, 0x29, 0x25, 0x3c, 0x83, 0xd1, 0xb3, 0x87}}
+	iidIDXGIOutput1    = comGUID{0x00cddea8, 0x939b, 0x4b83, [8]byte{0xa3, 0x40, 0xa6, 0x85, 0x22, 0x66, 0x66, 0xcc}}
+	iidID3D11Texture2D = comGUID{0x6f15aaf2, 0xd208, 0x4e89, [8]byte{0x9a, 0xb4, 0x48, 0x95, 0x35, 0xd3, 0x4f, 0x9c}}
+)
+
+// firstFrameTimeout bounds the wait for the first frame of a new duplication, which presents the current desktop image right away unless the compositor stalls.
+const firstFrameTimeout = 500 * time.Millisecond
+
+// ErrDuplicationUnavailable is reported when the desktop duplication API can not duplicate an output,
+// such as in a remote desktop session, on Windows before 8, or for a rotated display.
+var ErrDuplicationUnavailable = errors.New("desktop duplication is not available")
+
+// ErrDuplicationAccessLost is reported once a desktop duplication was invalidated, such as by a display mode change or switching to the secure desktop.
+// The duplication must be closed and a new one created.
+var ErrDuplicationAccessLost = errors.New("desktop duplication access was lost")
+
+// comGUID is the layout of a COM interface identifier.
+type comGUID struct {
+	Data1 uint32
+	Data2 uint16
+	Data3 uint16
+	Data4 [8]byte
+}
+
+// comObject is the layout of a COM object, which starts with a pointer to the table of its methods.
+type comObject struct {
+	vtbl *[64]uintptr
+}
+
+// call calls the method at the given index of the object's vtable, passing the object as the first argument.
+//
+// Parameters:
+//   - method: The index of the method in the vtable.
+//   - args: The arguments of the method, after the object itself.
+//
+// Returns:
+//   - uintptr: The value returned by the method, an HRESULT for most methods.
+//
+//go:uintptrescapes
+func (o *comObject) call(method int, args ...uintptr) uintptr {
+	ret, _, _ := syscall.SyscallN(o.vtbl[method], append([]uintptr{uintptr(unsafe.Pointer(o))}, args...)...)
+	return ret
+}
+
+// release releases the reference held on the object, if it is not nil.
+func (o *comObject) release() {
+	if o != nil {
+		o.call(methodRelease)
+	}
+}
+
+// hresultFailed reports whether an HRESULT is a failure code.
+func hresultFailed(hr uintptr) bool {
+	return int32(hr) < 0
+}
+
+// dxgiOutputDesc is the layout of DXGI_OUTPUT_DESC.
+type dxgiOutputDesc struct {
+	DeviceName         [32]uint16
+	DesktopCoordinates Rect
+	AttachedToDesktop  int32
+	Rotation           uint32
+	Monitor            uintptr
+}
+
+// dxgiOutduplDesc is the layout of DXGI_OUTDUPL_DESC.
+type dxgiOutduplDesc struct {
+	Width                      uint32
+	Height                     uint32
+	RefreshRateNumerator       uint32
+	RefreshRateDenominator     uint32
+	Format                     uint32
+	ScanlineOrdering           uint32
+	Scaling                    uint32
+	Rotation                   uint32
+	DesktopImageInSystemMemory int32
+}
+
+// dxgiOutduplFrameInfo is the layout of DXGI_OUTDUPL_FRAME_INFO.
+type dxgiOutduplFrameInfo struct {
+	LastPresentTime           int64
+	LastMouseUpdateTime       int64
+	AccumulatedFrames         uint32
+	RectsCoalesced            int32
+	ProtectedContentMaskedOut int32
+	PointerX                  int32
+	PointerY                  int32
+	PointerVisible            int32
+	TotalMetadataBufferSize   uint32
+	PointerShapeBufferSize    uint32
+}
+
+// d3d11Texture2DDesc is the layout of D3D11_TEXTURE2D_DESC.
+type d3d11Texture2DDesc struct {
+	Width          uint32
+	Height         uint32
+	MipLevels      uint32
+	ArraySize      uint32
+	Format         uint32
+	SampleCount    uint32
+	SampleQuality  uint32
+	Usage          uint32
+	BindFlags      uint32
+	CPUAccessFlags uint32
+	MiscFlags      uint32
+}
+
+// d3d11MappedSubresource is the layout of D3D11_MAPPED_SUBRESOURCE.
+type d3d11MappedSubresource struct {
+	Data       unsafe.Pointer
+	RowPitch   uint32
+	DepthPitch uint32
+}
+
+// DuplicatedFrame is a frame of a desktop duplication.
+type DuplicatedFrame struct {
+	Width  int    // the width of the frame in pixels
+	Height int    // the height of the frame in pixels
+	Pitch  int    // the number of bytes between the starts of two rows of Pixels
+	Pixels []byte // the pixels of the frame as top-down rows of 4 byte BGRA pixels
+
+	// DirtyRects are the regions of the output that changed since the previous frame, relative to the top-left corner of the output.
+	// It is empty if nothing changed, and nil if it is not known what changed, such as for the first frame, in which case the whole frame should be treated as changed.
+	DirtyRects []Rect
+	// Seq numbers the frames of the duplication, the first frame is 1.
+	Seq uint64
+}
+
+// OutputDuplication duplicates the desktop image of a single output with the DXGI desktop duplication API.
+// The latest frame is kept in a staging texture, so a frame can be read even when the desktop has not changed since the previous one.
+// An OutputDuplication is not safe for concurrent use.
+type OutputDuplication struct {
+	device      *comObject // ID3D11Device
+	context     *comObject // ID3D11DeviceContext
+	duplication *comObject // IDXGIOutputDuplication
+	staging     *comObject // ID3D11Texture2D holding the latest frame
+
+	width    int
+	height   int
+	seq      uint64
+	hasFrame bool
+	dirty    []Rect // reused buffer for the dirty rects of a frame
+}
+
+// NewOutputDuplication starts duplicating the output whose desktop coordinates start at the given point, the top-left corner of a display.
+// The process must be per-monitor DPI aware, which the package declares on load, for the duplication to cover the whole output.
+//
+// Parameters:
+//   - x: The x-coordinate of the top-left corner of the output in virtual screen coordinates.
+//   - y: The y-coordinate of the top-left corner of the output in virtual screen coordinates.
+//
+// Returns:
+//   - *OutputDuplication: The new duplication, which must be closed once it is no longer needed.
+//   - error: An error wrapping ErrDuplicationUnavailable if the output can not be duplicated, such as in a remote desktop session.
+func NewOutputDuplication(x, y int32) (*OutputDuplication, error) {
+	if err := createDXGIFactory1.Find(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDuplicationUnavailable, err)
+	}
+	var factory *comObject
+	if hr, _, _ := createDXGIFactory1.Call(uintptr(unsafe.Pointer(&iidIDXGIFactory1)), uintptr(unsafe.Pointer(&factory))); hresultFailed(hr) {
+		return nil, fmt.Errorf("%w: CreateDXGIFactory1 failed with HRESULT 0x%08X", ErrDuplicationUnavailable, uint32(hr))
+	}
+	defer factory.release()
+
+	adapter, output, rotation, err := findOutput(factory, x, y)
+	if err != nil {
+		return nil, err
+	}
+	defer adapter.release()
+	defer output.release()
+	if rotation != DXGI_MODE_ROTATION_UNSPECIFIED && rotation != DXGI_MODE_ROTATION_IDENTITY {
+		return nil, fmt.Errorf("%w: the output at (%d, %d) is rotated", ErrDuplicationUnavailable, x, y)
+	}
+
+	var output1 *comObject
+	if hr := output.call(methodQueryInterface, uintptr(unsafe.Pointer(&iidIDXGIOutput1)), uintptr(unsafe.Pointer(&output1))); hresultFailed(hr) {
+		return nil, fmt.Errorf("%w: IDXGIOutput1 is not supported, HRESULT 0x%08X", ErrDuplicationUnavailable, uint32(hr))
+	}
+	defer output1.release()
+
+	d := &OutputDuplication{}
+	if hr, _, _ := d3d11CreateDevice.Call(uintptr(unsafe.Pointer(adapter)), D3D_DRIVER_TYPE_UNKNOWN, 0, 0, 0, 0, D3D11_SDK_VERSION,
+		uintptr(unsafe.Pointer(&d.device)), 0, uintptr(unsafe.Pointer(&d.context))); hresultFailed(hr) {
+		return nil, fmt.Errorf("%w: D3D11CreateDevice failed with HRESULT 0x%08X", ErrDuplicationUnavailable, uint32(hr))
+	}
+
+	if hr := output1.call(outputDuplicate, uintptr(unsafe.Pointer(d.device)), uintptr(unsafe.Pointer(&d.duplication))); hresultFailed(hr) {
+		d.Close()
+		return nil, fmt.Errorf("%w: DuplicateOutput failed with HRESULT 0x%08X", ErrDuplicationUnavailable, uint32(hr))
+	}
+
+	var desc dxgiOutduplDesc
+	d.duplication.call(duplicationGetDesc, uintptr(unsafe.Pointer(&desc)))
+	d.width, d.height = int(desc.Width), int(desc.Height)
+
+	texDesc := d3d11Texture2DDesc{
+		Width:          desc.Width,
+		Height:         desc.Height,
+		MipLevels:      1,
+		ArraySize:      1,
+		Format:         DXGI_FORMAT_B8G8R8A8_UNORM,
+		SampleCount:    1,
+		Usage:          D3D11_USAGE_STAGING,
+		CPUAccessFlags: D3D11_CPU_ACCESS_READ,
+	}
+	if hr := d.device.call(deviceCreateTexture2D, uintptr(unsafe.Pointer(&texDesc)), 0, uintptr(unsafe.Pointer(&d.staging))); hresultFailed(hr) {
+		d.Close()
+		return nil, fmt.Errorf("%w: CreateTexture2D failed with HRESULT 0x%08X", ErrDuplicationUnavailable, uint32(hr))
+	}
+	return d, nil
+}
+
+// findOutput finds the output attached to the desktop whose desktop coordinates start at the given point, across every adapter.
+//
+// Parameters:
+//   - factory: The IDXGIFactory1 to enumerate the adapters of.
+//   - x: The x-coordinate of the top-left corner of the output.
+//   - y: The y-coordinate of the top-left corner of the output.
+//
+// Returns:
+//   - *comObject: The IDXGIAdapter the output is attached to, which must be released.
+//   - *comObject: The IDXGIOutput, which must be released.
+//   - uint32: The rotation of the output, one of the DXGI_MODE_ROTATION constants.
+//   - error: An error wrapping ErrDuplicationUnavailable if there is no such output.
+func findOutput(factory *comObject, x, y int32) (*comObject, *comObject, uint32, error) {
+	for i := 0; ; i++ {
+		var adapter *comObject
+		if hr := factory.call(factoryEnumAdapters, uintptr(i), uintptr(unsafe.Pointer(&adapter))); hresultFailed(hr) {
+			break
+		}
+		for j := 0; ; j++ {
+			var output *comObject
+			if hr := adapter.call(adapterEnumOutputs, uintptr(j), uintptr(unsafe.Pointer(&output))); hresultFailed(hr) {
+				break
+			}
+			var desc dxgiOutputDesc
+			hr := output.call(outputGetDesc, uintptr(unsafe.Pointer(&desc)))
+			if !hresultFailed(hr) && desc.AttachedToDesktop != 0 && desc.DesktopCoordinates.Left == x && desc.DesktopCoordinates.Top == y {
+				return adapter, output, desc.Rotation, nil
+			}
+			output.release()
+		}
+		adapter.release()
+	}
+	return nil, nil, 0, fmt.Errorf("%w: no output starts at (%d, %d)", ErrDuplicationUnavailable, x, y)
+}
+
+// Frame returns the latest frame of the output, waiting up to the timeout for the desktop to change.
+// If the desktop did not change within the timeout, the previous frame is returned again with no dirty rects.
+// The first frame of a new duplication is waited for at least firstFrameTimeout, since there is no previous frame to return.
+//
+// Parameters:
+//   - timeout: How long to wait for a new frame, zero returns right away.
+//
+// Returns:
+//   - DuplicatedFrame: The latest frame, with the regions that changed since the previous call to Frame.
+//   - error: ErrDuplicationAccessLost if the duplication must be recreated, or an error if no frame was captured yet or the frame could not be read.
+func (d *OutputDuplication) Frame(timeout time.Duration) (DuplicatedFrame, error) {
+	if !d.hasFrame {
+		timeout = max(timeout, firstFrameTimeout)
+	}
+	var info dxgiOutduplFrameInfo
+	var resource *comObject
+	hr := d.duplication.call(duplicationAcquireNextFrame, uintptr(timeout.Milliseconds()), uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&resource)))
+	switch {
+	case uint32(hr) == DXGI_ERROR_WAIT_TIMEOUT:
+		if !d.hasFrame {
+			return DuplicatedFrame{}, fmt.Errorf("no desktop frame was presented within %v", timeout)
+		}
+		return d.readFrame([]Rect{})
+	case uint32(hr) == DXGI_ERROR_ACCESS_LOST:
+		return DuplicatedFrame{}, ErrDuplicationAccessLost
+	case hresultFailed(hr):
+		return DuplicatedFrame{}, fmt.Errorf("AcquireNextFrame failed with HRESULT 0x%08X", uint32(hr))
+	}
+	defer d.duplication.call(duplicationReleaseFrame)
+	defer resource.release()
+
+	// a frame that only updated the mouse pointer leaves the desktop image as it was
+	dirty := []Rect{}
+	if info.LastPresentTime != 0 || !d.hasFrame {
+		var err error
+		if dirty, err = d.dirtyRects(info.TotalMetadataBufferSize); err != nil {
+			return DuplicatedFrame{}, err
+		}
+
+		var texture *comObject
+		if hr := resource.call(methodQueryInterface, uintptr(unsafe.Pointer(&iidID3D11Texture2D)), uintptr(unsafe.Pointer(&texture))); hresultFailed(hr) {
+			return DuplicatedFrame{}, fmt.Errorf("the desktop frame is not a texture, HRESULT 0x%08X", uint32(hr))
+		}
+		d.context.call(contextCopyResource, uintptr(unsafe.Pointer(d.staging)), uintptr(unsafe.Pointer(texture)))
+		texture.release()
+		if !d.hasFrame {
+			// the first frame is all new, there is no previous frame it could be compared to
+			dirty = nil
+			d.hasFrame = true
+		}
+	}
+	return d.readFrame(dirty)
+}
+
+// dirtyRects retrieves the dirty rects of the acquired frame.
+//
+// Parameters:
+//   - metadataSize: The size of the metadata of the frame, zero if it has no dirty rects.
+//
+// Returns:
+//   - []Rect: The dirty rects, empty if the frame has none.
+//   - error: An error if the dirty rects could not be retrieved.
+func (d *OutputDuplication) dirtyRects(metadataSize uint32) ([]Rect, error) {
+	if metadataSize == 0 {
+		return []Rect{}, nil
+	}
+	rectSize := uint32(unsafe.Sizeof(Rect{}))
+	if need := int(metadataSize / rectSize); cap(d.dirty) < need {
+		d.dirty = make([]Rect, need)
+	}
+	d.dirty = d.dirty[:cap(d.dirty)]
+
+	for {
+		var required uint32
+		hr := d.duplication.call(duplicationGetDirtyRects, uintptr(uint32(len(d.dirty))*rectSize), uintptr(unsafe.Pointer(&d.dirty[0])), uintptr(unsafe.Pointer(&required)))
+		if uint32(hr) == DXGI_ERROR_MORE_DATA {
+			d.dirty = make([]Rect, required/rectSize)
+			continue
+		}
+		if hresultFailed(hr) {
+			return nil, fmt.Errorf("GetFrameDirtyRects failed with HRESULT 0x%08X", uint32(hr))
+		}
+		return append([]Rect{}, d.dirty[:required/rectSize]...), nil
+	}
+}
+
+// readFrame copies the latest frame out of the staging texture.
+//
+// Parameters:
+//   - dirty: The dirty rects to report with the frame.
+//
+// Returns:
+//   - DuplicatedFrame: The frame.
+//   - error: An error if the staging texture could not be mapped.
+func (d *OutputDuplication) readFrame(dirty []Rect) (DuplicatedFrame, error) {
+	var mapped d3d11MappedSubresource
+	if hr := d.context.call(contextMap, uintptr(unsafe.Pointer(d.staging)), 0, D3D11_MAP_READ, 0, uintptr(unsafe.Pointer(&mapped))); hresultFailed(hr) {
+		return DuplicatedFrame{}, fmt.Errorf("failed to map the desktop frame, HRESULT 0x%08X", uint32(hr))
+	}
+	pitch := int(mapped.RowPitch)
+	pixels := make([]byte, pitch*d.height)
+	copy(pixels, unsafe.Slice((*byte)(mapped.Data), len(pixels)))
+	d.context.call(contextUnmap, uintptr(unsafe.Pointer(d.staging)), 0)
+
+	d.seq++
+	return DuplicatedFrame{
+		Width:      d.width,
+		Height:     d.height,
+		Pitch:      pitch,
+		Pixels:     pixels,
+		DirtyRects: dirty,
+		Seq:        d.seq,
+	}, nil
+}
+
+// Close stops the duplication and releases its resources. It is safe to call Close more than once.
+func (d *OutputDuplication) Close() {
+	d.staging.release()
+	d.duplication.release()
+	d.context.release()
+	d.device.release()
+	d.staging, d.duplication, d.context, d.device = nil, nil, nil, nil
+}
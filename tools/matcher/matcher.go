@@ -2,9 +2,13 @@ package matcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"image"
+	"math"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Carmen-Shannon/automation/device/display"
@@ -12,9 +16,43 @@ import (
 	"github.com/Carmen-Shannon/automation/tools/worker"
 )
 
+// ErrNoMatch is the error wrapped by every NoMatchError, so a search that found nothing can be told apart from one that failed with errors.Is.
+var ErrNoMatch = errors.New("no match found")
+
+// NoMatchError is the error reported when a search finds no window of the scan under the threshold.
+// It reports the window that came closest to matching, which tells whether the threshold is slightly too strict or the template is not on screen at all.
+// Windows are rejected as soon as they can not match, so the near miss is the closest window the search saw rather than necessarily the closest one in the scan.
+type NoMatchError struct {
+	Timeout bool // whether the search ran out of time before every window was compared
+
+	// NearMiss is the window that came closest to matching, relative to the scan the same way a match is, empty if no window was compared.
+	NearMiss image.Rectangle
+	// NearMissConfidence is the confidence of the near miss, see ConfidenceOpt.
+	NearMissConfidence float64
+}
+
+func (e *NoMatchError) Error() string {
+	msg := ErrNoMatch.Error()
+	if e.Timeout {
+		msg += " - timeout"
+	}
+	if !e.NearMiss.Empty() {
+		msg += fmt.Sprintf(", closest window at %d, %d with confidence %.3f", e.NearMiss.Min.X, e.NearMiss.Min.Y, e.NearMissConfidence)
+	}
+	return msg
+}
+
+func (e *NoMatchError) Unwrap() error {
+	return ErrNoMatch
+}
+
 type matcher struct {
 	pool worker.DynamicWorkerPool
 	scan display.BMP
+
+	defaultsMu sync.Mutex
+	threshold  float64       // the threshold used when a search is not given ThresholdOpt, zero for the package default
+	timeout    time.Duration // the timeout used when a search is not given TimeoutOpt, zero for the package default
 }
 
 type Matcher interface {
@@ -26,11 +64,110 @@ type Matcher interface {
 	//   - options: Optional parameters for the search, such as MSE threshold and timeout.
 	//
 	// Returns:
-	//   - (x, y): The top-left coordinates of the match in the larger BMP.
+	//   - (x, y): The top-left coordinates of the match in the larger BMP, or its center if CenterResultOpt is provided.
 	//     NOTE: The coordinates are relative to the larger BMP, not the screen.
-	//   - error: An error if no match is found or if the search fails.
+	//   - error: A *NoMatchError wrapping ErrNoMatch if no match is found, with the closest window as its near miss, or an error if the search fails.
 	FindTemplate(template display.BMP, options ...FindBuilderOption) (int, int, error)
 
+	// FindTemplateSubpixel searches for a smaller BMP within another BMP the same way FindTemplate does, but returns fractional coordinates.
+	// When SubpixelOpt is provided, the match is refined by fitting a parabola to the MSE surface around the best integer match,
+	// otherwise the integer coordinates of the match are returned as float64.
+	//
+	// Parameters:
+	//   - template: The smaller BMP image (template) to search for.
+	//   - options: Optional parameters for the search, such as MSE threshold, timeout and subpixel refinement.
+	//
+	// Returns:
+	//   - (x, y): The top-left coordinates of the match in the larger BMP, or its center if CenterResultOpt is provided.
+	//     NOTE: The coordinates are relative to the larger BMP, not the screen.
+	//   - error: An error if no match is found or if the search fails.
+	FindTemplateSubpixel(template display.BMP, options ...FindBuilderOption) (float64, float64, error)
+
+	// FindTemplateConfidence searches for a smaller BMP within another BMP the same way FindTemplate does, and also returns the confidence of the match.
+	// The confidence is a size-independent score in [0, 1], where 1 is a perfect match, see ConfidenceOpt.
+	//
+	// Parameters:
+	//   - template: The smaller BMP image (template) to search for.
+	//   - options: Optional parameters for the search, such as the minimum confidence and timeout.
+	//
+	// Returns:
+	//   - (x, y): The top-left coordinates of the match in the larger BMP, or its center if CenterResultOpt is provided.
+	//     NOTE: The coordinates are relative to the larger BMP, not the screen.
+	//   - float64: The confidence of the match.
+	//   - error: An error if no match is found or if the search fails.
+	FindTemplateConfidence(template display.BMP, options ...FindBuilderOption) (int, int, float64, error)
+
+	// FindTemplateRect searches for a smaller BMP within another BMP the same way FindTemplate does, but returns the whole matched rectangle.
+	// The rectangle spans the template size from the top-left corner of the match, its Max corner is exclusive, as with any image.Rectangle.
+	// CenterResultOpt has no effect, the center of the match is the center of the rectangle.
+	//
+	// Parameters:
+	//   - template: The smaller BMP image (template) to search for.
+	//   - options: Optional parameters for the search, such as MSE threshold and timeout.
+	//
+	// Returns:
+	//   - image.Rectangle: The matched rectangle in the larger BMP.
+	//     NOTE: The rectangle is relative to the larger BMP, not the screen.
+	//   - error: An error if no match is found or if the search fails.
+	FindTemplateRect(template display.BMP, options ...FindBuilderOption) (image.Rectangle, error)
+
+	// FindTemplateRotated searches for a smaller BMP within another BMP the same way FindTemplate does, and also returns the rotation it was found at.
+	// The rotations to try are given with AnglesOpt, without it only the template as is is tried and the rotation is always 0.
+	//
+	// Parameters:
+	//   - template: The smaller BMP image (template) to search for.
+	//   - options: Optional parameters for the search, such as the rotations to try, MSE threshold and timeout.
+	//
+	// Returns:
+	//   - (x, y): The top-left coordinates of the match in the larger BMP, or its center if CenterResultOpt is provided.
+	//     NOTE: The coordinates are relative to the larger BMP, not the screen.
+	//   - int: The clockwise rotation of the template the match was found at, in degrees, as given to AnglesOpt.
+	//   - error: An error if a rotation is not a multiple of 90 degrees, no match is found or the search fails.
+	FindTemplateRotated(template display.BMP, options ...FindBuilderOption) (int, int, int, error)
+
+	// FindTemplateBytes searches for a template given as encoded image bytes, such as an embedded asset, the same way FindTemplate does.
+	// The bytes may hold a BMP, PNG or JPEG image, they are decoded with display.LoadImage before the search.
+	//
+	// Parameters:
+	//   - data: The encoded template image to search for.
+	//   - options: Optional parameters for the search, such as MSE threshold and timeout.
+	//
+	// Returns:
+	//   - (x, y): The top-left coordinates of the match in the larger BMP, or its center if CenterResultOpt is provided.
+	//     NOTE: The coordinates are relative to the larger BMP, not the screen.
+	//   - error: An error if the template can not be decoded, no match is found or the search fails.
+	FindTemplateBytes(data []byte, options ...FindBuilderOption) (int, int, error)
+
+	// DebugRender searches the scan for every match of the template, and returns a copy of the scan with a red border drawn around each of them.
+	// Unlike FindTemplate, the whole scan is searched sequentially, and of several overlapping matches only the one with the lowest MSE is marked.
+	// Saving the result with ToBinary shows what a threshold actually matches, which makes tuning it much easier than guessing at numbers.
+	//
+	// Parameters:
+	//   - template: The smaller BMP image (template) to search for.
+	//   - options: Optional parameters for the search, such as MSE threshold and timeout.
+	//
+	// Returns:
+	//   - *display.BMP: A top-down 24-bit copy of the scan with the matches marked, unmarked if nothing matched.
+	//   - error: An error if the search fails or does not finish before the timeout.
+	DebugRender(template display.BMP, options ...FindBuilderOption) (*display.BMP, error)
+
+	// FindTemplateTiled searches for a smaller BMP across a scan that is split into tiles, instead of the matcher's own scan.
+	// This is useful for very large virtual screens that do not fit comfortably in memory as a single capture.
+	// Adjacent tiles must overlap by at least the template size minus one pixel, so every match straddling a seam lies entirely within one of the tiles.
+	// The tiles are searched in the order given and the first match found is returned, or the first match in reading order across all tiles with FirstInReadingOrderOpt.
+	// The timeout applies to the search as a whole, not to each tile.
+	//
+	// Parameters:
+	//   - tiles: The tiles of the scan, each with its origin.
+	//   - template: The smaller BMP image (template) to search for.
+	//   - options: Optional parameters for the search, such as MSE threshold and timeout.
+	//
+	// Returns:
+	//   - (x, y): The top-left coordinates of the match, or its center if CenterResultOpt is provided.
+	//     NOTE: The coordinates are in the space the tile origins are given in, such as the virtual screen.
+	//   - error: An error if the tiles are invalid or do not overlap enough, no match is found or the search fails.
+	FindTemplateTiled(tiles []TileBMP, template display.BMP, options ...FindBuilderOption) (int, int, error)
+
 	// SetScan sets the BMP to be used for scanning.
 	// This is useful for updating the scan area without creating a new matcher instance.
 	// It will stop the current worker pool and clear the task queue before setting the new BMP, as to stop any ongoing matching tasks.
@@ -39,10 +176,33 @@ type Matcher interface {
 	// Parameters:
 	//   - bmp: The new BMP to set for scanning.
 	SetScan(bmp display.BMP)
+
+	// SetThreshold sets the MSE threshold used by every following search that is not given ThresholdOpt or ConfidenceOpt.
+	// This is useful for tuning the threshold interactively, or for configuring a matcher once and reusing it, without passing the option to every call.
+	//
+	// Parameters:
+	//   - threshold: The default threshold, see ThresholdOpt. Zero or less restores the package default of 100.0.
+	SetThreshold(threshold float64)
+
+	// SetTimeout sets the timeout used by every following search that is not given TimeoutOpt.
+	//
+	// Parameters:
+	//   - timeout: The default timeout, see TimeoutOpt. Zero or less restores the package default of 500ms.
+	SetTimeout(timeout time.Duration)
+
+	// Close stops the worker pool the matcher searches with and releases its workers, such as once the matcher is no longer needed.
+	// The matcher must not be used for searches once it is closed. It is safe to call Close any number of times.
+	Close()
 }
 
 var _ Matcher = (*matcher)(nil)
 
+// TileBMP is one tile of a scan that is split into tiles, see FindTemplateTiled.
+type TileBMP struct {
+	BMP  display.BMP
+	X, Y int // the coordinates of the top-left corner of the tile in the whole scan
+}
+
 // NewMatcher creates a new matcher instance with the given BMP for scanning.
 // It initializes a worker pool for processing matching tasks and returns the matcher instance.
 //
@@ -53,92 +213,399 @@ var _ Matcher = (*matcher)(nil)
 //   - Matcher: A new matcher instance that can be used to find templates within the specified BMP.
 func NewMatcher(bmp display.BMP) Matcher {
 	return &matcher{
-		pool: worker.NewDynamicWorkerPool(1, 3000, 500*time.Millisecond),
+		// a search never uses more than one worker per CPU, leaving one for the caller,
+		// and the queue grows past its initial size for large scans split into many small chunks
+		pool: worker.NewDynamicWorkerPool(1, 3000, 500*time.Millisecond,
+			worker.WorkerBoundsOpt(1, tools.Max(runtime.NumCPU()-1, 1)),
+			worker.GrowQueueOpt(0),
+		),
 		scan: bmp,
 	}
 }
 
-func (m *matcher) FindTemplate(template display.BMP, options ...FindBuilderOption) (int, int, error) {
-	fbo := &findBuilderOption{}
-	for _, opt := range options {
-		opt(fbo)
+func (m *matcher) DebugRender(template display.BMP, options ...FindBuilderOption) (*display.BMP, error) {
+	fbo := m.findOptions(options)
+	space, err := newSearchSpace(m.scan, template, fbo.EdgeIgnore, fbo.BlurRadius, fbo.Edges, fbo.Comparator)
+	if err != nil {
+		return nil, err
 	}
-	if fbo.Threshold == 0 {
-		fbo.Threshold = 100.0
+
+	ctx, cancel := context.WithTimeout(context.Background(), fbo.Timeout)
+	defer cancel()
+	matches, err := scanAll(ctx, space.scan.Width-space.template.Width, space.scan.Height-space.template.Height, fbo.Threshold, space.mse)
+	if err != nil {
+		return nil, err
 	}
-	if fbo.Timeout == 0 {
-		fbo.Timeout = 500 * time.Millisecond
+	matches = suppressOverlapping(matches, template.Width, template.Height)
+
+	render, err := m.scan.ConvertTo(24)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy the scan: %w", err)
 	}
+	for _, match := range matches {
+		rect := image.Rect(match.X, match.Y, match.X+template.Width, match.Y+template.Height)
+		if err := drawBorder(render, rect, debugBorderThickness, 255, 0, 0); err != nil {
+			return nil, err
+		}
+	}
+	return render, nil
+}
+
+// debugBorderThickness is the width in pixels of the borders DebugRender draws around matches.
+const debugBorderThickness = 2
+
+func (m *matcher) FindTemplate(template display.BMP, options ...FindBuilderOption) (int, int, error) {
+	fbo := m.findOptions(options)
+	// subpixel refinement only applies to FindTemplateSubpixel, integer coordinates are never refined
+	fbo.Subpixel = false
 
-	if err := validateBMPDimensions(m.scan, template); err != nil {
+	x, y, _, match, err := m.findTemplateAngles(m.scan, template, fbo)
+	if err != nil {
 		return 0, 0, err
 	}
+	if fbo.CenterResult {
+		return int(x) + match.bmp.Width/2, int(y) + match.bmp.Height/2, nil
+	}
+	return int(x), int(y), nil
+}
 
-	largeData, smallData := normalizeBMPData(m.scan), normalizeBMPData(template)
+func (m *matcher) FindTemplateConfidence(template display.BMP, options ...FindBuilderOption) (int, int, float64, error) {
+	fbo := m.findOptions(options)
+	fbo.Subpixel = false
 
-	largeBytesPerPixel := tools.CalcBytesPerPixel(int(m.scan.InfoHeader.BiBitCount))
-	smallBytesPerPixel := tools.CalcBytesPerPixel(int(template.InfoHeader.BiBitCount))
-	largeRowSize := ((m.scan.Width*largeBytesPerPixel + 3) / 4) * 4
-	smallRowSize := ((template.Width*smallBytesPerPixel + 3) / 4) * 4
+	x, y, confidence, match, err := m.findTemplateAngles(m.scan, template, fbo)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if fbo.CenterResult {
+		return int(x) + match.bmp.Width/2, int(y) + match.bmp.Height/2, confidence, nil
+	}
+	return int(x), int(y), confidence, nil
+}
 
-	integralImage := buildIntegralImageSq(largeData, m.scan.Width, m.scan.Height, largeRowSize, largeBytesPerPixel)
-	chunks := chunkBMP(m.scan, template.Width, template.Height)
+func (m *matcher) FindTemplateRect(template display.BMP, options ...FindBuilderOption) (image.Rectangle, error) {
+	fbo := m.findOptions(options)
+	fbo.Subpixel = false
 
-	numWorkers := tools.Max(runtime.NumCPU()-1, 1)
-	chunkGroups := splitChunksForWorkers(chunks, numWorkers)
-	if numWorkers > m.pool.GetMaxWorkers() {
-		diff := numWorkers - m.pool.GetMaxWorkers()
-		m.pool.IncreaseMaxWorkers(diff)
+	x, y, _, match, err := m.findTemplateAngles(m.scan, template, fbo)
+	if err != nil {
+		return image.Rectangle{}, err
 	}
-	if !m.pool.IsWorking() {
-		m.pool.Start()
+	return image.Rect(int(x), int(y), int(x)+match.bmp.Width, int(y)+match.bmp.Height), nil
+}
+
+func (m *matcher) FindTemplateRotated(template display.BMP, options ...FindBuilderOption) (int, int, int, error) {
+	fbo := m.findOptions(options)
+	fbo.Subpixel = false
+
+	x, y, _, match, err := m.findTemplateAngles(m.scan, template, fbo)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if fbo.CenterResult {
+		return int(x) + match.bmp.Width/2, int(y) + match.bmp.Height/2, match.angle, nil
 	}
+	return int(x), int(y), match.angle, nil
+}
 
-	resultChan := make(chan struct {
-		X int
-		Y int
-	}, 1)
-	matchFound := int32(0)
-	var closeOnce sync.Once
-	closeResultChan := func() {
-		close(resultChan)
+func (m *matcher) FindTemplateTiled(tiles []TileBMP, template display.BMP, options ...FindBuilderOption) (int, int, error) {
+	fbo := m.findOptions(options)
+	fbo.Subpixel = false
+	if err := validateTiles(tiles, template); err != nil {
+		return 0, 0, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), fbo.Timeout)
-	defer cancel()
-	defer m.pool.Stop()
-	defer closeOnce.Do(closeResultChan)
-
-	sumTemplateSq := 0.0
-	for row := range template.Height {
-		smallRowStart := row * smallRowSize
-		for col := range template.Width {
-			smallPixelStart := smallRowStart + col*smallBytesPerPixel
-			smallR := float64(smallData[smallPixelStart])
-			smallG := float64(smallData[smallPixelStart+1])
-			smallB := float64(smallData[smallPixelStart+2])
-			sumTemplateSq += smallR*smallR + smallG*smallG + smallB*smallB
+	deadline := time.Now().Add(fbo.Timeout)
+	found := false
+	var matchX, matchY int
+	noMatch := &NoMatchError{}
+	for _, tile := range tiles {
+		// a tile smaller than the template can not contain a match, the overlap with its neighbours covers its windows
+		if tile.BMP.Width < template.Width || tile.BMP.Height < template.Height {
+			continue
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		tileOptions := *fbo
+		tileOptions.Timeout = remaining
+
+		// every tile was validated up front, so an error here means the tile holds no match
+		x, y, _, err := m.findTemplate(tile.BMP, template, &tileOptions)
+		if err != nil {
+			noMatch = closerNearMiss(noMatch, err, image.Pt(tile.X, tile.Y))
+			continue
+		}
+		tileX, tileY := tile.X+int(x), tile.Y+int(y)
+		if !found || tileY < matchY || (tileY == matchY && tileX < matchX) {
+			matchX, matchY = tileX, tileY
+		}
+		found = true
+		if !fbo.ReadingOrder {
+			break
 		}
 	}
 
-	// Submit tasks to the worker pool
-	submitTasks(m.pool, chunkGroups, resultChan, &matchFound, largeData, smallData, largeRowSize, smallRowSize, largeBytesPerPixel, smallBytesPerPixel, template.Width, template.Height, fbo.Threshold, ctx, sumTemplateSq, integralImage)
+	if !found {
+		noMatch.Timeout = time.Now().After(deadline)
+		return 0, 0, noMatch
+	}
+	if fbo.CenterResult {
+		return matchX + template.Width/2, matchY + template.Height/2, nil
+	}
+	return matchX, matchY, nil
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return 0, 0, fmt.Errorf("no match found - timeout")
-		case res := <-resultChan:
-			return res.X, res.Y, nil
-		}
+func (m *matcher) FindTemplateSubpixel(template display.BMP, options ...FindBuilderOption) (float64, float64, error) {
+	fbo := m.findOptions(options)
+	x, y, _, match, err := m.findTemplateAngles(m.scan, template, fbo)
+	if err != nil {
+		return 0, 0, err
+	}
+	if fbo.CenterResult {
+		return x + float64(match.bmp.Width-1)/2, y + float64(match.bmp.Height-1)/2, nil
 	}
+	return x, y, nil
+}
+
+func (m *matcher) FindTemplateBytes(data []byte, options ...FindBuilderOption) (int, int, error) {
+	template, err := display.LoadImage(data)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load template: %w", err)
+	}
+	return m.FindTemplate(*template, options...)
 }
 
 func (m *matcher) SetScan(bmp display.BMP) {
 	m.pool.ClearTaskQueue()
 	m.pool.Stop()
+	// a task a concurrent search was still submitting when the queue was cleared is only discarded once a worker dequeues it,
+	// so the pool is started again before waiting, otherwise Wait would block on it forever
+	m.pool.Start()
 	m.pool.Wait()
 
 	m.scan = bmp
-	m.pool.Start()
+}
+
+func (m *matcher) Close() {
+	m.pool.Close()
+}
+
+func (m *matcher) SetThreshold(threshold float64) {
+	m.defaultsMu.Lock()
+	defer m.defaultsMu.Unlock()
+	m.threshold = max(threshold, 0)
+}
+
+func (m *matcher) SetTimeout(timeout time.Duration) {
+	m.defaultsMu.Lock()
+	defer m.defaultsMu.Unlock()
+	m.timeout = max(timeout, 0)
+}
+
+// findOptions builds the options of a search from the defaults set on the matcher and the given options, which take precedence over them.
+//
+// Parameters:
+//   - options: The options given to the search.
+//
+// Returns:
+//   - *findBuilderOption: The resulting find options.
+func (m *matcher) findOptions(options []FindBuilderOption) *findBuilderOption {
+	m.defaultsMu.Lock()
+	defaults := []FindBuilderOption{ThresholdOpt(m.threshold), TimeoutOpt(m.timeout)}
+	m.defaultsMu.Unlock()
+	return buildFindOptions(append(defaults, options...))
+}
+
+// buildFindOptions applies the given options on top of the default find options.
+//
+// Parameters:
+//   - options: The options to apply.
+//
+// Returns:
+//   - *findBuilderOption: The resulting find options.
+func buildFindOptions(options []FindBuilderOption) *findBuilderOption {
+	fbo := &findBuilderOption{}
+	for _, opt := range options {
+		opt(fbo)
+	}
+	if fbo.Threshold == 0 {
+		fbo.Threshold = 100.0
+	}
+	if fbo.Timeout == 0 {
+		fbo.Timeout = 500 * time.Millisecond
+	}
+	if fbo.ChunkConcurrency == 0 {
+		fbo.ChunkConcurrency = runtime.NumCPU()
+	}
+	if fbo.UseMinConfidence {
+		fbo.Threshold = thresholdFromConfidence(fbo.MinConfidence)
+	}
+	return fbo
+}
+
+// findTemplateAngles runs the template search at each rotation of the template given with AnglesOpt, and returns the first one that matches.
+// Without any rotations the template is searched for as is.
+//
+// Parameters:
+//   - scan: The larger BMP to search in.
+//   - template: The smaller BMP image (template) to search for.
+//   - fbo: The find options to use for the search, the timeout applies to all of the rotations together.
+//
+// Returns:
+//   - (x, y): The top-left coordinates of the match in the larger BMP.
+//   - float64: The confidence of the match at its integer coordinates.
+//   - rotatedTemplate: The rotation of the template that matched.
+//   - error: An error if a rotation is invalid, no match is found or if the search fails.
+func (m *matcher) findTemplateAngles(scan, template display.BMP, fbo *findBuilderOption) (float64, float64, float64, rotatedTemplate, error) {
+	if len(fbo.Angles) == 0 {
+		x, y, confidence, err := m.findTemplate(scan, template, fbo)
+		return x, y, confidence, rotatedTemplate{bmp: template}, err
+	}
+	rotations, err := rotateTemplate(scan, template, fbo.Angles)
+	if err != nil {
+		return 0, 0, 0, rotatedTemplate{}, err
+	}
+
+	deadline := time.Now().Add(fbo.Timeout)
+	noMatch := &NoMatchError{}
+	for _, rotation := range rotations {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		rotationOptions := *fbo
+		rotationOptions.Timeout = remaining
+
+		// every rotation was validated up front, so an error here means the rotation holds no match
+		x, y, confidence, err := m.findTemplate(scan, rotation.bmp, &rotationOptions)
+		if err == nil {
+			return x, y, confidence, rotation, nil
+		}
+		noMatch = closerNearMiss(noMatch, err, image.Point{})
+	}
+	noMatch.Timeout = time.Now().After(deadline)
+	return 0, 0, 0, rotatedTemplate{}, noMatch
+}
+
+// findTemplate runs the template search with the given options, either on the worker pool or sequentially if the search is deterministic.
+// If subpixel refinement is enabled, the integer match is refined to fractional coordinates before being returned.
+//
+// Parameters:
+//   - scan: The larger BMP to search in.
+//   - template: The smaller BMP image (template) to search for.
+//   - fbo: The find options to use for the search.
+//
+// Returns:
+//   - (x, y): The top-left coordinates of the match in the larger BMP.
+//   - float64: The confidence of the match at its integer coordinates.
+//   - error: An error if no match is found or if the search fails.
+func (m *matcher) findTemplate(scan, template display.BMP, fbo *findBuilderOption) (float64, float64, float64, error) {
+	space, err := newSearchSpace(scan, template, fbo.EdgeIgnore, fbo.BlurRadius, fbo.Edges, fbo.Comparator)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	// the scan and template may have been cropped to their interiors, see EdgeIgnoreOpt
+	width, height := template.Width, template.Height
+	scan, template = space.scan, space.template
+	mse := space.mse
+
+	ctx, cancel := context.WithTimeout(context.Background(), fbo.Timeout)
+	defer cancel()
+
+	miss := &nearMiss{}
+	noMatch := func(timeout bool) error {
+		return miss.toError(timeout, width, height, mse)
+	}
+
+	var x, y int
+	if fbo.Deterministic {
+		var found bool
+		x, y, found = scanSequential(ctx, scan.Width-template.Width, scan.Height-template.Height, fbo.Threshold, mse, miss)
+		if !found {
+			return 0, 0, 0, noMatch(ctx.Err() != nil)
+		}
+	} else {
+		// one task per chunk, the pool hands them to whichever worker is free so a region that is expensive to scan does not leave the other workers idle
+		chunks := interleaveChunks(chunkBMP(scan, template.Width, template.Height, fbo.ChunkConcurrency))
+
+		numWorkers := tools.Max(runtime.NumCPU()-1, 1)
+		if numWorkers > m.pool.GetMaxWorkers() {
+			diff := numWorkers - m.pool.GetMaxWorkers()
+			m.pool.IncreaseMaxWorkers(diff)
+		}
+		// the pool is stopped at the end of every search, so resume it, Start does nothing if it is already running
+		m.pool.Start()
+
+		resultChan := make(chan struct {
+			X int
+			Y int
+		}, 1)
+		matchFound := int32(0)
+		var closeOnce sync.Once
+		closeResultChan := func() {
+			close(resultChan)
+		}
+
+		defer m.pool.Stop()
+		defer closeOnce.Do(closeResultChan)
+
+		// in reading order mode the tasks record the earliest match instead of stopping at the first one, and the search waits for all of them to finish
+		var best *atomic.Int64
+		if fbo.ReadingOrder {
+			best = &atomic.Int64{}
+			best.Store(math.MaxInt64)
+		}
+		// the search also ends once every task has finished, so a scan without a match does not wait out the whole timeout
+		wg := &sync.WaitGroup{}
+		wg.Add(len(chunks))
+
+		// Submit tasks to the worker pool
+		submitTasks(m.pool, chunks, resultChan, &matchFound, template.Width, template.Height, fbo.Threshold, ctx, mse, best, miss, wg)
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+
+		if fbo.ReadingOrder {
+			select {
+			case <-ctx.Done():
+				return 0, 0, 0, noMatch(true)
+			case <-done:
+			}
+
+			key := best.Load()
+			if key == math.MaxInt64 {
+				return 0, 0, 0, noMatch(false)
+			}
+			x, y = int(key&math.MaxUint32), int(key>>32)
+		} else {
+			select {
+			case <-ctx.Done():
+				return 0, 0, 0, noMatch(true)
+			case res := <-resultChan:
+				x, y = res.X, res.Y
+			case <-done:
+				// a task sends its match before it is marked done, so a match found by the last task is already waiting
+				select {
+				case res := <-resultChan:
+					x, y = res.X, res.Y
+				default:
+					return 0, 0, 0, noMatch(false)
+				}
+			}
+		}
+	}
+
+	confidence := confidenceFromMSE(mse(x, y, math.Inf(1)))
+	if !fbo.Subpixel {
+		return float64(x), float64(y), confidence, nil
+	}
+	refinedX, refinedY := refineSubpixel(x, y, scan.Width-template.Width, scan.Height-template.Height, func(x, y int) float64 {
+		return mse(x, y, math.Inf(1))
+	})
+	return refinedX, refinedY, confidence, nil
 }
@@ -5,6 +5,24 @@ import "time"
 type findBuilderOption struct {
 	Threshold float64
 	Timeout   time.Duration
+	Subpixel  bool
+
+	Deterministic bool
+	ReadingOrder  bool
+	EdgeIgnore    int
+
+	ChunkConcurrency int
+	CenterResult     bool
+
+	MinConfidence    float64
+	UseMinConfidence bool // whether MinConfidence was set, it takes precedence over Threshold
+
+	Angles []int // clockwise rotations of the template to try in order, in degrees, none to only try the template as is
+
+	BlurRadius float64 // the radius of the Gaussian blur applied to the scan and the template before matching, zero for no blur
+	Edges      bool    // whether the scan and the template are matched by their Sobel edges rather than their colors
+
+	Comparator func(window, template []byte) float64 // scores each window instead of the normalized MSE, nil for the normalized MSE
 }
 
 // FindBuilderOption is the builder option function for matcher package and it's associated uses.
@@ -13,6 +31,7 @@ type FindBuilderOption func(*findBuilderOption)
 // ThresholdOpt sets the threshold for the MSE matching algorithm.
 // This can be configured so that matches require less certainty or more to return a result.
 // Depending on the size of the template and the scan, this can be as low as 10.0 or as high as 5000.0.
+// ConfidenceOpt is a size-independent alternative that transfers across templates, and takes precedence over this option.
 //
 // Parameters:
 //   - threshold: The threshold value for the MSE matching algorithm. This is a float64 value that determines how strict the matching should be.
@@ -34,3 +53,133 @@ func TimeoutOpt(timeout time.Duration) FindBuilderOption {
 		opts.Timeout = timeout
 	}
 }
+
+// SubpixelOpt enables subpixel refinement of the match for FindTemplateSubpixel.
+// After the integer match is found, the neighboring offsets are evaluated and a parabola is fitted to the MSE surface on each axis,
+// which gives a fractional coordinate for the match. This is useful for precise clicking on scaled displays where one logical pixel spans several physical ones.
+// It has no effect on FindTemplate, which always returns integer coordinates.
+func SubpixelOpt() FindBuilderOption {
+	return func(opts *findBuilderOption) {
+		opts.Subpixel = true
+	}
+}
+
+// DeterministicOpt disables the worker pool for the search and scans the windows sequentially in reading order instead.
+// The first window under the threshold, scanning top to bottom then left to right, is returned, so the result is the same on every run.
+// This is slower than the default parallel search, but it is useful for debugging and for writing reliable tests around matching.
+func DeterministicOpt() FindBuilderOption {
+	return func(opts *findBuilderOption) {
+		opts.Deterministic = true
+	}
+}
+
+// FirstInReadingOrderOpt makes the search return the top-most, then left-most match instead of whichever match a worker finds first.
+// The search keeps running until every worker has finished rather than stopping at the first match, so it trades some latency for a predictable result.
+// This matters when several identical elements are on screen and the caller expects the "first" one.
+func FirstInReadingOrderOpt() FindBuilderOption {
+	return func(opts *findBuilderOption) {
+		opts.ReadingOrder = true
+	}
+}
+
+// EdgeIgnoreOpt masks out a border around the template from the MSE computation, so only the template interior is matched.
+// This handles anti-aliasing at element borders, where the edge pixels blend the element into a background that varies between captures.
+// The pixel count and normalization of the MSE only account for the interior, and the returned coordinates are still those of the full template.
+//
+// Parameters:
+//   - pixels: The width of the border to ignore on every side of the template, the template must be larger than twice this value on both axes.
+func EdgeIgnoreOpt(pixels int) FindBuilderOption {
+	return func(opts *findBuilderOption) {
+		opts.EdgeIgnore = max(pixels, 0)
+	}
+}
+
+// ChunkConcurrencyOpt limits how many rows of chunks are laid out concurrently while the scan is being split up.
+// Every row is handled by its own goroutine, so a lower limit reduces scheduler pressure on very tall captures at the cost of a slower split.
+// The chunks produced are the same regardless of the limit, it defaults to the number of CPUs.
+//
+// Parameters:
+//   - n: The maximum number of rows to extract concurrently, values less than 1 are treated as 1.
+func ChunkConcurrencyOpt(n int) FindBuilderOption {
+	return func(opts *findBuilderOption) {
+		opts.ChunkConcurrency = max(n, 1)
+	}
+}
+
+// CenterResultOpt makes the search return the center of the match instead of its top-left corner, so the result can be passed straight to mouse.Move.
+// The center is the top-left corner plus half the template size, for FindTemplateSubpixel it is the exact center pixel position (x + (width-1)/2),
+// and FindTemplate returns that position rounded, which is x + width/2.
+func CenterResultOpt() FindBuilderOption {
+	return func(opts *findBuilderOption) {
+		opts.CenterResult = true
+	}
+}
+
+// ConfidenceOpt sets the minimum confidence a match must have, as a size-independent alternative to ThresholdOpt.
+// The confidence of a match is 1 minus its MSE normalized by the energy of the template and the matched window, clamped to [0, 1],
+// so 1 is a perfect match and the same minimum works for templates of any size. It takes precedence over ThresholdOpt.
+//
+// Parameters:
+//   - minConfidence: The minimum confidence of a match, in [0, 1]. Values outside of the range are clamped.
+func ConfidenceOpt(minConfidence float64) FindBuilderOption {
+	return func(opts *findBuilderOption) {
+		opts.MinConfidence = min(max(minConfidence, 0), 1)
+		opts.UseMinConfidence = true
+	}
+}
+
+// AnglesOpt searches for the template at each of the given rotations in order, and returns the first rotation that matches.
+// This finds elements that appear rotated, such as a loading indicator or an icon in a rotated panel, without a template for every rotation.
+// Only multiples of 90 degrees are supported, the template is rotated exactly with display.BMP.Rotate, and a rotation that does not fit in the scan is skipped.
+// The timeout applies to the search as a whole, not to each rotation. The rotation of the match is reported by FindTemplateRotated,
+// and the other searches account for it in their results, such as the rectangle of FindTemplateRect. It has no effect on DebugRender and FindTemplateTiled.
+//
+// Parameters:
+//   - angles: The clockwise rotations of the template to try, in degrees, such as []int{0, 90, 180, 270}.
+func AnglesOpt(angles []int) FindBuilderOption {
+	return func(opts *findBuilderOption) {
+		opts.Angles = angles
+	}
+}
+
+// BlurOpt blurs the scan and the template identically with display.BMP.GaussianBlur before they are compared.
+// This smooths out rendering jitter, such as anti-aliasing, font hinting and subpixel differences between machines, so genuine matches get a lower MSE.
+// The blur also lowers the MSE of near misses, so a stricter threshold may be needed. The scan is blurred on every search, which adds to its duration.
+//
+// Parameters:
+//   - radius: The standard deviation of the Gaussian in pixels, around 1 is usually enough. Zero or less disables the blur.
+func BlurOpt(radius float64) FindBuilderOption {
+	return func(opts *findBuilderOption) {
+		opts.BlurRadius = max(radius, 0)
+	}
+}
+
+// EdgeMatchOpt matches the edges of the scan and the template computed with display.BMP.SobelEdges instead of their colors,
+// which matches on the structure of a control rather than its colors, such as a button whose fill changes between a light and a dark theme.
+// Edges are computed after any blur, which also suppresses the edges of noise. Flat areas have no edges and match anything flat,
+// so a template needs some outline or text to be told apart. Edges are computed for the scan on every search, which adds to its duration.
+func EdgeMatchOpt() FindBuilderOption {
+	return func(opts *findBuilderOption) {
+		opts.Edges = true
+	}
+}
+
+// ComparatorOpt replaces the normalized MSE with a custom comparison, which turns the matcher into a parallel template search for any metric,
+// such as one over edge maps or feature descriptors. The chunking, worker pool, thresholding, timeout and every other option work the same way.
+// The comparator is called with the window of the scan and the template as tightly packed rows of 3 bytes per pixel, top to bottom,
+// in the blue, green, red order of a BMP, after any blur, edge detection and edge ignore were applied. It must return a score where lower is better,
+// be safe for concurrent use, and must not keep or modify the slices, the window buffer is reused.
+// A window matches when its score is at or below the threshold of ThresholdOpt, so the threshold must be set on the scale of the comparator.
+// Confidences, such as those of ConfidenceOpt and FindTemplateConfidence, are 1 minus the score, so they are only meaningful for scores in [0, 1].
+//
+// NOTE: The normalized MSE rejects most windows from precomputed integral images without reading their pixels, and stops comparing a window once it exceeds the threshold.
+// Neither shortcut applies to a comparator, every pixel of every window is copied and passed to it, so expect a search to be many times slower.
+// Narrowing the scan, such as with a bounded capture, helps the most.
+//
+// Parameters:
+//   - fn: The comparator, given the window and the template, returning the score of the window.
+func ComparatorOpt(fn func(window, template []byte) float64) FindBuilderOption {
+	return func(opts *findBuilderOption) {
+		opts.Comparator = fn
+	}
+}
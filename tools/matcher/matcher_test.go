@@ -0,0 +1,259 @@
+package matcher
+
+import (
+	"testing"
+
+	"github.com/Carmen-Shannon/automation/device/display"
+	"github.com/Carmen-Shannon/automation/tools/worker"
+)
+
+// noiseBMP creates a BMP filled with pseudo-random noise from the given seed, so no window of it other than its own matches it closely.
+func noiseBMP(tb testing.TB, width, height int, seed uint32) *display.BMP {
+	tb.Helper()
+	bmp := display.NewBMP(width, height, 0, 0, 0)
+	for py := range height {
+		for px := range width {
+			seed = seed*1664525 + 1013904223
+			if err := bmp.SetPixel(px, py, uint8(seed>>24), uint8(seed>>16), uint8(seed>>8)); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	return bmp
+}
+
+// pastedScene creates a noise scan with a noise template of the given size pasted into it at the given position.
+func pastedScene(tb testing.TB, width, height, x, y, templateWidth, templateHeight int) (*display.BMP, *display.BMP) {
+	tb.Helper()
+	scan := noiseBMP(tb, width, height, 1)
+	template := noiseBMP(tb, templateWidth, templateHeight, 2)
+	if err := scan.Paste(template, x, y); err != nil {
+		tb.Fatal(err)
+	}
+	return scan, template
+}
+
+// checkChunkCoverage fails the test unless every window position of a template of the given size lies entirely within one of the chunks.
+func checkChunkCoverage(t *testing.T, chunks []chunk, scan display.BMP, templateWidth, templateHeight int) {
+	t.Helper()
+	for y := 0; y <= scan.Height-templateHeight; y++ {
+		for x := 0; x <= scan.Width-templateWidth; x++ {
+			covered := false
+			for _, c := range chunks {
+				if x >= c.X && y >= c.Y && x+templateWidth <= c.X+c.Width && y+templateHeight <= c.Y+c.Height {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				t.Fatalf("the window at %d, %d is not covered by any of the %d chunks", x, y, len(chunks))
+			}
+		}
+	}
+}
+
+// benchScene creates a scan filled with pseudo-random noise, so no window other than the template's own matches it closely,
+// and cuts the template out of it at the given position.
+func benchScene(b *testing.B, width, height, x, y, size int) (*display.BMP, *display.BMP) {
+	b.Helper()
+	scan := noiseBMP(b, width, height, 1)
+	template := display.NewBMP(size, size, 0, 0, 0)
+	for py := range size {
+		for px := range size {
+			r, g, bl, err := scan.Pixel(x+px, y+py)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := template.SetPixel(px, py, r, g, bl); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	return scan, template
+}
+
+func BenchmarkFind(b *testing.B) {
+	const wantX, wantY = 411, 287
+	scan, template := benchScene(b, 640, 480, wantX, wantY, 32)
+
+	benchmarks := []struct {
+		name    string
+		options []FindBuilderOption
+	}{
+		{name: "pool", options: []FindBuilderOption{ConfidenceOpt(0.95)}},
+		{name: "deterministic", options: []FindBuilderOption{ConfidenceOpt(0.95), DeterministicOpt()}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			m := NewMatcher(*scan)
+			x, y, err := m.FindTemplate(*template, bm.options...)
+			if err != nil || x != wantX || y != wantY {
+				b.Fatalf("FindTemplate() = %d, %d, %v, want %d, %d, nil", x, y, err, wantX, wantY)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				if _, _, err := m.FindTemplate(*template, bm.options...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestMatcherCloseStopsPool(t *testing.T) {
+	m := NewMatcher(*display.NewBMP(64, 64, 0, 0, 0)).(*matcher)
+	if _, _, err := m.FindTemplate(*display.NewBMP(8, 8, 0, 0, 0)); err != nil {
+		t.Fatalf("FindTemplate() error = %v", err)
+	}
+
+	m.Close()
+	m.Close()
+	if got := m.pool.Stats().Workers; got != 0 {
+		t.Errorf("%d workers are still running after Close", got)
+	}
+	if m.pool.TrySubmitTask(worker.Task{Do: func() (any, error) { return nil, nil }}) {
+		t.Error("the pool still accepts tasks after Close")
+	}
+}
+
+func TestChunkBMPWideTemplate(t *testing.T) {
+	// the template is about 40% of the scan width, wider than a chunk sized from the scan alone would be
+	const wantX, wantY = 115, 50
+	scan, template := pastedScene(t, 200, 100, wantX, wantY, 80, 30)
+
+	chunks := chunkBMP(*scan, template.Width, template.Height, 4)
+	if len(chunks) == 0 {
+		t.Fatal("chunkBMP() returned no chunks")
+	}
+	for _, c := range chunks {
+		if c.Width < template.Width || c.Height < template.Height {
+			t.Errorf("chunk %+v is smaller than the %dx%d template", c, template.Width, template.Height)
+		}
+	}
+	checkChunkCoverage(t, chunks, *scan, template.Width, template.Height)
+
+	m := NewMatcher(*scan)
+	defer m.Close()
+	x, y, err := m.FindTemplate(*template, ConfidenceOpt(0.95))
+	if err != nil || x != wantX || y != wantY {
+		t.Errorf("FindTemplate() = %d, %d, %v, want %d, %d, nil", x, y, err, wantX, wantY)
+	}
+}
+
+func TestThinTemplates(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		x, y          int
+	}{
+		{name: "1x50", width: 1, height: 50, x: 130, y: 70},
+		{name: "50x1", width: 50, height: 1, x: 140, y: 120},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scan, template := pastedScene(t, 200, 150, tt.x, tt.y, tt.width, tt.height)
+
+			chunks := chunkBMP(*scan, tt.width, tt.height, 4)
+			// chunks sized from the thin side of the template alone would split the scan into dozens of slivers
+			if len(chunks) > 16 {
+				t.Errorf("chunkBMP() split the scan into %d chunks, want at most 16", len(chunks))
+			}
+			checkChunkCoverage(t, chunks, *scan, tt.width, tt.height)
+
+			for _, options := range [][]FindBuilderOption{
+				{ConfidenceOpt(0.95)},
+				{ConfidenceOpt(0.95), DeterministicOpt()},
+			} {
+				m := NewMatcher(*scan)
+				x, y, err := m.FindTemplate(*template, options...)
+				m.Close()
+				if err != nil || x != tt.x || y != tt.y {
+					t.Errorf("FindTemplate() = %d, %d, %v, want %d, %d, nil", x, y, err, tt.x, tt.y)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkFindLastChunk places the match in the chunk submitted last, the worst case for a search that hands out chunks in submission order.
+func BenchmarkFindLastChunk(b *testing.B) {
+	const width, height, size = 640, 480, 32
+	chunks := interleaveChunks(chunkBMP(*display.NewBMP(width, height, 0, 0, 0), size, size, 1))
+	last := chunks[len(chunks)-1]
+	wantX, wantY := last.X+last.Width-size, last.Y+last.Height-size
+	scan, template := benchScene(b, width, height, wantX, wantY, size)
+
+	m := NewMatcher(*scan)
+	defer m.Close()
+	x, y, err := m.FindTemplate(*template, ConfidenceOpt(0.95))
+	if err != nil || x != wantX || y != wantY {
+		b.Fatalf("FindTemplate() = %d, %d, %v, want %d, %d, nil", x, y, err, wantX, wantY)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if _, _, err := m.FindTemplate(*template, ConfidenceOpt(0.95)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestEdgeMatch(t *testing.T) {
+	const wantX, wantY = 57, 34
+	scan := noiseBMP(t, 120, 80, 1)
+	// the template is the same region rendered in inverted colors, like a control switching between a light and a dark theme
+	template := display.NewBMP(24, 16, 0, 0, 0)
+	for py := range template.Height {
+		for px := range template.Width {
+			r, g, b, err := scan.Pixel(wantX+px, wantY+py)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := template.SetPixel(px, py, 255-r, 255-g, 255-b); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	m := NewMatcher(*scan)
+	defer m.Close()
+	if x, y, err := m.FindTemplate(*template, ConfidenceOpt(0.9)); err == nil {
+		t.Errorf("FindTemplate() of the inverted colors = %d, %d, nil, want no match", x, y)
+	}
+	// the template edges repeat its border pixels instead of seeing the scan around it, so the border is left out
+	for _, options := range [][]FindBuilderOption{
+		{EdgeMatchOpt(), EdgeIgnoreOpt(1), ConfidenceOpt(0.9)},
+		{EdgeMatchOpt(), EdgeIgnoreOpt(1), ConfidenceOpt(0.9), BlurOpt(1)},
+	} {
+		x, y, err := m.FindTemplate(*template, options...)
+		if err != nil || x != wantX || y != wantY {
+			t.Errorf("FindTemplate() = %d, %d, %v, want %d, %d, nil", x, y, err, wantX, wantY)
+		}
+	}
+}
+
+func TestEdgeMatchComparatorInput(t *testing.T) {
+	scan := display.NewBMP(16, 16, 200, 200, 200)
+	template := display.NewBMP(4, 4, 10, 10, 10)
+	// with edge matching the comparator sees edge magnitudes, which are zero everywhere in flat images of any color
+	comparator := func(window, template []byte) float64 {
+		for i := range window {
+			if window[i] != 0 || template[i] != 0 {
+				return 1
+			}
+		}
+		return 0
+	}
+
+	m := NewMatcher(*scan)
+	defer m.Close()
+	if _, _, err := m.FindTemplate(*template, ComparatorOpt(comparator), ThresholdOpt(0.5)); err == nil {
+		t.Error("FindTemplate() without EdgeMatchOpt matched the colors of a flat gray scan with a flat black template")
+	}
+	if _, _, err := m.FindTemplate(*template, EdgeMatchOpt(), ComparatorOpt(comparator), ThresholdOpt(0.5)); err != nil {
+		t.Errorf("FindTemplate() with EdgeMatchOpt error = %v, want the flat edges to match", err)
+	}
+}
@@ -1,9 +1,13 @@
 package matcher
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"image"
 	"math"
+	"slices"
 	"sync"
 	"sync/atomic"
 
@@ -12,10 +16,10 @@ import (
 	"github.com/Carmen-Shannon/automation/tools/worker"
 )
 
+// chunk is a region of the scan to search, it references the scan by position rather than holding a copy of its pixels.
 type chunk struct {
-	Data          []byte // pixel data for the chunk
-	X, Y          int    // top-left coordinates of the chunk in the original BMP
-	Width, Height int    // dimensions of the chunk
+	X, Y          int // top-left coordinates of the chunk in the original BMP
+	Width, Height int // dimensions of the chunk
 }
 
 // calculateMSE calculates the Mean Squared Error (MSE) between the current window in the larger BMP and the smaller BMP.
@@ -27,6 +31,9 @@ type chunk struct {
 //   - largeBytesPerPixel, smallBytesPerPixel: The bytes per pixel for the larger and smaller BMPs.
 //   - smallWidth, smallHeight: The dimensions of the smaller BMP.
 //   - normed: A boolean indicating whether to use normalized MSE (true) or regular MSE (false).
+//   - sumTemplateSq, sumTemplate: The sum of the squared pixel values and the sum of the pixel values of the smaller BMP.
+//   - integralImage, integralSum: The integral images of the squared pixel values and of the pixel values of the larger BMP.
+//   - mseThreshold: The threshold above which the calculation exits early, the returned value is then only known to exceed the threshold.
 //
 // Returns:
 //   - mse: The calculated Mean Squared Error.
@@ -36,17 +43,19 @@ func calculateMSE(
 	largeBytesPerPixel, smallBytesPerPixel,
 	smallWidth, smallHeight int,
 	normed bool,
-	sumTemplateSq float64,
-	integralImage [][]float64,
-	mseThreshold float64, // <-- Add this parameter
+	sumTemplateSq, sumTemplate float64,
+	integralImage, integralSum [][]float64,
+	mseThreshold float64,
 ) float64 {
 	var totalError float64
 	pixelCount := smallWidth * smallHeight
+	valueCount := float64(pixelCount * 3)
+	sumPatchSq := getPatchSumSq(integralImage, startX, startY, smallWidth, smallHeight)
+	sumPatch := getPatchSum(integralSum, startX, startY, smallWidth, smallHeight)
 
 	// For normalized, precompute denominator once per window
 	var denom float64
 	if normed {
-		sumPatchSq := getPatchSumSq(integralImage, startX, startY, smallWidth, smallHeight)
 		denom = math.Sqrt(sumTemplateSq * sumPatchSq)
 		const minDenom = 1e-6
 		if denom < minDenom {
@@ -54,6 +63,21 @@ func calculateMSE(
 		}
 	}
 
+	// the squared error of a window can not be lower than what the window and template sums alone allow, by Cauchy-Schwarz
+	// it is at least (sumPatch - sumTemplate)^2 / n, and by the triangle inequality at least (|patch| - |template|)^2,
+	// so windows whose bound already exceeds the threshold are rejected without comparing a single pixel
+	lowerBound := math.Max(
+		(sumPatch-sumTemplate)*(sumPatch-sumTemplate)/valueCount,
+		math.Pow(math.Sqrt(sumPatchSq)-math.Sqrt(sumTemplateSq), 2),
+	)
+	if normed {
+		if lowerBound > mseThreshold*denom {
+			return lowerBound / denom
+		}
+	} else if lowerBound > mseThreshold*valueCount {
+		return lowerBound / valueCount
+	}
+
 	for row := 0; row < smallHeight; row++ {
 		largeRowStart := (startY+row)*largeRowSize + startX*largeBytesPerPixel
 		smallRowStart := row * smallRowSize
@@ -89,121 +113,287 @@ func calculateMSE(
 	return totalError / denom
 }
 
+// searchSpace holds a scan and a template prepared for matching, with everything calculateMSE needs that does not depend on the window.
+type searchSpace struct {
+	scan, template display.BMP // the scan and template being matched, cropped to their interiors if edges are ignored
+
+	largeData, smallData                   []byte // top-down pixel data of the scan and the template
+	largeRowSize, smallRowSize             int
+	largeBytesPerPixel, smallBytesPerPixel int
+	sumTemplateSq, sumTemplate             float64
+	integralImage, integralSum             [][]float64
+
+	comparator     func(window, template []byte) float64 // the comparison set with ComparatorOpt, nil for the normalized MSE
+	packedTemplate []byte                                // the template as packed BGR rows, only prepared for a comparator
+	windows        sync.Pool                             // buffers the windows are packed into for the comparator, shared by the workers
+}
+
+// newSearchSpace validates the scan and the template, and prepares them for matching.
+//
+// Parameters:
+//   - scan: The larger BMP to search in.
+//   - template: The smaller BMP to search for.
+//   - edgeIgnore: The width of the border around the template to leave out of the match, see EdgeIgnoreOpt.
+//   - blurRadius: The radius of the Gaussian blur applied to both BMPs before matching, zero for no blur, see BlurOpt.
+//   - edges: Whether both BMPs are matched by their Sobel edges, see EdgeMatchOpt.
+//   - comparator: The comparison set with ComparatorOpt, nil for the normalized MSE.
+//
+// Returns:
+//   - *searchSpace: The prepared search space.
+//   - error: An error if either BMP is invalid, they can not be matched against each other, or the edge leaves no template interior.
+func newSearchSpace(scan, template display.BMP, edgeIgnore int, blurRadius float64, edges bool, comparator func(window, template []byte) float64) (*searchSpace, error) {
+	if err := scan.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scan: %w", err)
+	}
+	if err := template.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	if err := validateBMPDimensions(scan, template); err != nil {
+		return nil, err
+	}
+	if err := validatePixelFormats(scan, template); err != nil {
+		return nil, err
+	}
+
+	// both images are blurred before the edges are cropped, so the blur of the interior still takes the ignored border into account
+	if blurRadius > 0 {
+		blurredScan, err := scan.GaussianBlur(blurRadius)
+		if err != nil {
+			return nil, fmt.Errorf("failed to blur the scan: %w", err)
+		}
+		blurredTemplate, err := template.GaussianBlur(blurRadius)
+		if err != nil {
+			return nil, fmt.Errorf("failed to blur the template: %w", err)
+		}
+		scan, template = *blurredScan, *blurredTemplate
+	}
+	if edges {
+		scanEdges, err := scan.SobelEdges()
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute the edges of the scan: %w", err)
+		}
+		templateEdges, err := template.SobelEdges()
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute the edges of the template: %w", err)
+		}
+		scan, template = *scanEdges, *templateEdges
+	}
+
+	// ignoring the template edges matches the template interior against the scan inset by the same amount on every side,
+	// the interior offset is the same in both images so the match coordinates stay the same
+	if edgeIgnore > 0 {
+		if template.Width <= 2*edgeIgnore || template.Height <= 2*edgeIgnore {
+			return nil, fmt.Errorf("edge ignore of %d pixels leaves no template interior to match", edgeIgnore)
+		}
+		scan = cropBMP(scan, edgeIgnore, edgeIgnore, scan.Width-2*edgeIgnore, scan.Height-2*edgeIgnore)
+		template = cropBMP(template, edgeIgnore, edgeIgnore, template.Width-2*edgeIgnore, template.Height-2*edgeIgnore)
+	}
+
+	s := &searchSpace{
+		scan:               scan,
+		template:           template,
+		largeData:          normalizeBMPData(scan),
+		smallData:          normalizeBMPData(template),
+		largeBytesPerPixel: tools.CalcBytesPerPixel(int(scan.InfoHeader.BiBitCount)),
+		smallBytesPerPixel: tools.CalcBytesPerPixel(int(template.InfoHeader.BiBitCount)),
+	}
+	s.largeRowSize = ((scan.Width*s.largeBytesPerPixel + 3) / 4) * 4
+	s.smallRowSize = ((template.Width*s.smallBytesPerPixel + 3) / 4) * 4
+
+	// a comparator sees the pixels of every window as they are, so none of the sums calculateMSE prunes windows with are needed
+	if comparator != nil {
+		s.comparator = comparator
+		s.packedTemplate = packWindow(make([]byte, 0, template.Width*template.Height*3), s.smallData, 0, 0, template.Width, template.Height, s.smallRowSize, s.smallBytesPerPixel)
+		return s, nil
+	}
+
+	s.integralImage = buildIntegralImageSq(s.largeData, scan.Width, scan.Height, s.largeRowSize, s.largeBytesPerPixel)
+	s.integralSum = buildIntegralImage(s.largeData, scan.Width, scan.Height, s.largeRowSize, s.largeBytesPerPixel)
+
+	for row := range template.Height {
+		smallRowStart := row * s.smallRowSize
+		for col := range template.Width {
+			smallPixelStart := smallRowStart + col*s.smallBytesPerPixel
+			smallR := float64(s.smallData[smallPixelStart])
+			smallG := float64(s.smallData[smallPixelStart+1])
+			smallB := float64(s.smallData[smallPixelStart+2])
+			s.sumTemplateSq += smallR*smallR + smallG*smallG + smallB*smallB
+			s.sumTemplate += smallR + smallG + smallB
+		}
+	}
+	return s, nil
+}
+
+// mse calculates the normalized MSE of the template window at the given coordinates, exiting early once it exceeds the threshold.
+//
+// Parameters:
+//   - x, y: The top-left coordinates of the window in the scan.
+//   - threshold: The threshold above which the calculation exits early.
+//
+// Returns:
+//   - float64: The normalized MSE of the window.
+func (s *searchSpace) mse(x, y int, threshold float64) float64 {
+	if s.comparator != nil {
+		return s.compare(x, y)
+	}
+	return calculateMSE(
+		s.largeData, s.smallData,
+		x, y,
+		s.largeRowSize, s.smallRowSize,
+		s.largeBytesPerPixel, s.smallBytesPerPixel,
+		s.template.Width, s.template.Height, true, s.sumTemplateSq, s.sumTemplate, s.integralImage, s.integralSum, threshold,
+	)
+}
+
+// compare scores the template window at the given coordinates with the comparator set with ComparatorOpt.
+// The window is packed into a buffer of its own first, so unlike calculateMSE nothing is skipped, every pixel of every window is copied and compared.
+//
+// Parameters:
+//   - x, y: The top-left coordinates of the window in the scan.
+//
+// Returns:
+//   - float64: The score the comparator gave the window, lower is better.
+func (s *searchSpace) compare(x, y int) float64 {
+	buf, _ := s.windows.Get().(*[]byte)
+	if buf == nil {
+		buf = new([]byte)
+	}
+	*buf = packWindow((*buf)[:0], s.largeData, x, y, s.template.Width, s.template.Height, s.largeRowSize, s.largeBytesPerPixel)
+	score := s.comparator(*buf, s.packedTemplate)
+	s.windows.Put(buf)
+	return score
+}
+
+// packWindow appends a window of top-down pixel data to dst as tightly packed rows of 3 bytes per pixel, in the blue, green, red order of a BMP.
+// The fourth byte of a 32-bit pixel is left out, so 24-bit and 32-bit BMPs are packed the same way.
+//
+// Parameters:
+//   - dst: The buffer to append to.
+//   - data: The top-down pixel data.
+//   - x, y: The top-left coordinates of the window.
+//   - width, height: The dimensions of the window.
+//   - rowSize: The row size of the pixel data, including padding.
+//   - bytesPerPixel: The number of bytes per pixel of the pixel data, 3 or 4.
+//
+// Returns:
+//   - []byte: The buffer with the window appended.
+func packWindow(dst, data []byte, x, y, width, height, rowSize, bytesPerPixel int) []byte {
+	for row := range height {
+		rowStart := (y+row)*rowSize + x*bytesPerPixel
+		if bytesPerPixel == 3 {
+			dst = append(dst, data[rowStart:rowStart+width*3]...)
+			continue
+		}
+		for col := range width {
+			pixel := rowStart + col*bytesPerPixel
+			dst = append(dst, data[pixel:pixel+3]...)
+		}
+	}
+	return dst
+}
+
+// minChunkSize is the smallest width and height of a chunk, keeping the number of chunks reasonable for very thin templates.
+const minChunkSize = 32
+
 // chunkBMP divides a larger BMP into dynamically sized chunks based on the size of the smaller BMP.
 // Parameters:
 //   - largeBMP: The larger BMP to be divided.
 //   - smallWidth: The width of the smaller BMP.
 //   - smallHeight: The height of the smaller BMP.
+//   - maxConcurrency: The maximum number of rows of chunks to lay out concurrently.
 //
 // Returns:
 //   - []chunk: A list of chunks with their relative positions.
-func chunkBMP(largeBMP display.BMP, smallWidth, smallHeight int) []chunk {
-    bytesPerPixel := tools.CalcBytesPerPixel(int(largeBMP.InfoHeader.BiBitCount))
-    rowSize := ((largeBMP.Width*bytesPerPixel + 3) / 4) * 4
-
-    widthRatio := float64(largeBMP.Width) / float64(smallWidth)
-    heightRatio := float64(largeBMP.Height) / float64(smallHeight)
-
-    chunkWidth := int(float64(smallWidth) * math.Min(6, math.Max(2, widthRatio/4)))
-    chunkWidth = tools.Min(chunkWidth, largeBMP.Width/3)
-    chunkHeight := int(float64(smallHeight) * math.Min(6, math.Max(2, heightRatio/4)))
-    chunkHeight = tools.Min(chunkHeight, largeBMP.Height/3)
-
-    if largeBMP.Width < smallWidth*6 {
-        chunkWidth = largeBMP.Width
-    }
-    if largeBMP.Height < smallHeight*6 {
-        chunkHeight = largeBMP.Height
-    }
-
-    overlapX := tools.Max(smallWidth-1, int(float64(smallWidth)/math.Max(1.5, widthRatio/8)))
-    overlapY := tools.Max(smallHeight-1, int(float64(smallHeight)/math.Max(1.5, heightRatio/8)))
-    if chunkWidth == largeBMP.Width {
-        overlapX = smallWidth
-    }
-    if chunkHeight == largeBMP.Height {
-        overlapY = smallHeight
-    }
-
-    estimatedRows := (largeBMP.Height + chunkHeight - overlapY - 1) / (chunkHeight - overlapY)
-    allRowChunks := make([][]chunk, estimatedRows)
-
-    var wg sync.WaitGroup
-
-    rowIdx := 0
-    for y := 0; y < largeBMP.Height; y += chunkHeight - overlapY {
-        wg.Add(1)
-        go func(y, rowIdx int) {
-            defer wg.Done()
-            rowChunks := []chunk{}
-            localBuffer := make([]byte, chunkWidth*chunkHeight*bytesPerPixel)
-            for x := 0; x < largeBMP.Width; x += chunkWidth - overlapX {
-                actualChunkWidth := chunkWidth
-                if x+chunkWidth > largeBMP.Width {
-                    actualChunkWidth = largeBMP.Width - x
-                }
-                if actualChunkWidth < smallWidth {
-                    continue
-                }
-                actualChunkHeight := chunkHeight
-                if y+chunkHeight > largeBMP.Height {
-                    actualChunkHeight = largeBMP.Height - y
-                }
-                if actualChunkHeight < smallHeight {
-                    continue
-                }
-                chunkData := extractChunk(largeBMP.Data, x, y, actualChunkWidth, actualChunkHeight, rowSize, bytesPerPixel, localBuffer)
-                chunkCopy := make([]byte, len(chunkData))
-                copy(chunkCopy, chunkData)
-                rowChunks = append(rowChunks, chunk{
-                    Data:   chunkCopy,
-                    X:      x,
-                    Y:      y,
-                    Width:  actualChunkWidth,
-                    Height: actualChunkHeight,
-                })
-            }
-            allRowChunks[rowIdx] = rowChunks
-        }(y, rowIdx)
-        rowIdx++
-    }
-    wg.Wait()
-
-    // Flatten allRowChunks into a single slice
-    var chunks []chunk
-    for _, rowChunks := range allRowChunks {
-        chunks = append(chunks, rowChunks...)
-    }
-    return chunks
-}
-
-// extractChunk extracts the pixel data for a specific chunk from the larger BMP.
-// Parameters:
-//   - data: The pixel data of the larger BMP.
-//   - startX, startY: The top-left position of the chunk in the larger BMP.
-//   - chunkWidth, chunkHeight: The dimensions of the chunk.
-//   - rowSize: The row size of the larger BMP (including padding).
-//   - bytesPerPixel: The number of bytes per pixel in the larger BMP.
-//
-// Returns:
-//   - []byte: The pixel data for the chunk.
-func extractChunk(data []byte, startX, startY, chunkWidth, chunkHeight, rowSize, bytesPerPixel int, buffer []byte) []byte {
-	chunkSize := chunkWidth * chunkHeight * bytesPerPixel
-	if len(buffer) < chunkSize {
-		buffer = make([]byte, chunkSize)
+func chunkBMP(largeBMP display.BMP, smallWidth, smallHeight, maxConcurrency int) []chunk {
+	widthRatio := float64(largeBMP.Width) / float64(smallWidth)
+	heightRatio := float64(largeBMP.Height) / float64(smallHeight)
+
+	chunkWidth := int(float64(smallWidth) * math.Min(6, math.Max(2, widthRatio/4)))
+	chunkWidth = tools.Min(chunkWidth, largeBMP.Width/3)
+	chunkHeight := int(float64(smallHeight) * math.Min(6, math.Max(2, heightRatio/4)))
+	chunkHeight = tools.Min(chunkHeight, largeBMP.Height/3)
+
+	if largeBMP.Width < smallWidth*6 {
+		chunkWidth = largeBMP.Width
+	}
+	if largeBMP.Height < smallHeight*6 {
+		chunkHeight = largeBMP.Height
 	}
 
-	if startX*bytesPerPixel+chunkWidth*bytesPerPixel <= rowSize {
-		srcOffset := startY*rowSize + startX*bytesPerPixel
-		copy(buffer[:chunkSize], data[srcOffset:srcOffset+chunkSize])
-	} else {
-		for row := 0; row < chunkHeight; row++ {
-			srcOffset := (startY+row)*rowSize + startX*bytesPerPixel
-			dstOffset := row * chunkWidth * bytesPerPixel
-			copy(buffer[dstOffset:dstOffset+chunkWidth*bytesPerPixel], data[srcOffset:srcOffset+chunkWidth*bytesPerPixel])
-		}
+	// chunks are sized as a multiple of the template, which for a template a single pixel wide or tall would split the scan into slivers,
+	// so a chunk is never smaller than minChunkSize on either axis unless the scan itself is
+	chunkWidth = tools.Max(chunkWidth, tools.Min(minChunkSize, largeBMP.Width))
+	chunkHeight = tools.Max(chunkHeight, tools.Min(minChunkSize, largeBMP.Height))
+
+	// adjacent chunks must overlap by at least the template size minus one so that every window position is covered by some chunk
+	overlapX := tools.Max(smallWidth-1, int(float64(smallWidth)/math.Max(1.5, widthRatio/8)))
+	overlapY := tools.Max(smallHeight-1, int(float64(smallHeight)/math.Max(1.5, heightRatio/8)))
+
+	// a chunk must always fit the template plus the overlap, otherwise it would be skipped and the template could never match inside it,
+	// fall back to a single chunk spanning the whole scan on that axis when the template is too large relative to the scan
+	if chunkWidth < smallWidth+overlapX {
+		chunkWidth = tools.Min(smallWidth+overlapX, largeBMP.Width)
+	}
+	if chunkHeight < smallHeight+overlapY {
+		chunkHeight = tools.Min(smallHeight+overlapY, largeBMP.Height)
+	}
+	if chunkWidth == largeBMP.Width {
+		overlapX = smallWidth - 1
+	}
+	if chunkHeight == largeBMP.Height {
+		overlapY = smallHeight - 1
 	}
-	return buffer[:chunkSize]
+
+	estimatedRows := (largeBMP.Height + chunkHeight - overlapY - 1) / (chunkHeight - overlapY)
+	allRowChunks := make([][]chunk, estimatedRows)
+
+	var wg sync.WaitGroup
+	// bound the number of rows in flight so tall scans do not spawn a goroutine per row all at once
+	sem := make(chan struct{}, tools.Max(maxConcurrency, 1))
+
+	rowIdx := 0
+	for y := 0; y < largeBMP.Height; y += chunkHeight - overlapY {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(y, rowIdx int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			rowChunks := []chunk{}
+			for x := 0; x < largeBMP.Width; x += chunkWidth - overlapX {
+				actualChunkWidth := chunkWidth
+				if x+chunkWidth > largeBMP.Width {
+					actualChunkWidth = largeBMP.Width - x
+				}
+				if actualChunkWidth < smallWidth {
+					continue
+				}
+				actualChunkHeight := chunkHeight
+				if y+chunkHeight > largeBMP.Height {
+					actualChunkHeight = largeBMP.Height - y
+				}
+				if actualChunkHeight < smallHeight {
+					continue
+				}
+				// chunks overlap and are only read during matching, so they reference the scan instead of copying its pixels
+				rowChunks = append(rowChunks, chunk{
+					X:      x,
+					Y:      y,
+					Width:  actualChunkWidth,
+					Height: actualChunkHeight,
+				})
+			}
+			allRowChunks[rowIdx] = rowChunks
+		}(y, rowIdx)
+		rowIdx++
+	}
+	wg.Wait()
+
+	// Flatten allRowChunks into a single slice
+	var chunks []chunk
+	for _, rowChunks := range allRowChunks {
+		chunks = append(chunks, rowChunks...)
+	}
+	return chunks
 }
 
 // normalizeBMPData ensures that the BMP data is in top-down format.
@@ -235,6 +425,44 @@ func normalizeBMPData(bmp display.BMP) []byte {
 	return normalizedData
 }
 
+// cropBMP returns a top-down copy of a rectangular region of the BMP.
+//
+// Parameters:
+//   - bmp: The BMP to crop.
+//   - x, y: The top-left coordinates of the region.
+//   - width, height: The dimensions of the region, the region must lie within the BMP.
+//
+// Returns:
+//   - display.BMP: A new BMP containing only the region.
+func cropBMP(bmp display.BMP, x, y, width, height int) display.BMP {
+	bytesPerPixel := tools.CalcBytesPerPixel(int(bmp.InfoHeader.BiBitCount))
+	srcRowSize := ((bmp.Width*bytesPerPixel + 3) / 4) * 4
+	dstRowSize := ((width*bytesPerPixel + 3) / 4) * 4
+	data := normalizeBMPData(bmp)
+
+	cropped := make([]byte, dstRowSize*height)
+	for row := range height {
+		srcOffset := (y+row)*srcRowSize + x*bytesPerPixel
+		copy(cropped[row*dstRowSize:row*dstRowSize+width*bytesPerPixel], data[srcOffset:srcOffset+width*bytesPerPixel])
+	}
+
+	infoHeader := bmp.InfoHeader
+	infoHeader.BiWidth = int32(width)
+	infoHeader.BiHeight = -int32(height)
+	infoHeader.BiSizeImage = uint32(len(cropped))
+	fileHeader := bmp.FileHeader
+	fileHeader.Size = fileHeader.OffBits + uint32(len(cropped))
+
+	return display.BMP{
+		FileHeader: fileHeader,
+		InfoHeader: infoHeader,
+		ColorTable: bmp.ColorTable,
+		Data:       cropped,
+		Width:      width,
+		Height:     height,
+	}
+}
+
 // sendResult sends the result to the result channel and recovers from panic if the channel is closed.
 //
 // Parameters:
@@ -265,153 +493,225 @@ func sendResult(resultChan chan struct {
 	}
 }
 
-// splitChunksForWorkers divides the chunks into groups for parallel processing.
-// It ensures that the chunks are distributed evenly among the workers and reverses the order of chunks for alternate groups.
+// interleaveChunks orders the chunks alternately from the start and the end of the scan, so the first tasks picked up by the workers cover both ends of it.
 //
 // Parameters:
-//   - chunks: The list of chunks to be divided.
-//   - numWorkers: The number of workers to distribute the chunks among.
+//   - chunks: The list of chunks to be ordered.
 //
 // Returns:
-//   - [][]chunk: A slice of slices, where each inner slice contains the chunks for a specific worker.
-func splitChunksForWorkers(chunks []chunk, numWorkers int) [][]chunk {
-	groups := make([][]chunk, numWorkers)
-	n := len(chunks)
-	left, right := 0, n-1
-	assignIdx := 0
+//   - []chunk: The chunks in the order they should be submitted.
+func interleaveChunks(chunks []chunk) []chunk {
+	ordered := make([]chunk, 0, len(chunks))
+	left, right := 0, len(chunks)-1
 
 	for left <= right {
-		// Assign from the left
+		ordered = append(ordered, chunks[left])
+		left++
 		if left <= right {
-			groups[assignIdx%numWorkers] = append(groups[assignIdx%numWorkers], chunks[left])
-			assignIdx++
-			left++
-		}
-		// Assign from the right
-		if left <= right {
-			groups[assignIdx%numWorkers] = append(groups[assignIdx%numWorkers], chunks[right])
-			assignIdx++
+			ordered = append(ordered, chunks[right])
 			right--
 		}
 	}
-	return groups
+	return ordered
 }
 
 // submitTasks submits tasks to the worker pool for processing the chunks of the large BMP.
-// Each task processes a chunk and checks for matches with the small BMP.
+// Each task processes a single chunk and checks for matches with the small BMP, so the pool hands chunks to whichever worker is free
+// and a worker that draws an expensive region does not hold up the chunks queued behind it.
 //
 // Parameters:
 //   - worker: The worker pool to submit tasks to.
-//   - chunkGroups: The groups of chunks to be processed.
+//   - chunks: The chunks to be processed, in the order they are submitted.
 //   - resultChan: The channel to send results back to the main thread.
 //   - matchFound: A pointer to an atomic integer to signal when a match is found.
-//   - largeData: The pixel data of the larger BMP.
-//   - smallData: The pixel data of the smaller BMP.
-//   - largeRowSize: The row size of the larger BMP (including padding).
-//   - smallRowSize: The row size of the smaller BMP (including padding).
-//   - largeBytesPerPixel: The number of bytes per pixel in the larger BMP.
-//   - smallBytesPerPixel: The number of bytes per pixel in the smaller BMP.
 //   - smallWidth: The width of the smaller BMP.
 //   - smallHeight: The height of the smaller BMP.
 //   - mseThreshold: The maximum allowable MSE for a match.
-func submitTasks(pool worker.DynamicWorkerPool, chunkGroups [][]chunk, resultChan chan struct {
+//   - ctx: The context of the search, its deadline is applied to every task and submitting stops once it is done.
+//   - mse: A function returning the score of the template window at the given coordinates, which may exit early once it exceeds the given threshold, see searchSpace.mse.
+//   - best: The reading order key of the best match found so far, see readingOrderKey. If nil, the first match found is sent on resultChan,
+//     otherwise tasks keep scanning for matches earlier in reading order and record them in best instead.
+//   - miss: Records the window closest to matching among those the tasks rejected.
+//   - wg: An optional wait group that is marked done as each task finishes.
+func submitTasks(pool worker.DynamicWorkerPool, chunks []chunk, resultChan chan struct {
 	X int
 	Y int
-}, matchFound *int32, largeData, smallData []byte, largeRowSize, smallRowSize, largeBytesPerPixel, smallBytesPerPixel, smallWidth, smallHeight int, mseThreshold float64, ctx context.Context, sumTemplateSq float64, integralImage [][]float64) {
-	for _, chunkGroup := range chunkGroups {
-		chunkGroup := chunkGroup // Capture chunkGroup in the loop
+}, matchFound *int32, smallWidth, smallHeight int, mseThreshold float64, ctx context.Context, mse func(x, y int, threshold float64) float64, best *atomic.Int64, miss *nearMiss, wg *sync.WaitGroup) {
+	// the tasks run with the search deadline, their context is also cancelled once the pool is stopped at the end of the search
+	deadline, _ := ctx.Deadline()
+	for i, chunk := range chunks {
+		chunk := chunk // Capture chunk in the loop
 
 		task := worker.Task{
-			ID: len(chunkGroup),
-			Do: func() (any, error) {
-				for _, chunk := range chunkGroup {
-					if ctx.Err() != nil {
+			ID:       i,
+			Deadline: deadline,
+			DoCtx: func(ctx context.Context) (any, error) {
+				if wg != nil {
+					defer wg.Done()
+				}
+				// the closest rejected window of the chunk is only recorded once, so the tasks do not contend for the lock on every window
+				missX, missY, missMSE := 0, 0, math.Inf(1)
+				defer func() {
+					miss.observe(missX, missY, missMSE)
+				}()
+
+				for y := 0; y <= chunk.Height-smallHeight; y++ {
+					if best == nil && atomic.LoadInt32(matchFound) == 1 {
+						return nil, nil
+					} else if ctx.Err() != nil {
 						return nil, nil
 					}
-					for y := 0; y <= chunk.Height-smallHeight; y++ {
-						if atomic.LoadInt32(matchFound) == 1 {
-							return nil, nil
-						} else if ctx.Err() != nil {
+					// every remaining window in this chunk comes after the best match in reading order
+					if best != nil && readingOrderKey(chunk.X, chunk.Y+y) > best.Load() {
+						return nil, nil
+					}
+
+					for x := 0; x <= chunk.Width-smallWidth; x++ {
+						if ctx.Err() != nil {
 							return nil, nil
 						}
+						absoluteX := chunk.X + x
+						absoluteY := chunk.Y + y
+
+						// Calculate MSE for the current window
+						score := mse(absoluteX, absoluteY, mseThreshold)
+
+						// Early exit if the MSE is significantly below the threshold
+						matched := score <= mseThreshold/5
 
-						for x := 0; x <= chunk.Width-smallWidth; x++ {
-							if ctx.Err() != nil {
-								return nil, nil
+						// If the MSE is below the threshold, validate the match
+						if !matched && score <= mseThreshold {
+							matched = true
+							if score > mseThreshold*0.9 {
+								validationMSE := mse(absoluteX, absoluteY, mseThreshold)
+								matched = validationMSE <= mseThreshold
 							}
-							absoluteX := chunk.X + x
-							absoluteY := chunk.Y + y
-
-							// Calculate MSE for the current window
-							mse := calculateMSE(
-								largeData, smallData,
-								absoluteX, absoluteY,
-								largeRowSize, smallRowSize,
-								largeBytesPerPixel, smallBytesPerPixel,
-								smallWidth, smallHeight, true, sumTemplateSq, integralImage, mseThreshold,
-							)
-
-							// Early exit if the MSE is significantly below the threshold
-							if mse <= mseThreshold/5 {
-								if atomic.CompareAndSwapInt32(matchFound, 0, 1) {
-									sendResult(resultChan, struct {
-										X int
-										Y int
-									}{X: absoluteX, Y: absoluteY})
-									return nil, nil
-								}
+						}
+						if !matched {
+							if score < missMSE {
+								missX, missY, missMSE = absoluteX, absoluteY, score
 							}
+							continue
+						}
 
-							// If the MSE is below the threshold, validate the match
-							if mse <= mseThreshold {
-                                if mse > mseThreshold*0.9 {
-                                    validationMSE := calculateMSE(
-                                        largeData, smallData,
-                                        absoluteX, absoluteY,
-                                        largeRowSize, smallRowSize,
-                                        largeBytesPerPixel, smallBytesPerPixel,
-                                        smallWidth, smallHeight, true, sumTemplateSq, integralImage, mseThreshold,
-                                    )
-                                    if validationMSE > mseThreshold {
-                                        continue
-                                    }
-                                }
-                                if atomic.CompareAndSwapInt32(matchFound, 0, 1) {
-                                    sendResult(resultChan, struct {
-                                        X int
-                                        Y int
-                                    }{X: absoluteX, Y: absoluteY})
-                                    return nil, nil
-                                }
-                            }
+						if best != nil {
+							// the chunk is scanned in reading order, so this is the earliest match in the chunk
+							lowerReadingOrderBest(best, absoluteX, absoluteY)
+							return nil, nil
+						}
+						if atomic.CompareAndSwapInt32(matchFound, 0, 1) {
+							sendResult(resultChan, struct {
+								X int
+								Y int
+							}{X: absoluteX, Y: absoluteY})
+							return nil, nil
 						}
 					}
 				}
 				return nil, nil
 			},
 		}
-		if ctx.Err() != nil {
+		// a full queue must not block the search past its timeout, a task that could not be submitted counts as done
+		if err := pool.SubmitTaskCtx(ctx, task); err != nil {
+			if wg != nil {
+				wg.Done()
+			}
+		}
+	}
+}
+
+// readingOrderKey returns a key for the given coordinates that orders windows in reading order, top to bottom then left to right.
+//
+// Parameters:
+//   - x, y: The top-left coordinates of the window.
+//
+// Returns:
+//   - int64: The reading order key, smaller keys come first.
+func readingOrderKey(x, y int) int64 {
+	return int64(y)<<32 | int64(x)
+}
+
+// lowerReadingOrderBest stores the reading order key of the given coordinates in best if it comes before the current best.
+//
+// Parameters:
+//   - best: The reading order key of the best match found so far.
+//   - x, y: The top-left coordinates of the match.
+func lowerReadingOrderBest(best *atomic.Int64, x, y int) {
+	key := readingOrderKey(x, y)
+	for {
+		current := best.Load()
+		if key >= current || best.CompareAndSwap(current, key) {
 			return
 		}
-		pool.SubmitTask(task)
 	}
 }
 
-// validateBMPDimensions checks if the dimensions of the small BMP are within the bounds of the large BMP.
+// validateBMPDimensions checks that both BMPs have a non-zero area and that the dimensions of the small BMP are within the bounds of the large BMP.
+// Templates that are a single pixel wide or tall, such as those used to detect lines and separators, are valid.
 //
 // Parameters:
 //   - largeBMP: The larger BMP image.
 //   - smallBMP: The smaller BMP image.
 //
 // Returns:
-//   - error: An error if the small BMP dimensions exceed the large BMP dimensions.
+//   - error: An error if either BMP has a zero area or the small BMP dimensions exceed the large BMP dimensions.
 func validateBMPDimensions(largeBMP, smallBMP display.BMP) error {
+	if largeBMP.Width <= 0 || largeBMP.Height <= 0 {
+		return fmt.Errorf("large BMP has a zero area: %dx%d", largeBMP.Width, largeBMP.Height)
+	}
+	if smallBMP.Width <= 0 || smallBMP.Height <= 0 {
+		return fmt.Errorf("small BMP has a zero area: %dx%d", smallBMP.Width, smallBMP.Height)
+	}
 	if smallBMP.Width > largeBMP.Width || smallBMP.Height > largeBMP.Height {
 		return fmt.Errorf("small BMP dimensions exceed large BMP dimensions")
 	}
 	return nil
 }
 
+// validatePixelFormats checks that the scan and the template both use a pixel format the matcher can compare.
+// The MSE compares the first three channels of every pixel, so both images must be 24-bit or 32-bit BMPs, which store pixels in the same BGR(A) order.
+// Their pixel data must also cover every padded row, otherwise the row strides derived from the headers do not match the data.
+//
+// Parameters:
+//   - scan: The larger BMP image.
+//   - template: The smaller BMP image.
+//
+// Returns:
+//   - error: An error describing the first image with an unsupported or inconsistent pixel format.
+func validatePixelFormats(scan, template display.BMP) error {
+	for _, img := range []struct {
+		name string
+		bmp  display.BMP
+	}{{"scan", scan}, {"template", template}} {
+		bitCount := int(img.bmp.InfoHeader.BiBitCount)
+		if bitCount != 24 && bitCount != 32 {
+			return fmt.Errorf("unsupported %s pixel format: %d-bit, only 24-bit and 32-bit BMPs can be matched", img.name, bitCount)
+		}
+
+		rowSize := ((img.bmp.Width*tools.CalcBytesPerPixel(bitCount) + 3) / 4) * 4
+		if len(img.bmp.Data) < rowSize*img.bmp.Height {
+			return fmt.Errorf("invalid %s pixel data: expected at least %d bytes for a %dx%d %d-bit BMP, got %d", img.name, rowSize*img.bmp.Height, img.bmp.Width, img.bmp.Height, bitCount, len(img.bmp.Data))
+		}
+	}
+	return nil
+}
+
+// buildIntegralImage builds an integral image of pixel values, summed over the color channels, for fast patch sum calculation.
+func buildIntegralImage(data []byte, width, height, rowSize, bytesPerPixel int) [][]float64 {
+	integral := make([][]float64, height+1)
+	for i := range integral {
+		integral[i] = make([]float64, width+1)
+	}
+	for y := range height {
+		for x := range width {
+			pixelStart := y*rowSize + x*bytesPerPixel
+			val := float64(data[pixelStart]) + float64(data[pixelStart+1]) + float64(data[pixelStart+2])
+			integral[y+1][x+1] = val + integral[y][x+1] + integral[y+1][x] - integral[y][x]
+		}
+	}
+	return integral
+}
+
 // buildIntegralImageSq builds an integral image of squared pixel values for fast patch sum calculation.
 func buildIntegralImageSq(data []byte, width, height, rowSize, bytesPerPixel int) [][]float64 {
 	integral := make([][]float64, height+1)
@@ -431,9 +731,392 @@ func buildIntegralImageSq(data []byte, width, height, rowSize, bytesPerPixel int
 	return integral
 }
 
-// getPatchSumSq returns the sum of squares for a patch using the integral image.
+// getPatchSumSq returns the sum of squares for a patch using the integral image of squared pixel values.
 func getPatchSumSq(integral [][]float64, x, y, w, h int) float64 {
+	return getPatchSum(integral, x, y, w, h)
+}
+
+// getPatchSum returns the sum of the values of a patch using an integral image.
+func getPatchSum(integral [][]float64, x, y, w, h int) float64 {
 	x1, y1 := x, y
 	x2, y2 := x+w, y+h
 	return integral[y2][x2] - integral[y1][x2] - integral[y2][x1] + integral[y1][x1]
 }
+
+// refineSubpixel refines an integer match to fractional coordinates.
+// It first moves to the lowest MSE window in the immediate neighborhood of the match, since the matcher returns the first window under the threshold rather than the best one,
+// then fits a parabola through the MSE of the neighboring windows on each axis and returns the position of its minimum.
+//
+// Parameters:
+//   - x, y: The top-left coordinates of the integer match.
+//   - maxX, maxY: The largest valid top-left coordinates for the template window.
+//   - mse: A function returning the MSE of the template window at the given coordinates.
+//
+// Returns:
+//   - (float64, float64): The refined top-left coordinates of the match.
+func refineSubpixel(x, y, maxX, maxY int, mse func(x, y int) float64) (float64, float64) {
+	const maxSteps = 8
+
+	best := mse(x, y)
+	for range maxSteps {
+		bestX, bestY := x, y
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				nx, ny := x+dx, y+dy
+				if (dx == 0 && dy == 0) || nx < 0 || ny < 0 || nx > maxX || ny > maxY {
+					continue
+				}
+				if e := mse(nx, ny); e < best {
+					best, bestX, bestY = e, nx, ny
+				}
+			}
+		}
+		if bestX == x && bestY == y {
+			break
+		}
+		x, y = bestX, bestY
+	}
+
+	offsetX, offsetY := 0.0, 0.0
+	if x > 0 && x < maxX {
+		offsetX = parabolaVertex(mse(x-1, y), best, mse(x+1, y))
+	}
+	if y > 0 && y < maxY {
+		offsetY = parabolaVertex(mse(x, y-1), best, mse(x, y+1))
+	}
+	return float64(x) + offsetX, float64(y) + offsetY
+}
+
+// parabolaVertex returns the offset of the vertex of the parabola through three equally spaced samples, relative to the center sample.
+// The offset is clamped to [-0.5, 0.5], if the samples do not form an upward parabola the center is returned.
+//
+// Parameters:
+//   - left, center, right: The samples at offsets -1, 0 and 1.
+//
+// Returns:
+//   - float64: The offset of the vertex relative to the center sample.
+func parabolaVertex(left, center, right float64) float64 {
+	denom := left - 2*center + right
+	if denom <= 0 {
+		return 0
+	}
+	return math.Max(-0.5, math.Min(0.5, (left-right)/(2*denom)))
+}
+
+// scanSequential scans every template window of the scan in reading order on the calling goroutine, and returns the first window under the threshold.
+//
+// Parameters:
+//   - ctx: The context for the search, the scan stops with an error once it is done.
+//   - maxX, maxY: The largest valid top-left coordinates for the template window.
+//   - mseThreshold: The maximum allowable MSE for a match.
+//   - mse: A function returning the MSE of the template window at the given coordinates, which may exit early once it exceeds the given threshold.
+//   - miss: Records the window closest to matching among those that were rejected.
+//
+// Returns:
+//   - (int, int): The top-left coordinates of the first match.
+//   - bool: True if a match was found, false if there is none or the context is done before one is found.
+func scanSequential(ctx context.Context, maxX, maxY int, mseThreshold float64, mse func(x, y int, threshold float64) float64, miss *nearMiss) (int, int, bool) {
+	missX, missY, missMSE := 0, 0, math.Inf(1)
+	defer func() {
+		miss.observe(missX, missY, missMSE)
+	}()
+
+	for y := 0; y <= maxY; y++ {
+		if ctx.Err() != nil {
+			return 0, 0, false
+		}
+		for x := 0; x <= maxX; x++ {
+			score := mse(x, y, mseThreshold)
+			if score <= mseThreshold {
+				return x, y, true
+			}
+			if score < missMSE {
+				missX, missY, missMSE = x, y, score
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// nearMiss records the window closest to matching among those a search rejected, see NoMatchError.
+// The MSE of a rejected window is only a lower bound once its comparison exits early, so the window recorded is the most promising one rather than the closest one.
+type nearMiss struct {
+	mu   sync.Mutex
+	x, y int
+	mse  float64
+	seen bool
+}
+
+// observe records a rejected window if it is closer to matching than the one recorded so far.
+//
+// Parameters:
+//   - x, y: The top-left coordinates of the window.
+//   - mse: The normalized MSE of the window, windows with an infinite MSE are ignored.
+func (n *nearMiss) observe(x, y int, mse float64) {
+	if math.IsInf(mse, 1) {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.seen || mse < n.mse {
+		n.x, n.y, n.mse, n.seen = x, y, mse, true
+	}
+}
+
+// toError builds the error of a search that found no match, with the exact confidence of the recorded window.
+//
+// Parameters:
+//   - timeout: Whether the search ran out of time.
+//   - width, height: The size of the template, which is the size of the near miss.
+//   - mse: A function returning the MSE of the template window at the given coordinates.
+//
+// Returns:
+//   - *NoMatchError: The error of the search.
+func (n *nearMiss) toError(timeout bool, width, height int, mse func(x, y int, threshold float64) float64) *NoMatchError {
+	n.mu.Lock()
+	x, y, seen := n.x, n.y, n.seen
+	n.mu.Unlock()
+
+	err := &NoMatchError{Timeout: timeout}
+	if seen {
+		err.NearMiss = image.Rect(x, y, x+width, y+height)
+		err.NearMissConfidence = confidenceFromMSE(mse(x, y, math.Inf(1)))
+	}
+	return err
+}
+
+// closerNearMiss returns whichever of two no-match errors has the closer near miss, for searches made of several searches such as across tiles.
+//
+// Parameters:
+//   - current: The error with the closest near miss so far.
+//   - err: The error of the latest search, ignored unless it is a *NoMatchError.
+//   - offset: The offset of the scan of the latest search, added to its near miss.
+//
+// Returns:
+//   - *NoMatchError: The error with the closer near miss, current if neither has one.
+func closerNearMiss(current *NoMatchError, err error, offset image.Point) *NoMatchError {
+	var noMatch *NoMatchError
+	if !errors.As(err, &noMatch) || noMatch.NearMiss.Empty() {
+		return current
+	}
+	if !current.NearMiss.Empty() && current.NearMissConfidence >= noMatch.NearMissConfidence {
+		return current
+	}
+	return &NoMatchError{
+		Timeout:            current.Timeout,
+		NearMiss:           noMatch.NearMiss.Add(offset),
+		NearMissConfidence: noMatch.NearMissConfidence,
+	}
+}
+
+// confidenceFromMSE converts a normalized MSE into a size-independent confidence in [0, 1], where 1 is a perfect match.
+//
+// Parameters:
+//   - mse: The normalized MSE of a window.
+//
+// Returns:
+//   - float64: The confidence of the window.
+func confidenceFromMSE(mse float64) float64 {
+	return min(max(1-mse, 0), 1)
+}
+
+// thresholdFromConfidence converts a minimum confidence into the normalized MSE threshold the search compares windows against.
+//
+// Parameters:
+//   - confidence: The minimum confidence, in [0, 1].
+//
+// Returns:
+//   - float64: The normalized MSE threshold.
+func thresholdFromConfidence(confidence float64) float64 {
+	return 1 - confidence
+}
+
+// scoredMatch is a window of the scan that matched the template, with its normalized MSE.
+type scoredMatch struct {
+	X, Y int
+	MSE  float64
+}
+
+// scanAll scans every template window of the scan on the calling goroutine, and returns every window under the threshold.
+//
+// Parameters:
+//   - ctx: The context for the search, the scan stops with an error once it is done.
+//   - maxX, maxY: The largest valid top-left coordinates for the template window.
+//   - mseThreshold: The maximum allowable MSE for a match.
+//   - mse: A function returning the MSE of the template window at the given coordinates, which may exit early once it exceeds the given threshold.
+//
+// Returns:
+//   - []scoredMatch: Every window under the threshold, in reading order.
+//   - error: An error if the context is done before the scan finishes.
+func scanAll(ctx context.Context, maxX, maxY int, mseThreshold float64, mse func(x, y int, threshold float64) float64) ([]scoredMatch, error) {
+	var matches []scoredMatch
+	for y := 0; y <= maxY; y++ {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("scan did not finish - timeout")
+		}
+		for x := 0; x <= maxX; x++ {
+			if score := mse(x, y, mseThreshold); score <= mseThreshold {
+				matches = append(matches, scoredMatch{X: x, Y: y, MSE: score})
+			}
+		}
+	}
+	return matches, nil
+}
+
+// suppressOverlapping reduces matches that overlap each other to the best one among them, since a single on-screen element matches at several neighboring offsets.
+// Matches are kept from the lowest MSE up, and a match is dropped if its window overlaps the window of a match that was already kept.
+//
+// Parameters:
+//   - matches: The matches to reduce.
+//   - width, height: The size of the template window.
+//
+// Returns:
+//   - []scoredMatch: The kept matches, from the lowest MSE to the highest.
+func suppressOverlapping(matches []scoredMatch, width, height int) []scoredMatch {
+	sorted := slices.Clone(matches)
+	slices.SortStableFunc(sorted, func(a, b scoredMatch) int {
+		return cmp.Compare(a.MSE, b.MSE)
+	})
+
+	var kept []scoredMatch
+	for _, m := range sorted {
+		overlaps := slices.ContainsFunc(kept, func(k scoredMatch) bool {
+			return m.X < k.X+width && k.X < m.X+width && m.Y < k.Y+height && k.Y < m.Y+height
+		})
+		if !overlaps {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// drawBorder draws the border of a rectangle onto a BMP, clipped to the bounds of the BMP.
+//
+// Parameters:
+//   - bmp: The BMP to draw onto.
+//   - rect: The rectangle to draw the border of, its Max corner is exclusive.
+//   - thickness: The width of the border in pixels, drawn inwards from the edge of the rectangle.
+//   - r, g, b: The color of the border.
+//
+// Returns:
+//   - error: An error if the pixels of the BMP can not be set.
+func drawBorder(bmp *display.BMP, rect image.Rectangle, thickness int, r, g, b uint8) error {
+	rect = rect.Intersect(image.Rect(0, 0, bmp.Width, bmp.Height))
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			inner := x >= rect.Min.X+thickness && x < rect.Max.X-thickness && y >= rect.Min.Y+thickness && y < rect.Max.Y-thickness
+			if inner {
+				continue
+			}
+			if err := bmp.SetPixel(x, y, r, g, b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateTiles checks that the tiles of a scan can be searched for the template, and that adjacent tiles overlap enough to match across their seams.
+// Two tiles are adjacent along a vertical seam if they share at least a template height of rows, and their columns touch or overlap without one spanning the other,
+// in which case their columns must overlap by at least the template width minus one, and likewise for horizontal seams.
+//
+// Parameters:
+//   - tiles: The tiles of the scan.
+//   - template: The template to search for.
+//
+// Returns:
+//   - error: An error if there are no tiles, a tile is invalid or none can hold the template, or adjacent tiles do not overlap enough.
+func validateTiles(tiles []TileBMP, template display.BMP) error {
+	if len(tiles) == 0 {
+		return fmt.Errorf("no tiles to search")
+	}
+	if err := template.Validate(); err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+
+	fits := false
+	rects := make([]image.Rectangle, len(tiles))
+	for i, tile := range tiles {
+		if err := tile.BMP.Validate(); err != nil {
+			return fmt.Errorf("invalid tile at %d,%d: %w", tile.X, tile.Y, err)
+		}
+		if err := validatePixelFormats(tile.BMP, template); err != nil {
+			return fmt.Errorf("tile at %d,%d: %w", tile.X, tile.Y, err)
+		}
+		fits = fits || (tile.BMP.Width >= template.Width && tile.BMP.Height >= template.Height)
+		rects[i] = image.Rect(tile.X, tile.Y, tile.X+tile.BMP.Width, tile.Y+tile.BMP.Height)
+	}
+	if !fits {
+		return fmt.Errorf("no tile is large enough for the %dx%d template", template.Width, template.Height)
+	}
+
+	for i := range rects {
+		for j := i + 1; j < len(rects); j++ {
+			a, b := rects[i], rects[j]
+			sharedCols := min(a.Max.X, b.Max.X) - max(a.Min.X, b.Min.X)
+			sharedRows := min(a.Max.Y, b.Max.Y) - max(a.Min.Y, b.Min.Y)
+			spansCols := (a.Min.X <= b.Min.X && a.Max.X >= b.Max.X) || (b.Min.X <= a.Min.X && b.Max.X >= a.Max.X)
+			spansRows := (a.Min.Y <= b.Min.Y && a.Max.Y >= b.Max.Y) || (b.Min.Y <= a.Min.Y && b.Max.Y >= a.Max.Y)
+
+			if sharedRows >= template.Height && sharedCols >= 0 && !spansCols && sharedCols < template.Width-1 {
+				return fmt.Errorf("tiles %v and %v overlap by %d columns, at least %d are needed to match across their seam", a, b, sharedCols, template.Width-1)
+			}
+			if sharedCols >= template.Width && sharedRows >= 0 && !spansRows && sharedRows < template.Height-1 {
+				return fmt.Errorf("tiles %v and %v overlap by %d rows, at least %d are needed to match across their seam", a, b, sharedRows, template.Height-1)
+			}
+		}
+	}
+	return nil
+}
+
+// rotatedTemplate is the template rotated by one of the angles given with AnglesOpt.
+type rotatedTemplate struct {
+	bmp   display.BMP
+	angle int // the clockwise rotation in degrees, as given to AnglesOpt
+}
+
+// rotateTemplate rotates the template by each of the angles, and validates the rotations against the scan before any of them is searched.
+// Rotations that do not fit within the scan are left out, since they can not match.
+//
+// Parameters:
+//   - scan: The larger BMP to search in.
+//   - template: The template to rotate.
+//   - angles: The clockwise rotations of the template, in degrees.
+//
+// Returns:
+//   - []rotatedTemplate: The rotations that fit within the scan, in the order of the angles.
+//   - error: An error if an angle is not a multiple of 90 degrees, either BMP is invalid or can not be matched, or no rotation fits within the scan.
+func rotateTemplate(scan, template display.BMP, angles []int) ([]rotatedTemplate, error) {
+	if err := scan.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scan: %w", err)
+	}
+	if err := template.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	if err := validatePixelFormats(scan, template); err != nil {
+		return nil, err
+	}
+
+	rotations := make([]rotatedTemplate, 0, len(angles))
+	var dimensionsErr error
+	for _, angle := range angles {
+		rotated := template
+		if angle%360 != 0 {
+			bmp, err := template.Rotate(angle)
+			if err != nil {
+				return nil, err
+			}
+			// the rotation is stored in the same pixel format as the template, only its rows are no longer bottom-up
+			rotated = *bmp
+		}
+		if err := validateBMPDimensions(scan, rotated); err != nil {
+			dimensionsErr = err
+			continue
+		}
+		rotations = append(rotations, rotatedTemplate{bmp: rotated, angle: angle})
+	}
+	if len(rotations) == 0 {
+		return nil, dimensionsErr
+	}
+	return rotations, nil
+}
@@ -1,5 +1,16 @@
 package tools
 
+import "errors"
+
+// ErrWaylandSession is the error reported on Linux when an operation is attempted in a Wayland session.
+// The display, mouse and keyboard rely on X11 tools, which on Wayland capture black screens and have no effect instead of failing,
+// so the operation is refused with this error, wrapped with the name of the operation, see the AUTOMATION_ALLOW_WAYLAND environment variable to override it.
+var ErrWaylandSession = errors.New("the session is running Wayland, which the X11 tools used on linux can not capture or control, log in to an X11 session instead")
+
+// ErrMissingDependency is the error reported on Linux when an external tool an operation relies on is not installed.
+// It is wrapped with the name of the tool and the packages that provide it.
+var ErrMissingDependency = errors.New("a required external tool is not installed")
+
 // Max returns the maximum of two integers.
 //
 // Parameters:
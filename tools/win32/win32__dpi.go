@@ -0,0 +1,137 @@
+//go:build windows
+// +build windows
+
+package win32
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// Proc is a procedure exported by a DLL, as loaded by syscall.LazyProc, which is missing on the Windows versions that predate it.
+type Proc interface {
+	// Find loads the procedure.
+	// Returns:
+	//   - error: An error if the DLL or the procedure does not exist.
+	Find() error
+
+	// Call calls the procedure.
+	// Parameters:
+	//   - a: The arguments of the procedure.
+	//
+	// Returns:
+	//   - uintptr: The return value of the procedure.
+	//   - uintptr: The second return value, only used on 32-bit systems for 64-bit return values.
+	//   - error: The last error of the calling thread, set even when the call succeeds.
+	Call(a ...uintptr) (uintptr, uintptr, error)
+}
+
+const (
+	DPI_AWARENESS_CONTEXT_PER_MONITOR_AWARE_V2 = ^uintptr(3) // Per-monitor DPI awareness, including non-client areas and dialogs, the DPI_AWARENESS_CONTEXT handle -4
+	PROCESS_PER_MONITOR_DPI_AWARE              = 2           // Per-monitor DPI awareness for SetProcessDpiAwareness
+	ERROR_ACCESS_DENIED                        = 5           // The DPI awareness of the process was already set, by a manifest or an earlier call
+	E_ACCESSDENIED                             = 0x80070005  // The HRESULT form of ERROR_ACCESS_DENIED
+)
+
+// errDPIAwarenessSet is reported by a DPI awareness step when the awareness of the process was already set, which ends the fallback chain successfully.
+var errDPIAwarenessSet = errors.New("the DPI awareness of the process is already set")
+
+// SetDPIAware declares the process as per-monitor DPI aware, falling back through the APIs of older Windows versions:
+// SetProcessDpiAwarenessContext with per-monitor awareness v2 on Windows 10 version 1703 and later,
+// SetProcessDpiAwareness with per-monitor awareness on Windows 8.1 and later, and SetProcessDPIAware otherwise, which is system DPI awareness.
+// If the awareness was already set, such as by the manifest of the application, it is left as is and no error is returned.
+//
+// Parameters:
+//   - awarenessContext: The SetProcessDpiAwarenessContext procedure of user32.dll.
+//   - shcore: The SetProcessDpiAwareness procedure of shcore.dll.
+//   - legacy: The SetProcessDPIAware procedure of user32.dll.
+//
+// Returns:
+//   - error: An error if none of the procedures could set the DPI awareness.
+func SetDPIAware(awarenessContext, shcore, legacy Proc) error {
+	return applyDPIAwareness([]func() error{
+		func() error { return setDPIAwarenessContext(awarenessContext) },
+		func() error { return setDPIAwarenessShcore(shcore) },
+		func() error { return setDPIAwareLegacy(legacy) },
+	})
+}
+
+// applyDPIAwareness runs the DPI awareness steps in order until one of them succeeds, or reports that the awareness was already set.
+//
+// Parameters:
+//   - steps: The DPI awareness steps, the preferred one first.
+//
+// Returns:
+//   - error: The errors of every step if none of them succeeded, nil otherwise.
+func applyDPIAwareness(steps []func() error) error {
+	var errs []error
+	for _, step := range steps {
+		err := step()
+		if err == nil || errors.Is(err, errDPIAwarenessSet) {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("failed to set the DPI awareness: %w", errors.Join(errs...))
+}
+
+// setDPIAwarenessContext sets per-monitor DPI awareness v2 with SetProcessDpiAwarenessContext, available on Windows 10 version 1703 and later.
+//
+// Parameters:
+//   - proc: The SetProcessDpiAwarenessContext procedure.
+//
+// Returns:
+//   - error: errDPIAwarenessSet if the awareness was already set, an error if the procedure is missing or fails.
+func setDPIAwarenessContext(proc Proc) error {
+	if err := proc.Find(); err != nil {
+		return err
+	}
+	ret, _, err := proc.Call(DPI_AWARENESS_CONTEXT_PER_MONITOR_AWARE_V2)
+	if ret != 0 {
+		return nil
+	}
+	if errno, ok := err.(syscall.Errno); ok && errno == ERROR_ACCESS_DENIED {
+		return errDPIAwarenessSet
+	}
+	return fmt.Errorf("SetProcessDpiAwarenessContext failed: %w", err)
+}
+
+// setDPIAwarenessShcore sets per-monitor DPI awareness with SetProcessDpiAwareness, available on Windows 8.1 and later.
+//
+// Parameters:
+//   - proc: The SetProcessDpiAwareness procedure.
+//
+// Returns:
+//   - error: errDPIAwarenessSet if the awareness was already set, an error if the procedure is missing or fails.
+func setDPIAwarenessShcore(proc Proc) error {
+	if err := proc.Find(); err != nil {
+		return err
+	}
+	hr, _, _ := proc.Call(PROCESS_PER_MONITOR_DPI_AWARE)
+	switch uint32(hr) {
+	case 0:
+		return nil
+	case E_ACCESSDENIED:
+		return errDPIAwarenessSet
+	default:
+		return fmt.Errorf("SetProcessDpiAwareness failed with HRESULT 0x%08X", uint32(hr))
+	}
+}
+
+// setDPIAwareLegacy sets system DPI awareness with SetProcessDPIAware, available on Windows Vista and later.
+//
+// Parameters:
+//   - proc: The SetProcessDPIAware procedure.
+//
+// Returns:
+//   - error: An error if the procedure is missing or fails.
+func setDPIAwareLegacy(proc Proc) error {
+	if err := proc.Find(); err != nil {
+		return err
+	}
+	if ret, _, err := proc.Call(); ret == 0 {
+		return fmt.Errorf("SetProcessDPIAware failed: %w", err)
+	}
+	return nil
+}
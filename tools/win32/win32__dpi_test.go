@@ -0,0 +1,155 @@
+//go:build windows
+// +build windows
+
+package win32
+
+import (
+	"errors"
+	"slices"
+	"syscall"
+	"testing"
+)
+
+// fakeProc stands in for a DLL procedure, recording its calls in a log shared by the procedures of a test.
+type fakeProc struct {
+	name    string
+	missing bool // the procedure does not exist on this Windows version
+	ret     uintptr
+	lastErr error
+	log     *[]string
+	args    [][]uintptr
+}
+
+var errProcNotFound = errors.New("procedure not found")
+
+func (p *fakeProc) Find() error {
+	if p.missing {
+		return errProcNotFound
+	}
+	return nil
+}
+
+func (p *fakeProc) Call(a ...uintptr) (uintptr, uintptr, error) {
+	*p.log = append(*p.log, p.name)
+	p.args = append(p.args, a)
+	return p.ret, 0, p.lastErr
+}
+
+// the last error of a successful call, which syscall.LazyProc reports as well
+const errSuccess = syscall.Errno(0)
+
+func TestSetDPIAwareFallbackOrder(t *testing.T) {
+	const (
+		errorInvalidParameter = syscall.Errno(87)
+		eInvalidArg           = 0x80070057
+	)
+	ok := func(name string) fakeProc { return fakeProc{name: name, ret: 1, lastErr: errSuccess} }
+	shcoreOK := fakeProc{name: "shcore", ret: 0, lastErr: errSuccess}
+	missing := func(name string) fakeProc { return fakeProc{name: name, missing: true} }
+
+	tests := []struct {
+		name                  string
+		context, shcore, lgcy fakeProc
+		wantCalls             []string
+		wantErr               bool
+	}{
+		{
+			name:    "per-monitor v2",
+			context: ok("context"), shcore: shcoreOK, lgcy: ok("legacy"),
+			wantCalls: []string{"context"},
+		},
+		{
+			name:    "already set by the manifest",
+			context: fakeProc{name: "context", ret: 0, lastErr: syscall.Errno(ERROR_ACCESS_DENIED)}, shcore: shcoreOK, lgcy: ok("legacy"),
+			wantCalls: []string{"context"},
+		},
+		{
+			name:    "windows 8.1",
+			context: missing("context"), shcore: shcoreOK, lgcy: ok("legacy"),
+			wantCalls: []string{"shcore"},
+		},
+		{
+			name:    "per-monitor v2 rejected",
+			context: fakeProc{name: "context", ret: 0, lastErr: errorInvalidParameter}, shcore: shcoreOK, lgcy: ok("legacy"),
+			wantCalls: []string{"context", "shcore"},
+		},
+		{
+			name:    "windows 8.1 already set",
+			context: missing("context"), shcore: fakeProc{name: "shcore", ret: E_ACCESSDENIED}, lgcy: ok("legacy"),
+			wantCalls: []string{"shcore"},
+		},
+		{
+			name:    "windows 7",
+			context: missing("context"), shcore: missing("shcore"), lgcy: ok("legacy"),
+			wantCalls: []string{"legacy"},
+		},
+		{
+			name:    "shcore rejected",
+			context: missing("context"), shcore: fakeProc{name: "shcore", ret: eInvalidArg}, lgcy: ok("legacy"),
+			wantCalls: []string{"shcore", "legacy"},
+		},
+		{
+			name:    "every procedure fails",
+			context: fakeProc{name: "context", ret: 0, lastErr: errorInvalidParameter}, shcore: fakeProc{name: "shcore", ret: eInvalidArg}, lgcy: fakeProc{name: "legacy", ret: 0, lastErr: errorInvalidParameter},
+			wantCalls: []string{"context", "shcore", "legacy"},
+			wantErr:   true,
+		},
+		{
+			name:    "every procedure missing",
+			context: missing("context"), shcore: missing("shcore"), lgcy: missing("legacy"),
+			wantCalls: nil,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		var log []string
+		tt.context.log, tt.shcore.log, tt.lgcy.log = &log, &log, &log
+		err := SetDPIAware(&tt.context, &tt.shcore, &tt.lgcy)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: SetDPIAware() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if !slices.Equal(log, tt.wantCalls) {
+			t.Errorf("%s: procedures called = %v, want %v", tt.name, log, tt.wantCalls)
+		}
+	}
+}
+
+func TestSetDPIAwareArguments(t *testing.T) {
+	var log []string
+	context := fakeProc{name: "context", ret: 0, lastErr: syscall.Errno(87), log: &log}
+	shcore := fakeProc{name: "shcore", ret: 0x80070057, log: &log}
+	legacy := fakeProc{name: "legacy", ret: 1, log: &log}
+	if err := SetDPIAware(&context, &shcore, &legacy); err != nil {
+		t.Fatalf("SetDPIAware() error = %v", err)
+	}
+	if want := [][]uintptr{{DPI_AWARENESS_CONTEXT_PER_MONITOR_AWARE_V2}}; !slices.EqualFunc(context.args, want, slices.Equal) {
+		t.Errorf("SetProcessDpiAwarenessContext arguments = %#x, want %#x", context.args, want)
+	}
+	if want := [][]uintptr{{PROCESS_PER_MONITOR_DPI_AWARE}}; !slices.EqualFunc(shcore.args, want, slices.Equal) {
+		t.Errorf("SetProcessDpiAwareness arguments = %v, want %v", shcore.args, want)
+	}
+	if want := [][]uintptr{{}}; !slices.EqualFunc(legacy.args, want, slices.Equal) {
+		t.Errorf("SetProcessDPIAware arguments = %v, want none", legacy.args)
+	}
+	// the DPI_AWARENESS_CONTEXT handles are small negative numbers
+	if handle := DPI_AWARENESS_CONTEXT_PER_MONITOR_AWARE_V2; int(handle) != -4 {
+		t.Errorf("DPI_AWARENESS_CONTEXT_PER_MONITOR_AWARE_V2 = %d, want -4", int(handle))
+	}
+}
+
+func TestSetDPIAwareReportsEveryFailure(t *testing.T) {
+	var log []string
+	context := fakeProc{name: "context", missing: true, log: &log}
+	shcore := fakeProc{name: "shcore", ret: 0x80070057, log: &log}
+	legacy := fakeProc{name: "legacy", ret: 0, lastErr: syscall.Errno(87), log: &log}
+	err := SetDPIAware(&context, &shcore, &legacy)
+	if !errors.Is(err, errProcNotFound) {
+		t.Errorf("SetDPIAware() error = %v, want it to wrap the missing procedure error", err)
+	}
+	if !errors.Is(err, syscall.Errno(87)) {
+		t.Errorf("SetDPIAware() error = %v, want it to wrap the error of SetProcessDPIAware", err)
+	}
+	if errors.Is(err, errDPIAwarenessSet) {
+		t.Errorf("SetDPIAware() error = %v, must not report the awareness as already set", err)
+	}
+}
@@ -0,0 +1,166 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrTaskSkipped is the error reported for a task of a batch that was cancelled before the task started.
+var ErrTaskSkipped = errors.New("task skipped, its batch was cancelled")
+
+// ErrBatchExhausted is the error returned by Batch.Next once the result of every task of the batch has been returned.
+var ErrBatchExhausted = errors.New("every result of the batch has been returned")
+
+// Batch is a handle to a group of tasks submitted together with SubmitBatch.
+// It tracks how many of its tasks have not finished yet, so callers can wait on their own tasks while other work shares the pool.
+type Batch struct {
+	mu        sync.Mutex
+	remaining int
+	results   []TaskResult
+	finished  []bool // whether the task at each position has finished, results of unfinished tasks are not returned by Next
+	next      int    // the position of the next result returned by Next
+	cancelled bool
+	done      chan struct{} // closed once every task of the batch has finished
+	updated   chan struct{} // closed and replaced whenever a task of the batch finishes, wakes up callers blocked in Next
+}
+
+// newBatch creates a batch expecting the given number of tasks, a batch without tasks is done right away.
+//
+// Parameters:
+//   - size: The number of tasks in the batch.
+//
+// Returns:
+//   - *Batch: The new batch.
+func newBatch(size int) *Batch {
+	b := &Batch{
+		remaining: size,
+		results:   make([]TaskResult, size),
+		finished:  make([]bool, size),
+		done:      make(chan struct{}),
+		updated:   make(chan struct{}),
+	}
+	if size == 0 {
+		close(b.done)
+	}
+	return b
+}
+
+// Wait blocks until every task of the batch has finished, or the context is done.
+//
+// Parameters:
+//   - ctx: The context that bounds how long to wait.
+//
+// Returns:
+//   - error: The context's error if it is done before the batch, nil otherwise.
+func (b *Batch) Wait(ctx context.Context) error {
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Results returns the results of the tasks of the batch, in the order the tasks were submitted.
+// The result of a task that has not finished yet is the zero value, so this is usually called once Wait has returned.
+//
+// Returns:
+//   - []TaskResult: A copy of the results of the batch.
+func (b *Batch) Results() []TaskResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	results := make([]TaskResult, len(b.results))
+	copy(results, b.results)
+	return results
+}
+
+// Next returns the result of the next task of the batch in submission order, blocking until that task has finished or the context is done.
+// Results of tasks that finish out of order are held by the batch until every earlier task has finished, so the memory used for reordering is bounded by the size of the batch.
+// This is useful for pipeline stages whose output order matters, such as processing frames, while later tasks keep running in the background.
+// Each result is returned once, it is safe to call Next concurrently, in which case every caller receives a different result.
+//
+// Parameters:
+//   - ctx: The context that bounds how long to wait for the next result.
+//
+// Returns:
+//   - TaskResult: The result of the next task in submission order.
+//   - error: ErrBatchExhausted once every result has been returned, the context's error if it is done first, nil otherwise.
+func (b *Batch) Next(ctx context.Context) (TaskResult, error) {
+	for {
+		b.mu.Lock()
+		if b.next >= len(b.results) {
+			b.mu.Unlock()
+			return TaskResult{}, ErrBatchExhausted
+		}
+		if b.finished[b.next] {
+			res := b.results[b.next]
+			b.next++
+			b.mu.Unlock()
+			return res, nil
+		}
+		updated := b.updated
+		b.mu.Unlock()
+
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return TaskResult{}, ctx.Err()
+		}
+	}
+}
+
+// Cancel cancels the tasks of the batch that have not started yet, they finish right away with ErrTaskSkipped once a worker takes them.
+// Tasks that are already running are not interrupted. It is safe to call Cancel any number of times.
+func (b *Batch) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cancelled = true
+}
+
+// wrap returns a copy of the task that is skipped once the batch is cancelled, and records its result in the batch when it is done.
+//
+// Parameters:
+//   - i: The position of the task in the batch.
+//   - t: The task to wrap.
+//
+// Returns:
+//   - Task: The wrapped task.
+func (b *Batch) wrap(i int, t Task) Task {
+	do, doCtx := t.Do, t.DoCtx
+	t.Do = nil
+	t.DoCtx = func(ctx context.Context) (any, error) {
+		b.mu.Lock()
+		cancelled := b.cancelled
+		b.mu.Unlock()
+		if cancelled {
+			return nil, ErrTaskSkipped
+		}
+		if doCtx != nil {
+			return doCtx(ctx)
+		}
+		return do()
+	}
+	t.done = func(res TaskResult) {
+		b.finish(i, res)
+	}
+	return t
+}
+
+// finish records the result of the task at the given position, and marks the batch as done once it was the last one.
+//
+// Parameters:
+//   - i: The position of the task in the batch.
+//   - res: The result of the task.
+func (b *Batch) finish(i int, res TaskResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.results[i] = res
+	b.finished[i] = true
+	close(b.updated)
+	b.updated = make(chan struct{})
+	b.remaining--
+	if b.remaining == 0 {
+		close(b.done)
+	}
+}
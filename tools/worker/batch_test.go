@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBatchCompletesWhenClearedInFlight(t *testing.T) {
+	p := NewDynamicWorkerPool(1, 8, time.Minute)
+	defer p.Stop()
+	release := blockWorkers(t, p, 1)
+	defer release()
+
+	tasks := make([]Task, 3)
+	for i := range tasks {
+		tasks[i] = Task{ID: i, Do: func() (any, error) { return i, nil }}
+	}
+	b := p.SubmitBatch(tasks)
+	waitFor(t, "the batch to be queued", func() bool {
+		return queued(p, PriorityNormal) == len(tasks)
+	})
+	p.ClearTaskQueue()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := b.Wait(ctx); err != nil {
+		t.Fatalf("Batch.Wait() error = %v, the batch never completed after it was cleared", err)
+	}
+	for i, res := range b.Results() {
+		if res.ID != i || !errors.Is(res.Err, ErrTaskDiscarded) {
+			t.Errorf("Results()[%d] = {ID: %d, Err: %v}, want {ID: %d, Err: %v}", i, res.ID, res.Err, i, ErrTaskDiscarded)
+		}
+	}
+	for i := range tasks {
+		res, err := b.Next(ctx)
+		if err != nil || !errors.Is(res.Err, ErrTaskDiscarded) {
+			t.Fatalf("Next() #%d = %v, %v, want a result with %v", i, res.Err, err, ErrTaskDiscarded)
+		}
+	}
+	if _, err := b.Next(ctx); !errors.Is(err, ErrBatchExhausted) {
+		t.Errorf("Next() after the last result error = %v, want %v", err, ErrBatchExhausted)
+	}
+}
+
+func TestBatchCompletesWhenPartlyCleared(t *testing.T) {
+	p := NewDynamicWorkerPool(1, 8, time.Minute)
+	defer p.Stop()
+
+	gate := make(chan struct{})
+	started := make(chan struct{})
+	tasks := []Task{
+		{ID: 0, Do: func() (any, error) {
+			close(started)
+			<-gate
+			return "ran", nil
+		}},
+		{ID: 1, Do: func() (any, error) { return "ran", nil }},
+	}
+	b := p.SubmitBatch(tasks)
+	<-started
+	waitFor(t, "the second task to be queued", func() bool {
+		return queued(p, PriorityNormal) == 1
+	})
+	p.ClearTaskQueue()
+	close(gate)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := b.Wait(ctx); err != nil {
+		t.Fatalf("Batch.Wait() error = %v", err)
+	}
+	results := b.Results()
+	if results[0].Err != nil || results[0].Value != "ran" {
+		t.Errorf("the running task's result = %v, %v, want it to finish as usual", results[0].Value, results[0].Err)
+	}
+	if !errors.Is(results[1].Err, ErrTaskDiscarded) {
+		t.Errorf("the cleared task's error = %v, want %v", results[1].Err, ErrTaskDiscarded)
+	}
+}
+
+func TestBatchNextReturnsResultsInOrder(t *testing.T) {
+	p := NewDynamicWorkerPool(8, 8, time.Minute)
+	defer p.Stop()
+
+	// the tasks finish in a shuffled order, the earliest ones last
+	delays := []int{7, 2, 5, 0, 6, 1, 4, 3}
+	tasks := make([]Task, len(delays))
+	for i, d := range delays {
+		tasks[i] = Task{ID: i, Do: func() (any, error) {
+			time.Sleep(time.Duration(d) * 5 * time.Millisecond)
+			return i, nil
+		}}
+	}
+	b := p.SubmitBatch(tasks)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := range tasks {
+		res, err := b.Next(ctx)
+		if err != nil {
+			t.Fatalf("Next() #%d error = %v", i, err)
+		}
+		if res.ID != i || res.Value != i || res.Err != nil {
+			t.Errorf("Next() #%d = {ID: %d, Value: %v, Err: %v}, want the result of task %d", i, res.ID, res.Value, res.Err, i)
+		}
+	}
+	if _, err := b.Next(ctx); !errors.Is(err, ErrBatchExhausted) {
+		t.Errorf("Next() after the last result error = %v, want %v", err, ErrBatchExhausted)
+	}
+}
@@ -2,6 +2,8 @@ package worker
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"slices"
 	"sync"
 	"time"
@@ -16,45 +18,156 @@ type dynamicWorkerPool struct {
 
 	workers []Worker
 
-	taskQueue     chan Task
-	stopChan      chan int
+	taskQueues [priorityLevels]chan Task // one queue per priority level, indexed by Priority
+
+	// tasks that did not fit in a full task queue, indexed by Priority, only used when the queue is allowed to grow with GrowQueueOpt.
+	// Workers never read these directly, they are moved into the task queue in order as workers free up space in it.
+	overflow      [priorityLevels][]Task
+	growQueue     bool
+	overflowLimit int // the maximum number of tasks in the overflow across all priority levels, zero if there is no limit
+	overflowDepth int
+	peakOverflow  int
+
+	registry      *taskRegistry // tracks tasks by ID, nil unless the pool was created with TrackTasksOpt
 	maxWorkers    int
-	activeWorkers int
+	minWorkers    int // the floor of maxWorkers, and the number of workers kept alive through their idle timeout
+	workerCeiling int // the ceiling of maxWorkers, zero if there is none
+	nextWorkerID  int
+	activeWorkers int    // the number of workers currently running a task
+	pending       int    // the number of tasks submitted that have not finished yet, queued or running
+	clearGen      uint64 // the number of times the queue was cleared, tasks submitted before the last clear are discarded instead of run
 	stopped       bool
+	closed        bool
+	paused        bool
+	pauseChan     chan struct{} // closed when dispatch is paused, replaced on Resume
+	resumeChan    chan struct{} // closed when dispatch is resumed, nil while dispatch is not paused
+
+	results        chan TaskResult
+	resultsEnabled bool
+	errors         chan error
+	errorsEnabled  bool
+	onError        func(taskID int, err error)
+
+	// optional instrumentation hooks, see the pool options of the same name
+	onTaskStart   func(workerID, taskID int)
+	onTaskDone    func(workerID, taskID int, d time.Duration, err error)
+	onWorkerStart func(workerID int)
+	onWorkerExit  func(workerID int)
+	onStuckTask   func(workerID, taskID int)
+
+	taskTimeout time.Duration // the timeout of tasks submitted without a deadline of their own, zero if there is none
+	stuck       int           // the number of abandoned tasks that are still running in the background
+
+	// cumulative counters since the pool was created, reported by Stats
+	submitted     int64
+	completed     int64
+	failed        int64
+	discarded     int64
+	panics        int64
+	ran           int64 // the number of tasks that were run by a worker, completed or failed
+	totalDuration time.Duration
 
-	idleTimeout      time.Duration
-	handleWorkerExit func(int)
+	idleTimeout time.Duration
+	workerHooks WorkerHooks // the hooks every worker of the pool is created with
+}
+
+// ErrQueueFull is the error returned by SubmitTaskCtx when the context is done before there is space in the task queue.
+// The returned error wraps both ErrQueueFull and the context's error.
+var ErrQueueFull = errors.New("worker pool task queue is full")
+
+// ErrPoolClosed is the error reported for tasks that are submitted to, or still queued in, a pool that has been closed.
+var ErrPoolClosed = errors.New("worker pool is closed")
+
+// ErrTaskDropped is the error reported for tasks still queued when the context passed to Shutdown is done.
+var ErrTaskDropped = errors.New("task dropped, the pool shut down before it ran")
+
+// ErrTaskDiscarded is the error reported for tasks removed from the queue by ClearTaskQueue before they ran.
+var ErrTaskDiscarded = errors.New("task discarded, the queue was cleared before it ran")
+
+// PoolStats is a consistent snapshot of the state and counters of a dynamic worker pool.
+// The cumulative counters cover the lifetime of the pool, every submitted task is eventually counted once in Completed, Failed or Discarded,
+// so Submitted always equals Completed + Failed + Discarded + QueueDepth + BusyWorkers.
+type PoolStats struct {
+	Workers      int  // the number of workers currently in the pool
+	BusyWorkers  int  // the number of workers currently running a task
+	IdleWorkers  int  // the number of workers currently waiting for a task
+	QueueDepth   int  // the number of submitted tasks waiting to be run, across all priority levels
+	Overflow     int  // the number of waiting tasks held beyond the capacity of the task queue, see GrowQueueOpt
+	PeakOverflow int  // the largest Overflow since the pool was created
+	Paused       bool // whether dispatch is paused, see DynamicWorkerPool.Pause
+	StuckTasks   int  // the number of tasks abandoned after exceeding their deadline that are still running in the background, these are not counted in BusyWorkers
+
+	Submitted int64 // the number of tasks submitted, including tasks rejected by a closed pool
+	Completed int64 // the number of tasks that finished without an error
+	Failed    int64 // the number of tasks that returned an error, panicked, exceeded their deadline or were rejected by a closed pool
+	Discarded int64 // the number of queued tasks removed by ClearTaskQueue before they ran
+	Panics    int64 // the number of tasks that panicked, these are also counted in Failed
+
+	TotalDuration   time.Duration // the total time spent running tasks
+	AverageDuration time.Duration // the average time a task ran for, zero if no task has run yet
 }
 
 // DynamicWorkerPool is an interface that defines the methods for a dynamic worker pool.
 // It allows for dynamic management of worker threads, including adding and removing workers, submitting tasks, and checking the status of the pool.
 // The pool can be used to process tasks concurrently, with a maximum number of workers and a task queue to manage incoming tasks.
 // The pool is designed to be flexible and can be adjusted at runtime to accommodate changing workloads and resource availability.
+//
+// A pool is in one of three states:
+//   - running: the state a new pool starts in. Submitted tasks are dispatched to workers, which are spawned on demand up to the maximum.
+//   - stopped: entered by calling Stop on a running pool. All workers exit once they finish their current task and none are spawned,
+//     submitted tasks stay in the queue until the pool is started again. Calling Start returns the pool to running.
+//   - closed: entered by calling Close or Shutdown from any state, and terminal. Newly submitted tasks are rejected with ErrPoolClosed,
+//     and Start has no effect. Close rejects queued tasks with ErrPoolClosed, while Shutdown lets the workers run them first.
 type DynamicWorkerPool interface {
 	// ClearTaskQueue clears the task queue without stopping the workers.
 	// This is useful for resetting the pool state without terminating the workers.
 	//
+	// Every task submitted before the call that has not started running is discarded, including tasks held in the overflow of a growing queue.
+	// A discarded task finishes with ErrTaskDiscarded as its result, which is delivered the same way as the result of a task that ran, so SubmitTaskWait returns it.
+	// A task that a concurrent SubmitTask was still handing to the queue when the queue was cleared is discarded once a worker dequeues it,
+	// rather than by this call, so it is counted in the Discarded stat but not in the returned count, and its result is delivered once it is dequeued.
+	// Tasks submitted after the call are kept.
 	// It does not block the caller and returns immediately after clearing the queue.
 	// Note: This method does not stop the workers, it only clears the task queue.
 	// If you want to stop the workers, use the StopAll method instead.
-	ClearTaskQueue()
+	//
+	// Returns:
+	//   - int: The number of tasks removed from the queue.
+	ClearTaskQueue() int
 
-	// DecreaseMaxWorkers decreases the maximum number of workers in the pool.
-	// It does not block the caller and returns immediately after decreasing the number of workers.
+	// Close permanently shuts down the pool.
+	// It stops all workers the same way Stop does, then rejects every task still in the queue, including its overflow, with ErrPoolClosed.
+	// Tasks submitted after Close are rejected with ErrPoolClosed as well, a closed pool can not be started again.
+	// It is safe to call Close any number of times.
 	//
-	// Note: This method will stop active workers if there are no inactive workers to remove.
+	// Note: Close must not be called concurrently with SubmitTask, a task that is being submitted while the pool closes may be left in the queue.
+	Close()
+
+	// DecreaseMaxWorkers decreases the maximum number of workers in the pool by n, the maximum never drops below the minimum set with WorkerBoundsOpt, or 1.
+	// Workers are removed until the pool holds no more than the new maximum, idle workers are removed before busy ones.
+	// A busy worker finishes its current task before it exits, and DecreaseMaxWorkers blocks until every removed worker has exited.
 	//
 	// Parameters:
-	//   - n: The number of workers to remove from the pool, must be less than or equal to the current number of workers.
+	//   - n: The number to decrease the maximum number of workers by.
 	DecreaseMaxWorkers(n int)
 
+	// Errors returns a channel that receives a *TaskError for every task that returns a non-nil error.
+	// Errors are only delivered for tasks that fail after the first call to Errors, every call returns the same channel.
+	// This is an alternative to the OnErrorOpt callback for consumers who prefer channels, both can be used at the same time.
+	//
+	// Note: once Errors has been called the caller must keep draining the channel, workers block on delivering an error while the channel is full.
+	//
+	// Returns:
+	//   - <-chan error: The channel that task errors are delivered to.
+	Errors() <-chan error
+
 	// GetMaxWorkers returns the maximum number of workers in the pool.
 	//
 	// Returns:
 	//   - int: The maximum number of workers in the pool.
 	GetMaxWorkers() int
 
-	// IncreaseMaxWorkers increases the maximum number of workers in the pool.
+	// IncreaseMaxWorkers increases the maximum number of workers in the pool, the maximum never rises above the ceiling set with WorkerBoundsOpt.
 	// It does not block the caller and returns immediately after increasing the number of workers.
 	// The new workers will be initialized and added to the pool.
 	//
@@ -63,28 +176,159 @@ type DynamicWorkerPool interface {
 	IncreaseMaxWorkers(n int)
 
 	// IsWorking checks if the pool is currently processing tasks.
-	// It returns true if there are tasks in the queue or if any workers are active.
+	// It returns true if any workers are running a task, or if there are tasks in the queue and dispatch is not paused.
 	// This method is non-blocking and returns immediately.
 	//
 	// Note: this method should not be looped on, as it may cause a busy wait.
 	// Instead, use the Wait method to block until all tasks are completed.
 	IsWorking() bool
 
-	// Stop stops all workers in the pool.
-	// It does not clear the task queue, so any tasks that are currently in the queue will remain there and be picked up by the scheduler.
+	// Pause pauses task dispatch without stopping the workers or touching the task queue.
+	// Workers finish the task they are running, but do not start another one until Resume is called, queued and newly submitted tasks stay queued.
+	// While dispatch is paused, Wait blocks until Resume is called if any tasks are queued. It is safe to call Pause repeatedly and concurrently.
+	Pause()
+
+	// Results returns a channel that receives the result of every task processed by the pool, including tasks that returned an error.
+	// Results are only delivered for tasks that finish after the first call to Results, every call returns the same channel.
+	//
+	// Note: results are delivered in completion order, there is no guarantee that they arrive in the order the tasks were submitted.
+	// Once Results has been called the caller must keep draining the channel, workers block on delivering a result while the channel is full.
+	//
+	// Returns:
+	//   - <-chan TaskResult: The channel that task results are delivered to.
+	Results() <-chan TaskResult
+
+	// Resume resumes task dispatch after Pause, the workers start taking queued tasks again.
+	// Calling Resume when dispatch is not paused does nothing, it is safe to call Resume repeatedly and concurrently.
+	Resume()
+
+	// SetIdleTimeout changes how long workers may idle before they stop, for example shorter under memory pressure or longer during bursty workloads.
+	// Workers spawned afterwards use the new timeout, and existing workers pick it up the next time they start idling.
+	// Workers kept alive as the minimum number of workers still never stop, see WorkerBoundsOpt.
+	//
+	// Parameters:
+	//   - d: The new idle timeout, a non-positive value keeps workers alive until the pool is stopped.
+	SetIdleTimeout(d time.Duration)
+
+	// Stats returns a consistent snapshot of the pool's workers, queue and cumulative task counters.
+	// This is useful for tuning the maximum number of workers and the queue size.
+	//
+	// Returns:
+	//   - PoolStats: The current statistics of the pool.
+	Stats() PoolStats
+
+	// Shutdown gracefully closes the pool: new submissions are rejected with ErrPoolClosed, while the workers finish every task that is already queued.
+	// A stopped or paused pool is started and resumed so the queue can drain. Shutdown returns once every queued and running task has finished
+	// and the workers have exited, or once the context is done. In that case the tasks still queued are dropped, they are reported with ErrTaskDropped
+	// through the same paths as any other task error, the context of the running tasks is cancelled, and Shutdown returns without waiting for them.
+	//
+	// Note: like Close, Shutdown must not be called concurrently with SubmitTask.
+	//
+	// Parameters:
+	//   - ctx: The context that bounds how long to wait for the queue to drain.
+	//
+	// Returns:
+	//   - error: nil if every task finished, otherwise an error wrapping the context's error that reports how many tasks were dropped.
+	Shutdown(ctx context.Context) error
+
+	// Stop pauses the pool by stopping all of its workers, it blocks until every worker has finished its current task and exited.
+	// It does not clear the task queue, so any tasks that are currently in the queue will remain there and be picked up once the pool is started again.
+	// Tasks submitted while the pool is stopped are queued as well, so Wait blocks until the pool is started again if any tasks are queued.
+	// It is safe to call Stop any number of times and from any goroutine, including concurrently and after every worker has already idled out,
+	// each call returns once the workers that were running when it was called have exited.
+	//
+	// Note: Stop must not be called from a task running on the pool, as it would wait on the worker running it.
 	Stop()
 
-	// Start re-starts the task handler so workers can be assigned tasks.
+	// Start resumes a stopped pool, spawning workers up to the maximum number of workers so queued tasks are processed again.
+	// Calling Start on a running pool does nothing, and calling it on a closed pool has no effect.
 	Start()
 
-	// SubmitTask submits a task to the pool for processing.
-	// It does not block the caller and returns immediately after submitting the task.
+	// SubmitTask submits a task to the pool for processing with PriorityNormal.
+	// It returns immediately after submitting the task, unless the task queue is full, in which case it blocks until there is space.
+	// A queue that is allowed to grow with GrowQueueOpt is only full once its overflow limit is reached.
+	// Use TrySubmitTask or SubmitTaskCtx to avoid blocking indefinitely on a full queue.
 	// The task will be processed by one of the available workers in the pool.
 	//
 	// Parameters:
 	//   - t: The task to be submitted.
 	SubmitTask(t Task)
 
+	// SubmitBatch submits a group of tasks to the pool and returns a handle to wait on only those tasks, regardless of other work in the pool.
+	// It blocks the same way SubmitTask does while the task queue is full.
+	// A task of the batch removed from the queue by ClearTaskQueue finishes with ErrTaskDiscarded as its result, so the batch still completes.
+	//
+	// Parameters:
+	//   - tasks: The tasks to be submitted as one batch.
+	//
+	// Returns:
+	//   - *Batch: The handle of the batch.
+	SubmitBatch(tasks []Task) *Batch
+
+	// SubmitTaskCtx submits a task to the pool for processing, blocking only while the task queue is full.
+	// Unlike SubmitTask, it stops waiting for space in the queue once the context is done.
+	//
+	// Parameters:
+	//   - ctx: The context that bounds how long to wait for space in the task queue.
+	//   - t: The task to be submitted.
+	//
+	// Returns:
+	//   - error: ErrPoolClosed if the pool is closed, ErrDuplicateTaskID if the pool tracks tasks and the ID is in use,
+	//     an error wrapping ErrQueueFull and the context's error if the context is done first, nil otherwise.
+	SubmitTaskCtx(ctx context.Context, t Task) error
+
+	// SubmitTaskPriority submits a task to the pool for processing with the given priority, it blocks the same way SubmitTask does.
+	// Every priority level has its own queue of queueSize tasks, and workers take queued tasks from the highest priority level first.
+	// To bound the starvation of low priority tasks, every 8th task a worker takes comes from the lowest non-empty priority level instead,
+	// so PriorityLow tasks keep making progress even while the pool is saturated with higher priority work.
+	//
+	// Parameters:
+	//   - t: The task to be submitted.
+	//   - priority: The priority of the task, values outside of PriorityLow to PriorityHigh are clamped to that range.
+	SubmitTaskPriority(t Task, priority Priority)
+
+	// Status returns the status of the task with the given ID, only tasks of a pool created with TrackTasksOpt are tracked.
+	//
+	// Parameters:
+	//   - id: The ID of the task.
+	//
+	// Returns:
+	//   - TaskStatus: The status of the task.
+	//   - bool: True if the task is tracked, false if tracking is disabled, no task with the ID was submitted, or the task was evicted.
+	Status(id int) (TaskStatus, bool)
+
+	// Result returns the result of the finished task with the given ID, only tasks of a pool created with TrackTasksOpt are tracked.
+	// The status of a task is updated before its result is delivered anywhere else, so a task whose result was received is always reported as finished.
+	//
+	// Parameters:
+	//   - id: The ID of the task.
+	//
+	// Returns:
+	//   - TaskResult: The result of the task.
+	//   - bool: True if the task is tracked and has finished, false otherwise.
+	Result(id int) (TaskResult, bool)
+
+	// SubmitTaskWait submits a task to the pool and blocks until it has been processed.
+	// The task is still delivered to the Results channel if it is in use.
+	//
+	// Parameters:
+	//   - t: The task to be submitted.
+	//
+	// Returns:
+	//   - any: The value returned by the task.
+	//   - error: The error returned by the task.
+	SubmitTaskWait(t Task) (any, error)
+
+	// TrySubmitTask submits a task to the pool for processing without blocking.
+	// If the task queue is full, or the pool is closed, the task is not submitted and none of its callbacks are invoked.
+	//
+	// Parameters:
+	//   - t: The task to be submitted.
+	//
+	// Returns:
+	//   - bool: True if the task was queued, false otherwise.
+	TrySubmitTask(t Task) bool
+
 	// Wait blocks until all tasks in the queue are completed and all workers are idle.
 	// It is a blocking call and will not return until all tasks are processed.
 	// This method is useful for waiting for all tasks to complete before proceeding with the next steps in your program.
@@ -94,69 +338,155 @@ type DynamicWorkerPool interface {
 var _ DynamicWorkerPool = (*dynamicWorkerPool)(nil)
 
 // NewDynamicWorkerPool creates a new dynamic worker pool with the specified maximum number of workers and task queue size.
-// It initializes the pool with the given parameters and starts the worker threads, it has a default idle timeout of 1 second
-func NewDynamicWorkerPool(maxWorkers int, queueSize int, idleTimeout time.Duration) DynamicWorkerPool {
+// It initializes the pool with the given parameters and starts the worker threads.
+// Workers stop once they have idled for the idle timeout, and are recreated on demand as new tasks are submitted.
+//
+// Parameters:
+//   - maxWorkers: The maximum number of workers in the pool, defaults to 1 if less than 1. It is clamped to the bounds set with WorkerBoundsOpt.
+//   - queueSize: The size of the task queue, every priority level has its own queue of this size.
+//   - idleTimeout: The duration a worker may idle before it stops, a non-positive value keeps workers alive until they are stopped.
+//   - options: Optional parameters for the pool, such as an error callback.
+func NewDynamicWorkerPool(maxWorkers int, queueSize int, idleTimeout time.Duration, options ...PoolOption) DynamicWorkerPool {
+	poolOptions := &poolOption{}
+	for _, opt := range options {
+		opt(poolOptions)
+	}
 	if maxWorkers <= 0 {
 		maxWorkers = 1
 	}
+	maxWorkers = max(maxWorkers, poolOptions.MinWorkers)
+	if poolOptions.MaxWorkers > 0 {
+		maxWorkers = min(maxWorkers, poolOptions.MaxWorkers)
+	}
 	pool := &dynamicWorkerPool{
-		mu:          sync.Mutex{},
-		taskQueue:   make(chan Task, queueSize),
-		stopChan:    make(chan int, maxWorkers),
-		idleTimeout: idleTimeout,
-		maxWorkers:  maxWorkers,
+		mu:            sync.Mutex{},
+		results:       make(chan TaskResult, queueSize),
+		errors:        make(chan error, queueSize),
+		onError:       poolOptions.OnError,
+		onTaskStart:   poolOptions.OnTaskStart,
+		onTaskDone:    poolOptions.OnTaskDone,
+		onWorkerStart: poolOptions.OnWorkerStart,
+		onWorkerExit:  poolOptions.OnWorkerExit,
+		onStuckTask:   poolOptions.OnStuckTask,
+		taskTimeout:   poolOptions.TaskTimeout,
+		idleTimeout:   idleTimeout,
+		maxWorkers:    maxWorkers,
+		minWorkers:    poolOptions.MinWorkers,
+		workerCeiling: poolOptions.MaxWorkers,
+	}
+	if poolOptions.TrackTasks {
+		pool.registry = newTaskRegistry(poolOptions.TrackRetention, poolOptions.TrackMaxFinished)
+	}
+	for i := range pool.taskQueues {
+		pool.taskQueues[i] = make(chan Task, queueSize)
 	}
+	if poolOptions.GrowQueue {
+		pool.growQueue = true
+		pool.overflowLimit = poolOptions.OverflowLimit
+		// the overflow is moved into the task queue without blocking, which an unbuffered queue only accepts while a worker is waiting on it
+		if queueSize < 1 {
+			for i := range pool.taskQueues {
+				pool.taskQueues[i] = make(chan Task, 1)
+			}
+		}
+	}
+	pool.pauseChan = make(chan struct{})
 	pool.cond = sync.Cond{L: &pool.mu}
 	pool.poolCtx, pool.poolCancel = context.WithCancel(context.Background())
-	pool.handleWorkerExit = pool.workerExitHandler
+	pool.workerHooks = WorkerHooks{
+		DispatchState: pool.dispatchStateHandler,
+		OnStart:       pool.onWorkerStart,
+		OnExit:        pool.workerExitHandler,
+		OnTaskStart:   pool.taskStartHandler,
+		OnTaskDone:    pool.taskDoneHandler,
+		OnTaskStuck:   pool.taskStuckHandler,
+	}
+	if pool.minWorkers > 0 {
+		pool.workerHooks.OnIdle = pool.workerIdleHandler
+	}
 
 	pool.initWorkers()
 
 	return pool
 }
 
-func (p *dynamicWorkerPool) ClearTaskQueue() {
+func (p *dynamicWorkerPool) ClearTaskQueue() int {
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	// tasks are reserved under the lock, so every task reserved from here on is of the new generation,
+	// and any task of an older generation that is still on its way into the queue is discarded when it is dequeued
+	p.clearGen++
+	var cleared []Task
+	for i, queue := range p.taskQueues {
+		cleared = append(cleared, drainQueue(queue)...)
+		cleared = append(cleared, p.overflow[i]...)
+		p.overflow[i] = nil
+	}
+	p.overflowDepth = 0
+	for _, t := range cleared {
+		p.discardTask(t)
+	}
+	if p.pending == 0 {
+		p.cond.Broadcast()
+	}
+	p.mu.Unlock()
 
-	for len(p.taskQueue) > 0 {
-		<-p.taskQueue
+	for _, t := range cleared {
+		p.deliverResult(t, TaskResult{ID: t.ID, Err: ErrTaskDiscarded})
 	}
+	return len(cleared)
+}
+
+func (p *dynamicWorkerPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	p.Stop()
+
+	// the workers are gone, so anything left in the queue would never run
+	p.rejectQueued(ErrPoolClosed)
 }
 
 func (p *dynamicWorkerPool) DecreaseMaxWorkers(n int) {
-	if n > p.maxWorkers {
-		n = p.maxWorkers
+	if n <= 0 {
+		return
 	}
 
-	removed := 0
-
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	for i, w := range p.workers {
-		if !w.IsActive() {
-			w.Stop()
-			p.workers = slices.Delete(p.workers, i, i+1)
-			removed++
-			if removed >= n {
-				return
-			}
+	p.maxWorkers = max(p.maxWorkers-n, p.minWorkers, 1)
+	excess := len(p.workers) - p.maxWorkers
+
+	// split the workers into the ones to keep and the ones to stop, picking idle workers first, without modifying the slice being iterated
+	var toStop []Worker
+	kept := make([]Worker, 0, len(p.workers))
+	for _, w := range p.workers {
+		if len(toStop) < excess && !w.IsBusy() {
+			toStop = append(toStop, w)
+		} else {
+			kept = append(kept, w)
 		}
 	}
+	if len(toStop) < excess {
+		busy := excess - len(toStop)
+		toStop = append(toStop, kept[:busy]...)
+		kept = kept[busy:]
+	}
+	p.workers = kept
+	p.mu.Unlock()
 
-	// if we removed all inactive workers and still need to remove more, stop active workers
-	for i, w := range p.workers {
-		if w.IsActive() {
-			w.Stop()
-			p.workers = slices.Delete(p.workers, i, i+1)
-			removed++
-			if removed >= n {
-				return
-			}
-		}
+	// worker.Stop blocks until the worker has exited, and the worker's exit handler takes the pool lock, so the lock must not be held here
+	for _, w := range toStop {
+		w.Stop()
 	}
 }
 
+func (p *dynamicWorkerPool) Errors() <-chan error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.errorsEnabled = true
+	return p.errors
+}
+
 func (p *dynamicWorkerPool) GetMaxWorkers() int {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -167,53 +497,261 @@ func (p *dynamicWorkerPool) IncreaseMaxWorkers(n int) {
 	if n <= 0 {
 		return
 	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	p.maxWorkers += n
+	if p.workerCeiling > 0 {
+		p.maxWorkers = min(p.maxWorkers, p.workerCeiling)
+	}
 	for range n {
-		p.addWorker()
+		p.spawnWorker()
 	}
 }
 
 func (p *dynamicWorkerPool) IsWorking() bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	return p.stopped || len(p.taskQueue) > 0 || p.activeWorkers > 0
+	if p.paused {
+		return p.activeWorkers > 0
+	}
+	return p.pending > 0
+}
+
+func (p *dynamicWorkerPool) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused {
+		return
+	}
+	p.paused = true
+	p.resumeChan = make(chan struct{})
+	close(p.pauseChan)
+}
+
+func (p *dynamicWorkerPool) Result(id int) (TaskResult, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.registry == nil {
+		return TaskResult{}, false
+	}
+	e, ok := p.registry.lookup(id)
+	if !ok || e.status == TaskQueued || e.status == TaskRunning {
+		return TaskResult{}, false
+	}
+	return e.result, true
+}
+
+func (p *dynamicWorkerPool) Results() <-chan TaskResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resultsEnabled = true
+	return p.results
+}
+
+func (p *dynamicWorkerPool) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.paused {
+		return
+	}
+	p.paused = false
+	p.pauseChan = make(chan struct{})
+	close(p.resumeChan)
+	p.resumeChan = nil
+	// wake up workers holding a task they dequeued just as dispatch was paused
+	p.cond.Broadcast()
+}
+
+func (p *dynamicWorkerPool) SetIdleTimeout(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idleTimeout = d
+	for _, w := range p.workers {
+		w.SetIdleTimeout(d)
+	}
 }
 
 func (p *dynamicWorkerPool) Start() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if p.activeWorkers == 0 {
-		p.stopped = false
+	if p.closed || !p.stopped {
+		return
+	}
+
+	p.stopped = false
+	p.poolCtx, p.poolCancel = context.WithCancel(context.Background())
+	for len(p.workers) < p.maxWorkers {
+		p.spawnWorker()
 	}
 }
 
-func (p *dynamicWorkerPool) Stop() {
-	p.poolCancel()
-	for _, worker := range p.workers {
-		if worker.IsActive() {
-			worker.Stop()
-		}
+func (p *dynamicWorkerPool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := PoolStats{
+		Workers:       len(p.workers),
+		BusyWorkers:   p.activeWorkers,
+		IdleWorkers:   len(p.workers) - p.activeWorkers,
+		QueueDepth:    p.pending - p.activeWorkers,
+		Overflow:      p.overflowDepth,
+		PeakOverflow:  p.peakOverflow,
+		Paused:        p.paused,
+		StuckTasks:    p.stuck,
+		Submitted:     p.submitted,
+		Completed:     p.completed,
+		Failed:        p.failed,
+		Discarded:     p.discarded,
+		Panics:        p.panics,
+		TotalDuration: p.totalDuration,
+	}
+	if p.ran > 0 {
+		stats.AverageDuration = p.totalDuration / time.Duration(p.ran)
 	}
+	return stats
+}
+
+func (p *dynamicWorkerPool) Status(id int) (TaskStatus, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.activeWorkers = 0
+	if p.registry == nil {
+		return 0, false
+	}
+	e, ok := p.registry.lookup(id)
+	if !ok {
+		return 0, false
+	}
+	return e.status, true
+}
+
+func (p *dynamicWorkerPool) Shutdown(ctx context.Context) error {
+	// the queue only drains while the workers are running
+	p.Resume()
+	p.Start()
+
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		p.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		p.Stop()
+		return nil
+	case <-ctx.Done():
+	}
+
+	// stop the workers without waiting for the tasks they are running, which are told to stop through their context
+	p.mu.Lock()
+	p.poolCancel()
 	p.stopped = true
+	p.cond.Broadcast()
+	workers := slices.Clone(p.workers)
+	p.mu.Unlock()
+	for _, w := range workers {
+		go w.Stop()
+	}
+
+	dropped := p.rejectQueued(ErrTaskDropped)
+	return fmt.Errorf("shutdown did not finish, %d queued tasks were dropped: %w", dropped, ctx.Err())
+}
+
+func (p *dynamicWorkerPool) Stop() {
+	// mark the pool as stopped first so exiting workers are not replaced, and iterate over a copy since workers remove themselves from the pool as they exit
+	p.mu.Lock()
+	p.poolCancel()
+	p.stopped = true
+	// wake up workers holding a task while dispatch is paused, so they can finish it and exit
+	p.cond.Broadcast()
+	workers := slices.Clone(p.workers)
+	p.mu.Unlock()
+
+	// worker.Stop blocks until the worker has exited, and the worker's exit handler takes the pool lock, so the lock must not be held here
+	for _, worker := range workers {
+		worker.Stop()
+	}
 }
 
 func (p *dynamicWorkerPool) SubmitTask(t Task) {
-	// If we have fewer workers than max, and the queue is full, spin up new workers eagerly
-	for len(p.workers) < p.maxWorkers && len(p.taskQueue)/p.maxWorkers > 0 {
-		p.addWorker()
+	p.SubmitTaskPriority(t, PriorityNormal)
+}
+
+func (p *dynamicWorkerPool) SubmitBatch(tasks []Task) *Batch {
+	b := newBatch(len(tasks))
+	for i, t := range tasks {
+		p.SubmitTask(b.wrap(i, t))
 	}
+	return b
+}
 
-	p.taskQueue <- t
+func (p *dynamicWorkerPool) SubmitTaskCtx(ctx context.Context, t Task) error {
+	if err := p.reserveTask(&t); err != nil {
+		return err
+	}
+	t.enqueued = time.Now()
+	if p.queueTask(t, PriorityNormal) {
+		return nil
+	}
+	select {
+	case p.taskQueues[PriorityNormal] <- t:
+		return nil
+	case <-ctx.Done():
+		p.releaseTask(t.ID)
+		return fmt.Errorf("%w: %w", ErrQueueFull, ctx.Err())
+	}
+}
+
+func (p *dynamicWorkerPool) SubmitTaskPriority(t Task, priority Priority) {
+	priority = min(max(priority, PriorityLow), PriorityHigh)
+	if err := p.reserveTask(&t); err != nil {
+		p.mu.Lock()
+		p.submitted++
+		p.mu.Unlock()
+		p.rejectTask(t, err)
+		return
+	}
+	t.enqueued = time.Now()
+	if p.queueTask(t, priority) {
+		return
+	}
+	p.taskQueues[priority] <- t
+}
+
+func (p *dynamicWorkerPool) SubmitTaskWait(t Task) (any, error) {
+	t.result = make(chan TaskResult, 1)
+	p.SubmitTask(t)
+
+	res := <-t.result
+	return res.Value, res.Err
+}
+
+func (p *dynamicWorkerPool) TrySubmitTask(t Task) bool {
+	if p.reserveTask(&t) != nil {
+		return false
+	}
+	t.enqueued = time.Now()
+	if p.queueTask(t, PriorityNormal) {
+		return true
+	}
+	select {
+	case p.taskQueues[PriorityNormal] <- t:
+		return true
+	default:
+		p.releaseTask(t.ID)
+		return false
+	}
 }
 
 func (p *dynamicWorkerPool) Wait() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	for len(p.taskQueue) > 0 || p.activeWorkers > 0 {
+	for p.pending > 0 {
 		p.cond.Wait()
 	}
 }
@@ -221,12 +759,218 @@ func (p *dynamicWorkerPool) Wait() {
 // addWorker adds a new worker to the pool if the maximum number of workers has not been reached.
 // It does not block the caller and returns immediately after adding the worker.
 func (p *dynamicWorkerPool) addWorker() {
-	if len(p.workers) < p.maxWorkers {
-		worker := NewWorker(len(p.workers), p.taskQueue, p.stopChan, p.idleTimeout, p.handleWorkerExit)
-		worker.Start()
-		p.mu.Lock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.spawnWorker()
+}
+
+// spawnWorker creates and starts a new worker if the pool is not stopped and the maximum number of workers has not been reached.
+// The caller must hold the pool lock.
+func (p *dynamicWorkerPool) spawnWorker() {
+	if !p.stopped && len(p.workers) < p.maxWorkers {
+		worker := NewWorker(p.poolCtx, p.nextWorkerID, p.taskQueues, p.idleTimeout, p.workerHooks)
+		p.nextWorkerID++
 		p.workers = append(p.workers, worker)
-		p.mu.Unlock()
+		worker.Start()
+	}
+}
+
+// ensureWorkers spawns a new worker if there are more queued tasks than idle workers and the pool is not stopped.
+// Queued tasks are counted from the pending tasks rather than the queue length, so a task that is about to be queued is accounted for.
+// The caller must hold the pool lock.
+func (p *dynamicWorkerPool) ensureWorkers() {
+	if p.stopped {
+		return
+	}
+	queued := p.pending - p.activeWorkers
+	idle := len(p.workers) - p.activeWorkers
+	if queued > idle {
+		p.spawnWorker()
+	}
+}
+
+// discardTask counts a task removed from the queue by ClearTaskQueue as discarded, the caller must hold the pool lock.
+// Its result, carrying ErrTaskDiscarded, must be delivered with deliverResult once the lock is released, or a SubmitTaskWait caller waiting on it never returns.
+//
+// Parameters:
+//   - t: The discarded task.
+func (p *dynamicWorkerPool) discardTask(t Task) {
+	p.pending--
+	p.discarded++
+	if p.registry != nil {
+		p.registry.finish(t.ID, TaskDiscarded, TaskResult{ID: t.ID, Err: ErrTaskDiscarded})
+	}
+}
+
+// rejectQueued removes every task from the queue, including its overflow, and rejects them with the given error.
+// It is only called once the workers have been told to stop, a task that a worker takes before it notices is run as usual.
+//
+// Parameters:
+//   - err: The reason the tasks are rejected, delivered as their result.
+//
+// Returns:
+//   - int: The number of tasks that were rejected.
+func (p *dynamicWorkerPool) rejectQueued(err error) int {
+	var rejected []Task
+	p.mu.Lock()
+	for i, queue := range p.taskQueues {
+		rejected = append(rejected, drainQueue(queue)...)
+		rejected = append(rejected, p.overflow[i]...)
+		p.overflow[i] = nil
+	}
+	p.overflowDepth = 0
+	if p.registry != nil {
+		for _, t := range rejected {
+			p.registry.finish(t.ID, TaskFailed, TaskResult{ID: t.ID, Err: err})
+		}
+	}
+	p.mu.Unlock()
+
+	for _, t := range rejected {
+		p.rejectTask(t, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending -= len(rejected)
+	if p.pending == 0 {
+		p.cond.Broadcast()
+	}
+	return len(rejected)
+}
+
+// rejectTask finishes a task that will never run, because the pool is closed or its ID is in use, reporting the reason as its result.
+// It is delivered through the same paths as a task that returned the error, but the pending count is left to the caller.
+// The caller must not hold the pool lock.
+//
+// Parameters:
+//   - t: The task to reject.
+//   - err: The reason the task is rejected, ErrPoolClosed, ErrTaskDropped or ErrDuplicateTaskID.
+func (p *dynamicWorkerPool) rejectTask(t Task, err error) {
+	p.deliverResult(t, TaskResult{ID: t.ID, Err: err})
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failed++
+}
+
+// drainQueue takes every task currently in the queue without blocking, a worker may take tasks from it concurrently.
+//
+// Parameters:
+//   - queue: The queue to drain.
+//
+// Returns:
+//   - []Task: The tasks taken from the queue, in queue order.
+func drainQueue(queue chan Task) []Task {
+	var tasks []Task
+	for {
+		select {
+		case t := <-queue:
+			tasks = append(tasks, t)
+		default:
+			return tasks
+		}
+	}
+}
+
+// reserveTask counts a task as pending before it is queued, so Wait can never observe it as neither queued nor running.
+// Since workers stop after idling, a new one is spun up on demand if there are more queued tasks than idle workers.
+// If the task can not be queued after all, the reservation must be undone with releaseTask.
+//
+// Parameters:
+//   - t: The task, tracked as queued if the pool tracks tasks. It is stamped with the current clear generation, see ClearTaskQueue.
+//
+// Returns:
+//   - error: ErrPoolClosed if the pool is closed, or ErrDuplicateTaskID if the pool tracks tasks and the ID is in use, in which case the task must not be queued.
+func (p *dynamicWorkerPool) reserveTask(t *Task) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	if p.registry != nil && !p.registry.add(t.ID) {
+		return ErrDuplicateTaskID
+	}
+	t.clearGen = p.clearGen
+	if t.Deadline.IsZero() && t.Timeout <= 0 {
+		t.Timeout = p.taskTimeout
+	}
+	p.pending++
+	p.submitted++
+	p.ensureWorkers()
+	return nil
+}
+
+// queueTask queues the task without blocking when the queue is allowed to grow, holding it in the overflow if the task queue is full.
+// Tasks of a priority level that already has an overflow go to the back of the overflow, so tasks of the same priority stay in submission order.
+//
+// Parameters:
+//   - t: The task to queue.
+//   - priority: The priority level to queue the task at.
+//
+// Returns:
+//   - bool: True if the task was queued, false if the queue is not allowed to grow or the overflow limit is reached, in which case the caller falls back to the task queue.
+func (p *dynamicWorkerPool) queueTask(t Task, priority Priority) bool {
+	if !p.growQueue {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.overflow[priority]) == 0 {
+		select {
+		case p.taskQueues[priority] <- t:
+			return true
+		default:
+		}
+	}
+	if p.overflowLimit > 0 && p.overflowDepth >= p.overflowLimit {
+		return false
+	}
+	p.overflow[priority] = append(p.overflow[priority], t)
+	p.overflowDepth++
+	p.peakOverflow = max(p.peakOverflow, p.overflowDepth)
+	return true
+}
+
+// refillQueues moves tasks from the overflow into the task queue of the same priority level while there is space in it, oldest first.
+// It is called with the pool lock held whenever a worker has taken a task from the queue.
+func (p *dynamicWorkerPool) refillQueues() {
+	for i := range p.overflow {
+		moved := 0
+	fill:
+		for _, t := range p.overflow[i] {
+			select {
+			case p.taskQueues[i] <- t:
+				moved++
+			default:
+				break fill
+			}
+		}
+		// drop the references to the moved tasks so they can be collected once they have run
+		clear(p.overflow[i][:moved])
+		p.overflow[i] = p.overflow[i][moved:]
+		p.overflowDepth -= moved
+		if len(p.overflow[i]) == 0 {
+			p.overflow[i] = nil
+		}
+	}
+}
+
+// releaseTask undoes the reservation made by reserveTask for a task that was never queued.
+//
+// Parameters:
+//   - id: The ID of the task.
+func (p *dynamicWorkerPool) releaseTask(id int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.registry != nil {
+		p.registry.remove(id)
+	}
+	p.pending--
+	p.submitted--
+	if p.pending == 0 {
+		p.cond.Broadcast()
 	}
 }
 
@@ -234,30 +978,188 @@ func (p *dynamicWorkerPool) addWorker() {
 // It creates the workers and starts them, allowing them to process tasks from the task queue.
 // This method is called when the pool is created and sets up the initial state of the worker pool.
 func (p *dynamicWorkerPool) initWorkers() {
-	for i := range p.maxWorkers {
-		worker := NewWorker(i, p.taskQueue, p.stopChan, p.idleTimeout, p.handleWorkerExit)
-		worker.Start()
-		p.mu.Lock()
-		p.workers = append(p.workers, worker)
-		p.mu.Unlock()
+	for range p.maxWorkers {
+		p.addWorker()
+	}
+}
+
+// workerIdleHandler is the callback function that is called when a worker reaches its idle timeout, it is only set when the pool has a minimum number of workers.
+// The worker is allowed to stop, and removed from the pool right away so concurrently idling workers can not take the pool below its minimum, as long as more than the minimum number of workers remain.
+//
+// Parameters:
+//   - id: The ID of the idle worker.
+//
+// Returns:
+//   - bool: True if the worker should stop, false if it should keep waiting for tasks.
+func (p *dynamicWorkerPool) workerIdleHandler(id int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.workers) <= p.minWorkers {
+		return false
 	}
+	p.workers = slices.DeleteFunc(p.workers, func(w Worker) bool {
+		return w.ID() == id
+	})
+	return true
 }
 
 // workerExitHandler is the callback function that is called when a worker exits.
-// It removes the worker from the pool and checks if all workers are idle and the task queue is empty.
-// If so, it signals the condition variable to wake up any waiting goroutines.
+// It removes the worker from the pool, a worker only exits between tasks so the busy count is left untouched.
+// If the worker idled out just as a task was submitted, a replacement is spawned so the task is not stranded in the queue.
+// The OnWorkerExitOpt hook is invoked afterwards if one is set.
 func (p *dynamicWorkerPool) workerExitHandler(id int) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
 	for i, w := range p.workers {
 		if w.ID() == id {
 			p.workers = append(p.workers[:i], p.workers[i+1:]...)
 			break
 		}
 	}
+	p.ensureWorkers()
+	p.mu.Unlock()
+
+	if p.onWorkerExit != nil {
+		p.onWorkerExit(id)
+	}
+}
+
+// dispatchStateHandler is the callback function that workers call before taking a task, to learn whether dispatch is paused.
+//
+// Returns:
+//   - <-chan struct{}: A channel that is closed once dispatch is paused.
+//   - <-chan struct{}: A channel that is closed once dispatch is resumed, nil if dispatch is not paused.
+func (p *dynamicWorkerPool) dispatchStateHandler() (<-chan struct{}, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pauseChan, p.resumeChan
+}
+
+// taskStartHandler is the callback function that is called when a worker dequeues a task, before it is run.
+// A worker can dequeue a task just as dispatch is paused, in which case the task is held until dispatch is resumed or the pool is stopped,
+// so no task starts while dispatch is paused. It marks the worker as busy for the duration of the task, then invokes the OnTaskStartOpt hook if one is set.
+// A task submitted before the queue was last cleared, which reached the queue only after it was cleared, is discarded instead,
+// and finishes with ErrTaskDiscarded the same way as the tasks ClearTaskQueue removed.
+//
+// Returns:
+//   - bool: True if the worker should run the task, false if it was discarded.
+func (p *dynamicWorkerPool) taskStartHandler(workerID int, t Task) bool {
+	p.mu.Lock()
+	if p.overflowDepth > 0 {
+		p.refillQueues()
+	}
+	for p.paused && !p.stopped {
+		p.cond.Wait()
+	}
+	if t.clearGen != p.clearGen {
+		p.discardTask(t)
+		if p.pending == 0 {
+			p.cond.Broadcast()
+		}
+		p.mu.Unlock()
+		p.deliverResult(t, TaskResult{ID: t.ID, Err: ErrTaskDiscarded})
+		return false
+	}
+	p.activeWorkers++
+	if p.registry != nil {
+		p.registry.start(t.ID)
+	}
+	p.mu.Unlock()
+
+	if p.onTaskStart != nil {
+		p.onTaskStart(workerID, t.ID)
+	}
+	return true
+}
+
+// taskStuckHandler is the callback function that is called when a worker abandons a task that exceeded its deadline, before its result is delivered.
+// It counts the task as stuck until it returns, then invokes the OnStuckTaskOpt hook if one is set.
+//
+// Returns:
+//   - func(): The function to call once the abandoned task has returned, which stops counting it as stuck.
+func (p *dynamicWorkerPool) taskStuckHandler(workerID int, t Task) func() {
+	p.mu.Lock()
+	p.stuck++
+	p.mu.Unlock()
+
+	if p.onStuckTask != nil {
+		p.onStuckTask(workerID, t.ID)
+	}
+	return func() {
+		p.mu.Lock()
+		p.stuck--
+		p.mu.Unlock()
+	}
+}
+
+// taskDoneHandler is the callback function that is called when a worker finishes processing a task.
+// It delivers the task's result and invokes the OnTaskDoneOpt hook if one is set,
+// then the task stops counting as pending, and any callers blocked in Wait are woken up if it was the last one.
+func (p *dynamicWorkerPool) taskDoneHandler(workerID int, t Task, res TaskResult) {
+	// the tracked status is final before the result is delivered, so whoever receives it never sees the task as running
+	if p.registry != nil {
+		status := TaskCompleted
+		if res.Err != nil {
+			status = TaskFailed
+		}
+		p.mu.Lock()
+		p.registry.finish(t.ID, status, res)
+		p.mu.Unlock()
+	}
+	p.deliverResult(t, res)
+	if p.onTaskDone != nil {
+		p.onTaskDone(workerID, res.ID, res.Duration, res.Err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ran++
+	p.totalDuration += res.Duration
+	if res.Err != nil {
+		p.failed++
+		if _, ok := res.Err.(*PanicError); ok {
+			p.panics++
+		}
+	} else {
+		p.completed++
+	}
 	p.activeWorkers--
+	p.pending--
+	if p.pending == 0 {
+		p.cond.Broadcast()
+	}
+}
+
+// deliverResult reports a failed task to the error callbacks and the Errors channel if it is in use,
+// then delivers the result to the waiting SubmitTaskWait caller, if any, and to the Results channel if it is in use.
+// None of the callbacks or channel sends happen while the pool lock is held.
+//
+// Parameters:
+//   - t: The task the result belongs to.
+//   - res: The result of the task.
+func (p *dynamicWorkerPool) deliverResult(t Task, res TaskResult) {
+	p.mu.Lock()
+	resultsEnabled, errorsEnabled := p.resultsEnabled, p.errorsEnabled
+	p.mu.Unlock()
+
+	if res.Err != nil {
+		if t.ErrHandler != nil {
+			t.ErrHandler(res.Err)
+		}
+		if p.onError != nil {
+			p.onError(res.ID, res.Err)
+		}
+		if errorsEnabled {
+			p.errors <- &TaskError{ID: res.ID, Err: res.Err}
+		}
+	}
 
-	if len(p.taskQueue) == 0 && p.activeWorkers == 0 {
-		p.cond.Signal()
+	if t.result != nil {
+		t.result <- res
+	}
+	if t.done != nil {
+		t.done(res)
+	}
+	if resultsEnabled {
+		p.results <- res
 	}
 }
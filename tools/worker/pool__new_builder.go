@@ -0,0 +1,162 @@
+package worker
+
+import "time"
+
+type poolOption struct {
+	OnError func(taskID int, err error)
+
+	MinWorkers int
+	MaxWorkers int
+
+	GrowQueue     bool
+	OverflowLimit int
+
+	TrackTasks       bool
+	TrackRetention   time.Duration
+	TrackMaxFinished int
+
+	OnTaskStart   func(workerID, taskID int)
+	OnTaskDone    func(workerID, taskID int, d time.Duration, err error)
+	OnWorkerStart func(workerID int)
+	OnWorkerExit  func(workerID int)
+
+	TaskTimeout time.Duration
+	OnStuckTask func(workerID, taskID int)
+}
+
+// PoolOption is the builder option function for creating a new dynamic worker pool.
+type PoolOption func(*poolOption)
+
+// OnErrorOpt sets a callback that is invoked whenever a task returns a non-nil error.
+// The callback is invoked from the worker goroutine that ran the task, after the task has finished, and never while the pool's locks are held.
+// A slow callback will hold up the worker that invoked it, so long running work should be handed off to another goroutine.
+//
+// Parameters:
+//   - onError: The callback to invoke with the ID of the failed task and the error it returned.
+func OnErrorOpt(onError func(taskID int, err error)) PoolOption {
+	return func(opt *poolOption) {
+		opt.OnError = onError
+	}
+}
+
+// OnTaskStartOpt sets a hook that is invoked whenever a worker starts running a task.
+// The hook is invoked from the worker goroutine that runs the task, right before the task runs, and never while the pool's locks are held.
+// A slow hook will hold up the worker that invoked it, but never the rest of the pool.
+//
+// Parameters:
+//   - onTaskStart: The hook to invoke with the ID of the worker and the ID of the task it is about to run.
+func OnTaskStartOpt(onTaskStart func(workerID, taskID int)) PoolOption {
+	return func(opt *poolOption) {
+		opt.OnTaskStart = onTaskStart
+	}
+}
+
+// OnTaskDoneOpt sets a hook that is invoked whenever a worker finishes running a task, whether it succeeded or not.
+// The hook is invoked from the worker goroutine that ran the task, after the task's result has been delivered, and never while the pool's locks are held.
+// The hook is invoked before the task is counted as finished, so Wait does not return until the hooks of every waited on task have returned.
+// The time the task waited in the queue before it was run is reported in TaskResult.QueueWait.
+//
+// Parameters:
+//   - onTaskDone: The hook to invoke with the ID of the worker, the ID of the task, how long the task ran for and the error it returned.
+func OnTaskDoneOpt(onTaskDone func(workerID, taskID int, d time.Duration, err error)) PoolOption {
+	return func(opt *poolOption) {
+		opt.OnTaskDone = onTaskDone
+	}
+}
+
+// OnWorkerStartOpt sets a hook that is invoked whenever a worker is started, including workers spawned on demand.
+// The hook is invoked from the new worker's goroutine before it takes its first task, and never while the pool's locks are held.
+//
+// Parameters:
+//   - onWorkerStart: The hook to invoke with the ID of the started worker.
+func OnWorkerStartOpt(onWorkerStart func(workerID int)) PoolOption {
+	return func(opt *poolOption) {
+		opt.OnWorkerStart = onWorkerStart
+	}
+}
+
+// OnWorkerExitOpt sets a hook that is invoked whenever a worker exits, because it idled out, was removed or the pool was stopped.
+// The hook is invoked from the exiting worker's goroutine, and never while the pool's locks are held. Stop and DecreaseMaxWorkers wait for the hooks of the workers they stop.
+//
+// Parameters:
+//   - onWorkerExit: The hook to invoke with the ID of the exited worker.
+func OnWorkerExitOpt(onWorkerExit func(workerID int)) PoolOption {
+	return func(opt *poolOption) {
+		opt.OnWorkerExit = onWorkerExit
+	}
+}
+
+// WorkerBoundsOpt sets the bounds of the maximum number of workers, IncreaseMaxWorkers and DecreaseMaxWorkers never move the maximum outside of them.
+// The pool also keeps at least minWorkers workers alive through their idle timeout, so it shrinks while idle but never below the floor.
+// This prevents both an unbounded number of goroutines and a pool that is too small to make progress.
+//
+// Parameters:
+//   - minWorkers: The floor of the maximum number of workers, and the number of workers kept alive while idle. Zero keeps the default floor of 1 and lets every worker idle out.
+//   - maxWorkers: The ceiling of the maximum number of workers, zero means there is no ceiling.
+func WorkerBoundsOpt(minWorkers, maxWorkers int) PoolOption {
+	return func(opt *poolOption) {
+		opt.MinWorkers = max(minWorkers, 0)
+		opt.MaxWorkers = max(maxWorkers, 0)
+		if opt.MaxWorkers > 0 {
+			opt.MaxWorkers = max(opt.MaxWorkers, opt.MinWorkers)
+		}
+	}
+}
+
+// GrowQueueOpt lets the task queue grow beyond its size on demand, so submitting a task does not block while the queue is full.
+// Tasks that do not fit in the queue are held in an overflow, and moved into the queue in submission order as workers take tasks from it.
+// The number of tasks in the overflow is reported by Stats, so the memory growth of the queue can be observed.
+//
+// Once the overflow holds limit tasks the queue is full again: SubmitTask blocks until there is space, TrySubmitTask returns false,
+// and SubmitTaskCtx returns an error wrapping ErrQueueFull once its context is done.
+//
+// Parameters:
+//   - limit: The maximum number of tasks held in the overflow across all priority levels, zero or less means the queue grows without a limit.
+func GrowQueueOpt(limit int) PoolOption {
+	return func(opt *poolOption) {
+		opt.GrowQueue = true
+		opt.OverflowLimit = max(limit, 0)
+	}
+}
+
+// TrackTasksOpt tracks the status and result of every submitted task by its ID, so it can be looked up with Status and Result, such as for a monitoring dashboard.
+// Queued and running tasks are always tracked, finished tasks are kept until they are older than the retention or more tasks have finished since than the maximum.
+// If neither limit is set, the 1000 most recently finished tasks are kept.
+//
+// While tracking is enabled task IDs must be unique among the tasks that are queued or running, a task submitted with the ID of such a task is rejected with ErrDuplicateTaskID
+// the same way a closed pool rejects tasks. The ID of a finished task can be reused, which replaces its tracked status and result.
+//
+// Parameters:
+//   - retention: How long a finished task is kept, zero or less means there is no limit.
+//   - maxFinished: How many finished tasks are kept, zero or less means there is no limit.
+func TrackTasksOpt(retention time.Duration, maxFinished int) PoolOption {
+	return func(opt *poolOption) {
+		opt.TrackTasks = true
+		opt.TrackRetention = retention
+		opt.TrackMaxFinished = maxFinished
+	}
+}
+
+// TaskTimeoutOpt sets the timeout of every submitted task that has neither a Deadline nor a Timeout of its own, so a task that blocks forever can not hang the pool.
+// Once a task runs past its timeout the worker stops waiting for it, reports an error wrapping ErrTaskTimeout and goes on to the next task,
+// leaving the stuck task to finish in the background. The stuck task is reported to the OnStuckTaskOpt hook and counted in the StuckTasks stat until it returns.
+//
+// Parameters:
+//   - timeout: How long a task may run once a worker starts it, zero or less means tasks run without a limit unless they set their own.
+func TaskTimeoutOpt(timeout time.Duration) PoolOption {
+	return func(opt *poolOption) {
+		opt.TaskTimeout = max(timeout, 0)
+	}
+}
+
+// OnStuckTaskOpt sets a hook that is invoked whenever a worker abandons a task that exceeded its deadline, such as the timeout set with TaskTimeoutOpt.
+// The task may still be running in the background, since only a task that honors its context stops once its deadline passes.
+// The hook is invoked from the worker goroutine that abandoned the task, before the task's result is delivered, and never while the pool's locks are held.
+//
+// Parameters:
+//   - onStuckTask: The hook to invoke with the ID of the worker and the ID of the abandoned task.
+func OnStuckTaskOpt(onStuckTask func(workerID, taskID int)) PoolOption {
+	return func(opt *poolOption) {
+		opt.OnStuckTask = onStuckTask
+	}
+}
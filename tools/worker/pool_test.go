@@ -0,0 +1,893 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls the condition until it holds, failing the test if it does not within a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// blockWorkers submits a task for each of the given number of workers that blocks until the returned function is called,
+// and waits until every one of them has started. The returned function is safe to call more than once.
+func blockWorkers(t *testing.T, p DynamicWorkerPool, n int) func() {
+	t.Helper()
+	gate := make(chan struct{})
+	for i := range n {
+		p.SubmitTask(Task{ID: -1 - i, Do: func() (any, error) {
+			<-gate
+			return nil, nil
+		}})
+	}
+	waitFor(t, "the blocking tasks to start", func() bool {
+		return p.Stats().BusyWorkers == n
+	})
+	return sync.OnceFunc(func() { close(gate) })
+}
+
+// queued returns the number of tasks in the task queue of the given priority level.
+func queued(p DynamicWorkerPool, priority Priority) int {
+	return len(p.(*dynamicWorkerPool).taskQueues[priority])
+}
+
+func TestClearTaskQueueDeliversErrTaskDiscardedToSubmitTaskWait(t *testing.T) {
+	p := NewDynamicWorkerPool(1, 4, time.Minute)
+	defer p.Stop()
+	release := blockWorkers(t, p, 1)
+	defer release()
+
+	ran := false
+	errc := make(chan error, 1)
+	go func() {
+		_, err := p.SubmitTaskWait(Task{ID: 1, Do: func() (any, error) {
+			ran = true
+			return nil, nil
+		}})
+		errc <- err
+	}()
+	waitFor(t, "the task to be queued", func() bool {
+		return queued(p, PriorityNormal) == 1
+	})
+
+	if n := p.ClearTaskQueue(); n != 1 {
+		t.Fatalf("ClearTaskQueue() = %d, want 1", n)
+	}
+	select {
+	case err := <-errc:
+		if !errors.Is(err, ErrTaskDiscarded) {
+			t.Fatalf("SubmitTaskWait() error = %v, want %v", err, ErrTaskDiscarded)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SubmitTaskWait did not return after its task was cleared from the queue")
+	}
+
+	release()
+	p.Wait()
+	if ran {
+		t.Error("the cleared task ran")
+	}
+	if got := p.Stats().Discarded; got != 1 {
+		t.Errorf("Stats().Discarded = %d, want 1", got)
+	}
+}
+
+func TestTaskQueuedAfterClearIsDiscardedWithResult(t *testing.T) {
+	p := NewDynamicWorkerPool(1, 4, time.Minute).(*dynamicWorkerPool)
+	defer p.Stop()
+
+	// reserve the task the way SubmitTask does, and clear the queue before it reaches it, as a concurrent ClearTaskQueue would
+	task := Task{ID: 1, Do: func() (any, error) { return "ran", nil }, result: make(chan TaskResult, 1)}
+	if err := p.reserveTask(&task); err != nil {
+		t.Fatalf("reserveTask() error = %v", err)
+	}
+	if n := p.ClearTaskQueue(); n != 0 {
+		t.Fatalf("ClearTaskQueue() = %d, want 0", n)
+	}
+	p.taskQueues[PriorityNormal] <- task
+
+	select {
+	case res := <-task.result:
+		if !errors.Is(res.Err, ErrTaskDiscarded) {
+			t.Fatalf("result = %v, %v, want %v", res.Value, res.Err, ErrTaskDiscarded)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no result was delivered for the task dequeued after the clear")
+	}
+	p.Wait()
+	if got := p.Stats().Discarded; got != 1 {
+		t.Errorf("Stats().Discarded = %d, want 1", got)
+	}
+}
+
+// TestClearTaskQueueWhileDraining clears the queue over and over while the workers drain it and callers block in SubmitTaskWait and on batches.
+// Every caller must return, with either the task's result or ErrTaskDiscarded, and every task must be counted exactly once. Run it with -race.
+func TestClearTaskQueueWhileDraining(t *testing.T) {
+	const (
+		callers  = 16
+		perCall  = 50
+		batches  = 4
+		perBatch = 25
+	)
+	p := NewDynamicWorkerPool(4, 8, time.Minute, GrowQueueOpt(0))
+	defer p.Stop()
+
+	do := func() (any, error) {
+		time.Sleep(10 * time.Microsecond)
+		return "ran", nil
+	}
+	check := func(what string, err error) {
+		if err != nil && !errors.Is(err, ErrTaskDiscarded) {
+			t.Errorf("%s error = %v, want nil or %v", what, err, ErrTaskDiscarded)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for c := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perCall {
+				_, err := p.SubmitTaskWait(Task{ID: c*perCall + i, Do: do})
+				check("SubmitTaskWait()", err)
+			}
+		}()
+	}
+	for range batches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tasks := make([]Task, perBatch)
+			for i := range tasks {
+				tasks[i] = Task{Do: do}
+			}
+			b := p.SubmitBatch(tasks)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := b.Wait(ctx); err != nil {
+				t.Errorf("Batch.Wait() error = %v", err)
+				return
+			}
+			for _, res := range b.Results() {
+				check("batch result", res.Err)
+			}
+		}()
+	}
+
+	stop := make(chan struct{})
+	cleared := make(chan struct{})
+	go func() {
+		defer close(cleared)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				p.ClearTaskQueue()
+				time.Sleep(50 * time.Microsecond)
+			}
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		t.Fatal("callers are still blocked, a discarded task's result was never delivered")
+	}
+	close(stop)
+	<-cleared
+	p.Wait()
+
+	stats := p.Stats()
+	want := int64(callers*perCall + batches*perBatch)
+	if stats.Submitted != want || stats.Completed+stats.Failed+stats.Discarded != want {
+		t.Errorf("Stats() = submitted %d, completed %d, failed %d, discarded %d, want every one of %d tasks counted once",
+			stats.Submitted, stats.Completed, stats.Failed, stats.Discarded, want)
+	}
+}
+
+func TestWaitBlocksUntilInFlightTasksFinish(t *testing.T) {
+	p := NewDynamicWorkerPool(2, 4, time.Minute)
+	defer p.Stop()
+	release := blockWorkers(t, p, 2)
+	defer release()
+
+	waited := make(chan struct{})
+	go func() {
+		p.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("Wait returned while tasks were still running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if !p.IsWorking() {
+		t.Error("IsWorking() = false while tasks were still running")
+	}
+
+	release()
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return once the running tasks finished")
+	}
+	if got := p.Stats().Completed; got != 2 {
+		t.Errorf("Stats().Completed = %d, want 2", got)
+	}
+}
+
+func TestIdleWorkersStopAndRespawnOnDemand(t *testing.T) {
+	var started atomic.Int32
+	p := NewDynamicWorkerPool(2, 4, 20*time.Millisecond, OnWorkerStartOpt(func(int) {
+		started.Add(1)
+	}))
+	defer p.Stop()
+
+	waitFor(t, "the idle workers to stop", func() bool {
+		return p.Stats().Workers == 0
+	})
+	if got := started.Load(); got != 2 {
+		t.Fatalf("%d workers started with the pool, want 2", got)
+	}
+
+	v, err := p.SubmitTaskWait(Task{ID: 1, Do: func() (any, error) { return "ran", nil }})
+	if err != nil || v != "ran" {
+		t.Fatalf("SubmitTaskWait() = %v, %v, want ran, nil", v, err)
+	}
+	if got := started.Load(); got != 3 {
+		t.Errorf("%d workers started in total, want a single worker respawned for the task", got)
+	}
+
+	waitFor(t, "the respawned worker to stop again", func() bool {
+		return p.Stats().Workers == 0
+	})
+}
+
+// TestStopConcurrentAndIdempotent calls Stop and Start from many goroutines at once while workers idle out and tasks are submitted,
+// none of the calls may panic or deadlock and every task must still run once the pool is started for good. Run it with -race.
+func TestStopConcurrentAndIdempotent(t *testing.T) {
+	const (
+		callers = 10
+		rounds  = 50
+		tasks   = 200
+	)
+	p := NewDynamicWorkerPool(4, 8, time.Millisecond, GrowQueueOpt(0))
+
+	var ran atomic.Int32
+	var wg sync.WaitGroup
+	for c := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range rounds {
+				if (c+r)%2 == 0 {
+					p.Stop()
+				} else {
+					p.Start()
+				}
+			}
+		}()
+	}
+	for i := range tasks {
+		p.SubmitTask(Task{ID: i, Do: func() (any, error) {
+			ran.Add(1)
+			return nil, nil
+		}})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("concurrent Stop and Start calls deadlocked")
+	}
+
+	p.Start()
+	p.Wait()
+	if got := ran.Load(); got != tasks {
+		t.Errorf("%d tasks ran, want %d", got, tasks)
+	}
+
+	// every worker has idled out or been stopped by now, stopping the pool any number of times must still return
+	p.Stop()
+	p.Stop()
+	if got := p.Stats().Workers; got != 0 {
+		t.Errorf("Stats().Workers = %d after Stop, want 0", got)
+	}
+}
+
+func TestSubmitTaskPriorityRunsHighPriorityFirst(t *testing.T) {
+	p := NewDynamicWorkerPool(1, 8, time.Minute)
+	defer p.Stop()
+	release := blockWorkers(t, p, 1)
+	defer release()
+
+	var mu sync.Mutex
+	var order []int
+	record := func(id int) func() (any, error) {
+		return func() (any, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, id)
+			return nil, nil
+		}
+	}
+
+	// interleave the submissions, so the order the tasks run in only depends on their priority
+	for i := range 4 {
+		p.SubmitTaskPriority(Task{ID: i, Do: record(i)}, PriorityLow)
+		p.SubmitTaskPriority(Task{ID: 10 + i, Do: record(10 + i)}, PriorityHigh)
+	}
+	waitFor(t, "the tasks to be queued", func() bool {
+		return queued(p, PriorityLow) == 4 && queued(p, PriorityHigh) == 4
+	})
+
+	release()
+	p.Wait()
+	want := []int{10, 11, 12, 13, 0, 1, 2, 3}
+	if !slices.Equal(order, want) {
+		t.Errorf("tasks ran in the order %v, want %v", order, want)
+	}
+}
+
+func TestShutdownDrainsQueue(t *testing.T) {
+	p := NewDynamicWorkerPool(2, 4, time.Minute, GrowQueueOpt(0))
+
+	const tasks = 20
+	var ran atomic.Int32
+	for i := range tasks {
+		p.SubmitTask(Task{ID: i, Do: func() (any, error) {
+			time.Sleep(time.Millisecond)
+			ran.Add(1)
+			return nil, nil
+		}})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if got := ran.Load(); got != tasks {
+		t.Errorf("%d tasks ran before Shutdown returned, want %d", got, tasks)
+	}
+	if stats := p.Stats(); stats.Completed != tasks || stats.Workers != 0 {
+		t.Errorf("Stats() = completed %d, workers %d, want completed %d, workers 0", stats.Completed, stats.Workers, tasks)
+	}
+}
+
+func TestShutdownTimeoutDropsQueuedTasks(t *testing.T) {
+	var mu sync.Mutex
+	dropped := map[int]error{}
+	p := NewDynamicWorkerPool(1, 8, time.Minute, OnErrorOpt(func(id int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dropped[id] = err
+	}))
+	release := blockWorkers(t, p, 1)
+	defer release()
+
+	var ran atomic.Int32
+	for i := range 5 {
+		p.SubmitTask(Task{ID: i, Do: func() (any, error) {
+			ran.Add(1)
+			return nil, nil
+		}})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := p.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	mu.Lock()
+	for i := range 5 {
+		if !errors.Is(dropped[i], ErrTaskDropped) {
+			t.Errorf("task %d was reported with %v, want %v", i, dropped[i], ErrTaskDropped)
+		}
+	}
+	mu.Unlock()
+	release()
+	p.Wait()
+	if got := ran.Load(); got != 0 {
+		t.Errorf("%d dropped tasks ran", got)
+	}
+}
+
+func TestSubmitAfterShutdownIsRejected(t *testing.T) {
+	p := NewDynamicWorkerPool(1, 4, time.Minute)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	ran := false
+	task := Task{ID: 1, Do: func() (any, error) {
+		ran = true
+		return nil, nil
+	}}
+	if _, err := p.SubmitTaskWait(task); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("SubmitTaskWait() error = %v, want %v", err, ErrPoolClosed)
+	}
+	if err := p.SubmitTaskCtx(context.Background(), task); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("SubmitTaskCtx() error = %v, want %v", err, ErrPoolClosed)
+	}
+	if p.TrySubmitTask(task) {
+		t.Error("TrySubmitTask() = true after Shutdown")
+	}
+
+	// a closed pool can not be started again
+	p.Start()
+	p.Wait()
+	if ran {
+		t.Error("a task submitted after Shutdown ran")
+	}
+}
+
+func TestPauseHoldsTasksUntilResume(t *testing.T) {
+	p := NewDynamicWorkerPool(2, 16, time.Minute)
+	defer p.Stop()
+
+	p.Pause()
+	const tasks = 10
+	var started atomic.Int32
+	for i := range tasks {
+		p.SubmitTask(Task{ID: i, Do: func() (any, error) {
+			started.Add(1)
+			return nil, nil
+		}})
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if got := started.Load(); got != 0 {
+		t.Fatalf("%d tasks started while the pool was paused", got)
+	}
+	stats := p.Stats()
+	if !stats.Paused || stats.BusyWorkers != 0 || stats.QueueDepth != tasks {
+		t.Errorf("Stats() = paused %v, busy %d, queued %d, want paused, no busy workers and %d queued tasks",
+			stats.Paused, stats.BusyWorkers, stats.QueueDepth, tasks)
+	}
+	if p.IsWorking() {
+		t.Error("IsWorking() = true while nothing runs on a paused pool")
+	}
+
+	p.Resume()
+	p.Wait()
+	if got := started.Load(); got != tasks {
+		t.Errorf("%d tasks ran after Resume, want %d", got, tasks)
+	}
+	if p.Stats().Paused {
+		t.Error("Stats().Paused = true after Resume")
+	}
+}
+
+func TestFullQueueRejectsWithoutBlocking(t *testing.T) {
+	p := NewDynamicWorkerPool(1, 1, time.Minute)
+	defer p.Stop()
+	release := blockWorkers(t, p, 1)
+	defer release()
+
+	var ran atomic.Int32
+	task := func(id int) Task {
+		return Task{ID: id, Do: func() (any, error) {
+			ran.Add(1)
+			return nil, nil
+		}}
+	}
+	if !p.TrySubmitTask(task(1)) {
+		t.Fatal("TrySubmitTask() = false with space in the queue")
+	}
+
+	start := time.Now()
+	if p.TrySubmitTask(task(2)) {
+		t.Fatal("TrySubmitTask() = true with the queue full")
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("TrySubmitTask took %v on a full queue, want it to fail fast", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := p.SubmitTaskCtx(ctx, task(3))
+	if !errors.Is(err, ErrQueueFull) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SubmitTaskCtx() error = %v, want %v wrapping %v", err, ErrQueueFull, context.DeadlineExceeded)
+	}
+
+	release()
+	p.Wait()
+	if got := ran.Load(); got != 1 {
+		t.Errorf("%d tasks ran, want only the one that was queued", got)
+	}
+	// the blocking task and the queued one, the rejected submissions are not counted
+	if got := p.Stats().Submitted; got != 2 {
+		t.Errorf("Stats().Submitted = %d, want 2", got)
+	}
+}
+
+func TestPanickingTaskDoesNotKillWorker(t *testing.T) {
+	p := NewDynamicWorkerPool(1, 4, time.Minute)
+	defer p.Stop()
+
+	_, err := p.SubmitTaskWait(Task{ID: 1, Do: func() (any, error) {
+		panic("boom")
+	}})
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("SubmitTaskWait() error = %v, want a *PanicError", err)
+	}
+	if panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+		t.Errorf("PanicError = {Value: %v, Stack: %d bytes}, want the panic value and a stack trace", panicErr.Value, len(panicErr.Stack))
+	}
+
+	v, err := p.SubmitTaskWait(Task{ID: 2, Do: func() (any, error) { return "ran", nil }})
+	if err != nil || v != "ran" {
+		t.Fatalf("SubmitTaskWait() after the panic = %v, %v, want ran, nil", v, err)
+	}
+	stats := p.Stats()
+	if stats.Panics != 1 || stats.Failed != 1 || stats.Completed != 1 || stats.Workers != 1 {
+		t.Errorf("Stats() = panics %d, failed %d, completed %d, workers %d, want 1 of each",
+			stats.Panics, stats.Failed, stats.Completed, stats.Workers)
+	}
+}
+
+func TestOnErrorReportsFailedTasks(t *testing.T) {
+	errBoom := errors.New("boom")
+	var mu sync.Mutex
+	reported := map[int]error{}
+	p := NewDynamicWorkerPool(2, 16, time.Minute, OnErrorOpt(func(id int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported[id] = err
+	}))
+	defer p.Stop()
+
+	// every third task fails, the tasks after a failure must still run
+	var ran atomic.Int32
+	for i := range 12 {
+		p.SubmitTask(Task{ID: i, Do: func() (any, error) {
+			ran.Add(1)
+			if i%3 == 0 {
+				return nil, errBoom
+			}
+			return i, nil
+		}})
+	}
+	p.Wait()
+
+	if got := ran.Load(); got != 12 {
+		t.Errorf("%d tasks ran, want 12", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 4 {
+		t.Errorf("OnError was called for %d tasks, want 4", len(reported))
+	}
+	for _, id := range []int{0, 3, 6, 9} {
+		if !errors.Is(reported[id], errBoom) {
+			t.Errorf("OnError for task %d got %v, want %v", id, reported[id], errBoom)
+		}
+	}
+}
+
+// TestResizeConcurrently grows and shrinks the pool from many goroutines at once, the worker count must converge on the final maximum. Run it with -race.
+func TestResizeConcurrently(t *testing.T) {
+	const (
+		initial = 24
+		callers = 4
+		rounds  = 5
+	)
+	p := NewDynamicWorkerPool(initial, 8, time.Minute)
+	defer p.Stop()
+
+	// the decreases can never take the maximum down to its floor of one, so the increases and decreases cancel out in any order
+	var wg sync.WaitGroup
+	for range callers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				p.IncreaseMaxWorkers(1)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				p.DecreaseMaxWorkers(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := p.GetMaxWorkers(); got != initial {
+		t.Fatalf("GetMaxWorkers() = %d, want %d", got, initial)
+	}
+	waitFor(t, "the worker count to converge", func() bool {
+		return p.Stats().Workers == initial
+	})
+
+	// every remaining worker must still pick up tasks
+	release := blockWorkers(t, p, initial)
+	release()
+	p.Wait()
+}
+
+func TestRestartCycles(t *testing.T) {
+	p := NewDynamicWorkerPool(2, 8, time.Minute)
+	defer p.Stop()
+
+	var ran atomic.Int32
+	for cycle := range 5 {
+		p.Stop()
+		if got := p.Stats().Workers; got != 0 {
+			t.Fatalf("cycle %d: Stats().Workers = %d after Stop, want 0", cycle, got)
+		}
+		p.Start()
+		for i := range 4 {
+			p.SubmitTask(Task{ID: cycle*4 + i, Do: func() (any, error) {
+				ran.Add(1)
+				return nil, nil
+			}})
+		}
+		p.Wait()
+		if got := ran.Load(); got != int32(cycle+1)*4 {
+			t.Fatalf("cycle %d: %d tasks ran in total, want %d", cycle, got, (cycle+1)*4)
+		}
+	}
+	if got := p.Stats().Completed; got != 20 {
+		t.Errorf("Stats().Completed = %d, want 20", got)
+	}
+}
+
+func TestStatsAccountsForEveryTask(t *testing.T) {
+	p := NewDynamicWorkerPool(3, 32, time.Minute)
+	defer p.Stop()
+
+	// 20 tasks, of which 5 fail and 2 of those by panicking
+	for i := range 20 {
+		p.SubmitTask(Task{ID: i, Do: func() (any, error) {
+			time.Sleep(time.Millisecond)
+			switch {
+			case i < 2:
+				panic("boom")
+			case i < 5:
+				return nil, errors.New("failed")
+			}
+			return i, nil
+		}})
+	}
+	p.Wait()
+
+	stats := p.Stats()
+	if stats.Submitted != 20 || stats.Completed != 15 || stats.Failed != 5 || stats.Panics != 2 {
+		t.Errorf("Stats() = submitted %d, completed %d, failed %d, panics %d, want 20, 15, 5, 2",
+			stats.Submitted, stats.Completed, stats.Failed, stats.Panics)
+	}
+	if stats.Submitted != stats.Completed+stats.Failed {
+		t.Errorf("Stats().Submitted = %d, want completed + failed = %d", stats.Submitted, stats.Completed+stats.Failed)
+	}
+	if stats.BusyWorkers != 0 || stats.IdleWorkers != stats.Workers || stats.QueueDepth != 0 {
+		t.Errorf("Stats() = busy %d, idle %d of %d workers, queued %d, want every worker idle and nothing queued",
+			stats.BusyWorkers, stats.IdleWorkers, stats.Workers, stats.QueueDepth)
+	}
+	if stats.TotalDuration < 20*time.Millisecond || stats.AverageDuration != stats.TotalDuration/20 {
+		t.Errorf("Stats() = total %v, average %v, want at least 20ms in total and the average over 20 tasks", stats.TotalDuration, stats.AverageDuration)
+	}
+}
+
+func TestHooksAreInvokedOncePerEvent(t *testing.T) {
+	var workerStarts, workerExits, taskStarts, taskDones atomic.Int32
+	p := NewDynamicWorkerPool(2, 16, time.Minute,
+		OnWorkerStartOpt(func(int) { workerStarts.Add(1) }),
+		OnWorkerExitOpt(func(int) { workerExits.Add(1) }),
+		OnTaskStartOpt(func(int, int) { taskStarts.Add(1) }),
+		OnTaskDoneOpt(func(int, int, time.Duration, error) { taskDones.Add(1) }),
+	)
+
+	for i := range 10 {
+		p.SubmitTask(Task{ID: i, Do: func() (any, error) { return nil, nil }})
+	}
+	p.Wait()
+	p.Stop()
+
+	counts := []struct {
+		name string
+		got  int32
+		want int32
+	}{
+		{"OnWorkerStart", workerStarts.Load(), 2},
+		{"OnWorkerExit", workerExits.Load(), 2},
+		{"OnTaskStart", taskStarts.Load(), 10},
+		{"OnTaskDone", taskDones.Load(), 10},
+	}
+	for _, c := range counts {
+		if c.got != c.want {
+			t.Errorf("%s was called %d times, want %d", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestSlowHooksDoNotDeadlock(t *testing.T) {
+	// the hooks are slow and call back into the pool, which must not be locked while they run
+	var p DynamicWorkerPool
+	slow := func() {
+		time.Sleep(5 * time.Millisecond)
+		p.Stats()
+		p.GetMaxWorkers()
+	}
+	p = NewDynamicWorkerPool(2, 16, time.Minute,
+		OnTaskStartOpt(func(int, int) { slow() }),
+		OnTaskDoneOpt(func(int, int, time.Duration, error) { slow() }),
+		OnErrorOpt(func(int, error) { slow() }),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 10 {
+			p.SubmitTask(Task{ID: i, Do: func() (any, error) {
+				if i%2 == 0 {
+					return nil, errors.New("failed")
+				}
+				return nil, nil
+			}})
+		}
+		p.Wait()
+		p.Stop()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the pool deadlocked with slow hooks calling back into it")
+	}
+	if got := p.Stats().Completed + p.Stats().Failed; got != 10 {
+		t.Errorf("%d tasks finished, want 10", got)
+	}
+}
+
+func TestGrowQueueAcceptsTasksBeyondCapacity(t *testing.T) {
+	p := NewDynamicWorkerPool(1, 2, time.Minute, GrowQueueOpt(0))
+	defer p.Stop()
+	release := blockWorkers(t, p, 1)
+	defer release()
+
+	const tasks = 100
+	var mu sync.Mutex
+	var order []int
+	submitted := make(chan struct{})
+	go func() {
+		defer close(submitted)
+		for i := range tasks {
+			p.SubmitTask(Task{ID: i, Do: func() (any, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				order = append(order, i)
+				return nil, nil
+			}})
+		}
+	}()
+	select {
+	case <-submitted:
+	case <-time.After(time.Second):
+		t.Fatal("SubmitTask blocked with the queue allowed to grow")
+	}
+	if stats := p.Stats(); stats.Overflow != tasks-2 || stats.QueueDepth != tasks {
+		t.Errorf("Stats() = overflow %d, queued %d, want overflow %d, queued %d", stats.Overflow, stats.QueueDepth, tasks-2, tasks)
+	}
+
+	release()
+	p.Wait()
+	if len(order) != tasks {
+		t.Fatalf("%d tasks ran, want %d", len(order), tasks)
+	}
+	for i, id := range order {
+		if id != i {
+			t.Fatalf("task %d ran in position %d, want the overflow drained in submission order", id, i)
+		}
+	}
+	if stats := p.Stats(); stats.Overflow != 0 || stats.PeakOverflow != tasks-2 {
+		t.Errorf("Stats() = overflow %d, peak %d, want overflow 0, peak %d", stats.Overflow, stats.PeakOverflow, tasks-2)
+	}
+}
+
+func TestTrackedTaskStatusAndEviction(t *testing.T) {
+	p := NewDynamicWorkerPool(1, 8, time.Minute, TrackTasksOpt(0, 4))
+	defer p.Stop()
+	release := blockWorkers(t, p, 1)
+	defer release()
+
+	checkStatus := func(id int, want TaskStatus) {
+		t.Helper()
+		if got, ok := p.Status(id); !ok || got != want {
+			t.Errorf("Status(%d) = %v, %v, want %v, true", id, got, ok, want)
+		}
+	}
+	if status, ok := p.Status(-1); !ok || status != TaskRunning {
+		t.Fatalf("Status() of the blocking task = %v, %v, want %v", status, ok, TaskRunning)
+	}
+
+	p.SubmitTask(Task{ID: 3, Do: func() (any, error) { return nil, nil }})
+	checkStatus(3, TaskQueued)
+	if _, ok := p.Result(3); ok {
+		t.Error("Result() of a queued task is available")
+	}
+	p.ClearTaskQueue()
+	checkStatus(3, TaskDiscarded)
+
+	errFailed := errors.New("failed")
+	p.SubmitTask(Task{ID: 1, Do: func() (any, error) { return "ran", nil }})
+	p.SubmitTask(Task{ID: 2, Do: func() (any, error) { return nil, errFailed }})
+	checkStatus(1, TaskQueued)
+	if err := p.SubmitTaskCtx(context.Background(), Task{ID: 1}); !errors.Is(err, ErrDuplicateTaskID) {
+		t.Errorf("SubmitTaskCtx() with the ID of a queued task error = %v, want %v", err, ErrDuplicateTaskID)
+	}
+
+	release()
+	p.Wait()
+	checkStatus(-1, TaskCompleted)
+	checkStatus(1, TaskCompleted)
+	checkStatus(2, TaskFailed)
+	if res, ok := p.Result(1); !ok || res.Value != "ran" {
+		t.Errorf("Result(1) = %v, %v, want ran", res.Value, ok)
+	}
+	if res, ok := p.Result(2); !ok || !errors.Is(res.Err, errFailed) {
+		t.Errorf("Result(2) = %v, %v, want %v", res.Err, ok, errFailed)
+	}
+
+	// two more finished tasks go over the limit of four, evicting the two that finished first
+	p.SubmitTask(Task{ID: 4, Do: func() (any, error) { return nil, nil }})
+	p.SubmitTask(Task{ID: 5, Do: func() (any, error) { return nil, nil }})
+	p.Wait()
+	for _, id := range []int{3, -1} {
+		if status, ok := p.Status(id); ok {
+			t.Errorf("Status(%d) = %v, want the task evicted", id, status)
+		}
+	}
+	for _, id := range []int{1, 2, 4, 5} {
+		if _, ok := p.Status(id); !ok {
+			t.Errorf("Status(%d) is not tracked, want it kept", id)
+		}
+	}
+}
+
+func TestTrackedTaskRetention(t *testing.T) {
+	p := NewDynamicWorkerPool(1, 4, time.Minute, TrackTasksOpt(20*time.Millisecond, 0))
+	defer p.Stop()
+
+	if _, err := p.SubmitTaskWait(Task{ID: 1, Do: func() (any, error) { return nil, nil }}); err != nil {
+		t.Fatalf("SubmitTaskWait() error = %v", err)
+	}
+	if status, ok := p.Status(1); !ok || status != TaskCompleted {
+		t.Fatalf("Status(1) = %v, %v right after it finished, want %v", status, ok, TaskCompleted)
+	}
+	waitFor(t, "the finished task to outlive its retention", func() bool {
+		_, ok := p.Status(1)
+		return !ok
+	})
+	if _, ok := p.Result(1); ok {
+		t.Error("Result(1) is still available after the task was evicted")
+	}
+}
@@ -0,0 +1,153 @@
+package worker
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrDuplicateTaskID is the error reported for a task submitted to a pool that tracks tasks while another task with the same ID is still queued or running.
+// The ID of a task that has finished can be reused, the new task replaces the tracked entry of the finished one.
+var ErrDuplicateTaskID = errors.New("a task with the same ID is already queued or running")
+
+// defaultTrackedTasks is the number of finished tasks kept by a task registry when neither a retention nor a count is given.
+const defaultTrackedTasks = 1000
+
+// taskEntry is the tracked state of a single task.
+type taskEntry struct {
+	status   TaskStatus
+	result   TaskResult
+	finished time.Time // when the task finished, zero while it is queued or running
+	seq      uint64    // distinguishes the entries of tasks that reused the same ID
+}
+
+// finishedTask identifies an entry in the order tasks finished, used to evict the oldest finished tasks first.
+type finishedTask struct {
+	id  int
+	seq uint64
+}
+
+// taskRegistry tracks the status and result of every task submitted to a pool, keyed by task ID.
+// Queued and running tasks are always kept, finished tasks are evicted once they are older than the retention or there are more of them than the maximum.
+// It is not safe for concurrent use, the pool only uses it while holding its lock.
+type taskRegistry struct {
+	retention   time.Duration // how long a finished task is kept, zero if there is no limit
+	maxFinished int           // how many finished tasks are kept, zero if there is no limit
+
+	entries       map[int]*taskEntry
+	finished      []finishedTask // finished tasks in the order they finished, oldest first, including ones whose ID was reused since
+	finishedCount int            // the number of finished tasks still tracked
+	nextSeq       uint64
+}
+
+// newTaskRegistry creates a new task registry.
+//
+// Parameters:
+//   - retention: How long a finished task is kept, zero or less means there is no limit.
+//   - maxFinished: How many finished tasks are kept, zero or less means there is no limit.
+//     If neither limit is set, defaultTrackedTasks finished tasks are kept.
+//
+// Returns:
+//   - *taskRegistry: The new task registry.
+func newTaskRegistry(retention time.Duration, maxFinished int) *taskRegistry {
+	retention, maxFinished = max(retention, 0), max(maxFinished, 0)
+	if retention == 0 && maxFinished == 0 {
+		maxFinished = defaultTrackedTasks
+	}
+	return &taskRegistry{
+		retention:   retention,
+		maxFinished: maxFinished,
+		entries:     make(map[int]*taskEntry),
+	}
+}
+
+// add starts tracking a newly submitted task as queued.
+//
+// Parameters:
+//   - id: The ID of the task.
+//
+// Returns:
+//   - bool: False if a task with the same ID is still queued or running, in which case nothing is tracked, true otherwise.
+func (r *taskRegistry) add(id int) bool {
+	if e, ok := r.entries[id]; ok {
+		if e.status == TaskQueued || e.status == TaskRunning {
+			return false
+		}
+		r.finishedCount--
+	}
+	r.entries[id] = &taskEntry{status: TaskQueued, seq: r.nextSeq}
+	r.nextSeq++
+	return true
+}
+
+// remove stops tracking a task that was added but never queued.
+//
+// Parameters:
+//   - id: The ID of the task.
+func (r *taskRegistry) remove(id int) {
+	delete(r.entries, id)
+}
+
+// start marks a queued task as running.
+//
+// Parameters:
+//   - id: The ID of the task.
+func (r *taskRegistry) start(id int) {
+	if e, ok := r.entries[id]; ok && e.status == TaskQueued {
+		e.status = TaskRunning
+	}
+}
+
+// finish records the final status and result of a queued or running task, then evicts the finished tasks that are no longer kept.
+//
+// Parameters:
+//   - id: The ID of the task.
+//   - status: The final status of the task, one of TaskCompleted, TaskFailed or TaskDiscarded.
+//   - res: The result of the task.
+func (r *taskRegistry) finish(id int, status TaskStatus, res TaskResult) {
+	e, ok := r.entries[id]
+	if !ok || (e.status != TaskQueued && e.status != TaskRunning) {
+		return
+	}
+	e.status = status
+	e.result = res
+	e.finished = time.Now()
+	r.finished = append(r.finished, finishedTask{id: id, seq: e.seq})
+	r.finishedCount++
+	r.evict()
+}
+
+// lookup returns the tracked entry of a task, after evicting the finished tasks that have outlived the retention.
+//
+// Parameters:
+//   - id: The ID of the task.
+//
+// Returns:
+//   - *taskEntry: The entry of the task.
+//   - bool: True if the task is tracked, false otherwise.
+func (r *taskRegistry) lookup(id int) (*taskEntry, bool) {
+	r.evict()
+	e, ok := r.entries[id]
+	return e, ok
+}
+
+// evict removes the oldest finished tasks while there are more than maxFinished of them, or they are older than the retention.
+func (r *taskRegistry) evict() {
+	now := time.Now()
+	for len(r.finished) > 0 {
+		oldest := r.finished[0]
+		e, ok := r.entries[oldest.id]
+		// the ID was reused by a newer task since this one finished, which replaced its entry
+		stale := !ok || e.seq != oldest.seq
+		if !stale {
+			overCount := r.maxFinished > 0 && r.finishedCount > r.maxFinished
+			expired := r.retention > 0 && now.Sub(e.finished) > r.retention
+			if !overCount && !expired {
+				return
+			}
+			delete(r.entries, oldest.id)
+			r.finishedCount--
+		}
+		r.finished = r.finished[1:]
+	}
+	r.finished = nil
+}
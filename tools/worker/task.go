@@ -1,9 +1,122 @@
 package worker
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTaskTimeout is the error reported for a task that did not finish before its deadline.
+// The reported error wraps both ErrTaskTimeout and context.DeadlineExceeded.
+var ErrTaskTimeout = errors.New("task exceeded its deadline")
+
 // Task represents a task to be processed by a worker.
 // TODO: turn this into an interface, set up an easier-to-use option builder pattern
 type Task struct {
 	ID      int
 	Payload any
 	Do      func() (any, error)
+
+	// DoCtx is an alternative to Do that receives a context, which is cancelled when the pool is stopped or the task's deadline passes.
+	// If both are set DoCtx is used, tasks that only set Do keep working but can not observe cancellation.
+	DoCtx func(ctx context.Context) (any, error)
+
+	// Deadline is an optional point in time the task must finish by, the zero value means no deadline.
+	Deadline time.Time
+
+	// Timeout is an optional limit on how long the task may run once a worker starts it, zero means no limit.
+	// If both Deadline and Timeout are set, whichever expires first applies. A task that sets neither gets the pool's timeout, see TaskTimeoutOpt.
+	// When a task exceeds its deadline the worker stops waiting for it and reports an error wrapping ErrTaskTimeout,
+	// a task that does not honor its context keeps running in the background but its result is discarded.
+	Timeout time.Duration
+
+	// ErrHandler is an optional callback invoked with the task's error if Do returns a non-nil error.
+	// It is called before the pool's OnErrorOpt callback, and never while the pool's locks are held.
+	ErrHandler func(err error)
+
+	// result is an optional channel the task result is delivered to once the task is done, used by SubmitTaskWait
+	result chan TaskResult
+	// done is an optional callback invoked with the task result once the task is done, used by SubmitBatch
+	done func(TaskResult)
+	// enqueued is the time the task was put in the pool's task queue, used to measure how long it waited to be dequeued
+	enqueued time.Time
+	// clearGen is the number of times the pool's queue had been cleared when the task was submitted, see ClearTaskQueue
+	clearGen uint64
+}
+
+// Priority is the priority level a task is submitted with, workers always take queued tasks of a higher priority first.
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+
+	// priorityLevels is the number of priority levels, each level has its own task queue
+	priorityLevels = 3
+)
+
+// TaskStatus is the state of a task tracked by a pool created with TrackTasksOpt.
+type TaskStatus int
+
+const (
+	TaskQueued    TaskStatus = iota // the task is waiting in the queue
+	TaskRunning                     // a worker is running the task
+	TaskCompleted                   // the task finished without an error
+	TaskFailed                      // the task returned an error, panicked, exceeded its deadline or was rejected by a closed pool
+	TaskDiscarded                   // the task was removed from the queue by ClearTaskQueue before it ran
+)
+
+func (s TaskStatus) String() string {
+	switch s {
+	case TaskQueued:
+		return "queued"
+	case TaskRunning:
+		return "running"
+	case TaskCompleted:
+		return "completed"
+	case TaskFailed:
+		return "failed"
+	case TaskDiscarded:
+		return "discarded"
+	default:
+		return fmt.Sprintf("TaskStatus(%d)", int(s))
+	}
+}
+
+// TaskResult is the outcome of a single task, as returned by the task's Do function.
+type TaskResult struct {
+	ID    int   // the ID of the task that produced this result
+	Value any   // the value returned by the task
+	Err   error // the error returned by the task, nil if the task succeeded
+
+	Duration  time.Duration // how long the task ran for, zero if it never ran
+	QueueWait time.Duration // how long the task waited in the queue between being submitted and being dequeued by a worker, zero if it never ran
+}
+
+// TaskError is the error delivered on the pool's Errors channel when a task fails.
+// It wraps the error returned by the task along with the ID of the task that returned it.
+type TaskError struct {
+	ID  int   // the ID of the task that failed
+	Err error // the error returned by the task
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("task %d failed: %v", e.ID, e.Err)
+}
+
+func (e *TaskError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is the error reported for a task whose Do function panicked.
+// The panic is recovered by the worker so it keeps processing tasks, and is reported through the same paths as an error returned by the task.
+type PanicError struct {
+	Value any    // the value the task panicked with
+	Stack []byte // the stack trace of the goroutine at the time of the panic
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panicked: %v\n%s", e.Value, e.Stack)
 }
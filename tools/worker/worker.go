@@ -1,27 +1,62 @@
 package worker
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
 	"sync"
 	"time"
 )
 
-// NewWorker creates a new worker with the given ID, task channel, stop channel, idle timeout, and exit callback function.
+// WorkerHooks holds the callbacks a worker invokes over its lifecycle and around the tasks it runs, any of them may be nil.
+// The callbacks are invoked from the worker's goroutine, so a slow callback holds up the worker.
+type WorkerHooks struct {
+	// DispatchState is called before the worker takes a task to learn whether dispatch is paused. If it is nil dispatch is never paused.
+	// It returns a channel that is closed once dispatch is paused, and a channel that is closed once a pause ends, which is nil while dispatch is not paused.
+	DispatchState func() (paused <-chan struct{}, resumed <-chan struct{})
+
+	// OnIdle is called when the worker reaches its idle timeout, with the worker ID. The worker only stops if it returns true,
+	// otherwise it keeps waiting for tasks for another idle timeout. If it is nil the worker always stops.
+	OnIdle func(workerID int) bool
+
+	// OnStart is called once the worker's goroutine has started, with the worker ID.
+	OnStart func(workerID int)
+
+	// OnExit is called when the worker exits, with the worker ID.
+	OnExit func(workerID int)
+
+	// OnTaskStart is called when a task is dequeued, before it is processed, with the worker ID and the task.
+	// The task is only run if it returns true, otherwise it is skipped without calling OnTaskDone. If it is nil every task is run.
+	OnTaskStart func(workerID int, t Task) bool
+
+	// OnTaskDone is called after each task is processed, with the worker ID, the task and its result.
+	OnTaskDone func(workerID int, t Task, res TaskResult)
+
+	// OnTaskStuck is called when the worker abandons a task that exceeded its deadline, with the worker ID and the task, before OnTaskDone is called.
+	// The worker goes on to its next task while the abandoned one keeps running in the background, and the returned function, if not nil, is called once it returns.
+	OnTaskStuck func(workerID int, t Task) func()
+}
+
+// NewWorker creates a new worker with the given context, ID, task channel, idle timeout, and callback functions.
 // This will return an interface which can be used to manipulate the worker.
 //
 // Parameters:
+//   - ctx: The context the context of every task run by the worker is derived from, cancelling it cancels the running task.
 //   - id: The ID of the worker. This is an integer value that uniquely identifies the worker.
-//   - taskChan: The channel for tasks to be processed by the worker. This is a channel of Task type that the worker will listen to for incoming tasks.
-//   - stopChan: The channel for stopping the worker. This is a channel of int type that the worker will listen to for stop signals.
+//   - taskChans: The channels for tasks to be processed by the worker, indexed by Priority. The worker drains them from the highest priority to the lowest.
 //   - idleTimeout: The timeout duration for the worker to wait before stopping. This is a time.Duration value that determines how long the worker should wait before stopping if there are no tasks.
-//   - onExit: The callback function to be called when the worker exits. This is a function that takes an integer parameter (the worker ID) and returns nothing.
-func NewWorker(id int, taskChan chan Task, stopChan chan int, idleTimeout time.Duration, onExit func(int)) Worker {
+//   - hooks: The callbacks invoked over the worker's lifecycle and around the tasks it runs, see WorkerHooks.
+func NewWorker(ctx context.Context, id int, taskChans [priorityLevels]chan Task, idleTimeout time.Duration, hooks WorkerHooks) Worker {
 	return &worker{
 		mu:          sync.Mutex{},
+		ctx:         ctx,
 		id:          id,
-		taskChan:    taskChan,
-		stopChan:    stopChan,
+		taskChans:   taskChans,
+		stopChan:    make(chan struct{}),
+		done:        make(chan struct{}),
 		idleTimeout: idleTimeout,
-		onExit:      onExit,
+		hooks:       hooks,
 		active:      false,
 	}
 }
@@ -29,14 +64,20 @@ func NewWorker(id int, taskChan chan Task, stopChan chan int, idleTimeout time.D
 type worker struct {
 	mu sync.Mutex
 
-	id     int
-	active bool
+	ctx     context.Context
+	id      int
+	active  bool
+	busy    bool
+	started bool
 
 	idleTimeout time.Duration
-	onExit      func(int)
+	hooks       WorkerHooks
 
-	taskChan chan Task
-	stopChan chan int
+	taskChans [priorityLevels]chan Task
+	dequeued  int           // the number of tasks taken from the queues, used to bound the starvation of low priority tasks
+	stopChan  chan struct{} // closed to signal this worker, and only this worker, to stop
+	stopOnce  sync.Once
+	done      chan struct{} // closed once the worker's goroutine has exited
 }
 
 // Worker is the interface that defines the methods for a worker in the worker pool.
@@ -53,11 +94,29 @@ type Worker interface {
 	//   - bool: True if the worker is active, false otherwise.
 	IsActive() bool
 
+	// IsBusy returns true if the worker is currently running a task, false otherwise.
+	//
+	// Returns:
+	//   - bool: True if the worker is running a task, false otherwise.
+	IsBusy() bool
+
+	// SetIdleTimeout changes how long the worker may idle before it stops.
+	// The new timeout takes effect the next time the worker starts idling, the idle period in progress keeps the timeout it started with.
+	//
+	// Parameters:
+	//   - d: The new idle timeout, a non-positive value keeps the worker alive until it is stopped.
+	SetIdleTimeout(d time.Duration)
+
 	// Start starts the worker and begins processing tasks from the task channel.
 	// The worker controls it's own lifecycle and will stop when it finished processing tasks and it idles for long enough to reach it's idle timeout threshold.
+	// A worker can only be started once, calling Start on a worker that was already started or stopped does nothing.
 	Start()
 
 	// Stop stops the worker and cleans up any resources used by the worker.
+	// If the worker is running a task, it finishes that task before exiting. Stop blocks until the worker's goroutine has exited.
+	// It is safe to call Stop any number of times, including after the worker has exited on its own.
+	//
+	// Note: Stop must not be called from a task running on the same worker, as it would wait on itself.
 	Stop()
 }
 
@@ -71,34 +130,286 @@ func (w *worker) IsActive() bool {
 	return w.active
 }
 
+func (w *worker) IsBusy() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.busy
+}
+
+func (w *worker) SetIdleTimeout(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.idleTimeout = d
+}
+
 func (w *worker) Start() {
 	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.stopChan:
+		return
+	default:
+	}
+	if w.started {
+		return
+	}
+	w.started = true
 	w.active = true
-	w.mu.Unlock()
+
 	go func() {
+		defer close(w.done)
+		// the exit callback is invoked on every exit path, so the pool always learns that the worker is gone
+		defer func() {
+			w.mu.Lock()
+			w.active = false
+			w.mu.Unlock()
+			if w.hooks.OnExit != nil {
+				w.hooks.OnExit(w.id)
+			}
+		}()
+		if w.hooks.OnStart != nil {
+			w.hooks.OnStart(w.id)
+		}
+
+		// the idle timer stops the worker once it goes idleTimeout without receiving a task, a non-positive timeout never expires.
+		// The timeout is read again every time the worker starts idling, so a change made with SetIdleTimeout is picked up on the next idle period.
+		var idle <-chan time.Time
+		var idleTimer *time.Timer
+		resetIdle := func() {
+			timeout := w.getIdleTimeout()
+			if timeout <= 0 {
+				if idleTimer != nil {
+					idleTimer.Stop()
+				}
+				idle = nil
+				return
+			}
+			if idleTimer == nil {
+				idleTimer = time.NewTimer(timeout)
+			} else {
+				idleTimer.Reset(timeout)
+			}
+			idle = idleTimer.C
+		}
+		resetIdle()
+		defer func() {
+			if idleTimer != nil {
+				idleTimer.Stop()
+			}
+		}()
+
 		for {
+			// check for a stop signal first, so a stopped worker never picks up another task even if tasks are queued
 			select {
-			case i, ok := <-w.stopChan:
-				if !ok {
-					return
+			case <-w.stopChan:
+				return
+			default:
+			}
+
+			// while dispatch is paused no task is taken, and the worker does not idle out since it is not out of work
+			var paused <-chan struct{}
+			if w.hooks.DispatchState != nil {
+				var resumed <-chan struct{}
+				paused, resumed = w.hooks.DispatchState()
+				if resumed != nil {
+					select {
+					case <-w.stopChan:
+						return
+					case <-resumed:
+					}
+					resetIdle()
+					continue
 				}
-				if i == w.id {
+			}
+
+			t, ok := w.dequeue()
+			if !ok {
+				// every queue is empty, so wait for a task of any priority, or for dispatch to be paused
+				var open bool
+				select {
+				case <-idle:
+					if w.hooks.OnIdle == nil || w.hooks.OnIdle(w.id) {
+						return
+					}
+					resetIdle()
+					continue
+				case <-w.stopChan:
 					return
+				case <-paused:
+					continue
+				case t, open = <-w.taskChans[PriorityHigh]:
+				case t, open = <-w.taskChans[PriorityNormal]:
+				case t, open = <-w.taskChans[PriorityLow]:
 				}
-			case t, ok := <-w.taskChan:
-				if !ok {
+				if !open {
 					return
 				}
+			}
 
-				t.Do()
+			// the queue wait is measured up to the dequeue, time spent waiting for a paused pool to resume is not part of it
+			var queueWait time.Duration
+			if !t.enqueued.IsZero() {
+				queueWait = time.Since(t.enqueued)
 			}
+
+			w.setBusy(true)
+			if w.hooks.OnTaskStart != nil && !w.hooks.OnTaskStart(w.id, t) {
+				w.setBusy(false)
+				continue
+			}
+			start := time.Now()
+			value, err := runTask(w.ctx, t, func() func() {
+				if w.hooks.OnTaskStuck == nil {
+					return nil
+				}
+				return w.hooks.OnTaskStuck(w.id, t)
+			})
+			if w.hooks.OnTaskDone != nil {
+				w.hooks.OnTaskDone(w.id, t, TaskResult{ID: t.ID, Value: value, Err: err, Duration: time.Since(start), QueueWait: queueWait})
+			}
+			w.setBusy(false)
+			resetIdle()
 		}
 	}()
 }
 
 func (w *worker) Stop() {
-	w.stopChan <- w.id
+	w.stopOnce.Do(func() {
+		close(w.stopChan)
+	})
+
 	w.mu.Lock()
-	w.active = false
+	started := w.started
 	w.mu.Unlock()
+	if started {
+		<-w.done
+	}
+}
+
+// starvationInterval is how often a worker takes a task from the lowest priority queue instead of the highest,
+// every starvationInterval-th task a worker dequeues is taken from the lowest non-empty priority level.
+const starvationInterval = 8
+
+// dequeue takes the next queued task without blocking, from the highest non-empty priority level.
+// To bound the starvation of low priority tasks, every starvationInterval-th task is taken from the lowest non-empty priority level instead.
+//
+// Returns:
+//   - Task: The dequeued task.
+//   - bool: True if a task was dequeued, false if every queue is empty or closed.
+func (w *worker) dequeue() (Task, bool) {
+	w.dequeued++
+	lowestFirst := w.dequeued%starvationInterval == 0
+
+	for i := range priorityLevels {
+		level := priorityLevels - 1 - i
+		if lowestFirst {
+			level = i
+		}
+		select {
+		case t, ok := <-w.taskChans[level]:
+			if ok {
+				return t, true
+			}
+		default:
+		}
+	}
+	return Task{}, false
+}
+
+// getIdleTimeout returns the current idle timeout of the worker.
+//
+// Returns:
+//   - time.Duration: The idle timeout, a non-positive value never expires.
+func (w *worker) getIdleTimeout() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.idleTimeout
+}
+
+// setBusy marks the worker as running a task or not.
+//
+// Parameters:
+//   - busy: Whether the worker is running a task.
+func (w *worker) setBusy(busy bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.busy = busy
+}
+
+// runTask runs the task with a context derived from the given context and the task's deadline.
+// Without a deadline the task runs on the calling goroutine, otherwise it runs on its own goroutine so the worker can stop waiting for it once the deadline passes.
+// A task that does not return by its deadline is abandoned, it keeps running on its own goroutine while the caller goes on.
+//
+// Parameters:
+//   - ctx: The context to derive the task's context from.
+//   - t: The task to run.
+//   - onAbandon: The function called when the task is abandoned, which may return a function to call once the abandoned task returns. This may be nil.
+//
+// Returns:
+//   - any: The value returned by the task, nil if it panicked or exceeded its deadline.
+//   - error: The error returned by the task, a *PanicError if it panicked, or an error wrapping ErrTaskTimeout if it exceeded its deadline.
+func runTask(ctx context.Context, t Task, onAbandon func() func()) (any, error) {
+	if t.Deadline.IsZero() && t.Timeout <= 0 {
+		return callTask(ctx, t)
+	}
+
+	if !t.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, t.Deadline)
+		defer cancel()
+	}
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+
+	done := make(chan TaskResult, 1)
+	go func() {
+		value, err := callTask(ctx, t)
+		done <- TaskResult{Value: value, Err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.Value, res.Err
+	case <-ctx.Done():
+		// only a passed deadline abandons the task, when the worker's context is cancelled the task is left to finish on its own
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			if onAbandon != nil {
+				if release := onAbandon(); release != nil {
+					go func() {
+						<-done
+						release()
+					}()
+				}
+			}
+			return nil, fmt.Errorf("%w: %w", ErrTaskTimeout, ctx.Err())
+		}
+		res := <-done
+		return res.Value, res.Err
+	}
+}
+
+// callTask calls the task's DoCtx function, or its Do function if DoCtx is not set, recovering from any panic inside it.
+// A panic is converted into a *PanicError carrying the panic value and stack trace, so the worker stays alive and the panic is reported like any other task error.
+//
+// Parameters:
+//   - ctx: The context to pass to DoCtx.
+//   - t: The task to call.
+//
+// Returns:
+//   - any: The value returned by the task, nil if it panicked.
+//   - error: The error returned by the task, or a *PanicError if it panicked.
+func callTask(ctx context.Context, t Task) (value any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			value = nil
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	if t.DoCtx != nil {
+		return t.DoCtx(ctx)
+	}
+	return t.Do()
 }
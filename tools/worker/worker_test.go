@@ -0,0 +1,141 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestQueues creates a set of task queues of the given size, one for every priority level.
+func newTestQueues(size int) [priorityLevels]chan Task {
+	var queues [priorityLevels]chan Task
+	for i := range queues {
+		queues[i] = make(chan Task, size)
+	}
+	return queues
+}
+
+func TestStoppingOneWorkerLeavesOthersRunning(t *testing.T) {
+	queues := newTestQueues(4)
+	ranBy := make(chan int, 1)
+	hooks := WorkerHooks{
+		OnTaskDone: func(workerID int, _ Task, _ TaskResult) {
+			ranBy <- workerID
+		},
+	}
+	stopped := NewWorker(context.Background(), 1, queues, 0, hooks)
+	running := NewWorker(context.Background(), 2, queues, 0, hooks)
+	stopped.Start()
+	running.Start()
+	defer running.Stop()
+
+	stopped.Stop()
+	if stopped.IsActive() {
+		t.Error("the stopped worker is still active")
+	}
+	if !running.IsActive() {
+		t.Fatal("stopping one worker stopped the other as well")
+	}
+
+	queues[PriorityNormal] <- Task{ID: 1, Do: func() (any, error) { return nil, nil }}
+	select {
+	case id := <-ranBy:
+		if id != running.ID() {
+			t.Errorf("the task ran on worker %d, want %d", id, running.ID())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the remaining worker did not run the task")
+	}
+}
+
+func TestWorkerStopTwice(t *testing.T) {
+	exits := 0
+	w := NewWorker(context.Background(), 1, newTestQueues(1), 0, WorkerHooks{
+		OnExit: func(int) { exits++ },
+	})
+	w.Start()
+
+	w.Stop()
+	w.Stop()
+	if exits != 1 {
+		t.Errorf("the worker exited %d times, want 1", exits)
+	}
+
+	// a stopped worker can not be started again, and stopping it once more still returns
+	w.Start()
+	w.Stop()
+	if w.IsActive() {
+		t.Error("a stopped worker became active again")
+	}
+}
+
+func TestWorkerStopBeforeStart(t *testing.T) {
+	w := NewWorker(context.Background(), 1, newTestQueues(1), 0, WorkerHooks{})
+
+	done := make(chan struct{})
+	go func() {
+		w.Stop()
+		w.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked on a worker that was never started")
+	}
+}
+
+func TestRunTaskReturnsWhenCancelledTaskStops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	task := Task{ID: 1, Deadline: time.Now().Add(time.Minute), DoCtx: func(ctx context.Context) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return "stopped", ctx.Err()
+	}}
+
+	go func() {
+		<-started
+		cancel()
+	}()
+	abandoned := false
+	value, err := runTask(ctx, task, func() func() {
+		abandoned = true
+		return nil
+	})
+	if value != "stopped" || !errors.Is(err, context.Canceled) {
+		t.Errorf("runTask() = %v, %v, want the task's own result stopped, %v", value, err, context.Canceled)
+	}
+	if abandoned {
+		t.Error("a task that stopped on cancellation was abandoned")
+	}
+}
+
+func TestRunTaskAbandonsTaskPastDeadline(t *testing.T) {
+	gate := make(chan struct{})
+	task := Task{ID: 1, Deadline: time.Now().Add(20 * time.Millisecond), Do: func() (any, error) {
+		<-gate
+		return "late", nil
+	}}
+
+	released := make(chan struct{})
+	value, err := runTask(context.Background(), task, func() func() {
+		return func() { close(released) }
+	})
+	if value != nil || !errors.Is(err, ErrTaskTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("runTask() = %v, %v, want nil and %v wrapping %v", value, err, ErrTaskTimeout, context.DeadlineExceeded)
+	}
+
+	select {
+	case <-released:
+		t.Fatal("the abandoned task was released before it returned")
+	default:
+	}
+	close(gate)
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("the abandoned task was never released after it returned")
+	}
+}
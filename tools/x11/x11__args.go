@@ -0,0 +1,87 @@
+//go:build linux
+// +build linux
+
+package x11
+
+import "fmt"
+
+// The argument builders are kept free of side effects so the commands can be checked without running them.
+// Arguments are passed to the tools as they are, without a shell, so they need no quoting.
+
+// XdotoolMouseMoveArgs returns the xdotool arguments that move the cursor to a point.
+//
+// Parameters:
+//   - x: The x coordinate of the point.
+//   - y: The y coordinate of the point.
+//
+// Returns:
+//   - []string: The arguments of the command.
+func XdotoolMouseMoveArgs(x, y int32) []string {
+	return []string{"mousemove", fmt.Sprintf("%d", x), fmt.Sprintf("%d", y)}
+}
+
+// XdotoolButtonArgs returns the xdotool arguments that act on a mouse button.
+//
+// Parameters:
+//   - action: The xdotool command, click, mousedown or mouseup.
+//   - button: The button to act on (1 for left, 2 for middle, 3 for right).
+//
+// Returns:
+//   - []string: The arguments of the command.
+func XdotoolButtonArgs(action string, button int) []string {
+	return []string{action, fmt.Sprintf("%d", button)}
+}
+
+// XdotoolClickArgs returns the arguments of the xdotool commands that click a mouse button, in the order they are run.
+// An instant click is a single xdotool click, while a click with a duration is a mousedown and a mouseup, with the button held between them.
+//
+// Parameters:
+//   - button: The button to click (1 for left, 2 for middle, 3 for right).
+//   - duration: The time to hold the button down in milliseconds, 0 for an instant click.
+//
+// Returns:
+//   - [][]string: The arguments of each command.
+func XdotoolClickArgs(button int, duration int) [][]string {
+	if duration == 0 {
+		return [][]string{XdotoolButtonArgs("click", button)}
+	}
+	return [][]string{XdotoolButtonArgs("mousedown", button), XdotoolButtonArgs("mouseup", button)}
+}
+
+// XdotoolKeyArgs returns the xdotool arguments that press or release a key.
+//
+// Parameters:
+//   - action: The xdotool command, keydown or keyup.
+//   - keySym: The keysym name of the key, or several joined with a plus for a combination.
+//
+// Returns:
+//   - []string: The arguments of the command.
+func XdotoolKeyArgs(action string, keySym string) []string {
+	return []string{action, keySym}
+}
+
+// XdotoolTypeArgs returns the xdotool arguments that type text.
+// The text follows a "--", so text that starts with a dash is typed rather than read as an option, and empty text is kept as an empty argument.
+//
+// Parameters:
+//   - text: The text to type.
+//
+// Returns:
+//   - []string: The arguments of the command.
+func XdotoolTypeArgs(text string) []string {
+	return []string{"type", "--clearmodifiers", "--", text}
+}
+
+// XwdArgs returns the xwd arguments that dump a region of the root window.
+//
+// Parameters:
+//   - x: The x coordinate of the top-left corner of the region.
+//   - y: The y coordinate of the top-left corner of the region.
+//   - width: The width of the region.
+//   - height: The height of the region.
+//
+// Returns:
+//   - []string: The arguments of the command.
+func XwdArgs(x, y, width, height int) []string {
+	return []string{"-root", "-silent", "-geometry", fmt.Sprintf("%dx%d+%d+%d", width, height, x, y)}
+}
@@ -0,0 +1,61 @@
+//go:build linux
+// +build linux
+
+package x11
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestXdotoolArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{name: "mousemove", got: XdotoolMouseMoveArgs(640, 480), want: []string{"mousemove", "640", "480"}},
+		{name: "mousemove negative", got: XdotoolMouseMoveArgs(-1920, 0), want: []string{"mousemove", "-1920", "0"}},
+		{name: "mousedown", got: XdotoolButtonArgs("mousedown", 1), want: []string{"mousedown", "1"}},
+		{name: "mouseup", got: XdotoolButtonArgs("mouseup", 3), want: []string{"mouseup", "3"}},
+		{name: "keydown", got: XdotoolKeyArgs("keydown", "ctrl+shift+t"), want: []string{"keydown", "ctrl+shift+t"}},
+		{name: "keyup", got: XdotoolKeyArgs("keyup", "Return"), want: []string{"keyup", "Return"}},
+		{name: "keydown empty", got: XdotoolKeyArgs("keydown", ""), want: []string{"keydown", ""}},
+		{name: "type", got: XdotoolTypeArgs("hello"), want: []string{"type", "--clearmodifiers", "--", "hello"}},
+		{name: "type spaces and quotes", got: XdotoolTypeArgs(`say "hi" it's me`), want: []string{"type", "--clearmodifiers", "--", `say "hi" it's me`}},
+		{name: "type shell syntax", got: XdotoolTypeArgs("$(rm -rf ~); `id` | cat > x"), want: []string{"type", "--clearmodifiers", "--", "$(rm -rf ~); `id` | cat > x"}},
+		{name: "type leading dash", got: XdotoolTypeArgs("--delay 0"), want: []string{"type", "--clearmodifiers", "--", "--delay 0"}},
+		{name: "type empty", got: XdotoolTypeArgs(""), want: []string{"type", "--clearmodifiers", "--", ""}},
+		{name: "type newline", got: XdotoolTypeArgs("a\nb"), want: []string{"type", "--clearmodifiers", "--", "a\nb"}},
+		{name: "xwd", got: XwdArgs(10, 20, 300, 200), want: []string{"-root", "-silent", "-geometry", "300x200+10+20"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !slices.Equal(tt.got, tt.want) {
+				t.Errorf("args = %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestXdotoolClickArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		button   int
+		duration int
+		want     [][]string
+	}{
+		{name: "instant", button: 1, duration: 0, want: [][]string{{"click", "1"}}},
+		{name: "instant right", button: 3, duration: 0, want: [][]string{{"click", "3"}}},
+		{name: "held", button: 1, duration: 100, want: [][]string{{"mousedown", "1"}, {"mouseup", "1"}}},
+		{name: "held middle", button: 2, duration: 1, want: [][]string{{"mousedown", "2"}, {"mouseup", "2"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := XdotoolClickArgs(tt.button, tt.duration)
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("XdotoolClickArgs(%d, %d) = %q, want %q", tt.button, tt.duration, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+//go:build linux
+// +build linux
+
+package x11
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Carmen-Shannon/automation/tools"
+)
+
+// DependencyStatus is the status of an external tool the linux implementation relies on, see CheckDependencies.
+type DependencyStatus struct {
+	Tool       string // the name of the command
+	AptPackage string // the package that provides the tool on Debian and Ubuntu
+	DnfPackage string // the package that provides the tool on Fedora and RHEL
+	Found      bool   // whether the tool is installed
+	Path       string // the resolved path of the tool, empty if it is not installed
+	Version    string // the version reported by the tool, empty if it is not installed or the version could not be parsed
+}
+
+// dependency is an external tool the linux implementation relies on.
+type dependency struct {
+	tool       string
+	aptPackage string
+	dnfPackage string
+	versionArg string // the argument that makes the tool print its version
+}
+
+// dependencies are the external tools the display, mouse and keyboard rely on.
+var dependencies = []dependency{
+	{tool: "xdotool", aptPackage: "xdotool", dnfPackage: "xdotool", versionArg: "--version"},
+	{tool: "xrandr", aptPackage: "x11-xserver-utils", dnfPackage: "xrandr", versionArg: "--version"},
+	{tool: "import", aptPackage: "imagemagick", dnfPackage: "ImageMagick", versionArg: "-version"},
+	{tool: "xwd", aptPackage: "x11-apps", dnfPackage: "xwd", versionArg: "-version"},
+}
+
+// CheckDependencies checks which of the external tools the display, mouse and keyboard rely on are installed, and their versions.
+//
+// Parameters:
+//   - lookPath: Resolves the path of a command, exec.LookPath outside of tests.
+//   - combinedOutput: Runs a command and returns its combined output.
+//
+// Returns:
+//   - []DependencyStatus: The status of every tool.
+func CheckDependencies(lookPath func(string) (string, error), combinedOutput func(name string, args ...string) ([]byte, error)) []DependencyStatus {
+	return checkDependencies(dependencies, lookPath, combinedOutput)
+}
+
+// checkDependencies resolves the path and version of every dependency.
+// The version is read from the output of the tool even when it exits with an error, which some tools do after printing it.
+//
+// Parameters:
+//   - deps: The dependencies to check.
+//   - lookPath: Resolves the path of a command.
+//   - combinedOutput: Runs a command and returns its combined output.
+//
+// Returns:
+//   - []DependencyStatus: The status of every dependency, in the same order.
+func checkDependencies(deps []dependency, lookPath func(string) (string, error), combinedOutput func(name string, args ...string) ([]byte, error)) []DependencyStatus {
+	statuses := make([]DependencyStatus, len(deps))
+	for i, dep := range deps {
+		statuses[i] = DependencyStatus{Tool: dep.tool, AptPackage: dep.aptPackage, DnfPackage: dep.dnfPackage}
+		path, err := lookPath(dep.tool)
+		if err != nil {
+			continue
+		}
+		statuses[i].Found = true
+		statuses[i].Path = path
+		out, _ := combinedOutput(path, dep.versionArg)
+		statuses[i].Version = ParseVersion(string(out))
+	}
+	return statuses
+}
+
+// ParseVersion extracts the version from the output of a tool, the first word of the first line that starts with a digit,
+// such as 3.20160805.1 from "xdotool version 3.20160805.1" or 6.9.11-60 from "Version: ImageMagick 6.9.11-60 Q16 x86_64".
+//
+// Parameters:
+//   - output: The output of the tool.
+//
+// Returns:
+//   - string: The version, empty if none was found on the first line.
+func ParseVersion(output string) string {
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	for _, field := range strings.Fields(firstLine) {
+		if field[0] >= '0' && field[0] <= '9' {
+			return strings.TrimRight(field, ",;")
+		}
+	}
+	return ""
+}
+
+// RequireTool checks that an external tool is installed before it is used.
+//
+// Parameters:
+//   - tool: The name of the tool, one of the tools reported by CheckDependencies.
+//   - lookPath: Resolves the path of a command, exec.LookPath outside of tests.
+//
+// Returns:
+//   - error: tools.ErrMissingDependency wrapped with the tool and the packages that provide it if the tool is not installed, nil otherwise.
+func RequireTool(tool string, lookPath func(string) (string, error)) error {
+	if _, err := lookPath(tool); err == nil {
+		return nil
+	}
+	for _, dep := range dependencies {
+		if dep.tool == tool {
+			return fmt.Errorf("%s not found, install the %s package with apt or %s with dnf: %w", tool, dep.aptPackage, dep.dnfPackage, tools.ErrMissingDependency)
+		}
+	}
+	return fmt.Errorf("%s not found: %w", tool, tools.ErrMissingDependency)
+}
@@ -0,0 +1,124 @@
+//go:build linux
+// +build linux
+
+package x11
+
+import (
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Carmen-Shannon/automation/tools"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{name: "xdotool", output: "xdotool version 3.20160805.1\n", want: "3.20160805.1"},
+		{name: "xrandr", output: "xrandr program version       1.5.1\nServer reports RandR version 1.6\n", want: "1.5.1"},
+		{name: "imagemagick", output: "Version: ImageMagick 6.9.11-60 Q16 x86_64 2021-01-25 https://imagemagick.org\nCopyright: (C) 1999-2021 ImageMagick Studio LLC\n", want: "6.9.11-60"},
+		{name: "trailing punctuation", output: "tool 2.1, built 2020\n", want: "2.1"},
+		{name: "leading blank lines", output: "\n\n  xwd 1.0.8\n", want: "1.0.8"},
+		{name: "version on a later line", output: "usage: xwd [-options ...]\nversion 1.0.8\n", want: ""},
+		{name: "no version", output: "xwd: unknown option -version\n", want: ""},
+		{name: "empty", output: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := ParseVersion(tt.output); got != tt.want {
+			t.Errorf("%s: ParseVersion(%q) = %q, want %q", tt.name, tt.output, got, tt.want)
+		}
+	}
+}
+
+// fakeTools is an installation of some of the tools, with the output each prints for its version argument.
+type fakeTools struct {
+	installed map[string]string // the path of each installed tool
+	outputs   map[string]string // the output of each tool, by path
+	failing   map[string]bool   // the tools that exit with an error after printing their output, by path
+	ran       []string
+}
+
+func (f *fakeTools) lookPath(tool string) (string, error) {
+	if path, ok := f.installed[tool]; ok {
+		return path, nil
+	}
+	return "", &exec.Error{Name: tool, Err: exec.ErrNotFound}
+}
+
+func (f *fakeTools) combinedOutput(name string, args ...string) ([]byte, error) {
+	f.ran = append(f.ran, strings.Join(append([]string{name}, args...), " "))
+	if f.failing[name] {
+		return []byte(f.outputs[name]), errors.New("exit status 1")
+	}
+	return []byte(f.outputs[name]), nil
+}
+
+func TestCheckDependencies(t *testing.T) {
+	f := &fakeTools{
+		installed: map[string]string{"xdotool": "/usr/bin/xdotool", "import": "/usr/local/bin/import", "xwd": "/usr/bin/xwd"},
+		outputs: map[string]string{
+			"/usr/bin/xdotool":      "xdotool version 3.20160805.1\n",
+			"/usr/local/bin/import": "Version: ImageMagick 7.1.1-21 Q16-HDRI x86_64\n",
+			"/usr/bin/xwd":          "xwd: unknown option -version\n",
+		},
+		failing: map[string]bool{"/usr/bin/xwd": true, "/usr/local/bin/import": true},
+	}
+
+	got := CheckDependencies(f.lookPath, f.combinedOutput)
+	want := []DependencyStatus{
+		{Tool: "xdotool", AptPackage: "xdotool", DnfPackage: "xdotool", Found: true, Path: "/usr/bin/xdotool", Version: "3.20160805.1"},
+		{Tool: "xrandr", AptPackage: "x11-xserver-utils", DnfPackage: "xrandr"},
+		// the version is read even though the tool exited with an error
+		{Tool: "import", AptPackage: "imagemagick", DnfPackage: "ImageMagick", Found: true, Path: "/usr/local/bin/import", Version: "7.1.1-21"},
+		{Tool: "xwd", AptPackage: "x11-apps", DnfPackage: "xwd", Found: true, Path: "/usr/bin/xwd"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("CheckDependencies() = %+v, want %+v", got, want)
+	}
+	wantRan := []string{"/usr/bin/xdotool --version", "/usr/local/bin/import -version", "/usr/bin/xwd -version"}
+	if !slices.Equal(f.ran, wantRan) {
+		t.Errorf("commands run = %q, want %q, only installed tools may be run, by their resolved path", f.ran, wantRan)
+	}
+}
+
+func TestCheckDependenciesNothingInstalled(t *testing.T) {
+	f := &fakeTools{}
+	for _, status := range CheckDependencies(f.lookPath, f.combinedOutput) {
+		if status.Found || status.Path != "" || status.Version != "" {
+			t.Errorf("status of %s = %+v, want it not found", status.Tool, status)
+		}
+		if status.AptPackage == "" || status.DnfPackage == "" {
+			t.Errorf("status of %s = %+v, want the packages that provide it", status.Tool, status)
+		}
+	}
+	if len(f.ran) != 0 {
+		t.Errorf("commands run = %q, want none", f.ran)
+	}
+}
+
+func TestRequireTool(t *testing.T) {
+	f := &fakeTools{installed: map[string]string{"xdotool": "/usr/bin/xdotool"}}
+
+	if err := RequireTool("xdotool", f.lookPath); err != nil {
+		t.Errorf("RequireTool(xdotool) error = %v, want nil for an installed tool", err)
+	}
+
+	err := RequireTool("import", f.lookPath)
+	if !errors.Is(err, tools.ErrMissingDependency) {
+		t.Fatalf("RequireTool(import) error = %v, want %v", err, tools.ErrMissingDependency)
+	}
+	for _, pkg := range []string{"imagemagick", "ImageMagick"} {
+		if !strings.Contains(err.Error(), pkg) {
+			t.Errorf("RequireTool(import) error = %q, want it to name the %s package", err, pkg)
+		}
+	}
+
+	if err := RequireTool("xclip", f.lookPath); !errors.Is(err, tools.ErrMissingDependency) {
+		t.Errorf("RequireTool(xclip) error = %v, want %v for a tool that is not a known dependency", err, tools.ErrMissingDependency)
+	}
+}
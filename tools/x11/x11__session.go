@@ -0,0 +1,52 @@
+//go:build linux
+// +build linux
+
+package x11
+
+import "strings"
+
+// IsWaylandSession detects whether the session is a Wayland session.
+// XDG_SESSION_TYPE is trusted when it names a graphical session, otherwise a set WAYLAND_DISPLAY means Wayland and a set DISPLAY means X11,
+// and without any of them, such as in a service, the type of the login session is asked from loginctl.
+//
+// Parameters:
+//   - getenv: Looks up an environment variable, os.Getenv outside of tests.
+//   - sessionType: Returns the type of the login session as reported by loginctl, empty if it is not known.
+//
+// Returns:
+//   - bool: True if the session is a Wayland session, false otherwise.
+func IsWaylandSession(getenv func(string) string, sessionType func() string) bool {
+	switch strings.ToLower(getenv("XDG_SESSION_TYPE")) {
+	case "wayland":
+		return true
+	case "x11":
+		return false
+	}
+	if getenv("WAYLAND_DISPLAY") != "" {
+		return true
+	}
+	if getenv("DISPLAY") != "" {
+		return false
+	}
+	return strings.ToLower(sessionType()) == "wayland"
+}
+
+// LoginctlSessionType asks loginctl for the type of the login session, from XDG_SESSION_ID or the session of the process.
+//
+// Parameters:
+//   - getenv: Looks up an environment variable, os.Getenv outside of tests.
+//   - output: Runs a command and returns its standard output.
+//
+// Returns:
+//   - string: The type of the session, such as x11, wayland or tty, empty if loginctl is not available or does not know the session.
+func LoginctlSessionType(getenv func(string) string, output func(name string, args ...string) ([]byte, error)) string {
+	session := getenv("XDG_SESSION_ID")
+	if session == "" {
+		session = "self"
+	}
+	out, err := output("loginctl", "show-session", session, "-p", "Type", "--value")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
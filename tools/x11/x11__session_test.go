@@ -0,0 +1,85 @@
+//go:build linux
+// +build linux
+
+package x11
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// env returns a getenv function over a fixed environment.
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestIsWaylandSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		loginctl  string
+		want      bool
+		wantAsked bool // whether loginctl has to be asked
+	}{
+		{name: "wayland session type", env: map[string]string{"XDG_SESSION_TYPE": "wayland"}, want: true},
+		{name: "wayland session type in upper case", env: map[string]string{"XDG_SESSION_TYPE": "Wayland"}, want: true},
+		{name: "x11 session type", env: map[string]string{"XDG_SESSION_TYPE": "x11"}, want: false},
+		{name: "x11 session type wins over wayland display", env: map[string]string{"XDG_SESSION_TYPE": "x11", "WAYLAND_DISPLAY": "wayland-0"}, want: false},
+		{name: "wayland session type wins over display", env: map[string]string{"XDG_SESSION_TYPE": "wayland", "DISPLAY": ":0"}, want: true},
+		// XWayland sets DISPLAY in a Wayland session as well
+		{name: "xwayland", env: map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"}, want: true},
+		{name: "tty session type with wayland display", env: map[string]string{"XDG_SESSION_TYPE": "tty", "WAYLAND_DISPLAY": "wayland-0"}, want: true},
+		{name: "tty session type with display", env: map[string]string{"XDG_SESSION_TYPE": "tty", "DISPLAY": ":1"}, want: false},
+		{name: "display only", env: map[string]string{"DISPLAY": ":0"}, want: false},
+		{name: "wayland display only", env: map[string]string{"WAYLAND_DISPLAY": "wayland-1"}, want: true},
+		{name: "service in a wayland login session", env: map[string]string{}, loginctl: "wayland", want: true, wantAsked: true},
+		{name: "service in a wayland login session in upper case", env: map[string]string{}, loginctl: "WAYLAND", want: true, wantAsked: true},
+		{name: "service in an x11 login session", env: map[string]string{}, loginctl: "x11", want: false, wantAsked: true},
+		{name: "service without a login session", env: map[string]string{}, loginctl: "", want: false, wantAsked: true},
+		{name: "unspecified session type", env: map[string]string{"XDG_SESSION_TYPE": "unspecified"}, loginctl: "wayland", want: true, wantAsked: true},
+	}
+	for _, tt := range tests {
+		var asked bool
+		sessionType := func() string {
+			asked = true
+			return tt.loginctl
+		}
+		if got := IsWaylandSession(env(tt.env), sessionType); got != tt.want {
+			t.Errorf("%s: IsWaylandSession(%v) = %v, want %v", tt.name, tt.env, got, tt.want)
+		}
+		if asked != tt.wantAsked {
+			t.Errorf("%s: loginctl asked = %v, want %v", tt.name, asked, tt.wantAsked)
+		}
+	}
+}
+
+func TestLoginctlSessionType(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		out      string
+		err      error
+		wantArgs []string
+		want     string
+	}{
+		{name: "own session", env: map[string]string{}, out: "wayland\n", wantArgs: []string{"show-session", "self", "-p", "Type", "--value"}, want: "wayland"},
+		{name: "session id", env: map[string]string{"XDG_SESSION_ID": "c2"}, out: "x11\n", wantArgs: []string{"show-session", "c2", "-p", "Type", "--value"}, want: "x11"},
+		{name: "loginctl missing", env: map[string]string{}, err: errors.New(`exec: "loginctl": executable file not found in $PATH`), wantArgs: []string{"show-session", "self", "-p", "Type", "--value"}, want: ""},
+		{name: "unknown session", env: map[string]string{"XDG_SESSION_ID": "99"}, out: "", err: errors.New("exit status 1"), wantArgs: []string{"show-session", "99", "-p", "Type", "--value"}, want: ""},
+	}
+	for _, tt := range tests {
+		var gotName string
+		var gotArgs []string
+		output := func(name string, args ...string) ([]byte, error) {
+			gotName, gotArgs = name, args
+			return []byte(tt.out), tt.err
+		}
+		if got := LoginctlSessionType(env(tt.env), output); got != tt.want {
+			t.Errorf("%s: LoginctlSessionType() = %q, want %q", tt.name, got, tt.want)
+		}
+		if gotName != "loginctl" || !slices.Equal(gotArgs, tt.wantArgs) {
+			t.Errorf("%s: ran %s %q, want loginctl %q", tt.name, gotName, gotArgs, tt.wantArgs)
+		}
+	}
+}
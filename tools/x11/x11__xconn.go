@@ -0,0 +1,116 @@
+//go:build linux
+// +build linux
+
+package x11
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// ErrConnectionLost is reported when a request is made on an X connection that xgb has already shut down, such as after the X server restarted.
+var ErrConnectionLost = errors.New("the connection to the X server was lost")
+
+// Conn is a connection to the X server, an *xgb.Conn outside of tests.
+type Conn interface {
+	// Close closes the connection.
+	Close()
+}
+
+// ConnManager shares a single X connection between every caller in the process.
+// The connection is opened on first use, requests are serialized by its lock, and it is replaced by a new connection once it is lost.
+type ConnManager struct {
+	mu    sync.Mutex
+	dial  func() (Conn, error)
+	setup func(conn Conn) error
+
+	conn     Conn  // the current connection, nil before the first use, after Close, or once it was lost
+	setupErr error // the error of setup on conn, such as when an extension is not available
+}
+
+// NewConnManager creates a ConnManager, which does not connect until it is first used.
+//
+// Parameters:
+//   - dial: Opens a new connection.
+//   - setup: Prepares a new connection, such as by initializing the extensions it uses. Its error is handed to every caller of the connection rather than failing it.
+//
+// Returns:
+//   - *ConnManager: The connection manager.
+func NewConnManager(dial func() (Conn, error), setup func(conn Conn) error) *ConnManager {
+	return &ConnManager{dial: dial, setup: setup}
+}
+
+// Do runs fn with the connection, opening it if needed, and retries it once on a new connection if the connection was lost.
+// The connection is locked while fn runs, so the requests of concurrent callers are never interleaved, and fn must not call Do itself.
+//
+// Parameters:
+//   - fn: The function making the requests, given the connection and the error of setup on it.
+//
+// Returns:
+//   - error: An error if the X server can not be reached, otherwise the error returned by fn.
+func (m *ConnManager) Do(fn func(conn Conn, setupErr error) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if m.conn == nil {
+			conn, err := m.dial()
+			if err != nil {
+				return fmt.Errorf("failed to connect to the X server: %w", err)
+			}
+			m.conn = conn
+			m.setupErr = m.setup(conn)
+		}
+
+		err := m.call(fn)
+		if !errors.Is(err, ErrConnectionLost) || attempt > 0 {
+			return err
+		}
+		// the X server may have restarted, retry on a new connection
+		m.closeConn()
+	}
+}
+
+// call runs fn with the current connection, turning the panic of xgb on a connection it has already shut down into ErrConnectionLost.
+//
+// Parameters:
+//   - fn: The function making the requests.
+//
+// Returns:
+//   - error: ErrConnectionLost if the connection was shut down, otherwise the error returned by fn.
+func (m *ConnManager) call(fn func(conn Conn, setupErr error) error) (err error) {
+	// xgb closes its request channel once the connection fails, so the next request panics sending on it
+	defer func() {
+		if r := recover(); r != nil {
+			if rErr, ok := r.(runtime.Error); !ok || !strings.Contains(rErr.Error(), "closed channel") {
+				panic(r)
+			}
+			err = fmt.Errorf("%w: %v", ErrConnectionLost, r)
+		}
+	}()
+	return fn(m.conn, m.setupErr)
+}
+
+// Close closes the connection, if it is open. The next call to Do opens a new connection.
+func (m *ConnManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closeConn()
+}
+
+// closeConn closes the connection without locking, the caller must hold the lock.
+func (m *ConnManager) closeConn() {
+	if m.conn == nil {
+		return
+	}
+	// closing a connection xgb already shut down panics the same way sending a request on it does
+	func() {
+		defer func() { _ = recover() }()
+		m.conn.Close()
+	}()
+	m.conn = nil
+	m.setupErr = nil
+}
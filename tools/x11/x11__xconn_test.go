@@ -0,0 +1,293 @@
+//go:build linux
+// +build linux
+
+package x11
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// fakeConn is a connection of a fakeServer.
+type fakeConn struct {
+	id     int
+	lost   bool // the connection was shut down, like xgb does when the X server goes away
+	closed int
+}
+
+// Close panics on a lost connection, like xgb does.
+func (c *fakeConn) Close() {
+	if c.lost {
+		closedChannel()
+	}
+	c.closed++
+}
+
+// closedChannel sends on a closed channel, which is how a request on a connection xgb already shut down fails.
+func closedChannel() {
+	ch := make(chan struct{})
+	close(ch)
+	ch <- struct{}{}
+}
+
+// fakeServer dials fakeConns, failing while it is down.
+type fakeServer struct {
+	down     bool
+	setupErr error
+	conns    []*fakeConn
+	setups   int
+}
+
+var errServerDown = errors.New("connection refused")
+
+func (s *fakeServer) manager() *ConnManager {
+	return NewConnManager(
+		func() (Conn, error) {
+			if s.down {
+				return nil, errServerDown
+			}
+			conn := &fakeConn{id: len(s.conns) + 1}
+			s.conns = append(s.conns, conn)
+			return conn, nil
+		},
+		func(Conn) error {
+			s.setups++
+			return s.setupErr
+		},
+	)
+}
+
+// request makes a request on a fakeConn, failing the way xgb does if the connection was lost.
+func request(conn Conn) int {
+	c := conn.(*fakeConn)
+	if c.lost {
+		closedChannel()
+	}
+	return c.id
+}
+
+func TestConnManagerConnectsLazily(t *testing.T) {
+	s := &fakeServer{}
+	m := s.manager()
+	if len(s.conns) != 0 {
+		t.Fatalf("%d connections dialed before the first use, want none", len(s.conns))
+	}
+
+	for i := range 3 {
+		if err := m.Do(func(conn Conn, setupErr error) error {
+			if id := request(conn); id != 1 {
+				t.Errorf("call %d used connection %d, want 1", i, id)
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+	}
+	if len(s.conns) != 1 || s.setups != 1 {
+		t.Errorf("dialed %d connections and set up %d, want 1 of each shared by every call", len(s.conns), s.setups)
+	}
+}
+
+func TestConnManagerPassesSetupError(t *testing.T) {
+	errNoXTest := errors.New("XTEST extension not available")
+	s := &fakeServer{setupErr: errNoXTest}
+	m := s.manager()
+	var got error
+	if err := m.Do(func(_ Conn, setupErr error) error {
+		got = setupErr
+		return nil
+	}); err != nil {
+		t.Fatalf("Do() error = %v, a setup error must not fail the call", err)
+	}
+	if !errors.Is(got, errNoXTest) {
+		t.Errorf("setup error = %v, want %v", got, errNoXTest)
+	}
+}
+
+func TestConnManagerReturnsErrorOfFn(t *testing.T) {
+	s := &fakeServer{}
+	m := s.manager()
+	errRequest := errors.New("BadWindow")
+	var calls int
+	err := m.Do(func(Conn, error) error {
+		calls++
+		return errRequest
+	})
+	if !errors.Is(err, errRequest) {
+		t.Errorf("Do() error = %v, want %v", err, errRequest)
+	}
+	if calls != 1 || len(s.conns) != 1 {
+		t.Errorf("fn called %d times on %d connections, a failed request must not be retried", calls, len(s.conns))
+	}
+}
+
+func TestConnManagerDialError(t *testing.T) {
+	s := &fakeServer{down: true}
+	m := s.manager()
+	var calls int
+	fn := func(Conn, error) error {
+		calls++
+		return nil
+	}
+	if err := m.Do(fn); !errors.Is(err, errServerDown) {
+		t.Fatalf("Do() error = %v, want %v", err, errServerDown)
+	}
+	if calls != 0 || s.setups != 0 {
+		t.Errorf("fn called %d times and setup %d times without a connection, want neither", calls, s.setups)
+	}
+
+	// the failed dial is not remembered, the next call connects once the server is up
+	s.down = false
+	if err := m.Do(fn); err != nil {
+		t.Fatalf("Do() error = %v after the server came up", err)
+	}
+	if calls != 1 || len(s.conns) != 1 {
+		t.Errorf("fn called %d times on %d connections, want 1 on 1", calls, len(s.conns))
+	}
+}
+
+func TestConnManagerReconnectsOnce(t *testing.T) {
+	s := &fakeServer{}
+	m := s.manager()
+	if err := m.Do(func(conn Conn, _ error) error { request(conn); return nil }); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	// the X server restarted
+	s.conns[0].lost = true
+	var used []int
+	err := m.Do(func(conn Conn, _ error) error {
+		used = append(used, conn.(*fakeConn).id)
+		request(conn)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do() error = %v, want the call retried on a new connection", err)
+	}
+	if len(used) != 2 || used[0] != 1 || used[1] != 2 {
+		t.Errorf("connections used = %v, want [1 2]", used)
+	}
+	if s.setups != 2 {
+		t.Errorf("setup called %d times, want once per connection", s.setups)
+	}
+
+	// the new connection is kept
+	if err := m.Do(func(conn Conn, _ error) error {
+		if id := request(conn); id != 2 {
+			t.Errorf("call after the reconnect used connection %d, want 2", id)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if len(s.conns) != 2 {
+		t.Errorf("dialed %d connections, want 2", len(s.conns))
+	}
+}
+
+func TestConnManagerGivesUpAfterOneReconnect(t *testing.T) {
+	s := &fakeServer{}
+	m := s.manager()
+	var calls int
+	err := m.Do(func(conn Conn, _ error) error {
+		calls++
+		conn.(*fakeConn).lost = true
+		request(conn)
+		return nil
+	})
+	if !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("Do() error = %v, want %v", err, ErrConnectionLost)
+	}
+	if calls != 2 || len(s.conns) != 2 {
+		t.Errorf("fn called %d times on %d connections, want 2 on 2", calls, len(s.conns))
+	}
+
+	// the next call replaces the lost connection, even though closing it panics
+	if err := m.Do(func(conn Conn, _ error) error { request(conn); return nil }); err != nil {
+		t.Fatalf("Do() error = %v after giving up", err)
+	}
+	if len(s.conns) != 3 {
+		t.Errorf("dialed %d connections, want a new one after giving up", len(s.conns))
+	}
+}
+
+func TestConnManagerRepanicsOtherPanics(t *testing.T) {
+	s := &fakeServer{}
+	m := s.manager()
+	defer func() {
+		if r := recover(); r != "unrelated" {
+			t.Errorf("recovered %v, want the panic of fn to be propagated", r)
+		}
+		// the lock is released on the way out
+		if err := m.Do(func(Conn, error) error { return nil }); err != nil {
+			t.Errorf("Do() error = %v after a panic", err)
+		}
+	}()
+	_ = m.Do(func(Conn, error) error { panic("unrelated") })
+}
+
+func TestConnManagerClose(t *testing.T) {
+	s := &fakeServer{}
+	m := s.manager()
+	m.Close() // closing before the first use does nothing
+
+	if err := m.Do(func(Conn, error) error { return nil }); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	m.Close()
+	m.Close()
+	if s.conns[0].closed != 1 {
+		t.Errorf("connection closed %d times, want 1", s.conns[0].closed)
+	}
+
+	if err := m.Do(func(conn Conn, _ error) error {
+		if id := request(conn); id != 2 {
+			t.Errorf("call after Close used connection %d, want a new one", id)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	// closing a lost connection panics in xgb, which Close absorbs
+	s.conns[1].lost = true
+	m.Close()
+}
+
+func TestConnManagerSerializesConcurrentCalls(t *testing.T) {
+	s := &fakeServer{}
+	m := s.manager()
+	var (
+		inFlight, maxInFlight, total int // only touched under the lock of the manager, the race detector reports it otherwise
+		wg                           sync.WaitGroup
+	)
+	for range 32 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				if err := m.Do(func(conn Conn, _ error) error {
+					inFlight++
+					maxInFlight = max(maxInFlight, inFlight)
+					request(conn)
+					total++
+					inFlight--
+					return nil
+				}); err != nil {
+					t.Errorf("Do() error = %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if maxInFlight != 1 {
+		t.Errorf("%d calls ran at the same time, want 1", maxInFlight)
+	}
+	if total != 32*50 {
+		t.Errorf("%d calls ran, want %d", total, 32*50)
+	}
+	if len(s.conns) != 1 {
+		t.Errorf("dialed %d connections, want 1 shared by every goroutine", len(s.conns))
+	}
+}